@@ -15,11 +15,23 @@ import (
 func main() {
 	address := flag.String("address", "127.0.0.1:3223", "server address (required), e.g. 127.0.0.1:3223")
 	idleTimeout := flag.Duration("timeout", 0, "timeout for server connection, e.g. 5s, 1m")
+	useTLS := flag.Bool("tls", false, "connect over TLS")
+	caFile := flag.String("tls-ca", "", "CA certificate to verify the server, system CAs by default")
+	certFile := flag.String("tls-cert", "", "client certificate for mutual TLS")
+	keyFile := flag.String("tls-key", "", "client certificate key for mutual TLS")
+	serverName := flag.String("tls-server-name", "", "expected server certificate name, host from -address by default")
 	flag.Parse()
 
 	clientNetworkConfig := config.ClientNetworkConfig{
 		Address:     *address,
 		IdleTimeout: *idleTimeout,
+		TLS: config.TLSConfig{
+			Enabled:    *useTLS,
+			CertFile:   *certFile,
+			KeyFile:    *keyFile,
+			CAFile:     *caFile,
+			ServerName: *serverName,
+		},
 	}
 
 	logger, _ := zap.NewProduction()
@@ -57,5 +69,19 @@ func main() {
 		}
 
 		fmt.Println(response)
+
+		// после подписки сервер сам присылает сообщения каналов, их печатаем до закрытия соединения
+		command := strings.ToUpper(strings.SplitN(trimmedInput, " ", 2)[0])
+		if err == nil && (command == "SUBSCRIBE" || command == "PSUBSCRIBE") {
+			for {
+				message, err := client.Receive()
+				if err != nil {
+					logger.Fatal("client connection closed", zap.Error(err))
+					return
+				}
+
+				fmt.Print(message)
+			}
+		}
 	}
 }
@@ -2,17 +2,37 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"github.com/TimonKK/inmemory-db/internal/config"
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+	"github.com/TimonKK/inmemory-db/internal/database/dataset"
+	"github.com/TimonKK/inmemory-db/internal/database/storage"
+	"github.com/TimonKK/inmemory-db/internal/database/storage/wal"
 	"github.com/TimonKK/inmemory-db/internal/logger"
 	"github.com/TimonKK/inmemory-db/internal/server"
 	"go.uber.org/zap"
+	"io"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
+)
+
+var (
+	recoverFrom    = flag.String("recover-from", "", "restore the WAL from archived segments in this directory before start")
+	recoverWALDir  = flag.String("recover-wal", "", "WAL directory moved aside before recovery, its segments are replayed after the archived ones")
+	recoverBase    = flag.String("recover-base", "", "shutdown snapshot to start recovery from instead of an empty database")
+	recoverBaseSeq = flag.Uint64("recover-base-seq", 0, "last WAL record contained in -recover-base, logged when the snapshot is written")
+	recoverToSeq   = flag.Uint64("recover-to-seq", 0, "last WAL record to restore, 0 - no limit")
+	recoverToTime  = flag.String("recover-to-time", "", "restore WAL records up to this time (RFC3339)")
 )
 
 func main() {
+	flag.Parse()
+
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
@@ -29,6 +49,12 @@ func main() {
 
 	l.Info("Loading config", zap.Any("config", cfg))
 
+	if *recoverFrom != "" || *recoverWALDir != "" || *recoverBase != "" {
+		if err := recoverWAL(cfg, l); err != nil {
+			l.Fatal("Failed to recover WAL", zap.Error(err))
+		}
+	}
+
 	srv, err := server.NewServer(cfg, l)
 	if err != nil {
 		l.Fatal("failed to initialize server: %v", zap.Error(err))
@@ -39,8 +65,103 @@ func main() {
 	}
 
 	<-ctx.Done()
+	// обработка сигналов возвращается по умолчанию: повторный сигнал завершает процесс сразу
+	cancel()
 
 	if err := srv.Shutdown(); err != nil {
 		l.Fatal("Failed to shutdown server", zap.Error(err))
 	}
+
+	l.Info("Server stopped")
+	_ = l.Sync()
+}
+
+// recoverWAL - восстановление на момент времени: WAL собирается из базовой выгрузки и записей архива
+// и отложенного каталога WAL до цели, затем сервер стартует как обычно и повторяет его с пустого состояния
+func recoverWAL(cfg *config.Config, l *zap.Logger) error {
+	opts := wal.RecoveryOptions{BaseSeq: *recoverBaseSeq}
+	for _, dir := range []string{*recoverFrom, *recoverWALDir} {
+		if dir != "" {
+			opts.Sources = append(opts.Sources, dir)
+		}
+	}
+
+	if *recoverBase != "" {
+		base, err := baseRecords(*recoverBase)
+		if err != nil {
+			return fmt.Errorf("recover-base: %w", err)
+		}
+
+		opts.Base = base
+	}
+
+	target := wal.RecoveryTarget{Seq: *recoverToSeq}
+	if *recoverToTime != "" {
+		t, err := time.Parse(time.RFC3339, *recoverToTime)
+		if err != nil {
+			return fmt.Errorf("recover-to-time: %w", err)
+		}
+
+		target.Timestamp = t.UnixMilli()
+	}
+
+	// данные движков на диске новее цели восстановления, повтор WAL поверх них ее не вернет
+	var dataDirectory string
+	switch cfg.Engine.Type {
+	case "lsm":
+		dataDirectory = cfg.Engine.LSM.DataDirectory
+	case "bitcask":
+		dataDirectory = cfg.Engine.Bitcask.DataDirectory
+	}
+
+	if dataDirectory != "" {
+		entries, err := os.ReadDir(dataDirectory)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if len(entries) > 0 {
+			return fmt.Errorf("engine data directory %s must be empty for recovery", dataDirectory)
+		}
+	}
+
+	opts.Target = target
+
+	_, err := wal.Recover(&cfg.Wal, opts, l)
+	return err
+}
+
+// baseRecords - записи WAL, которые воссоздают ключи выгрузки. Выгрузка должна быть снимком на один момент,
+// как при остановке сервера: EXPORT во время записи к номеру записи WAL не привязан
+func baseRecords(file string) ([]compute.Query, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	reader := dataset.NewReader(f, dataset.FormatOf(file))
+
+	var records []compute.Query
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		entry, err := record.Decode()
+		if err != nil {
+			return nil, err
+		}
+
+		// истекшие ключи отбросит повтор: записи выгрузки повторяются во время ее последней записи WAL
+		queries, err := storage.ImportRecords(entry.Key, entry.Entry, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, queries...)
+	}
 }
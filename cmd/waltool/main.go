@@ -0,0 +1,280 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/TimonKK/inmemory-db/internal/database/storage/wal"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const usage = `usage: waltool <command> [flags]
+
+commands:
+  dump      print records with their segment and offset, as text or JSON
+  verify    check checksums, segment numbering, timestamp order and torn tails
+  stats     per-command counts and key cardinality
+  truncate  keep only the first -keep records
+  repair    cut the WAL at the last valid record
+
+Run "waltool <command> -h" for command flags. The server must be stopped while truncate or repair run.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	commands := map[string]func(args []string) error{
+		"dump":     dump,
+		"verify":   verify,
+		"stats":    stats,
+		"truncate": truncate,
+		"repair":   repair,
+	}
+
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err := command(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "waltool:", err)
+		os.Exit(1)
+	}
+}
+
+// newFlagSet - флаги подкоманды, у всех есть -dir
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	dir := fs.String("dir", "wal", "wal data directory")
+
+	return fs, dir
+}
+
+// dumpEntry - запись в выводе dump -format json
+type dumpEntry struct {
+	Segment   int      `json:"segment"`
+	Offset    int64    `json:"offset"`
+	Seq       uint64   `json:"seq"`
+	Timestamp int64    `json:"timestamp,omitempty"`
+	Command   string   `json:"command,omitempty"`
+	Args      []string `json:"args,omitempty"`
+	Checksum  bool     `json:"checksum"`
+	Error     string   `json:"error,omitempty"`
+	Raw       string   `json:"raw,omitempty"`
+}
+
+func dump(args []string) error {
+	fs, dir := newFlagSet("dump")
+	format := fs.String("format", "text", "output format: text or json")
+	_ = fs.Parse(args)
+
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+
+	return wal.Scan(*dir, func(entry wal.Entry) error {
+		if *format == "json" {
+			out := dumpEntry{Segment: entry.Segment, Offset: entry.Offset, Seq: entry.Seq, Checksum: entry.Checksum}
+			if entry.Err != nil {
+				out.Error, out.Raw = entry.Err.Error(), entry.Data
+			} else {
+				out.Timestamp = entry.Record.Timestamp
+				out.Command, out.Args = string(entry.Record.Query.CommandId()), entry.Record.Query.Args()
+			}
+
+			return encoder.Encode(out)
+		}
+
+		if entry.Err != nil {
+			_, err := fmt.Printf("%d:%d #%d ERROR %v\n", entry.Segment, entry.Offset, entry.Seq, entry.Err)
+			return err
+		}
+
+		_, err := fmt.Printf("%d:%d #%d %s %s %s\n", entry.Segment, entry.Offset, entry.Seq, formatTimestamp(entry.Record.Timestamp),
+			entry.Record.Query.CommandId(), strings.Join(entry.Record.Query.Args(), " "))
+		return err
+	})
+}
+
+func verify(args []string) error {
+	fs, dir := newFlagSet("verify")
+	_ = fs.Parse(args)
+
+	segments, err := wal.ListSegments(*dir)
+	if err != nil {
+		return err
+	}
+
+	problems := 0
+	report := func(format string, args ...any) {
+		problems++
+		fmt.Printf(format+"\n", args...)
+	}
+
+	for i, segment := range segments {
+		if segment.Num != i {
+			report("segment %d is missing", i)
+			break
+		}
+	}
+
+	var records, unchecked uint64
+	var lastTimestamp int64
+	err = wal.Scan(*dir, func(entry wal.Entry) error {
+		records++
+
+		switch {
+		case errors.Is(entry.Err, wal.ErrTornRecord):
+			report("%d:%d #%d torn record, run repair to cut it", entry.Segment, entry.Offset, entry.Seq)
+		case entry.Err != nil:
+			report("%d:%d #%d %v", entry.Segment, entry.Offset, entry.Seq, entry.Err)
+		default:
+			if !entry.Checksum {
+				unchecked++
+			}
+
+			timestamp := entry.Record.Timestamp
+			if timestamp != 0 && timestamp < lastTimestamp {
+				report("%d:%d #%d timestamp %s is before the previous record %s", entry.Segment, entry.Offset, entry.Seq,
+					formatTimestamp(timestamp), formatTimestamp(lastTimestamp))
+			}
+			lastTimestamp = max(lastTimestamp, timestamp)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("segments: %d, records: %d, without checksum: %d, problems: %d\n", len(segments), records, unchecked, problems)
+	if problems > 0 {
+		return fmt.Errorf("problems found: %d", problems)
+	}
+
+	return nil
+}
+
+func stats(args []string) error {
+	fs, dir := newFlagSet("stats")
+	_ = fs.Parse(args)
+
+	segments, err := wal.ListSegments(*dir)
+	if err != nil {
+		return err
+	}
+
+	var records, damaged, bytes uint64
+	var first, last int64
+	commands := make(map[string]int)
+	keys := make(map[string]struct{})
+
+	err = wal.Scan(*dir, func(entry wal.Entry) error {
+		bytes += uint64(entry.Size)
+		if entry.Err != nil {
+			damaged++
+			return nil
+		}
+
+		records++
+		commands[string(entry.Record.Query.CommandId())]++
+		for _, key := range entry.Record.Query.Keys() {
+			keys[key] = struct{}{}
+		}
+
+		if timestamp := entry.Record.Timestamp; timestamp != 0 {
+			if first == 0 {
+				first = timestamp
+			}
+			last = timestamp
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("segments: %d\nbytes: %d\nrecords: %d\ndamaged: %d\nkeys: %d\nfirst: %s\nlast: %s\n",
+		len(segments), bytes, records, damaged, len(keys), formatTimestamp(first), formatTimestamp(last))
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		return cmp.Or(cmp.Compare(commands[b], commands[a]), cmp.Compare(a, b))
+	})
+
+	fmt.Println("commands:")
+	for _, name := range names {
+		fmt.Printf("  %-16s %d\n", name, commands[name])
+	}
+
+	return nil
+}
+
+func truncate(args []string) error {
+	fs, dir := newFlagSet("truncate")
+	keep := fs.Int64("keep", -1, "number of records to keep (required)")
+	_ = fs.Parse(args)
+
+	if *keep < 0 {
+		return errors.New("-keep is required")
+	}
+
+	result, err := wal.Truncate(*dir, uint64(*keep))
+	if err != nil {
+		return err
+	}
+
+	printTruncateResult(result)
+
+	return nil
+}
+
+func repair(args []string) error {
+	fs, dir := newFlagSet("repair")
+	_ = fs.Parse(args)
+
+	result, err := wal.Repair(*dir)
+	if err != nil {
+		return err
+	}
+
+	printTruncateResult(result)
+
+	return nil
+}
+
+func printTruncateResult(result wal.TruncateResult) {
+	if !result.Cut {
+		fmt.Printf("nothing to cut, records: %d\n", result.Records)
+		return
+	}
+
+	fmt.Printf("cut segment %d at offset %d, records kept: %d\n", result.Segment, result.Offset, result.Records)
+	for _, path := range result.Orphaned {
+		fmt.Printf("moved aside: %s\n", path)
+	}
+}
+
+// formatTimestamp - время записи, "-" для записей без времени
+func formatTimestamp(ms int64) string {
+	if ms == 0 {
+		return "-"
+	}
+
+	return time.UnixMilli(ms).UTC().Format(time.RFC3339Nano)
+}
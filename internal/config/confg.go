@@ -6,6 +6,8 @@ import (
 	"github.com/TimonKK/inmemory-db/internal/utils"
 	"net"
 	"os"
+	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -19,11 +21,38 @@ var (
 	ErrInvalidAddressFormat = errors.New("network address must valid host:port")
 	ErrInvalidParamRange    = errors.New("must be in range")
 	ErrEmptyFilePath        = errors.New("file path cannot be empty")
+	ErrArchiveDirectory     = errors.New("wal archive directory must differ from data directory")
+	ErrTLSConfig            = errors.New("invalid tls config")
+	ErrShutdownSnapshot     = errors.New("shutdown snapshot requires export directory and a relative file path")
 )
 
 // EngineConfig - настройки движка
 type EngineConfig struct {
-	Type string `yaml:"type"`
+	Type    string        `yaml:"type"`
+	LSM     LSMConfig     `yaml:"lsm"`
+	Bitcask BitcaskConfig `yaml:"bitcask"`
+}
+
+// LSMConfig - настройки LSM движка. Нулевые значения заменяются значениями по умолчанию
+type LSMConfig struct {
+	DataDirectory       string      `yaml:"data_directory" default:"lsm"`
+	MemtableSize        SizeInBytes `yaml:"memtable_size" default:"4MB"`
+	BlockSize           SizeInBytes `yaml:"block_size" default:"4KB"`
+	TargetFileSize      SizeInBytes `yaml:"target_file_size" default:"2MB"`
+	BloomBitsPerKey     int         `yaml:"bloom_bits_per_key" default:"10"`
+	L0CompactionTrigger int         `yaml:"l0_compaction_trigger" default:"4"`
+	BaseLevelSize       SizeInBytes `yaml:"base_level_size" default:"10MB"`
+	LevelSizeMultiplier int         `yaml:"level_size_multiplier" default:"10"`
+	MaxLevels           int         `yaml:"max_levels" default:"7"`
+}
+
+// BitcaskConfig - настройки bitcask движка. Нулевые значения заменяются значениями по умолчанию
+type BitcaskConfig struct {
+	DataDirectory string        `yaml:"data_directory" default:"bitcask"`
+	MaxFileSize   SizeInBytes   `yaml:"max_file_size" default:"64MB"`
+	MergeInterval time.Duration `yaml:"merge_interval" default:"1m"`
+	MergeTrigger  float64       `yaml:"merge_trigger" default:"0.5"` // доля мертвых данных, после которой запускается слияние
+	SyncOnWrite   bool          `yaml:"sync_on_write" default:"false"`
 }
 
 type SizeInBytes int64
@@ -31,15 +60,50 @@ type SizeInBytes int64
 type ClientNetworkConfig struct {
 	Address     string
 	IdleTimeout time.Duration
+	// DialTimeout - сколько ждать подключения к серверу, включая TLS рукопожатие, 0 - без ограничения
+	DialTimeout time.Duration
+	TLS         TLSConfig
+}
+
+// Значения TLSConfig.ClientAuth
+const (
+	// ClientAuthNone - сертификат клиента не запрашивается
+	ClientAuthNone = "none"
+	// ClientAuthRequest - сертификат клиента проверяется, если клиент его прислал
+	ClientAuthRequest = "request"
+	// ClientAuthRequire - без проверенного сертификата клиент не подключится
+	ClientAuthRequire = "require"
+)
+
+// TLSConfig - TLS соединений, версии не ниже 1.2. Файлы перечитываются при изменении без перезапуска.
+// Сервер использует те же настройки и для своих исходящих соединений (MIGRATE): сертификат - как клиентский,
+// CA - для проверки другого сервера
+type TLSConfig struct {
+	Enabled  bool   `yaml:"enabled" default:"false"`
+	CertFile string `yaml:"cert_file" default:""`
+	KeyFile  string `yaml:"key_file" default:""`
+	// CAFile - CA для проверки сертификата другой стороны, пустая строка - системные CA
+	CAFile string `yaml:"ca_file" default:""`
+	// ClientAuth - проверка сертификатов клиентов на сервере: none, request или require
+	ClientAuth string `yaml:"client_auth" default:"none"`
+	// ServerName - имя в сертификате сервера для клиента, пустая строка - хост из адреса
+	ServerName string `yaml:"server_name" default:""`
 }
 
 // NetworkConfig - сетевые настройки сервера
 // TODO Встраиваие ClientNetworkConfig в NetworkConfig ломает парсинг yaml
 type NetworkConfig struct {
-	Address        string        `yaml:"address" default:"127.0.0.1:3223"`
-	MaxConnections int           `yaml:"max_connections" default:"100"`
-	MaxMessageSize SizeInBytes   `yaml:"max_message_size" default:"4KB"` // "4KB", "1MB" и т.д.
-	IdleTimeout    time.Duration `yaml:"idle_timeout" default:"5m"`      // "5m", "10s" и т.д.
+	Address        string `yaml:"address" default:"127.0.0.1:3223"`
+	MaxConnections int    `yaml:"max_connections" default:"100"`
+	// MaxConnectionsPerIP - сколько соединений можно открыть с одного IP, 0 - без ограничения.
+	// Лишние соединения, как и сверх max_connections, получают ошибку и закрываются
+	MaxConnectionsPerIP int           `yaml:"max_connections_per_ip" default:"0"`
+	MaxMessageSize      SizeInBytes   `yaml:"max_message_size" default:"4KB"` // "4KB", "1MB" и т.д.
+	IdleTimeout         time.Duration `yaml:"idle_timeout" default:"5m"`      // "5m", "10s" и т.д.
+	// MaxOutputBuffer - сколько push сообщений (pub/sub) может ждать отправки одному клиенту.
+	// Клиент, который не успевает их читать, отключается. 0 - без ограничения
+	MaxOutputBuffer SizeInBytes `yaml:"max_output_buffer" default:"1MB"`
+	TLS             TLSConfig   `yaml:"tls"`
 }
 
 // LoggingConfig - настройки логирования
@@ -48,19 +112,58 @@ type LoggingConfig struct {
 	Output string `yaml:"output" default:"output.log"` // путь к файлу или "stdout"
 }
 
+// NotificationsConfig - уведомления об изменениях ключей в pub/sub
+type NotificationsConfig struct {
+	// KeyspaceEvents - флаги как notify-keyspace-events в Redis: "KEA", "Kx", пустая строка - выключены
+	KeyspaceEvents string `yaml:"keyspace_events" default:""`
+}
+
+// ExportConfig - файлы EXPORT и IMPORT
+type ExportConfig struct {
+	// Directory - каталог, в котором лежат файлы выгрузок, пустая строка - команды выключены
+	Directory string `yaml:"directory" default:""`
+}
+
+// AuthConfig - пользователи и их права (ACL). Без пользователей аутентификация выключена
+type AuthConfig struct {
+	// Users - пользователи в формате ACL файла: "user alice on #<sha256> ~cache:* +@read"
+	Users []string `yaml:"users"`
+	// ACLFile - файл с пользователями в том же формате, пустая строка - только Users
+	ACLFile string `yaml:"acl_file" default:""`
+	// TLSUsers - клиент с проверенным TLS сертификатом входит пользователем с именем из CommonName без AUTH
+	TLSUsers bool `yaml:"tls_users" default:"false"`
+}
+
+// ShutdownConfig - остановка сервера по SIGINT и SIGTERM
+type ShutdownConfig struct {
+	// GracePeriod - сколько ждать завершения выполняемых запросов. Потом соединения закрываются,
+	// а их запросы отменяются. 0 - не ждать
+	GracePeriod time.Duration `yaml:"grace_period" default:"10s"`
+	// SnapshotFile - файл в каталоге выгрузок, в который данные выгружаются как EXPORT перед выходом,
+	// пустая строка - не выгружаются
+	SnapshotFile string `yaml:"snapshot_file" default:""`
+}
+
 type WALConfig struct {
 	FlushingBatchSize    int           `yaml:"flushing_batch_size" default:"100"`
 	FlushingBatchTimeout time.Duration `yaml:"flushing_batch_timeout" default:"10ms"`
 	MaxSegmentSize       SizeInBytes   `yaml:"max_segment_size" default:"10MB"`
 	DataDirectory        string        `yaml:"data_directory" default:"wal"`
+	// ArchiveDirectory - куда копируются закрытые сегменты для восстановления на момент времени,
+	// пустая строка - не копируются
+	ArchiveDirectory string `yaml:"archive_directory" default:""`
 }
 
 // Config - основная структура конфигурации
 type Config struct {
-	Engine  EngineConfig  `yaml:"engine"`
-	Network NetworkConfig `yaml:"network"`
-	Wal     WALConfig     `yaml:"wal"`
-	Logging LoggingConfig `yaml:"logging"`
+	Engine        EngineConfig        `yaml:"engine"`
+	Network       NetworkConfig       `yaml:"network"`
+	Wal           WALConfig           `yaml:"wal"`
+	Logging       LoggingConfig       `yaml:"logging"`
+	Notifications NotificationsConfig `yaml:"notifications"`
+	Export        ExportConfig        `yaml:"export"`
+	Auth          AuthConfig          `yaml:"auth"`
+	Shutdown      ShutdownConfig      `yaml:"shutdown"`
 }
 
 // UnmarshalYAML SizeInBytes - кастомное правило десериализации для MaxMessageSize
@@ -128,6 +231,22 @@ func (c *Config) Validate() error {
 		return err
 	}
 
+	if err := c.validateShutdown(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *Config) validateShutdown() error {
+	if c.Shutdown.GracePeriod < 0 || c.Shutdown.GracePeriod > 10*time.Minute {
+		return fmt.Errorf("shutdown.grace_period %w [0, 10m], but got %s", ErrInvalidParamRange, c.Shutdown.GracePeriod)
+	}
+
+	if c.Shutdown.SnapshotFile != "" && (c.Export.Directory == "" || !filepath.IsLocal(c.Shutdown.SnapshotFile)) {
+		return fmt.Errorf("%w: %s", ErrShutdownSnapshot, c.Shutdown.SnapshotFile)
+	}
+
 	return nil
 }
 
@@ -148,17 +267,96 @@ func (c *Config) validateWAL() error {
 		return fmt.Errorf("config empty wal path %w", ErrEmptyFilePath)
 	}
 
+	if c.Wal.ArchiveDirectory != "" && path.Clean(c.Wal.ArchiveDirectory) == path.Clean(c.Wal.DataDirectory) {
+		return fmt.Errorf("%w: %s", ErrArchiveDirectory, c.Wal.ArchiveDirectory)
+	}
+
 	return nil
 }
 
 func (c *Config) validateEngine() error {
 	validTypes := map[string]bool{
 		"in_memory": true,
+		"ordered":   true,
+		"lsm":       true,
+		"bitcask":   true,
 	}
 
 	if !validTypes[c.Engine.Type] {
 		return ErrEngineType
 	}
+
+	switch c.Engine.Type {
+	case "lsm":
+		return c.validateLSM()
+	case "bitcask":
+		return c.validateBitcask()
+	}
+
+	return nil
+}
+
+func (c *Config) validateLSM() error {
+	lsm := c.Engine.LSM
+
+	if lsm.DataDirectory == "" {
+		return fmt.Errorf("config empty lsm path %w", ErrEmptyFilePath)
+	}
+
+	if lsm.MemtableSize < 0 || lsm.MemtableSize > 1<<30 {
+		return fmt.Errorf("lsm.memtable_size %w [0, 1^30] byte, but got %d", ErrInvalidParamRange, lsm.MemtableSize)
+	}
+
+	if lsm.BlockSize < 0 || lsm.BlockSize > 1<<20 {
+		return fmt.Errorf("lsm.block_size %w [0, 1^20] byte, but got %d", ErrInvalidParamRange, lsm.BlockSize)
+	}
+
+	if lsm.TargetFileSize < 0 || lsm.TargetFileSize > 1<<30 {
+		return fmt.Errorf("lsm.target_file_size %w [0, 1^30] byte, but got %d", ErrInvalidParamRange, lsm.TargetFileSize)
+	}
+
+	if lsm.BloomBitsPerKey < 0 || lsm.BloomBitsPerKey > 64 {
+		return fmt.Errorf("lsm.bloom_bits_per_key %w [0, 64], but got %d", ErrInvalidParamRange, lsm.BloomBitsPerKey)
+	}
+
+	if lsm.L0CompactionTrigger < 0 || lsm.L0CompactionTrigger > 64 {
+		return fmt.Errorf("lsm.l0_compaction_trigger %w [0, 64], but got %d", ErrInvalidParamRange, lsm.L0CompactionTrigger)
+	}
+
+	if lsm.BaseLevelSize < 0 || lsm.BaseLevelSize > 1<<40 {
+		return fmt.Errorf("lsm.base_level_size %w [0, 1^40] byte, but got %d", ErrInvalidParamRange, lsm.BaseLevelSize)
+	}
+
+	if lsm.LevelSizeMultiplier < 0 || lsm.LevelSizeMultiplier == 1 || lsm.LevelSizeMultiplier > 100 {
+		return fmt.Errorf("lsm.level_size_multiplier %w [2, 100], but got %d", ErrInvalidParamRange, lsm.LevelSizeMultiplier)
+	}
+
+	if lsm.MaxLevels < 0 || lsm.MaxLevels == 1 || lsm.MaxLevels > 16 {
+		return fmt.Errorf("lsm.max_levels %w [2, 16], but got %d", ErrInvalidParamRange, lsm.MaxLevels)
+	}
+
+	return nil
+}
+
+func (c *Config) validateBitcask() error {
+	bitcask := c.Engine.Bitcask
+
+	if bitcask.DataDirectory == "" {
+		return fmt.Errorf("config empty bitcask path %w", ErrEmptyFilePath)
+	}
+
+	if bitcask.MaxFileSize < 0 || bitcask.MaxFileSize > 1<<32 {
+		return fmt.Errorf("bitcask.max_file_size %w [0, 1^32] byte, but got %d", ErrInvalidParamRange, bitcask.MaxFileSize)
+	}
+
+	if bitcask.MergeInterval < 0 || bitcask.MergeInterval > 24*time.Hour {
+		return fmt.Errorf("bitcask.merge_interval %w [0, 24h], but got %s", ErrInvalidParamRange, bitcask.MergeInterval)
+	}
+
+	if bitcask.MergeTrigger < 0 || bitcask.MergeTrigger > 1 {
+		return fmt.Errorf("bitcask.merge_trigger %w [0, 1], but got %f", ErrInvalidParamRange, bitcask.MergeTrigger)
+	}
+
 	return nil
 }
 
@@ -185,6 +383,10 @@ func (c *Config) validateNetwork() error {
 		return fmt.Errorf("max_connections %w [1, 100]", ErrInvalidParamRange)
 	}
 
+	if c.Network.MaxConnectionsPerIP < 0 || c.Network.MaxConnectionsPerIP > c.Network.MaxConnections {
+		return fmt.Errorf("max_connections_per_ip %w [0, max_connections]", ErrInvalidParamRange)
+	}
+
 	if c.Network.MaxMessageSize <= 0 || c.Network.MaxMessageSize > 1<<30 {
 		return fmt.Errorf("max_message_size %w [1, 1^30] byte", ErrInvalidParamRange)
 	}
@@ -193,6 +395,33 @@ func (c *Config) validateNetwork() error {
 		return fmt.Errorf("idle_timeout %w [1s, 5m]", ErrInvalidParamRange)
 	}
 
+	if c.Network.MaxOutputBuffer < 0 || c.Network.MaxOutputBuffer > 1<<30 {
+		return fmt.Errorf("max_output_buffer %w [0, 1^30] byte", ErrInvalidParamRange)
+	}
+
+	return c.Network.TLS.ValidateServer()
+}
+
+// ValidateServer - проверка настроек TLS сервера: нужны сертификат и ключ, а для проверки клиентов - CA
+func (t TLSConfig) ValidateServer() error {
+	if !t.Enabled {
+		return nil
+	}
+
+	if t.CertFile == "" || t.KeyFile == "" {
+		return fmt.Errorf("%w: cert_file and key_file are required", ErrTLSConfig)
+	}
+
+	switch t.ClientAuth {
+	case "", ClientAuthNone:
+	case ClientAuthRequest, ClientAuthRequire:
+		if t.CAFile == "" {
+			return fmt.Errorf("%w: client_auth %s requires ca_file", ErrTLSConfig, t.ClientAuth)
+		}
+	default:
+		return fmt.Errorf("%w: client_auth must be none, request or require, got %q", ErrTLSConfig, t.ClientAuth)
+	}
+
 	return nil
 }
 
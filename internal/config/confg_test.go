@@ -46,6 +46,68 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "valid lsm engine",
+			cfg: Config{
+				Engine: EngineConfig{
+					Type: "lsm",
+					LSM:  LSMConfig{DataDirectory: "lsm", MemtableSize: 4 << 20},
+				},
+				Network: NetworkConfig{
+					Address:        "127.0.0.1:8080",
+					MaxConnections: 100,
+					MaxMessageSize: 1024,
+					IdleTimeout:    5 * time.Minute,
+				},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Output: "stdout",
+				},
+				Wal: WALConfig{
+					FlushingBatchSize:    100,
+					FlushingBatchTimeout: 10 * time.Millisecond,
+					MaxSegmentSize:       10 << 20,
+					DataDirectory:        "wal",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "lsm engine without data directory",
+			cfg: Config{
+				Engine: EngineConfig{Type: "lsm"},
+				Network: NetworkConfig{
+					Address: "127.0.0.1:8080",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid lsm level multiplier",
+			cfg: Config{
+				Engine: EngineConfig{
+					Type: "lsm",
+					LSM:  LSMConfig{DataDirectory: "lsm", LevelSizeMultiplier: 1},
+				},
+				Network: NetworkConfig{
+					Address: "127.0.0.1:8080",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid bitcask merge trigger",
+			cfg: Config{
+				Engine: EngineConfig{
+					Type:    "bitcask",
+					Bitcask: BitcaskConfig{DataDirectory: "bitcask", MergeTrigger: 1.5},
+				},
+				Network: NetworkConfig{
+					Address: "127.0.0.1:8080",
+				},
+			},
+			wantErr: true,
+		},
 		{
 			name: "invalid address",
 			cfg: Config{
@@ -67,6 +129,42 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "max connections per ip above max connections",
+			cfg: Config{
+				Engine: EngineConfig{Type: "in_memory"},
+				Network: NetworkConfig{
+					Address:             "127.0.0.1:8080",
+					MaxConnections:      10,
+					MaxConnectionsPerIP: 11,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "shutdown snapshot without export directory",
+			cfg: Config{
+				Engine: EngineConfig{Type: "in_memory"},
+				Network: NetworkConfig{
+					Address:        "127.0.0.1:8080",
+					MaxConnections: 100,
+					MaxMessageSize: 1024,
+					IdleTimeout:    5 * time.Minute,
+				},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Output: "stdout",
+				},
+				Wal: WALConfig{
+					FlushingBatchSize:    100,
+					FlushingBatchTimeout: 10 * time.Millisecond,
+					MaxSegmentSize:       10 << 20,
+					DataDirectory:        "wal",
+				},
+				Shutdown: ShutdownConfig{SnapshotFile: "shutdown.jsonl"},
+			},
+			wantErr: true,
+		},
 		{
 			name: "invalid log level",
 			cfg: Config{
@@ -121,6 +219,59 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "archive in wal directory",
+			cfg: Config{
+				Engine: EngineConfig{Type: "in_memory"},
+				Network: NetworkConfig{
+					Address:        "127.0.0.1:8080",
+					MaxConnections: 100,
+					MaxMessageSize: 1024,
+					IdleTimeout:    5 * time.Minute,
+				},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Output: "stdout",
+				},
+				Wal: WALConfig{
+					FlushingBatchSize:    100,
+					FlushingBatchTimeout: 10 * time.Millisecond,
+					MaxSegmentSize:       1024,
+					DataDirectory:        "wal",
+					ArchiveDirectory:     "./wal/",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "client auth without ca",
+			cfg: Config{
+				Engine: EngineConfig{Type: "in_memory"},
+				Network: NetworkConfig{
+					Address:        "127.0.0.1:8080",
+					MaxConnections: 100,
+					MaxMessageSize: 1024,
+					IdleTimeout:    5 * time.Minute,
+					TLS: TLSConfig{
+						Enabled:    true,
+						CertFile:   "server.crt",
+						KeyFile:    "server.key",
+						ClientAuth: ClientAuthRequire,
+					},
+				},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Output: "stdout",
+				},
+				Wal: WALConfig{
+					FlushingBatchSize:    100,
+					FlushingBatchTimeout: 10 * time.Millisecond,
+					MaxSegmentSize:       1024,
+					DataDirectory:        "wal",
+				},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
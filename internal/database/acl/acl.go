@@ -0,0 +1,444 @@
+package acl
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+	"github.com/TimonKK/inmemory-db/internal/utils"
+)
+
+var (
+	ErrNoAuth      = errors.New("NOAUTH Authentication required")
+	ErrWrongPass   = errors.New("WRONGPASS invalid username-password pair or user is disabled")
+	ErrNoPerm      = errors.New("NOPERM")
+	ErrInvalidRule = errors.New("invalid ACL rule")
+)
+
+// Правила пользователя, как в ACL Redis. Применяются по порядку:
+//
+//	on, off           - пользователь может или не может входить
+//	>password         - добавить пароль, #sha256hex - добавить пароль по хешу (только в файле и конфиге)
+//	nopass, resetpass - вход с любым паролем, удалить все пароли
+//	~pattern          - доступные ключи (glob), allkeys - все ключи, resetkeys - никакие
+//	&pattern          - доступные каналы pub/sub (glob), allchannels - все каналы, resetchannels - никакие
+//	+cmd, -cmd        - разрешить или запретить команду
+//	+@cat, -@cat      - разрешить или запретить категорию: read, write, admin или all
+//	allcommands, nocommands - то же, что +@all и -@all
+//	reset             - off, resetpass, resetkeys, resetchannels, nocommands
+const (
+	userPrefix = "user"
+	allRule    = "all"
+)
+
+// notificationPrefixes - каналы уведомлений о ключах. В них видны имена и изменения всех ключей базы,
+// поэтому подписка на них требует allkeys, как KEYS и SCAN
+var notificationPrefixes = []string{"__keyspace@", "__keyevent@"}
+
+// User - пользователь и его права
+type User struct {
+	Name    string
+	Enabled bool
+	NoPass  bool
+	// passwords - sha256 паролей в hex
+	passwords []string
+	// keys - шаблоны доступных ключей
+	keys []string
+	// channels - шаблоны доступных каналов pub/sub
+	channels []string
+	// commands - разрешенные команды, commandRules - правила, из которых они получились, для ACL LIST
+	commands     map[compute.CommandId]struct{}
+	commandRules []string
+}
+
+func newUser(name string) *User {
+	return &User{Name: name, commands: make(map[compute.CommandId]struct{})}
+}
+
+func (u *User) clone() *User {
+	c := *u
+	c.passwords = slices.Clone(u.passwords)
+	c.keys = slices.Clone(u.keys)
+	c.channels = slices.Clone(u.channels)
+	c.commandRules = slices.Clone(u.commandRules)
+	c.commands = make(map[compute.CommandId]struct{}, len(u.commands))
+	for id := range u.commands {
+		c.commands[id] = struct{}{}
+	}
+
+	return &c
+}
+
+func (u *User) apply(rule string) error {
+	lower := strings.ToLower(rule)
+
+	switch {
+	case lower == "on":
+		u.Enabled = true
+	case lower == "off":
+		u.Enabled = false
+	case lower == "nopass":
+		u.NoPass, u.passwords = true, nil
+	case lower == "resetpass":
+		u.NoPass, u.passwords = false, nil
+	case strings.HasPrefix(rule, ">"):
+		u.addPassword(HashPassword(rule[1:]))
+	case strings.HasPrefix(rule, "#"):
+		hash := strings.ToLower(rule[1:])
+		if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+			return fmt.Errorf("%w: %s is not a sha256 hash", ErrInvalidRule, rule)
+		}
+		u.addPassword(hash)
+	case lower == "allkeys":
+		u.keys = []string{"*"}
+	case lower == "resetkeys":
+		u.keys = nil
+	case strings.HasPrefix(rule, "~"):
+		if rule == "~" {
+			return fmt.Errorf("%w: empty key pattern", ErrInvalidRule)
+		}
+		u.keys = append(u.keys, rule[1:])
+	case lower == "allchannels":
+		u.channels = []string{"*"}
+	case lower == "resetchannels":
+		u.channels = nil
+	case strings.HasPrefix(rule, "&"):
+		if rule == "&" {
+			return fmt.Errorf("%w: empty channel pattern", ErrInvalidRule)
+		}
+		u.channels = append(u.channels, rule[1:])
+	case lower == "allcommands":
+		return u.apply("+@all")
+	case lower == "nocommands":
+		return u.apply("-@all")
+	case lower == "reset":
+		for _, r := range []string{"off", "resetpass", "resetkeys", "resetchannels", "nocommands"} {
+			if err := u.apply(r); err != nil {
+				return err
+			}
+		}
+	case strings.HasPrefix(rule, "+") || strings.HasPrefix(rule, "-"):
+		return u.applyCommandRule(lower)
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidRule, rule)
+	}
+
+	return nil
+}
+
+func (u *User) addPassword(hash string) {
+	u.NoPass = false
+	if !slices.Contains(u.passwords, hash) {
+		u.passwords = append(u.passwords, hash)
+	}
+}
+
+// applyCommandRule - +cmd, -cmd, +@cat, -@cat
+func (u *User) applyCommandRule(rule string) error {
+	allow, name := rule[0] == '+', rule[1:]
+
+	var commands []compute.CommandId
+	if category, ok := strings.CutPrefix(name, "@"); ok {
+		if category == allRule {
+			commands = compute.Commands()
+			// +@all и -@all перекрывают все прежние правила
+			u.commandRules = nil
+		} else {
+			if !slices.Contains(compute.Categories, compute.Category(category)) {
+				return fmt.Errorf("%w: unknown category %s", ErrInvalidRule, category)
+			}
+
+			for _, id := range compute.Commands() {
+				if compute.CategoryOf(id) == compute.Category(category) {
+					commands = append(commands, id)
+				}
+			}
+		}
+	} else {
+		id := compute.CommandId(strings.ToUpper(name))
+		if _, ok := compute.ArityOf(id); !ok {
+			return fmt.Errorf("%w: unknown command %s", ErrInvalidRule, name)
+		}
+		commands = []compute.CommandId{id}
+	}
+
+	for _, id := range commands {
+		if allow {
+			u.commands[id] = struct{}{}
+		} else {
+			delete(u.commands, id)
+		}
+	}
+	u.commandRules = append(u.commandRules, rule)
+
+	return nil
+}
+
+// String - пользователь в формате ACL файла: "user alice on #<sha256> ~cache:* &news.* +@read"
+func (u *User) String() string {
+	parts := []string{userPrefix, u.Name, "off"}
+	if u.Enabled {
+		parts[2] = "on"
+	}
+
+	if u.NoPass {
+		parts = append(parts, "nopass")
+	}
+	for _, hash := range u.passwords {
+		parts = append(parts, "#"+hash)
+	}
+
+	if len(u.keys) == 0 {
+		parts = append(parts, "resetkeys")
+	}
+	for _, pattern := range u.keys {
+		parts = append(parts, "~"+pattern)
+	}
+
+	if len(u.channels) == 0 {
+		parts = append(parts, "resetchannels")
+	}
+	for _, pattern := range u.channels {
+		parts = append(parts, "&"+pattern)
+	}
+
+	if len(u.commandRules) == 0 {
+		parts = append(parts, "-@all")
+	}
+
+	return strings.Join(append(parts, u.commandRules...), " ")
+}
+
+func (u *User) checkPassword(password string) bool {
+	if u.NoPass {
+		return true
+	}
+
+	hash := []byte(HashPassword(password))
+	for _, stored := range u.passwords {
+		if subtle.ConstantTimeCompare(hash, []byte(stored)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allKeys - доступ ко всем ключам, без него нельзя KEYS, SCAN, RANGE, PREFIX и другие команды по всей базе
+func (u *User) allKeys() bool {
+	return slices.Contains(u.keys, "*")
+}
+
+func (u *User) keyAllowed(key string) bool {
+	for _, pattern := range u.keys {
+		if utils.MatchGlob(pattern, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// channelAllowed - доступен ли канал. Шаблон PSUBSCRIBE, как в Redis, должен совпадать с разрешенным
+// шаблоном буквально: иначе шаблон шире разрешенного открыл бы чужие каналы
+func (u *User) channelAllowed(channel string, pattern bool) bool {
+	for _, allowed := range u.channels {
+		if allowed == "*" || allowed == channel || (!pattern && utils.MatchGlob(allowed, channel)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// keyNotifications - канал уведомлений о ключах или шаблон, под который такой канал может попасть.
+// Для шаблона сравнивается его часть до первого спецсимвола, поэтому "*" и "__key*" тоже считаются
+func keyNotifications(channel string, pattern bool) bool {
+	literal := channel
+	if pattern {
+		if i := strings.IndexAny(channel, `*?[\`); i >= 0 {
+			literal = channel[:i]
+		}
+	}
+
+	for _, prefix := range notificationPrefixes {
+		if strings.HasPrefix(literal, prefix) || (len(literal) < len(channel) && strings.HasPrefix(prefix, literal)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HashPassword - sha256 пароля в hex, в таком виде пароли хранятся в ACL файле
+func HashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// ACL - пользователи сервера
+type ACL struct {
+	mu    sync.RWMutex
+	users map[string]*User
+}
+
+// New - пользователи из строк формата ACL файла: "user alice on >secret ~cache:* +@read"
+func New(lines []string) (*ACL, error) {
+	acl := &ACL{users: make(map[string]*User)}
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != userPrefix {
+			return nil, fmt.Errorf("%w: line must start with \"user <name>\": %q", ErrInvalidRule, line)
+		}
+
+		if err := acl.SetUser(fields[1], fields[2:]); err != nil {
+			return nil, err
+		}
+	}
+
+	return acl, nil
+}
+
+// LoadFile - строки пользователей из ACL файла. Пустые строки и строки, начинающиеся с "//", пропускаются
+func LoadFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines, scanner.Err()
+}
+
+// SetUser - применяет правила к пользователю, создает его, если нет. Новый пользователь выключен и без прав.
+// Ошибка в любом правиле не меняет пользователя
+func (a *ACL) SetUser(name string, rules []string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	user, ok := a.users[name]
+	if ok {
+		user = user.clone()
+	} else {
+		user = newUser(name)
+	}
+
+	for _, rule := range rules {
+		if err := user.apply(rule); err != nil {
+			return fmt.Errorf("user %s: %w", name, err)
+		}
+	}
+	a.users[name] = user
+
+	return nil
+}
+
+// Authenticate - проверяет пароль. ErrWrongPass, если пользователя нет, он выключен или пароль не подходит
+func (a *ACL) Authenticate(name, password string) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	user, ok := a.users[name]
+	if !ok || !user.Enabled || !user.checkPassword(password) {
+		return ErrWrongPass
+	}
+
+	return nil
+}
+
+// NoPassword - пользователь включен и входит без пароля. Так соединения без AUTH работают пользователем default
+func (a *ACL) NoPassword(name string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	user, ok := a.users[name]
+	return ok && user.Enabled && user.NoPass
+}
+
+// Exists - есть ли пользователь name и включен ли он
+func (a *ACL) Exists(name string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	user, ok := a.users[name]
+	return ok && user.Enabled
+}
+
+// Check - может ли пользователь выполнить запрос: разрешена ли команда, все ее ключи и каналы. Команды по всем
+// ключам требуют allkeys (~*): шаблоны ключей не должны обходиться через KEYS или PREFIX, и так же через
+// каналы уведомлений о ключах. Как в Redis, выключение пользователя не отключает тех, кто уже вошел
+func (a *ACL) Check(name string, query compute.Query) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	user, ok := a.users[name]
+	if !ok {
+		return ErrNoAuth
+	}
+
+	if _, ok := user.commands[query.CommandId()]; !ok {
+		return fmt.Errorf("%w User %s has no permissions to run the '%s' command", ErrNoPerm, name, query.CommandId())
+	}
+
+	if query.AllKeys() && !user.allKeys() {
+		return fmt.Errorf("%w User %s has no permissions to access all keys with the '%s' command", ErrNoPerm, name, query.CommandId())
+	}
+
+	for _, key := range query.Keys() {
+		if !user.keyAllowed(key) {
+			return fmt.Errorf("%w User %s has no permissions to access the '%s' key", ErrNoPerm, name, key)
+		}
+	}
+
+	pattern := query.CommandId() == compute.PSubscribeCommandId
+	for _, channel := range query.Channels() {
+		if !user.channelAllowed(channel, pattern) {
+			return fmt.Errorf("%w User %s has no permissions to access the '%s' channel", ErrNoPerm, name, channel)
+		}
+
+		if keyNotifications(channel, pattern) && !user.allKeys() {
+			return fmt.Errorf("%w User %s has no permissions to access all keys with the '%s' channel", ErrNoPerm, name, channel)
+		}
+	}
+
+	return nil
+}
+
+// List - пользователи в формате ACL файла, по именам
+func (a *ACL) List() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	names := make([]string, 0, len(a.users))
+	for name := range a.users {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		lines = append(lines, a.users[name].String())
+	}
+
+	return lines
+}
@@ -0,0 +1,143 @@
+package acl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func query(id compute.CommandId, args ...string) compute.Query {
+	return compute.NewQuery(id, args)
+}
+
+func TestACL_Authenticate(t *testing.T) {
+	acl, err := New([]string{
+		"user alice on >secret ~* +@all",
+		"user bob on #" + HashPassword("hunter2") + " ~* +@all",
+		"user carol off >secret",
+		"user default on nopass",
+	})
+	require.NoError(t, err)
+
+	assert.NoError(t, acl.Authenticate("alice", "secret"))
+	assert.ErrorIs(t, acl.Authenticate("alice", "wrong"), ErrWrongPass)
+	assert.NoError(t, acl.Authenticate("bob", "hunter2"))
+	assert.ErrorIs(t, acl.Authenticate("carol", "secret"), ErrWrongPass)
+	assert.ErrorIs(t, acl.Authenticate("nobody", "secret"), ErrWrongPass)
+	assert.NoError(t, acl.Authenticate("default", "anything"))
+
+	assert.True(t, acl.NoPassword("default"))
+	assert.False(t, acl.NoPassword("alice"))
+
+	// в LIST пароли только хешами
+	assert.Equal(t, "user alice on #"+HashPassword("secret")+" ~* resetchannels +@all", acl.List()[0])
+}
+
+func TestACL_Check(t *testing.T) {
+	acl, err := New([]string{
+		"user reader on nopass ~cache:* ~session:* +@read -keys",
+		"user writer on nopass allkeys +@read +@write -del",
+		"user admin on nopass allkeys allcommands",
+		"user nobody on nopass allkeys",
+		"user scoped on nopass ~sec* +@read +@admin",
+		"user news on nopass ~app:* &news.* +@read +@write",
+		"user watcher on nopass allkeys allchannels +@read",
+		"user listener on nopass ~app:* allchannels +@read +@write",
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		user    string
+		query   compute.Query
+		wantErr error
+	}{
+		{name: "read in pattern", user: "reader", query: query(compute.GetCommandId, "cache:1")},
+		{name: "read outside pattern", user: "reader", query: query(compute.GetCommandId, "user:1"), wantErr: ErrNoPerm},
+		{name: "one of keys outside pattern", user: "reader", query: query(compute.MGetCommandId, "cache:1", "user:1"), wantErr: ErrNoPerm},
+		{name: "write without category", user: "reader", query: query(compute.SetCommandId, "cache:1", "v"), wantErr: ErrNoPerm},
+		{name: "removed command", user: "reader", query: query(compute.KeysCommandId, "*"), wantErr: ErrNoPerm},
+		{name: "write", user: "writer", query: query(compute.SetCommandId, "a", "v")},
+		{name: "write with removed command", user: "writer", query: query(compute.DeleteCommandId, "a"), wantErr: ErrNoPerm},
+		{name: "admin without category", user: "writer", query: query(compute.FlushDBCommandId), wantErr: ErrNoPerm},
+		{name: "admin", user: "admin", query: query(compute.FlushDBCommandId)},
+		{name: "keys with key patterns", user: "scoped", query: query(compute.KeysCommandId, "*"), wantErr: ErrNoPerm},
+		{name: "scan with key patterns", user: "scoped", query: query(compute.ScanCommandId, "0"), wantErr: ErrNoPerm},
+		{name: "range with key patterns", user: "scoped", query: query(compute.RangeCommandId, "sec", "sed"), wantErr: ErrNoPerm},
+		{name: "prefix with key patterns", user: "scoped", query: query(compute.PrefixCommandId, "sec"), wantErr: ErrNoPerm},
+		{name: "export with key patterns", user: "scoped", query: query(compute.ExportCommandId, "dump.json"), wantErr: ErrNoPerm},
+		{name: "keys with allkeys", user: "admin", query: query(compute.KeysCommandId, "*")},
+		{name: "prefix with allkeys", user: "writer", query: query(compute.PrefixCommandId, "sec")},
+		{name: "no commands", user: "nobody", query: query(compute.GetCommandId, "a"), wantErr: ErrNoPerm},
+		{name: "unknown user", user: "ghost", query: query(compute.GetCommandId, "a"), wantErr: ErrNoAuth},
+		{name: "subscribe in channel pattern", user: "news", query: query(compute.SubscribeCommandId, "news.sport")},
+		{name: "subscribe outside channel pattern", user: "news", query: query(compute.SubscribeCommandId, "news.sport", "alerts"), wantErr: ErrNoPerm},
+		{name: "publish outside channel pattern", user: "news", query: query(compute.PublishCommandId, "alerts", "m"), wantErr: ErrNoPerm},
+		{name: "psubscribe with allowed pattern", user: "news", query: query(compute.PSubscribeCommandId, "news.*")},
+		{name: "psubscribe wider than allowed", user: "news", query: query(compute.PSubscribeCommandId, "*"), wantErr: ErrNoPerm},
+		{name: "no channels", user: "reader", query: query(compute.SubscribeCommandId, "news.sport"), wantErr: ErrNoPerm},
+		{name: "keyspace channel with allkeys", user: "watcher", query: query(compute.SubscribeCommandId, "__keyspace@0__:app:1")},
+		{name: "keyspace pattern with allkeys", user: "watcher", query: query(compute.PSubscribeCommandId, "__key*__:*")},
+		{name: "keyspace channel with key patterns", user: "listener", query: query(compute.SubscribeCommandId, "__keyevent@0__:del"), wantErr: ErrNoPerm},
+		{name: "keyspace pattern with key patterns", user: "listener", query: query(compute.PSubscribeCommandId, "__key*__:*"), wantErr: ErrNoPerm},
+		{name: "any pattern with key patterns", user: "listener", query: query(compute.PSubscribeCommandId, "*"), wantErr: ErrNoPerm},
+		{name: "other pattern with key patterns", user: "listener", query: query(compute.PSubscribeCommandId, "news.*")},
+		{name: "publish to keyspace with key patterns", user: "listener", query: query(compute.PublishCommandId, "__keyspace@0__:x", "del"), wantErr: ErrNoPerm},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := acl.Check(tt.user, tt.query)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestACL_SetUser(t *testing.T) {
+	acl, err := New(nil)
+	require.NoError(t, err)
+
+	// новый пользователь выключен и без прав
+	require.NoError(t, acl.SetUser("alice", nil))
+	assert.Equal(t, []string{"user alice off resetkeys resetchannels -@all"}, acl.List())
+	assert.ErrorIs(t, acl.Authenticate("alice", ""), ErrWrongPass)
+
+	require.NoError(t, acl.SetUser("alice", []string{"on", ">secret", "~cache:*", "+@read"}))
+	require.NoError(t, acl.SetUser("alice", []string{"+SET"}))
+	assert.NoError(t, acl.Authenticate("alice", "secret"))
+	assert.NoError(t, acl.Check("alice", query(compute.SetCommandId, "cache:1", "v")))
+
+	// ошибка в правиле не меняет пользователя
+	assert.ErrorIs(t, acl.SetUser("alice", []string{"resetkeys", "+@nope"}), ErrInvalidRule)
+	assert.ErrorIs(t, acl.SetUser("alice", []string{"+nosuchcommand"}), ErrInvalidRule)
+	assert.ErrorIs(t, acl.SetUser("alice", []string{"#abc"}), ErrInvalidRule)
+	assert.ErrorIs(t, acl.SetUser("alice", []string{"bogus"}), ErrInvalidRule)
+	assert.NoError(t, acl.Check("alice", query(compute.GetCommandId, "cache:1")))
+
+	// +@all перекрывает прежние правила, reset снимает все
+	require.NoError(t, acl.SetUser("alice", []string{"-@all", "+get"}))
+	assert.Equal(t, "user alice on #"+HashPassword("secret")+" ~cache:* resetchannels -@all +get", acl.List()[0])
+
+	require.NoError(t, acl.SetUser("alice", []string{"reset"}))
+	assert.Equal(t, []string{"user alice off resetkeys resetchannels -@all"}, acl.List())
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.acl")
+	require.NoError(t, os.WriteFile(path, []byte("// пользователи\n\nuser alice on >secret ~* +@read\n"), 0o600))
+
+	lines, err := LoadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user alice on >secret ~* +@read"}, lines)
+
+	_, err = New([]string{"alice on >secret"})
+	assert.ErrorIs(t, err, ErrInvalidRule)
+}
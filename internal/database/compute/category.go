@@ -0,0 +1,63 @@
+package compute
+
+import (
+	"slices"
+)
+
+// Category - группа команд в правах пользователей ACL
+type Category string
+
+const (
+	// CategoryRead - команды, которые только читают
+	CategoryRead Category = "read"
+	// CategoryWrite - команды, которые меняют ключи или публикуют сообщения
+	CategoryWrite Category = "write"
+	// CategoryAdmin - команды над всей базой и пользователями: FLUSHDB, EXPORT, IMPORT, MIGRATE, CDC, ACL
+	CategoryAdmin Category = "admin"
+)
+
+// Categories - все категории команд
+var Categories = []Category{CategoryRead, CategoryWrite, CategoryAdmin}
+
+var writeCommands = map[CommandId]struct{}{
+	SetCommandId: {}, DeleteCommandId: {}, MSetCommandId: {}, MSetNXCommandId: {}, MDelCommandId: {},
+	GetSetCommandId: {}, GetDelCommandId: {}, GetExCommandId: {}, RenameCommandId: {}, CopyCommandId: {},
+	AppendCommandId: {}, SetRangeCommandId: {}, RestoreCommandId: {},
+	LPushCommandId: {}, RPushCommandId: {}, LPopCommandId: {}, RPopCommandId: {}, LTrimCommandId: {},
+	LMoveCommandId: {}, BLPopCommandId: {}, BRPopCommandId: {}, BLMoveCommandId: {},
+	HSetCommandId: {}, HDelCommandId: {}, HIncrByCommandId: {}, HExpireCommandId: {},
+	SAddCommandId: {}, SRemCommandId: {}, SInterStoreCommandId: {}, SUnionStoreCommandId: {}, SDiffStoreCommandId: {},
+	ZAddCommandId: {}, ZIncrByCommandId: {}, ZRemCommandId: {}, ZRangeStoreCommandId: {},
+	ZPopMinCommandId: {}, ZPopMaxCommandId: {},
+	XAddCommandId: {}, XGroupCommandId: {}, XReadGroupCommandId: {}, XAckCommandId: {}, XClaimCommandId: {},
+	PublishCommandId: {},
+}
+
+var adminCommands = map[CommandId]struct{}{
+	FlushDBCommandId: {}, CDCCommandId: {}, ExportCommandId: {}, ImportCommandId: {}, MigrateCommandId: {},
+	ACLCommandId: {},
+}
+
+// CategoryOf - категория команды. Команды, которые не меняют данные и не относятся к администрированию, - read
+func CategoryOf(id CommandId) Category {
+	if _, ok := adminCommands[id]; ok {
+		return CategoryAdmin
+	}
+
+	if _, ok := writeCommands[id]; ok {
+		return CategoryWrite
+	}
+
+	return CategoryRead
+}
+
+// Commands - все команды клиента по алфавиту
+func Commands() []CommandId {
+	commands := make([]CommandId, 0, len(commandArity))
+	for id := range commandArity {
+		commands = append(commands, id)
+	}
+	slices.Sort(commands)
+
+	return commands
+}
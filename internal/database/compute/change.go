@@ -0,0 +1,66 @@
+package compute
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ChangePrefix - начало строки изменения в ленте CDC
+const ChangePrefix = "change"
+
+// Change - изменение из ленты CDC: запись WAL с ее номером. Номера записей начинаются с 1 и идут подряд,
+// поэтому по последнему полученному номеру можно продолжить чтение после переподключения.
+// Прежнее значение в WAL не хранится, Query содержит только итоговое изменение
+type Change struct {
+	Seq       uint64
+	Timestamp int64
+	Query     Query
+}
+
+func NewChange(seq uint64, record Record) Change {
+	return Change{Seq: seq, Timestamp: record.Timestamp, Query: record.Query}
+}
+
+// Op - команда изменения: SET, DEL, LPUSH и т.д.
+func (c Change) Op() CommandId {
+	return c.Query.CommandId()
+}
+
+// Key - первый измененный ключ, пустой для изменений без ключа (FLUSHDB)
+func (c Change) Key() string {
+	keys := c.Query.Keys()
+	if len(keys) == 0 {
+		return ""
+	}
+
+	return keys[0]
+}
+
+// String - "change seq timestamp CMD arg1 arg2 ..."
+func (c Change) String() string {
+	parts := append([]string{ChangePrefix, strconv.FormatUint(c.Seq, 10), strconv.FormatInt(c.Timestamp, 10),
+		string(c.Query.id)}, c.Query.args...)
+
+	return strings.Join(parts, " ")
+}
+
+// ParseChange - разбирает строку изменения, которую сформировал Change.String
+func ParseChange(s string) (Change, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 4 || fields[0] != ChangePrefix {
+		return Change{}, fmt.Errorf("%w: change %q", ErrInvalidRecord, s)
+	}
+
+	seq, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return Change{}, fmt.Errorf("%w: change seq %q", ErrInvalidRecord, s)
+	}
+
+	timestamp, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return Change{}, fmt.Errorf("%w: change timestamp %q", ErrInvalidRecord, s)
+	}
+
+	return Change{Seq: seq, Timestamp: timestamp, Query: NewQuery(CommandId(fields[3]), fields[4:])}, nil
+}
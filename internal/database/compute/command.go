@@ -1,15 +1,314 @@
 package compute
 
+import "fmt"
+
 type CommandId string
 
 const (
-	GetCommandId    CommandId = "GET"
-	SetCommandId    CommandId = "SET"
-	DeleteCommandId CommandId = "DEL"
-)
+	GetCommandId      CommandId = "GET"
+	SetCommandId      CommandId = "SET"
+	DeleteCommandId   CommandId = "DEL"
+	RangeCommandId    CommandId = "RANGE"
+	PrefixCommandId   CommandId = "PREFIX"
+	ScanCommandId     CommandId = "SCAN"
+	KeysCommandId     CommandId = "KEYS"
+	DBSizeCommandId   CommandId = "DBSIZE"
+	MGetCommandId     CommandId = "MGET"
+	MSetCommandId     CommandId = "MSET"
+	MSetNXCommandId   CommandId = "MSETNX"
+	MDelCommandId     CommandId = "MDEL"
+	GetSetCommandId   CommandId = "GETSET"
+	GetDelCommandId   CommandId = "GETDEL"
+	GetExCommandId    CommandId = "GETEX"
+	TTLCommandId      CommandId = "TTL"
+	PTTLCommandId     CommandId = "PTTL"
+	ExistsCommandId   CommandId = "EXISTS"
+	RenameCommandId   CommandId = "RENAME"
+	CopyCommandId     CommandId = "COPY"
+	TypeCommandId     CommandId = "TYPE"
+	FlushDBCommandId  CommandId = "FLUSHDB"
+	AppendCommandId   CommandId = "APPEND"
+	StrLenCommandId   CommandId = "STRLEN"
+	GetRangeCommandId CommandId = "GETRANGE"
+	SetRangeCommandId CommandId = "SETRANGE"
+	LPushCommandId    CommandId = "LPUSH"
+	RPushCommandId    CommandId = "RPUSH"
+	LPopCommandId     CommandId = "LPOP"
+	RPopCommandId     CommandId = "RPOP"
+	LLenCommandId     CommandId = "LLEN"
+	LRangeCommandId   CommandId = "LRANGE"
+	LIndexCommandId   CommandId = "LINDEX"
+	LTrimCommandId    CommandId = "LTRIM"
+	LMoveCommandId    CommandId = "LMOVE"
+	BLPopCommandId    CommandId = "BLPOP"
+	BRPopCommandId    CommandId = "BRPOP"
+	BLMoveCommandId   CommandId = "BLMOVE"
+	HSetCommandId     CommandId = "HSET"
+	HGetCommandId     CommandId = "HGET"
+	HDelCommandId     CommandId = "HDEL"
+	HGetAllCommandId  CommandId = "HGETALL"
+	HLenCommandId     CommandId = "HLEN"
+	HIncrByCommandId  CommandId = "HINCRBY"
+	HScanCommandId    CommandId = "HSCAN"
+	HExpireCommandId  CommandId = "HEXPIRE"
+	HTTLCommandId     CommandId = "HTTL"
 
-const (
-	GetCommandArgsCount    = 1
-	SetCommandArgsCount    = 2
-	DeleteCommandArgsCount = 1
+	// множества
+	SAddCommandId        CommandId = "SADD"
+	SRemCommandId        CommandId = "SREM"
+	SIsMemberCommandId   CommandId = "SISMEMBER"
+	SMembersCommandId    CommandId = "SMEMBERS"
+	SCardCommandId       CommandId = "SCARD"
+	SInterCommandId      CommandId = "SINTER"
+	SUnionCommandId      CommandId = "SUNION"
+	SDiffCommandId       CommandId = "SDIFF"
+	SInterStoreCommandId CommandId = "SINTERSTORE"
+	SUnionStoreCommandId CommandId = "SUNIONSTORE"
+	SDiffStoreCommandId  CommandId = "SDIFFSTORE"
+	SScanCommandId       CommandId = "SSCAN"
+
+	// сортированные множества
+	ZAddCommandId        CommandId = "ZADD"
+	ZIncrByCommandId     CommandId = "ZINCRBY"
+	ZRemCommandId        CommandId = "ZREM"
+	ZScoreCommandId      CommandId = "ZSCORE"
+	ZCardCommandId       CommandId = "ZCARD"
+	ZRankCommandId       CommandId = "ZRANK"
+	ZRevRankCommandId    CommandId = "ZREVRANK"
+	ZRangeCommandId      CommandId = "ZRANGE"
+	ZRangeStoreCommandId CommandId = "ZRANGESTORE"
+	ZPopMinCommandId     CommandId = "ZPOPMIN"
+	ZPopMaxCommandId     CommandId = "ZPOPMAX"
+
+	// потоки
+	XAddCommandId       CommandId = "XADD"
+	XLenCommandId       CommandId = "XLEN"
+	XRangeCommandId     CommandId = "XRANGE"
+	XReadCommandId      CommandId = "XREAD"
+	XGroupCommandId     CommandId = "XGROUP"
+	XReadGroupCommandId CommandId = "XREADGROUP"
+	XAckCommandId       CommandId = "XACK"
+	XPendingCommandId   CommandId = "XPENDING"
+	XClaimCommandId     CommandId = "XCLAIM"
+
+	// pub/sub
+	SubscribeCommandId    CommandId = "SUBSCRIBE"
+	PSubscribeCommandId   CommandId = "PSUBSCRIBE"
+	UnsubscribeCommandId  CommandId = "UNSUBSCRIBE"
+	PUnsubscribeCommandId CommandId = "PUNSUBSCRIBE"
+	PublishCommandId      CommandId = "PUBLISH"
+
+	// CDCCommandId - CDC seq, лента изменений из WAL начиная с записи seq
+	CDCCommandId CommandId = "CDC"
+
+	// выгрузка и загрузка данных: файл в каталоге export.directory, формат по расширению (.csv или JSON Lines)
+	ExportCommandId CommandId = "EXPORT"
+	ImportCommandId CommandId = "IMPORT"
+
+	// перенос отдельных ключей: DUMP - значение с типом и сроком жизни, RESTORE создает из него ключ,
+	// MIGRATE переносит ключи на другой сервер через DUMP и RESTORE
+	DumpCommandId    CommandId = "DUMP"
+	RestoreCommandId CommandId = "RESTORE"
+	MigrateCommandId CommandId = "MIGRATE"
+
+	// AuthCommandId - AUTH [user] password, вход пользователем, без user - пользователем default
+	AuthCommandId CommandId = "AUTH"
+	// ACLCommandId - ACL WHOAMI, ACL LIST, ACL SETUSER user [rule ...]
+	ACLCommandId CommandId = "ACL"
+
+	// PExpireAtCommandId - служебная запись WAL: новый срок жизни ключа в unix ms, 0 - бессрочно.
+	// Клиентом не разбирается
+	PExpireAtCommandId CommandId = "PEXPIREAT"
+	// HPExpireAtCommandId - служебная запись WAL: срок жизни полей хеша в unix ms, HPEXPIREAT key ms field [field ...]
+	HPExpireAtCommandId CommandId = "HPEXPIREAT"
 )
+
+// UnlimitedArgs - у команды нет верхней границы числа аргументов
+const UnlimitedArgs = -1
+
+// Arity - допустимое число аргументов команды
+type Arity struct {
+	Min int
+	Max int // UnlimitedArgs - без ограничения
+	// Pairs - аргументы идут парами ключ-значение
+	Pairs bool
+	// PairsFrom - сколько аргументов идет перед парами (HSET key field value ...)
+	PairsFrom int
+}
+
+// commandArity - число аргументов каждой известной команды. Команды, которых здесь нет, не распознаются
+var commandArity = map[CommandId]Arity{
+	GetCommandId: {Min: 1, Max: 1},
+	// SET key value [NX|XX] [GET] [EX s|PX ms|EXAT s|PXAT ms|KEEPTTL]
+	SetCommandId:    {Min: 2, Max: 6},
+	DeleteCommandId: {Min: 1, Max: 1},
+	// RANGE start end [LIMIT n] [REV]
+	RangeCommandId: {Min: 2, Max: 5},
+	// PREFIX prefix [LIMIT n] [REV]
+	PrefixCommandId: {Min: 1, Max: 4},
+	// SCAN cursor [MATCH pattern] [COUNT n]
+	ScanCommandId:   {Min: 1, Max: 5},
+	KeysCommandId:   {Min: 1, Max: 1},
+	DBSizeCommandId: {Min: 0, Max: 0},
+	// MGET key [key ...]
+	MGetCommandId: {Min: 1, Max: UnlimitedArgs},
+	// MSET key value [key value ...]
+	MSetCommandId:   {Min: 2, Max: UnlimitedArgs, Pairs: true},
+	MSetNXCommandId: {Min: 2, Max: UnlimitedArgs, Pairs: true},
+	// MDEL key [key ...]
+	MDelCommandId:   {Min: 1, Max: UnlimitedArgs},
+	GetSetCommandId: {Min: 2, Max: 2},
+	GetDelCommandId: {Min: 1, Max: 1},
+	// GETEX key [EX s|PX ms|EXAT s|PXAT ms|PERSIST]
+	GetExCommandId: {Min: 1, Max: 3},
+	TTLCommandId:   {Min: 1, Max: 1},
+	PTTLCommandId:  {Min: 1, Max: 1},
+	// EXISTS key [key ...]
+	ExistsCommandId: {Min: 1, Max: UnlimitedArgs},
+	RenameCommandId: {Min: 2, Max: 2},
+	// COPY src dst [REPLACE]
+	CopyCommandId:    {Min: 2, Max: 3},
+	TypeCommandId:    {Min: 1, Max: 1},
+	FlushDBCommandId: {Min: 0, Max: 0},
+	AppendCommandId:  {Min: 2, Max: 2},
+	StrLenCommandId:  {Min: 1, Max: 1},
+	// GETRANGE key start end, индексы включительно, отрицательные - от конца
+	GetRangeCommandId: {Min: 3, Max: 3},
+	// SETRANGE key offset value
+	SetRangeCommandId: {Min: 3, Max: 3},
+	// LPUSH key value [value ...]
+	LPushCommandId: {Min: 2, Max: UnlimitedArgs},
+	RPushCommandId: {Min: 2, Max: UnlimitedArgs},
+	// LPOP key [count]
+	LPopCommandId: {Min: 1, Max: 2},
+	RPopCommandId: {Min: 1, Max: 2},
+	LLenCommandId: {Min: 1, Max: 1},
+	// LRANGE key start stop, индексы как у GETRANGE
+	LRangeCommandId: {Min: 3, Max: 3},
+	LIndexCommandId: {Min: 2, Max: 2},
+	// LTRIM key start stop
+	LTrimCommandId: {Min: 3, Max: 3},
+	// LMOVE src dst LEFT|RIGHT LEFT|RIGHT
+	LMoveCommandId: {Min: 4, Max: 4},
+	// BLPOP key [key ...] timeout, timeout в секундах, 0 - ждать без ограничения
+	BLPopCommandId: {Min: 2, Max: UnlimitedArgs},
+	BRPopCommandId: {Min: 2, Max: UnlimitedArgs},
+	// BLMOVE src dst LEFT|RIGHT LEFT|RIGHT timeout
+	BLMoveCommandId: {Min: 5, Max: 5},
+	// HSET key field value [field value ...]
+	HSetCommandId: {Min: 3, Max: UnlimitedArgs, Pairs: true, PairsFrom: 1},
+	HGetCommandId: {Min: 2, Max: 2},
+	// HDEL key field [field ...]
+	HDelCommandId:    {Min: 2, Max: UnlimitedArgs},
+	HGetAllCommandId: {Min: 1, Max: 1},
+	HLenCommandId:    {Min: 1, Max: 1},
+	// HINCRBY key field increment
+	HIncrByCommandId: {Min: 3, Max: 3},
+	// HSCAN key cursor [MATCH pattern] [COUNT n]
+	HScanCommandId: {Min: 2, Max: 6},
+	// HEXPIRE key seconds field [field ...]
+	HExpireCommandId: {Min: 3, Max: UnlimitedArgs},
+	// HTTL key field
+	HTTLCommandId: {Min: 2, Max: 2},
+	// SADD key member [member ...]
+	SAddCommandId:      {Min: 2, Max: UnlimitedArgs},
+	SRemCommandId:      {Min: 2, Max: UnlimitedArgs},
+	SIsMemberCommandId: {Min: 2, Max: 2},
+	SMembersCommandId:  {Min: 1, Max: 1},
+	SCardCommandId:     {Min: 1, Max: 1},
+	// SINTER key [key ...]
+	SInterCommandId: {Min: 1, Max: UnlimitedArgs},
+	SUnionCommandId: {Min: 1, Max: UnlimitedArgs},
+	SDiffCommandId:  {Min: 1, Max: UnlimitedArgs},
+	// SINTERSTORE dst key [key ...]
+	SInterStoreCommandId: {Min: 2, Max: UnlimitedArgs},
+	SUnionStoreCommandId: {Min: 2, Max: UnlimitedArgs},
+	SDiffStoreCommandId:  {Min: 2, Max: UnlimitedArgs},
+	// SSCAN key cursor [MATCH pattern] [COUNT n]
+	SScanCommandId: {Min: 2, Max: 6},
+	// ZADD key [NX|XX] [GT|LT] [CH] score member [score member ...]
+	ZAddCommandId: {Min: 3, Max: UnlimitedArgs},
+	// ZINCRBY key increment member
+	ZIncrByCommandId: {Min: 3, Max: 3},
+	// ZREM key member [member ...]
+	ZRemCommandId:     {Min: 2, Max: UnlimitedArgs},
+	ZScoreCommandId:   {Min: 2, Max: 2},
+	ZCardCommandId:    {Min: 1, Max: 1},
+	ZRankCommandId:    {Min: 2, Max: 2},
+	ZRevRankCommandId: {Min: 2, Max: 2},
+	// ZRANGE key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+	ZRangeCommandId: {Min: 3, Max: 9},
+	// ZRANGESTORE dst src start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count]
+	ZRangeStoreCommandId: {Min: 4, Max: 9},
+	// ZPOPMIN key [count]
+	ZPopMinCommandId: {Min: 1, Max: 2},
+	ZPopMaxCommandId: {Min: 1, Max: 2},
+	// XADD key [MAXLEN n] id|* field value [field value ...]
+	XAddCommandId: {Min: 4, Max: UnlimitedArgs},
+	XLenCommandId: {Min: 1, Max: 1},
+	// XRANGE key start end [COUNT n]
+	XRangeCommandId: {Min: 3, Max: 5},
+	// XREAD [COUNT n] STREAMS key [key ...] id [id ...]
+	XReadCommandId: {Min: 3, Max: UnlimitedArgs},
+	// XGROUP CREATE key group id|$ [MKSTREAM], XGROUP DESTROY key group
+	XGroupCommandId: {Min: 3, Max: 5},
+	// XREADGROUP GROUP group consumer [COUNT n] [NOACK] STREAMS key [key ...] id [id ...]
+	XReadGroupCommandId: {Min: 6, Max: UnlimitedArgs},
+	// XACK key group id [id ...]
+	XAckCommandId: {Min: 3, Max: UnlimitedArgs},
+	// XPENDING key group [start end count [consumer]]
+	XPendingCommandId: {Min: 2, Max: 6},
+	// XCLAIM key group consumer min-idle-time id [id ...], min-idle-time в миллисекундах
+	XClaimCommandId: {Min: 5, Max: UnlimitedArgs},
+	// SUBSCRIBE channel [channel ...], PSUBSCRIBE pattern [pattern ...]
+	SubscribeCommandId:  {Min: 1, Max: UnlimitedArgs},
+	PSubscribeCommandId: {Min: 1, Max: UnlimitedArgs},
+	// UNSUBSCRIBE [channel ...], без аргументов - от всех каналов
+	UnsubscribeCommandId:  {Min: 0, Max: UnlimitedArgs},
+	PUnsubscribeCommandId: {Min: 0, Max: UnlimitedArgs},
+	// PUBLISH channel message
+	PublishCommandId: {Min: 2, Max: 2},
+	// CDC seq
+	CDCCommandId: {Min: 1, Max: 1},
+	// EXPORT file
+	ExportCommandId: {Min: 1, Max: 1},
+	// IMPORT file [REPLACE]
+	ImportCommandId: {Min: 1, Max: 2},
+	// DUMP key
+	DumpCommandId: {Min: 1, Max: 1},
+	// RESTORE key ttl payload [REPLACE], ttl в миллисекундах
+	RestoreCommandId: {Min: 3, Max: 4},
+	// MIGRATE host port key [key ...] [COPY] [REPLACE]
+	MigrateCommandId: {Min: 3, Max: UnlimitedArgs},
+	// AUTH [user] password
+	AuthCommandId: {Min: 1, Max: 2},
+	// ACL WHOAMI | LIST | SETUSER user [rule ...]
+	ACLCommandId: {Min: 1, Max: UnlimitedArgs},
+}
+
+// ArityOf - число аргументов команды, ok=false для неизвестной команды
+func ArityOf(id CommandId) (Arity, bool) {
+	arity, ok := commandArity[id]
+	return arity, ok
+}
+
+func (a Arity) check(n int) bool {
+	if n < a.Min || (a.Max != UnlimitedArgs && n > a.Max) {
+		return false
+	}
+
+	return !a.Pairs || (n-a.PairsFrom)%2 == 0
+}
+
+func (a Arity) String() string {
+	switch {
+	case a.Min == a.Max:
+		return fmt.Sprintf("%d", a.Min)
+	case a.Max == UnlimitedArgs && a.Pairs:
+		return fmt.Sprintf("[%d, ...) pairs", a.Min)
+	case a.Max == UnlimitedArgs:
+		return fmt.Sprintf("[%d, ...)", a.Min)
+	default:
+		return fmt.Sprintf("[%d, %d]", a.Min, a.Max)
+	}
+}
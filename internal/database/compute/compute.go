@@ -44,10 +44,9 @@ func (c *Compute) parseQuery(query string) (Query, error) {
 
 	commandId, args := CommandId(tokens[0]), tokens[1:]
 
-	switch commandId {
-	case GetCommandId, SetCommandId, DeleteCommandId:
-		return NewQuery(commandId, args), nil
-	default:
+	if _, ok := ArityOf(commandId); !ok {
 		return Query{}, ErrUnknownQuery
 	}
+
+	return NewQuery(commandId, args), nil
 }
@@ -57,7 +57,7 @@ func TestComputeParseQuery(t *testing.T) {
 		},
 		{
 			name:    "too many args for SET",
-			raw:     "SET bbb cccc dddd",
+			raw:     "SET bbb cccc NX GET EX 10 KEEPTTL",
 			wantErr: ErrQueryArgsCount,
 		},
 		{
@@ -65,6 +65,26 @@ func TestComputeParseQuery(t *testing.T) {
 			raw:  "SET bbb 123",
 			want: Query{id: SetCommandId, args: []string{"bbb", "123"}},
 		},
+		{
+			name:    "SET with NX and XX",
+			raw:     "SET bbb 123 NX XX",
+			wantErr: ErrInvalidQueryOption,
+		},
+		{
+			name:    "SET with two expire options",
+			raw:     "SET bbb 123 EX 10 KEEPTTL",
+			wantErr: ErrInvalidQueryOption,
+		},
+		{
+			name:    "SET with unknown option",
+			raw:     "SET bbb cccc dddd",
+			wantErr: ErrInvalidQueryOption,
+		},
+		{
+			name: "valid SET with options",
+			raw:  "SET lock owner1 NX GET PX 3000",
+			want: Query{id: SetCommandId, args: []string{"lock", "owner1", "NX", "GET", "PX", "3000"}},
+		},
 
 		// DELETE
 		{
@@ -77,6 +97,470 @@ func TestComputeParseQuery(t *testing.T) {
 			raw:  "DEL ccc",
 			want: Query{id: DeleteCommandId, args: []string{"ccc"}},
 		},
+
+		// RANGE
+		{
+			name:    "too less args for RANGE",
+			raw:     "RANGE a",
+			wantErr: ErrQueryArgsCount,
+		},
+		{
+			name:    "RANGE with unknown option",
+			raw:     "RANGE a b FAST",
+			wantErr: ErrInvalidQueryOption,
+		},
+		{
+			name:    "RANGE with invalid limit",
+			raw:     "RANGE a b LIMIT x",
+			wantErr: ErrInvalidQueryOption,
+		},
+		{
+			name: "valid RANGE with options",
+			raw:  "RANGE a b LIMIT 10 REV",
+			want: Query{id: RangeCommandId, args: []string{"a", "b", "LIMIT", "10", "REV"}},
+		},
+
+		// PREFIX
+		{
+			name:    "PREFIX without value for LIMIT",
+			raw:     "PREFIX user/42/ LIMIT",
+			wantErr: ErrInvalidQueryOption,
+		},
+		{
+			name: "valid PREFIX",
+			raw:  "PREFIX user/42/",
+			want: Query{id: PrefixCommandId, args: []string{"user/42/"}},
+		},
+
+		// SCAN, KEYS, DBSIZE
+		{
+			name:    "SCAN with invalid COUNT",
+			raw:     "SCAN 0 COUNT 0",
+			wantErr: ErrInvalidQueryOption,
+		},
+		{
+			name:    "SCAN with MATCH without pattern",
+			raw:     "SCAN 0 COUNT 10 MATCH",
+			wantErr: ErrInvalidQueryOption,
+		},
+		{
+			name: "valid SCAN with glob",
+			raw:  "SCAN 0 MATCH user/* COUNT 100",
+			want: Query{id: ScanCommandId, args: []string{"0", "MATCH", "user/*", "COUNT", "100"}},
+		},
+		{
+			name:    "KEYS without pattern",
+			raw:     "KEYS",
+			wantErr: ErrQueryArgsCount,
+		},
+		{
+			name:    "DBSIZE with args",
+			raw:     "DBSIZE a",
+			wantErr: ErrQueryArgsCount,
+		},
+		{
+			name: "valid DBSIZE",
+			raw:  "DBSIZE",
+			want: Query{id: DBSizeCommandId, args: []string{}},
+		},
+
+		// GETSET, GETDEL, GETEX, TTL
+		{
+			name:    "GETEX with PERSIST and value",
+			raw:     "GETEX a PERSIST 10",
+			wantErr: ErrInvalidQueryOption,
+		},
+		{
+			name:    "GETEX with negative EX",
+			raw:     "GETEX a EX 0",
+			wantErr: ErrInvalidQueryOption,
+		},
+		{
+			name: "valid GETEX",
+			raw:  "GETEX a EXAT 1700000000",
+			want: Query{id: GetExCommandId, args: []string{"a", "EXAT", "1700000000"}},
+		},
+		{
+			name:    "GETDEL with two keys",
+			raw:     "GETDEL a b",
+			wantErr: ErrQueryArgsCount,
+		},
+
+		// EXISTS, RENAME, COPY, TYPE, FLUSHDB
+		{
+			name: "valid EXISTS",
+			raw:  "EXISTS a b a",
+			want: Query{id: ExistsCommandId, args: []string{"a", "b", "a"}},
+		},
+		{
+			name:    "RENAME without destination",
+			raw:     "RENAME a",
+			wantErr: ErrQueryArgsCount,
+		},
+		{
+			name:    "COPY with unknown option",
+			raw:     "COPY a b FORCE",
+			wantErr: ErrInvalidQueryOption,
+		},
+		{
+			name: "valid COPY with REPLACE",
+			raw:  "COPY a b REPLACE",
+			want: Query{id: CopyCommandId, args: []string{"a", "b", "REPLACE"}},
+		},
+		{
+			name: "valid FLUSHDB",
+			raw:  "FLUSHDB",
+			want: Query{id: FlushDBCommandId, args: []string{}},
+		},
+
+		// APPEND, STRLEN, GETRANGE, SETRANGE
+		{
+			name: "valid GETRANGE with negative index",
+			raw:  "GETRANGE a 0 -1",
+			want: Query{id: GetRangeCommandId, args: []string{"a", "0", "-1"}},
+		},
+		{
+			name:    "GETRANGE with invalid index",
+			raw:     "GETRANGE a 0 end",
+			wantErr: ErrInvalidQueryArg,
+		},
+		{
+			name:    "SETRANGE with negative offset",
+			raw:     "SETRANGE a -1 b",
+			wantErr: ErrInvalidQueryArg,
+		},
+		{
+			name:    "SETRANGE with offset out of range",
+			raw:     "SETRANGE a 9223372036854775807 x",
+			wantErr: ErrInvalidQueryArg,
+		},
+		{
+			name: "valid SETRANGE",
+			raw:  "SETRANGE a 6 Redis",
+			want: Query{id: SetRangeCommandId, args: []string{"a", "6", "Redis"}},
+		},
+
+		// списки
+		{
+			name: "valid LPUSH",
+			raw:  "LPUSH jobs a b",
+			want: Query{id: LPushCommandId, args: []string{"jobs", "a", "b"}},
+		},
+		{
+			name:    "RPUSH without values",
+			raw:     "RPUSH jobs",
+			wantErr: ErrQueryArgsCount,
+		},
+		{
+			name: "valid LPOP with count",
+			raw:  "LPOP jobs 3",
+			want: Query{id: LPopCommandId, args: []string{"jobs", "3"}},
+		},
+		{
+			name:    "RPOP with zero count",
+			raw:     "RPOP jobs 0",
+			wantErr: ErrInvalidQueryArg,
+		},
+		{
+			name: "valid LRANGE",
+			raw:  "LRANGE jobs 0 -1",
+			want: Query{id: LRangeCommandId, args: []string{"jobs", "0", "-1"}},
+		},
+		{
+			name:    "LINDEX with invalid index",
+			raw:     "LINDEX jobs first",
+			wantErr: ErrInvalidQueryArg,
+		},
+		{
+			name: "valid BLPOP on several keys",
+			raw:  "BLPOP a b 5",
+			want: Query{id: BLPopCommandId, args: []string{"a", "b", "5"}},
+		},
+		{
+			name:    "BRPOP with negative timeout",
+			raw:     "BRPOP a -1",
+			wantErr: ErrInvalidQueryArg,
+		},
+		{
+			name: "valid BLMOVE",
+			raw:  "BLMOVE src dst LEFT RIGHT 0",
+			want: Query{id: BLMoveCommandId, args: []string{"src", "dst", "LEFT", "RIGHT", "0"}},
+		},
+		{
+			name:    "LMOVE with invalid side",
+			raw:     "LMOVE src dst LEFT UP",
+			wantErr: ErrInvalidQueryOption,
+		},
+
+		// хеши
+		{
+			name: "valid HSET",
+			raw:  "HSET user name bob age 42",
+			want: Query{id: HSetCommandId, args: []string{"user", "name", "bob", "age", "42"}},
+		},
+		{
+			name:    "HSET without value",
+			raw:     "HSET user name bob age",
+			wantErr: ErrQueryArgsCount,
+		},
+		{
+			name: "valid HINCRBY with negative increment",
+			raw:  "HINCRBY user visits -5",
+			want: Query{id: HIncrByCommandId, args: []string{"user", "visits", "-5"}},
+		},
+		{
+			name:    "HSCAN with invalid cursor",
+			raw:     "HSCAN user next",
+			wantErr: ErrInvalidQueryArg,
+		},
+		{
+			name: "valid HSCAN",
+			raw:  "HSCAN user 0 MATCH n* COUNT 5",
+			want: Query{id: HScanCommandId, args: []string{"user", "0", "MATCH", "n*", "COUNT", "5"}},
+		},
+		{
+			name:    "HEXPIRE with negative seconds",
+			raw:     "HEXPIRE user -1 name",
+			wantErr: ErrInvalidQueryArg,
+		},
+
+		// множества
+		{
+			name: "valid SADD",
+			raw:  "SADD tags go db",
+			want: Query{id: SAddCommandId, args: []string{"tags", "go", "db"}},
+		},
+		{
+			name:    "SDIFFSTORE without sources",
+			raw:     "SDIFFSTORE dst",
+			wantErr: ErrQueryArgsCount,
+		},
+		{
+			name:    "SSCAN with invalid count",
+			raw:     "SSCAN tags 0 COUNT 0",
+			wantErr: ErrInvalidQueryOption,
+		},
+
+		// сортированные множества
+		{
+			name: "valid ZADD with options",
+			raw:  "ZADD board XX CH 1.5 bob -inf alice",
+			want: Query{id: ZAddCommandId, args: []string{"board", "XX", "CH", "1.5", "bob", "-inf", "alice"}},
+		},
+		{
+			name:    "ZADD with GT and NX",
+			raw:     "ZADD board NX GT 1 bob",
+			wantErr: ErrInvalidQueryOption,
+		},
+		{
+			name:    "ZADD with invalid score",
+			raw:     "ZADD board one bob",
+			wantErr: ErrInvalidQueryArg,
+		},
+		{
+			name:    "ZADD without member",
+			raw:     "ZADD board 1 bob 2",
+			wantErr: ErrQueryArgsCount,
+		},
+		{
+			name: "valid ZRANGE BYSCORE",
+			raw:  "ZRANGE board (1 +inf BYSCORE LIMIT 0 10 WITHSCORES",
+			want: Query{id: ZRangeCommandId, args: []string{"board", "(1", "+inf", "BYSCORE", "LIMIT", "0", "10", "WITHSCORES"}},
+		},
+		{
+			name:    "ZRANGE with invalid lex bound",
+			raw:     "ZRANGE board a z BYLEX",
+			wantErr: ErrInvalidQueryArg,
+		},
+		{
+			name:    "ZRANGE by rank with LIMIT",
+			raw:     "ZRANGE board 0 -1 LIMIT 0 1",
+			wantErr: ErrInvalidQueryOption,
+		},
+		{
+			name:    "ZRANGESTORE with WITHSCORES",
+			raw:     "ZRANGESTORE dst board 0 -1 WITHSCORES",
+			wantErr: ErrInvalidQueryOption,
+		},
+
+		// потоки
+		{
+			name: "valid XADD with MAXLEN",
+			raw:  "XADD events MAXLEN 1000 * type signup",
+			want: Query{id: XAddCommandId, args: []string{"events", "MAXLEN", "1000", "*", "type", "signup"}},
+		},
+		{
+			name:    "XADD with invalid id",
+			raw:     "XADD events 1-x type signup",
+			wantErr: ErrInvalidQueryArg,
+		},
+		{
+			name:    "XADD without value",
+			raw:     "XADD events * type",
+			wantErr: ErrQueryArgsCount,
+		},
+		{
+			name: "valid XREADGROUP",
+			raw:  "XREADGROUP GROUP workers w1 COUNT 10 STREAMS events audit > 0",
+			want: Query{id: XReadGroupCommandId, args: []string{"GROUP", "workers", "w1", "COUNT", "10", "STREAMS", "events", "audit", ">", "0"}},
+		},
+		{
+			name:    "XREAD with > id",
+			raw:     "XREAD STREAMS events >",
+			wantErr: ErrInvalidQueryArg,
+		},
+		{
+			name:    "XREAD with unpaired keys",
+			raw:     "XREAD STREAMS events audit 0",
+			wantErr: ErrQueryArgsCount,
+		},
+		{
+			name:    "XGROUP with unknown subcommand",
+			raw:     "XGROUP SETID events workers 0",
+			wantErr: ErrInvalidQueryOption,
+		},
+		{
+			name:    "XPENDING with partial range",
+			raw:     "XPENDING events workers - +",
+			wantErr: ErrQueryArgsCount,
+		},
+
+		// pub/sub
+		{
+			name: "valid PSUBSCRIBE",
+			raw:  "PSUBSCRIBE news.* user.?",
+			want: Query{id: PSubscribeCommandId, args: []string{"news.*", "user.?"}},
+		},
+		{
+			name: "valid SUBSCRIBE to keyspace channel",
+			raw:  "SUBSCRIBE __keyspace@0__:user:1",
+			want: Query{id: SubscribeCommandId, args: []string{"__keyspace@0__:user:1"}},
+		},
+		{
+			name:    "SUBSCRIBE without channels",
+			raw:     "SUBSCRIBE",
+			wantErr: ErrQueryArgsCount,
+		},
+		{
+			name:    "PUBLISH without message",
+			raw:     "PUBLISH news",
+			wantErr: ErrQueryArgsCount,
+		},
+
+		// CDC
+		{
+			name: "valid CDC",
+			raw:  "CDC 42",
+			want: Query{id: CDCCommandId, args: []string{"42"}},
+		},
+		{
+			name:    "CDC with negative seq",
+			raw:     "CDC -1",
+			wantErr: ErrInvalidQueryArg,
+		},
+
+		// EXPORT, IMPORT
+		{
+			name: "valid EXPORT",
+			raw:  "EXPORT backup/keys.jsonl",
+			want: Query{id: ExportCommandId, args: []string{"backup/keys.jsonl"}},
+		},
+		{
+			name: "valid IMPORT with REPLACE",
+			raw:  "IMPORT keys.csv REPLACE",
+			want: Query{id: ImportCommandId, args: []string{"keys.csv", "REPLACE"}},
+		},
+		{
+			name:    "IMPORT with unknown option",
+			raw:     "IMPORT keys.csv FORCE",
+			wantErr: ErrInvalidQueryOption,
+		},
+
+		// DUMP, RESTORE, MIGRATE
+		{
+			name: "valid RESTORE with REPLACE",
+			raw:  "RESTORE user 0 AQAAbm9uZQ REPLACE",
+			want: Query{id: RestoreCommandId, args: []string{"user", "0", "AQAAbm9uZQ", "REPLACE"}},
+		},
+		{
+			name:    "RESTORE with negative ttl",
+			raw:     "RESTORE user -5 AQAAbm9uZQ",
+			wantErr: ErrInvalidQueryArg,
+		},
+		{
+			name: "valid MIGRATE with options",
+			raw:  "MIGRATE 10.0.0.2 3223 a b COPY REPLACE",
+			want: Query{id: MigrateCommandId, args: []string{"10.0.0.2", "3223", "a", "b", "COPY", "REPLACE"}},
+		},
+		{
+			name:    "MIGRATE with invalid port",
+			raw:     "MIGRATE 10.0.0.2 70000 a",
+			wantErr: ErrInvalidQueryArg,
+		},
+		{
+			name:    "MIGRATE without keys",
+			raw:     "MIGRATE 10.0.0.2 3223 COPY",
+			wantErr: ErrQueryArgsCount,
+		},
+
+		// AUTH, ACL
+		{
+			name: "valid AUTH with user",
+			raw:  "AUTH alice secret",
+			want: Query{id: AuthCommandId, args: []string{"alice", "secret"}},
+		},
+		{
+			name:    "AUTH without password",
+			raw:     "AUTH",
+			wantErr: ErrQueryArgsCount,
+		},
+		{
+			name: "valid ACL SETUSER",
+			raw:  "ACL SETUSER alice on >secret ~cache:* +@read -keys",
+			want: Query{id: ACLCommandId, args: []string{"SETUSER", "alice", "on", ">secret", "~cache:*", "+@read", "-keys"}},
+		},
+		{
+			name:    "ACL SETUSER without user",
+			raw:     "ACL SETUSER",
+			wantErr: ErrQueryArgsCount,
+		},
+		{
+			name:    "ACL WHOAMI with args",
+			raw:     "ACL WHOAMI alice",
+			wantErr: ErrQueryArgsCount,
+		},
+		{
+			name:    "ACL unknown subcommand",
+			raw:     "ACL DELUSER alice",
+			wantErr: ErrInvalidQueryOption,
+		},
+
+		// MGET, MSET, MSETNX, MDEL
+		{
+			name:    "MGET without keys",
+			raw:     "MGET",
+			wantErr: ErrQueryArgsCount,
+		},
+		{
+			name: "valid MGET",
+			raw:  "MGET a b c",
+			want: Query{id: MGetCommandId, args: []string{"a", "b", "c"}},
+		},
+		{
+			name:    "MSET with odd args",
+			raw:     "MSET a 1 b",
+			wantErr: ErrQueryArgsCount,
+		},
+		{
+			name: "valid MSETNX",
+			raw:  "MSETNX a 1 b 2",
+			want: Query{id: MSetNXCommandId, args: []string{"a", "1", "b", "2"}},
+		},
+		{
+			name: "valid MDEL",
+			raw:  "MDEL a b",
+			want: Query{id: MDelCommandId, args: []string{"a", "b"}},
+		},
 	}
 
 	for _, tt := range tests {
@@ -90,3 +574,123 @@ func TestComputeParseQuery(t *testing.T) {
 		})
 	}
 }
+
+func TestQueryRangeOptions(t *testing.T) {
+	query := NewQuery(RangeCommandId, []string{"a", "b", "REV", "LIMIT", "3"})
+	assert.Equal(t, RangeOptions{Limit: 3, Reverse: true}, query.RangeOptions())
+
+	query = NewQuery(PrefixCommandId, []string{"LIMIT"})
+	assert.Equal(t, RangeOptions{}, query.RangeOptions())
+}
+
+func TestRecord(t *testing.T) {
+	record := NewRecord(NewQuery(SetCommandId, []string{"a", "1"}), 1700000000000)
+	assert.Equal(t, "SET;a,1;1700000000000", record.String())
+
+	parsed, err := NewRecordFromString(record.String())
+	assert.NoError(t, err)
+	assert.Equal(t, record, parsed)
+
+	// записи без времени из WAL старого формата
+	parsed, err = NewRecordFromString("DEL;a")
+	assert.NoError(t, err)
+	assert.Equal(t, NewRecord(NewQuery(DeleteCommandId, []string{"a"}), 0), parsed)
+
+	parsed, err = NewRecordFromString("FLUSHDB;;1")
+	assert.NoError(t, err)
+	assert.Equal(t, NewRecord(NewQuery(FlushDBCommandId, []string{}), 1), parsed)
+
+	_, err = NewRecordFromString("SET;a,1;x")
+	assert.ErrorIs(t, err, ErrInvalidRecord)
+}
+
+func TestQueryPairs(t *testing.T) {
+	query := NewQuery(MSetCommandId, []string{"a", "1", "b", "2"})
+	assert.Equal(t, [][2]string{{"a", "1"}, {"b", "2"}}, query.Pairs())
+
+	query = NewQuery(HSetCommandId, []string{"user", "name", "bob", "age", "42"})
+	assert.Equal(t, [][2]string{{"name", "bob"}, {"age", "42"}}, query.Pairs())
+}
+
+func TestQuerySetOptions(t *testing.T) {
+	query := NewQuery(SetCommandId, []string{"a", "1"})
+	assert.Equal(t, SetOptions{}, query.SetOptions())
+
+	query = NewQuery(SetCommandId, []string{"a", "1", "XX", "GET", "EX", "2"})
+	assert.Equal(t, SetOptions{XX: true, Get: true, Expire: Expire{Mode: ExpireAfter, Millis: 2000}}, query.SetOptions())
+
+	query = NewQuery(GetExCommandId, []string{"a"})
+	assert.Equal(t, Expire{Mode: ExpireKeep}, query.GetExOptions())
+}
+
+func TestExpireResolve(t *testing.T) {
+	assert.Equal(t, int64(0), Expire{Mode: ExpireClear}.Resolve(100, 500))
+	assert.Equal(t, int64(500), Expire{Mode: ExpireKeep}.Resolve(100, 500))
+	assert.Equal(t, int64(150), Expire{Mode: ExpireAfter, Millis: 50}.Resolve(100, 500))
+	assert.Equal(t, int64(42), Expire{Mode: ExpireAtTime, Millis: 42}.Resolve(100, 500))
+}
+
+func TestQueryScanOptions(t *testing.T) {
+	query := NewQuery(ScanCommandId, []string{"0"})
+	assert.Equal(t, ScanOptions{Count: DefaultScanCount}, query.ScanOptions())
+
+	query = NewQuery(ScanCommandId, []string{"42", "COUNT", "5", "MATCH", "a*"})
+	assert.Equal(t, ScanOptions{Match: "a*", Count: 5}, query.ScanOptions())
+}
+
+func TestQueryMigrateOptions(t *testing.T) {
+	query := NewQuery(MigrateCommandId, []string{"host", "3223", "a", "COPY"})
+	assert.Equal(t, MigrateOptions{Host: "host", Port: "3223", Keys: []string{"a"}, Copy: true}, query.MigrateOptions())
+
+	query = NewQuery(RestoreCommandId, []string{"a", "1500", "payload"})
+	assert.Equal(t, RestoreOptions{TTL: 1500, Payload: "payload"}, query.RestoreOptions())
+}
+
+func TestQueryRedacted(t *testing.T) {
+	query := NewQuery(AuthCommandId, []string{"alice", "secret"})
+	assert.Equal(t, "AUTH;***", query.Redacted())
+	assert.Equal(t, "AUTH ***", Redact("AUTH alice secret\n"))
+
+	query = NewQuery(ACLCommandId, []string{"SETUSER", "alice", ">secret"})
+	assert.Equal(t, "ACL;SETUSER,alice,***", query.Redacted())
+	assert.Equal(t, "ACL SETUSER alice ***", Redact("ACL SETUSER alice >secret"))
+
+	query = NewQuery(GetCommandId, []string{"a"})
+	assert.Equal(t, "GET;a", query.Redacted())
+	assert.Equal(t, "GET a", Redact("GET a"))
+}
+
+func TestQueryKeys(t *testing.T) {
+	tests := []struct {
+		query Query
+		want  []string
+	}{
+		{query: NewQuery(GetCommandId, []string{"a"}), want: []string{"a"}},
+		{query: NewQuery(MSetCommandId, []string{"a", "1", "b", "2"}), want: []string{"a", "b"}},
+		{query: NewQuery(BLPopCommandId, []string{"a", "b", "0"}), want: []string{"a", "b"}},
+		{query: NewQuery(LMoveCommandId, []string{"src", "dst", "LEFT", "RIGHT"}), want: []string{"src", "dst"}},
+		{query: NewQuery(XReadGroupCommandId, []string{"GROUP", "g", "c", "STREAMS", "a", "b", ">", ">"}), want: []string{"a", "b"}},
+		{query: NewQuery(XGroupCommandId, []string{"CREATE", "events", "g", "$"}), want: []string{"events"}},
+		{query: NewQuery(MigrateCommandId, []string{"host", "3223", "a", "b", "REPLACE"}), want: []string{"a", "b"}},
+		{query: NewQuery(FlushDBCommandId, []string{}), want: nil},
+		{query: NewQuery(PublishCommandId, []string{"news", "hi"}), want: nil},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.query.Keys(), tt.query.String())
+	}
+}
+
+func TestChange(t *testing.T) {
+	change := NewChange(7, NewRecord(NewQuery(SetCommandId, []string{"a", "1", "PXAT", "1700000000000"}), 1690000000000))
+	assert.Equal(t, "change 7 1690000000000 SET a 1 PXAT 1700000000000", change.String())
+
+	parsed, err := ParseChange(change.String() + "\n")
+	require.NoError(t, err)
+	assert.Equal(t, change, parsed)
+	assert.Equal(t, SetCommandId, parsed.Op())
+	assert.Equal(t, "a", parsed.Key())
+
+	_, err = ParseChange("message news hello")
+	assert.ErrorIs(t, err, ErrInvalidRecord)
+}
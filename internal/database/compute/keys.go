@@ -0,0 +1,64 @@
+package compute
+
+// Keys - ключи, которые читает или меняет команда. У команд без ключей (DBSIZE, FLUSHDB, SCAN, pub/sub и т.п.)
+// пусто, команды по всем ключам отмечает AllKeys. Вызывать после Validate
+func (q *Query) Keys() []string {
+	switch q.id {
+	case DBSizeCommandId, FlushDBCommandId, KeysCommandId, ScanCommandId, RangeCommandId, PrefixCommandId,
+		SubscribeCommandId, PSubscribeCommandId, UnsubscribeCommandId, PUnsubscribeCommandId, PublishCommandId,
+		CDCCommandId, ExportCommandId, ImportCommandId, AuthCommandId, ACLCommandId:
+		return nil
+	case MGetCommandId, MDelCommandId, ExistsCommandId,
+		SInterCommandId, SUnionCommandId, SDiffCommandId,
+		SInterStoreCommandId, SUnionStoreCommandId, SDiffStoreCommandId:
+		return q.args
+	case MSetCommandId, MSetNXCommandId:
+		keys := make([]string, 0, len(q.args)/2)
+		for _, pair := range q.Pairs() {
+			keys = append(keys, pair[0])
+		}
+
+		return keys
+	case RenameCommandId, CopyCommandId, LMoveCommandId, BLMoveCommandId, ZRangeStoreCommandId:
+		return q.args[:2]
+	case BLPopCommandId, BRPopCommandId:
+		return q.BlockKeys()
+	case XReadCommandId, XReadGroupCommandId:
+		return q.XReadOptions().Keys
+	case XGroupCommandId:
+		return q.args[1:2]
+	case MigrateCommandId:
+		return q.MigrateOptions().Keys
+	}
+
+	if len(q.args) == 0 {
+		return nil
+	}
+
+	return q.args[:1]
+}
+
+// Channels - каналы pub/sub, на которые подписывается или в которые публикует команда. У PSUBSCRIBE это шаблоны.
+// Вызывать после Validate
+func (q *Query) Channels() []string {
+	switch q.id {
+	case SubscribeCommandId, PSubscribeCommandId:
+		return q.args
+	case PublishCommandId:
+		return q.args[:1]
+	}
+
+	return nil
+}
+
+// AllKeys - команда читает или меняет все ключи базы, а не перечисленные в аргументах.
+// ACL разрешает такие команды только пользователям с доступом ко всем ключам
+func (q *Query) AllKeys() bool {
+	switch q.id {
+	case KeysCommandId, ScanCommandId, RangeCommandId, PrefixCommandId,
+		FlushDBCommandId, CDCCommandId, ExportCommandId, ImportCommandId:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,473 @@
+package compute
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	LimitOption   = "LIMIT"
+	ReverseOption = "REV"
+	MatchOption   = "MATCH"
+	CountOption   = "COUNT"
+
+	DefaultScanCount = 10
+
+	NXOption      = "NX"
+	XXOption      = "XX"
+	GetOption     = "GET"
+	EXOption      = "EX"
+	PXOption      = "PX"
+	EXATOption    = "EXAT"
+	PXATOption    = "PXAT"
+	KeepTTLOption = "KEEPTTL"
+	PersistOption = "PERSIST"
+	ReplaceOption = "REPLACE"
+	CopyOption    = "COPY"
+	LeftOption    = "LEFT"
+	RightOption   = "RIGHT"
+
+	GTOption         = "GT"
+	LTOption         = "LT"
+	CHOption         = "CH"
+	ByScoreOption    = "BYSCORE"
+	ByLexOption      = "BYLEX"
+	WithScoresOption = "WITHSCORES"
+
+	ACLWhoAmI  = "WHOAMI"
+	ACLList    = "LIST"
+	ACLSetUser = "SETUSER"
+	// DefaultUser - пользователь соединений, которые не вызывали AUTH
+	DefaultUser = "default"
+)
+
+// ExpireMode - что сделать со сроком жизни ключа
+type ExpireMode int
+
+const (
+	// ExpireClear - снять срок жизни. Так работает SET без параметров срока
+	ExpireClear ExpireMode = iota
+	// ExpireKeep - оставить текущий срок жизни (SET ... KEEPTTL, GETEX без параметров)
+	ExpireKeep
+	// ExpireAfter - истечь через Millis миллисекунд (EX, PX)
+	ExpireAfter
+	// ExpireAtTime - истечь в момент Millis, unix ms (EXAT, PXAT)
+	ExpireAtTime
+)
+
+var (
+	ErrInvalidQueryOption = errors.New("query contains invalid option")
+)
+
+// RangeOptions - необязательные параметры обхода диапазона
+type RangeOptions struct {
+	Limit   int // 0 - без ограничения
+	Reverse bool
+}
+
+func parseRangeOptions(args []string) (RangeOptions, error) {
+	var opts RangeOptions
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case LimitOption:
+			if i+1 == len(args) {
+				return RangeOptions{}, fmt.Errorf("%w: %s without value", ErrInvalidQueryOption, LimitOption)
+			}
+
+			limit, err := strconv.Atoi(args[i+1])
+			if err != nil || limit < 0 {
+				return RangeOptions{}, fmt.Errorf("%w: %s %s", ErrInvalidQueryOption, LimitOption, args[i+1])
+			}
+
+			opts.Limit = limit
+			i++
+		case ReverseOption:
+			opts.Reverse = true
+		default:
+			return RangeOptions{}, fmt.Errorf("%w: %s", ErrInvalidQueryOption, args[i])
+		}
+	}
+
+	return opts, nil
+}
+
+// ScanOptions - необязательные параметры SCAN
+type ScanOptions struct {
+	Match string // пустой - без фильтра
+	Count int    // сколько ключей просмотреть за вызов, подсказка для движка
+}
+
+func parseScanOptions(args []string) (ScanOptions, error) {
+	opts := ScanOptions{Count: DefaultScanCount}
+
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return ScanOptions{}, fmt.Errorf("%w: %s without value", ErrInvalidQueryOption, args[i])
+		}
+
+		switch args[i] {
+		case MatchOption:
+			opts.Match = args[i+1]
+		case CountOption:
+			count, err := strconv.Atoi(args[i+1])
+			if err != nil || count <= 0 {
+				return ScanOptions{}, fmt.Errorf("%w: %s %s", ErrInvalidQueryOption, CountOption, args[i+1])
+			}
+
+			opts.Count = count
+		default:
+			return ScanOptions{}, fmt.Errorf("%w: %s", ErrInvalidQueryOption, args[i])
+		}
+	}
+
+	return opts, nil
+}
+
+// Expire - параметр срока жизни SET и GETEX
+type Expire struct {
+	Mode   ExpireMode
+	Millis int64
+}
+
+// Resolve - абсолютный срок жизни в unix ms для записи, у которой сейчас срок current. 0 - бессрочно
+func (e Expire) Resolve(now, current int64) int64 {
+	switch e.Mode {
+	case ExpireKeep:
+		return current
+	case ExpireAfter:
+		return now + e.Millis
+	case ExpireAtTime:
+		return e.Millis
+	default:
+		return 0
+	}
+}
+
+// SetOptions - необязательные параметры SET: [NX|XX] [GET] [EX s|PX ms|EXAT s|PXAT ms|KEEPTTL]
+type SetOptions struct {
+	NX     bool
+	XX     bool
+	Get    bool
+	Expire Expire
+}
+
+func parseSetOptions(args []string) (SetOptions, error) {
+	var (
+		opts      SetOptions
+		hasExpire bool
+	)
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case NXOption, XXOption:
+			if opts.NX || opts.XX {
+				return SetOptions{}, fmt.Errorf("%w: %s and %s are exclusive", ErrInvalidQueryOption, NXOption, XXOption)
+			}
+
+			opts.NX, opts.XX = args[i] == NXOption, args[i] == XXOption
+		case GetOption:
+			opts.Get = true
+		case KeepTTLOption, EXOption, PXOption, EXATOption, PXATOption:
+			if hasExpire {
+				return SetOptions{}, fmt.Errorf("%w: more than one expire option", ErrInvalidQueryOption)
+			}
+			hasExpire = true
+
+			if args[i] == KeepTTLOption {
+				opts.Expire = Expire{Mode: ExpireKeep}
+				continue
+			}
+
+			if i+1 == len(args) {
+				return SetOptions{}, fmt.Errorf("%w: %s without value", ErrInvalidQueryOption, args[i])
+			}
+
+			expire, err := parseExpire(args[i], args[i+1])
+			if err != nil {
+				return SetOptions{}, err
+			}
+
+			opts.Expire = expire
+			i++
+		default:
+			return SetOptions{}, fmt.Errorf("%w: %s", ErrInvalidQueryOption, args[i])
+		}
+	}
+
+	return opts, nil
+}
+
+// parseGetExOptions - GETEX key [EX s|PX ms|EXAT s|PXAT ms|PERSIST]. Без параметров срок не меняется
+func parseGetExOptions(args []string) (Expire, error) {
+	switch {
+	case len(args) == 0:
+		return Expire{Mode: ExpireKeep}, nil
+	case len(args) == 1 && args[0] == PersistOption:
+		return Expire{Mode: ExpireClear}, nil
+	case len(args) == 2:
+		return parseExpire(args[0], args[1])
+	default:
+		return Expire{}, fmt.Errorf("%w: %v", ErrInvalidQueryOption, args)
+	}
+}
+
+func parseExpire(option, value string) (Expire, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return Expire{}, fmt.Errorf("%w: %s %s", ErrInvalidQueryOption, option, value)
+	}
+
+	switch option {
+	case EXOption:
+		return Expire{Mode: ExpireAfter, Millis: n * 1000}, nil
+	case PXOption:
+		return Expire{Mode: ExpireAfter, Millis: n}, nil
+	case EXATOption:
+		return Expire{Mode: ExpireAtTime, Millis: n * 1000}, nil
+	case PXATOption:
+		return Expire{Mode: ExpireAtTime, Millis: n}, nil
+	default:
+		return Expire{}, fmt.Errorf("%w: %s", ErrInvalidQueryOption, option)
+	}
+}
+
+// ZAddOptions - необязательные параметры ZADD: [NX|XX] [GT|LT] [CH]
+type ZAddOptions struct {
+	NX bool
+	XX bool
+	// GT, LT - обновлять score, только если новый больше или меньше текущего. Новые элементы добавляются
+	GT bool
+	LT bool
+	// CH - вернуть число добавленных и измененных элементов, а не только добавленных
+	CH bool
+}
+
+// parseZAddOptions - параметры в начале args. Возвращает их и число аргументов, которые они заняли
+func parseZAddOptions(args []string) (ZAddOptions, int, error) {
+	var opts ZAddOptions
+
+	i := 0
+	for ; i < len(args); i++ {
+		switch args[i] {
+		case NXOption:
+			opts.NX = true
+		case XXOption:
+			opts.XX = true
+		case GTOption:
+			opts.GT = true
+		case LTOption:
+			opts.LT = true
+		case CHOption:
+			opts.CH = true
+		default:
+			if opts.NX && opts.XX {
+				return ZAddOptions{}, 0, fmt.Errorf("%w: %s and %s are exclusive", ErrInvalidQueryOption, NXOption, XXOption)
+			}
+
+			if (opts.GT && opts.LT) || (opts.NX && (opts.GT || opts.LT)) {
+				return ZAddOptions{}, 0, fmt.Errorf("%w: %s, %s and %s are exclusive", ErrInvalidQueryOption, GTOption, LTOption, NXOption)
+			}
+
+			return opts, i, nil
+		}
+	}
+
+	return ZAddOptions{}, 0, fmt.Errorf("%w: no score and member", ErrQueryArgsCount)
+}
+
+// ParseScore - score сортированного множества: число с плавающей точкой, "inf", "+inf" или "-inf"
+func ParseScore(s string) (float64, error) {
+	score, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, fmt.Errorf("%w: score %s", ErrInvalidQueryArg, s)
+	}
+
+	return score, nil
+}
+
+// FormatScore - запись score в ответе и в WAL, ParseScore читает ее обратно без потерь
+func FormatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	default:
+		return strconv.FormatFloat(score, 'g', -1, 64)
+	}
+}
+
+// ZRangeBy - по чему выбирается диапазон ZRANGE
+type ZRangeBy int
+
+const (
+	ZRangeByRank ZRangeBy = iota
+	ZRangeByScore
+	ZRangeByLex
+)
+
+// ZRangeOptions - необязательные параметры ZRANGE и ZRANGESTORE
+type ZRangeOptions struct {
+	By ZRangeBy
+	// Reverse - от больших к меньшим. Для BYSCORE и BYLEX границы тогда идут в порядке max min
+	Reverse bool
+	// Offset, Count - LIMIT offset count, только для BYSCORE и BYLEX. Count < 0 - без ограничения
+	Offset int
+	Count  int
+	// WithScores - вернуть элементы вместе со score, только для ZRANGE
+	WithScores bool
+}
+
+func parseZRangeOptions(args []string, store bool) (ZRangeOptions, error) {
+	opts := ZRangeOptions{Count: -1}
+
+	var hasLimit bool
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case ByScoreOption, ByLexOption:
+			if opts.By != ZRangeByRank {
+				return ZRangeOptions{}, fmt.Errorf("%w: %s and %s are exclusive", ErrInvalidQueryOption, ByScoreOption, ByLexOption)
+			}
+
+			opts.By = ZRangeByScore
+			if args[i] == ByLexOption {
+				opts.By = ZRangeByLex
+			}
+		case ReverseOption:
+			opts.Reverse = true
+		case LimitOption:
+			if i+2 >= len(args) {
+				return ZRangeOptions{}, fmt.Errorf("%w: %s without offset and count", ErrInvalidQueryOption, LimitOption)
+			}
+
+			offset, err := strconv.Atoi(args[i+1])
+			if err != nil || offset < 0 {
+				return ZRangeOptions{}, fmt.Errorf("%w: %s offset %s", ErrInvalidQueryOption, LimitOption, args[i+1])
+			}
+
+			count, err := strconv.Atoi(args[i+2])
+			if err != nil {
+				return ZRangeOptions{}, fmt.Errorf("%w: %s count %s", ErrInvalidQueryOption, LimitOption, args[i+2])
+			}
+
+			opts.Offset, opts.Count, hasLimit = offset, count, true
+			i += 2
+		case WithScoresOption:
+			if store {
+				return ZRangeOptions{}, fmt.Errorf("%w: %s", ErrInvalidQueryOption, args[i])
+			}
+
+			opts.WithScores = true
+		default:
+			return ZRangeOptions{}, fmt.Errorf("%w: %s", ErrInvalidQueryOption, args[i])
+		}
+	}
+
+	if hasLimit && opts.By == ZRangeByRank {
+		return ZRangeOptions{}, fmt.Errorf("%w: %s requires %s or %s", ErrInvalidQueryOption, LimitOption, ByScoreOption, ByLexOption)
+	}
+
+	return opts, nil
+}
+
+// ScoreBound - граница BYSCORE: "1.5" включительно, "(1.5" не включая, "-inf" и "+inf"
+type ScoreBound struct {
+	Value     float64
+	Exclusive bool
+}
+
+func parseScoreBound(s string) (ScoreBound, error) {
+	value, exclusive := strings.CutPrefix(s, "(")
+
+	score, err := ParseScore(value)
+	if err != nil {
+		return ScoreBound{}, err
+	}
+
+	return ScoreBound{Value: score, Exclusive: exclusive}, nil
+}
+
+// LexBound - граница BYLEX: "[a" включительно, "(a" не включая, "-" и "+" - меньше и больше любой строки
+type LexBound struct {
+	Value     string
+	Exclusive bool
+	// Inf - -1 для "-", 1 для "+", 0 - граница задана строкой Value
+	Inf int
+}
+
+func parseLexBound(s string) (LexBound, error) {
+	switch {
+	case s == "-":
+		return LexBound{Inf: -1}, nil
+	case s == "+":
+		return LexBound{Inf: 1}, nil
+	case strings.HasPrefix(s, "["):
+		return LexBound{Value: s[1:]}, nil
+	case strings.HasPrefix(s, "("):
+		return LexBound{Value: s[1:], Exclusive: true}, nil
+	default:
+		return LexBound{}, fmt.Errorf("%w: lex bound %s", ErrInvalidQueryArg, s)
+	}
+}
+
+// RestoreOptions - разобранные RESTORE key ttl payload [REPLACE]
+type RestoreOptions struct {
+	// TTL - срок жизни в миллисекундах, 0 - срок из payload
+	TTL     int64
+	Payload string
+	Replace bool
+}
+
+func parseRestoreOptions(args []string) (RestoreOptions, error) {
+	ttl, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || ttl < 0 {
+		return RestoreOptions{}, fmt.Errorf("%w: ttl %s", ErrInvalidQueryArg, args[1])
+	}
+
+	opts := RestoreOptions{TTL: ttl, Payload: args[2]}
+	if len(args) == 4 {
+		if args[3] != ReplaceOption {
+			return RestoreOptions{}, fmt.Errorf("%w: %s", ErrInvalidQueryOption, args[3])
+		}
+		opts.Replace = true
+	}
+
+	return opts, nil
+}
+
+// MigrateOptions - разобранные MIGRATE host port key [key ...] [COPY] [REPLACE]. Параметры стоят после ключей,
+// поэтому ключи с именами COPY и REPLACE последними перенести нельзя
+type MigrateOptions struct {
+	Host    string
+	Port    string
+	Keys    []string
+	Copy    bool
+	Replace bool
+}
+
+func parseMigrateOptions(args []string) (MigrateOptions, error) {
+	if port, err := strconv.Atoi(args[1]); err != nil || port <= 0 || port > math.MaxUint16 {
+		return MigrateOptions{}, fmt.Errorf("%w: port %s", ErrInvalidQueryArg, args[1])
+	}
+
+	opts := MigrateOptions{Host: args[0], Port: args[1]}
+	keys := args[2:]
+	for len(keys) > 0 {
+		switch keys[len(keys)-1] {
+		case CopyOption:
+			opts.Copy = true
+		case ReplaceOption:
+			opts.Replace = true
+		default:
+			opts.Keys = keys
+			return opts, nil
+		}
+		keys = keys[:len(keys)-1]
+	}
+
+	return MigrateOptions{}, fmt.Errorf("%w: no keys to migrate", ErrQueryArgsCount)
+}
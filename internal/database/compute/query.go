@@ -4,16 +4,36 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var (
 	ErrEmptyQuery      = errors.New("query is empty")
 	ErrInvalidQueryArg = errors.New("query contains invalid argument")
 	ErrQueryArgsCount  = errors.New("query contains invalid arguments count")
+	ErrInvalidRecord   = errors.New("invalid wal record")
 )
 
-var argRegex = regexp.MustCompile(`^[a-zA-Z0-9*/_]+$`)
+// argRegex - допустимые символы аргументов. "-" нужен для отрицательных индексов (GETRANGE key 0 -1),
+// "." и "+" - для score (ZADD key 1.5 m, +inf), "(" и "[" - для границ ZRANGE, "$" и ">" - для id потоков,
+// "?" - для шаблонов PSUBSCRIBE, ":" и "@" - для каналов уведомлений (__keyspace@0__:key), "~" - для шаблонов
+// ключей в правилах ACL
+var argRegex = regexp.MustCompile(`^[a-zA-Z0-9*?/_.+(\[$>:@~-]+$`)
+
+const (
+	// redacted - чем заменяются секреты в логах
+	redacted = "***"
+
+	// MaxStringSize - предельная длина строкового значения, которую можно получить через APPEND и SETRANGE
+	MaxStringSize = 512 << 20
+)
+
+// ValidArg - допустим ли аргумент в запросе и, значит, в записи WAL
+func ValidArg(arg string) bool {
+	return argRegex.MatchString(arg)
+}
 
 type Query struct {
 	id   CommandId
@@ -29,7 +49,10 @@ func NewQuery(id CommandId, args []string) Query {
 
 func NewQueryFromString(s string) Query {
 	data := strings.Split(s, ";")
-	key, args := data[0], strings.Split(data[1], ",")
+	key, args := data[0], []string{}
+	if len(data) > 1 && data[1] != "" {
+		args = strings.Split(data[1], ",")
+	}
 
 	return Query{
 		id:   CommandId(key),
@@ -38,24 +61,140 @@ func NewQueryFromString(s string) Query {
 }
 
 func (q *Query) Validate() error {
-	if q.id == GetCommandId && len(q.args) != GetCommandArgsCount {
-		return fmt.Errorf("%w: expected=%d, got=%d", ErrQueryArgsCount, 1, len(q.args))
+	arity, ok := ArityOf(q.id)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownQuery, q.id)
 	}
 
-	if q.id == SetCommandId && len(q.args) != SetCommandArgsCount {
-		return fmt.Errorf("%w: expected=%d, got=%d", ErrQueryArgsCount, 2, len(q.args))
-	}
-
-	if q.id == DeleteCommandId && len(q.args) != DeleteCommandArgsCount {
-		return fmt.Errorf("%w: expected=%d, got=%d", ErrQueryArgsCount, 1, len(q.args))
+	if !arity.check(len(q.args)) {
+		return fmt.Errorf("%w: expected=%s, got=%d", ErrQueryArgsCount, arity, len(q.args))
 	}
 
 	for _, arg := range q.args {
-		if !argRegex.MatchString(arg) {
+		if !ValidArg(arg) {
 			return ErrInvalidQueryArg
 		}
 	}
 
+	if q.id == RangeCommandId || q.id == PrefixCommandId {
+		if _, err := parseRangeOptions(q.rangeOptionArgs()); err != nil {
+			return err
+		}
+	}
+
+	if q.id == SetCommandId {
+		if _, err := parseSetOptions(q.setOptionArgs()); err != nil {
+			return err
+		}
+	}
+
+	if q.id == GetExCommandId {
+		if _, err := parseGetExOptions(q.args[1:]); err != nil {
+			return err
+		}
+	}
+
+	switch q.id {
+	case GetRangeCommandId, SetRangeCommandId, LRangeCommandId, LIndexCommandId, LTrimCommandId:
+		if err := q.validateRangeArgs(); err != nil {
+			return err
+		}
+	case LMoveCommandId, BLMoveCommandId:
+		for _, side := range q.args[2:4] {
+			if side != LeftOption && side != RightOption {
+				return fmt.Errorf("%w: %s", ErrInvalidQueryOption, side)
+			}
+		}
+	case LPopCommandId, RPopCommandId, ZPopMinCommandId, ZPopMaxCommandId:
+		if len(q.args) == 2 {
+			if count, err := strconv.Atoi(q.args[1]); err != nil || count <= 0 {
+				return fmt.Errorf("%w: count %s", ErrInvalidQueryArg, q.args[1])
+			}
+		}
+	}
+
+	if q.id == CopyCommandId && len(q.args) == 3 && q.args[2] != ReplaceOption {
+		return fmt.Errorf("%w: %s", ErrInvalidQueryOption, q.args[2])
+	}
+
+	if q.id == ImportCommandId && len(q.args) == 2 && q.args[1] != ReplaceOption {
+		return fmt.Errorf("%w: %s", ErrInvalidQueryOption, q.args[1])
+	}
+
+	if q.id == BLPopCommandId || q.id == BRPopCommandId || q.id == BLMoveCommandId {
+		if timeout, err := strconv.Atoi(q.args[len(q.args)-1]); err != nil || timeout < 0 {
+			return fmt.Errorf("%w: timeout %s", ErrInvalidQueryArg, q.args[len(q.args)-1])
+		}
+	}
+
+	if q.id == ScanCommandId || q.id == HScanCommandId || q.id == SScanCommandId {
+		if _, err := parseScanOptions(q.scanOptionArgs()); err != nil {
+			return err
+		}
+	}
+
+	if q.id == HScanCommandId || q.id == SScanCommandId {
+		if cursor, err := strconv.Atoi(q.args[1]); err != nil || cursor < 0 {
+			return fmt.Errorf("%w: cursor %s", ErrInvalidQueryArg, q.args[1])
+		}
+	}
+
+	if q.id == HIncrByCommandId {
+		if _, err := strconv.ParseInt(q.args[2], 10, 64); err != nil {
+			return fmt.Errorf("%w: increment %s", ErrInvalidQueryArg, q.args[2])
+		}
+	}
+
+	switch q.id {
+	case ZAddCommandId:
+		if err := q.validateZAddArgs(); err != nil {
+			return err
+		}
+	case ZIncrByCommandId:
+		if _, err := ParseScore(q.args[1]); err != nil {
+			return err
+		}
+	case ZRangeCommandId, ZRangeStoreCommandId:
+		if err := q.validateZRangeArgs(); err != nil {
+			return err
+		}
+	case XAddCommandId, XRangeCommandId, XReadCommandId, XGroupCommandId, XReadGroupCommandId,
+		XAckCommandId, XPendingCommandId, XClaimCommandId:
+		if err := q.validateStreamArgs(); err != nil {
+			return err
+		}
+	}
+
+	if q.id == HExpireCommandId {
+		if seconds, err := strconv.Atoi(q.args[1]); err != nil || seconds < 0 {
+			return fmt.Errorf("%w: seconds %s", ErrInvalidQueryArg, q.args[1])
+		}
+	}
+
+	if q.id == RestoreCommandId {
+		if _, err := parseRestoreOptions(q.args); err != nil {
+			return err
+		}
+	}
+
+	if q.id == MigrateCommandId {
+		if _, err := parseMigrateOptions(q.args); err != nil {
+			return err
+		}
+	}
+
+	if q.id == ACLCommandId {
+		if err := q.validateACLArgs(); err != nil {
+			return err
+		}
+	}
+
+	if q.id == CDCCommandId {
+		if _, err := strconv.ParseUint(q.args[0], 10, 64); err != nil {
+			return fmt.Errorf("%w: seq %s", ErrInvalidQueryArg, q.args[0])
+		}
+	}
+
 	return nil
 }
 
@@ -63,6 +202,31 @@ func (q *Query) String() string {
 	return fmt.Sprintf("%s;%s", q.id, strings.Join(q.args, ","))
 }
 
+// Redacted - String без секретов для логов: пароль AUTH и правила ACL SETUSER заменены на "***"
+func (q *Query) Redacted() string {
+	switch {
+	case q.id == AuthCommandId:
+		return fmt.Sprintf("%s;%s", q.id, redacted)
+	case q.id == ACLCommandId && len(q.args) > 2 && q.args[0] == ACLSetUser:
+		return fmt.Sprintf("%s;%s,%s,%s", q.id, q.args[0], q.args[1], redacted)
+	default:
+		return q.String()
+	}
+}
+
+// Redact - текст запроса без секретов для логов, как Redacted, но до разбора запроса
+func Redact(query string) string {
+	fields := strings.Fields(query)
+	switch {
+	case len(fields) > 1 && fields[0] == string(AuthCommandId):
+		return string(AuthCommandId) + " " + redacted
+	case len(fields) > 3 && fields[0] == string(ACLCommandId) && fields[1] == ACLSetUser:
+		return strings.Join(fields[:3], " ") + " " + redacted
+	default:
+		return query
+	}
+}
+
 func (q *Query) CommandId() CommandId {
 	return q.id
 }
@@ -78,3 +242,317 @@ func (q *Query) Value() string {
 func (q *Query) Args() []string {
 	return q.args
 }
+
+// Pairs - аргументы команд вида MSET key value [key value ...] и HSET key field value [field value ...], разбитые на пары
+func (q *Query) Pairs() [][2]string {
+	pairs := make([][2]string, 0, len(q.args)/2)
+	for i := commandArity[q.id].PairsFrom; i+1 < len(q.args); i += 2 {
+		pairs = append(pairs, [2]string{q.args[i], q.args[i+1]})
+	}
+
+	return pairs
+}
+
+// RangeOptions - необязательные параметры RANGE и PREFIX. Вызывать после Validate
+func (q *Query) RangeOptions() RangeOptions {
+	opts, _ := parseRangeOptions(q.rangeOptionArgs())
+	return opts
+}
+
+// rangeOptionArgs - аргументы после позиционных: RANGE start end ..., PREFIX prefix ...
+func (q *Query) rangeOptionArgs() []string {
+	return q.args[commandArity[q.id].Min:]
+}
+
+// ScanOptions - необязательные параметры SCAN. Вызывать после Validate
+func (q *Query) ScanOptions() ScanOptions {
+	opts, _ := parseScanOptions(q.scanOptionArgs())
+	return opts
+}
+
+// scanOptionArgs - аргументы после курсора: SCAN cursor ..., HSCAN и SSCAN key cursor ...
+func (q *Query) scanOptionArgs() []string {
+	return q.args[commandArity[q.id].Min:]
+}
+
+// SetOptions - необязательные параметры SET. Вызывать после Validate
+func (q *Query) SetOptions() SetOptions {
+	opts, _ := parseSetOptions(q.setOptionArgs())
+	return opts
+}
+
+// setOptionArgs - аргументы после key value
+func (q *Query) setOptionArgs() []string {
+	return q.args[commandArity[SetCommandId].Min:]
+}
+
+// GetExOptions - новый срок жизни GETEX. Вызывать после Validate
+func (q *Query) GetExOptions() Expire {
+	expire, _ := parseGetExOptions(q.args[1:])
+	return expire
+}
+
+// PopCount - число элементов LPOP/RPOP и ZPOPMIN/ZPOPMAX, по умолчанию 1
+func (q *Query) PopCount() int {
+	if len(q.args) < 2 {
+		return 1
+	}
+
+	return q.IntArg(1)
+}
+
+// MoveSides - откуда снимать и куда класть элемент в LMOVE и BLMOVE: LEFT или RIGHT
+func (q *Query) MoveSides() (string, string) {
+	return q.args[2], q.args[3]
+}
+
+// BlockKeys - ключи, на которых ждут BLPOP и BRPOP
+func (q *Query) BlockKeys() []string {
+	if q.id == BLMoveCommandId {
+		return q.args[:1]
+	}
+
+	return q.args[:len(q.args)-1]
+}
+
+// Blocking - команда может ждать данных сколько угодно: BLPOP, BRPOP, BLMOVE и лента CDC
+func (q *Query) Blocking() bool {
+	switch q.id {
+	case BLPopCommandId, BRPopCommandId, BLMoveCommandId, CDCCommandId:
+		return true
+	}
+
+	return false
+}
+
+// BlockTimeout - сколько ждать элемент в блокирующих командах, 0 - без ограничения
+func (q *Query) BlockTimeout() time.Duration {
+	return time.Duration(q.IntArg(len(q.args)-1)) * time.Second
+}
+
+// CDCFrom - с какой записи WAL начинать ленту CDC. Вызывать после Validate
+func (q *Query) CDCFrom() uint64 {
+	from, _ := strconv.ParseUint(q.args[0], 10, 64)
+	return from
+}
+
+// ImportReplace - IMPORT file REPLACE
+func (q *Query) ImportReplace() bool {
+	return q.id == ImportCommandId && len(q.args) == 2 && q.args[1] == ReplaceOption
+}
+
+// RestoreOptions - параметры RESTORE. Вызывать после Validate
+func (q *Query) RestoreOptions() RestoreOptions {
+	opts, _ := parseRestoreOptions(q.args)
+	return opts
+}
+
+// MigrateOptions - параметры MIGRATE. Вызывать после Validate
+func (q *Query) MigrateOptions() MigrateOptions {
+	opts, _ := parseMigrateOptions(q.args)
+	return opts
+}
+
+// validateACLArgs - ACL WHOAMI, ACL LIST без аргументов, ACL SETUSER с именем пользователя
+func (q *Query) validateACLArgs() error {
+	switch q.args[0] {
+	case ACLWhoAmI, ACLList:
+		if len(q.args) != 1 {
+			return fmt.Errorf("%w: ACL %s takes no arguments", ErrQueryArgsCount, q.args[0])
+		}
+	case ACLSetUser:
+		if len(q.args) < 2 {
+			return fmt.Errorf("%w: ACL SETUSER requires a user name", ErrQueryArgsCount)
+		}
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidQueryOption, q.args[0])
+	}
+
+	return nil
+}
+
+// AuthUser - пользователь и пароль AUTH, без имени пользователя - DefaultUser
+func (q *Query) AuthUser() (string, string) {
+	if len(q.args) == 1 {
+		return DefaultUser, q.args[0]
+	}
+
+	return q.args[0], q.args[1]
+}
+
+// CopyReplace - COPY src dst REPLACE
+func (q *Query) CopyReplace() bool {
+	return len(q.args) == 3 && q.args[2] == ReplaceOption
+}
+
+// validateRangeArgs - GETRANGE key start end, SETRANGE key offset value, LRANGE/LTRIM key start stop, LINDEX key index
+func (q *Query) validateRangeArgs() error {
+	if q.id == SetRangeCommandId {
+		offset, err := strconv.Atoi(q.args[1])
+		if err != nil || offset < 0 || offset > MaxStringSize {
+			return fmt.Errorf("%w: offset %s is out of range", ErrInvalidQueryArg, q.args[1])
+		}
+
+		return nil
+	}
+
+	for _, arg := range q.args[1:] {
+		if _, err := strconv.Atoi(arg); err != nil {
+			return fmt.Errorf("%w: index %s", ErrInvalidQueryArg, arg)
+		}
+	}
+
+	return nil
+}
+
+// validateZAddArgs - после параметров ZADD идут пары score member
+func (q *Query) validateZAddArgs() error {
+	_, n, err := parseZAddOptions(q.args[1:])
+	if err != nil {
+		return err
+	}
+
+	pairs := q.args[1+n:]
+	if len(pairs)%2 != 0 {
+		return fmt.Errorf("%w: score without member", ErrQueryArgsCount)
+	}
+
+	for i := 0; i < len(pairs); i += 2 {
+		if _, err := ParseScore(pairs[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateZRangeArgs - границы ZRANGE и ZRANGESTORE разбираются в зависимости от BYSCORE и BYLEX
+func (q *Query) validateZRangeArgs() error {
+	opts, err := parseZRangeOptions(q.zrangeOptionArgs(), q.id == ZRangeStoreCommandId)
+	if err != nil {
+		return err
+	}
+
+	for _, bound := range q.zrangeBounds() {
+		switch opts.By {
+		case ZRangeByScore:
+			_, err = parseScoreBound(bound)
+		case ZRangeByLex:
+			_, err = parseLexBound(bound)
+		default:
+			if _, atoiErr := strconv.Atoi(bound); atoiErr != nil {
+				err = fmt.Errorf("%w: index %s", ErrInvalidQueryArg, bound)
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ZAddOptions - необязательные параметры ZADD. Вызывать после Validate
+func (q *Query) ZAddOptions() ZAddOptions {
+	opts, _, _ := parseZAddOptions(q.args[1:])
+	return opts
+}
+
+// ScoreMember - элемент сортированного множества со score
+type ScoreMember struct {
+	Score  float64
+	Member string
+}
+
+// ZAddMembers - пары score member из ZADD в порядке запроса. Вызывать после Validate
+func (q *Query) ZAddMembers() []ScoreMember {
+	_, n, _ := parseZAddOptions(q.args[1:])
+
+	pairs := q.args[1+n:]
+	members := make([]ScoreMember, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		score, _ := ParseScore(pairs[i])
+		members = append(members, ScoreMember{Score: score, Member: pairs[i+1]})
+	}
+
+	return members
+}
+
+// ZRangeOptions - необязательные параметры ZRANGE и ZRANGESTORE. Вызывать после Validate
+func (q *Query) ZRangeOptions() ZRangeOptions {
+	opts, _ := parseZRangeOptions(q.zrangeOptionArgs(), q.id == ZRangeStoreCommandId)
+	return opts
+}
+
+// ZRangeSource - ключ, из которого читает ZRANGE или ZRANGESTORE
+func (q *Query) ZRangeSource() string {
+	if q.id == ZRangeStoreCommandId {
+		return q.args[1]
+	}
+
+	return q.args[0]
+}
+
+// RankRange - индексы start stop ZRANGE без BYSCORE и BYLEX
+func (q *Query) RankRange() (int, int) {
+	bounds := q.zrangeBounds()
+	start, _ := strconv.Atoi(bounds[0])
+	stop, _ := strconv.Atoi(bounds[1])
+
+	return start, stop
+}
+
+// ScoreRange - границы min max ZRANGE ... BYSCORE. С REV они записаны в запросе в обратном порядке
+func (q *Query) ScoreRange() (ScoreBound, ScoreBound) {
+	bounds := q.zrangeBounds()
+	first, _ := parseScoreBound(bounds[0])
+	second, _ := parseScoreBound(bounds[1])
+
+	if q.ZRangeOptions().Reverse {
+		return second, first
+	}
+
+	return first, second
+}
+
+// LexRange - границы min max ZRANGE ... BYLEX, с REV как у ScoreRange
+func (q *Query) LexRange() (LexBound, LexBound) {
+	bounds := q.zrangeBounds()
+	first, _ := parseLexBound(bounds[0])
+	second, _ := parseLexBound(bounds[1])
+
+	if q.ZRangeOptions().Reverse {
+		return second, first
+	}
+
+	return first, second
+}
+
+// zrangeBounds - start и stop: последние два позиционных аргумента ZRANGE и ZRANGESTORE
+func (q *Query) zrangeBounds() []string {
+	n := commandArity[q.id].Min
+	return q.args[n-2 : n]
+}
+
+func (q *Query) zrangeOptionArgs() []string {
+	return q.args[commandArity[q.id].Min:]
+}
+
+// FloatArg - i-й аргумент как score. Вызывать после Validate для аргументов, которые она проверяет
+func (q *Query) FloatArg(i int) float64 {
+	n, _ := ParseScore(q.args[i])
+	return n
+}
+
+// IntArg - i-й аргумент как число. Вызывать после Validate для аргументов, которые она проверяет
+func (q *Query) IntArg(i int) int {
+	n, _ := strconv.Atoi(q.args[i])
+	return n
+}
+
+// Int64Arg - i-й аргумент как int64. Вызывать после Validate для аргументов, которые она проверяет
+func (q *Query) Int64Arg(i int) int64 {
+	n, _ := strconv.ParseInt(q.args[i], 10, 64)
+	return n
+}
@@ -0,0 +1,45 @@
+package compute
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Record - запись WAL: изменение и время, в которое оно было применено.
+// Формат строки "CMD;arg1,arg2;timestamp", у записей старого формата времени нет
+type Record struct {
+	Query Query
+	// Timestamp - время применения в unix ms, 0 - неизвестно
+	Timestamp int64
+}
+
+func NewRecord(query Query, timestamp int64) Record {
+	return Record{
+		Query:     query,
+		Timestamp: timestamp,
+	}
+}
+
+func NewRecordFromString(s string) (Record, error) {
+	data := strings.Split(s, ";")
+	if len(data) < 2 || len(data) > 3 || data[0] == "" {
+		return Record{}, fmt.Errorf("%w: %q", ErrInvalidRecord, s)
+	}
+
+	record := Record{Query: NewQueryFromString(data[0] + ";" + data[1])}
+	if len(data) == 3 {
+		timestamp, err := strconv.ParseInt(data[2], 10, 64)
+		if err != nil {
+			return Record{}, fmt.Errorf("%w: %q", ErrInvalidRecord, s)
+		}
+
+		record.Timestamp = timestamp
+	}
+
+	return record, nil
+}
+
+func (r *Record) String() string {
+	return fmt.Sprintf("%s;%d", r.Query.String(), r.Timestamp)
+}
@@ -0,0 +1,369 @@
+package compute
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	MaxLenOption   = "MAXLEN"
+	StreamsOption  = "STREAMS"
+	GroupOption    = "GROUP"
+	NoAckOption    = "NOACK"
+	CreateOption   = "CREATE"
+	DestroyOption  = "DESTROY"
+	MkStreamOption = "MKSTREAM"
+
+	// AutoStreamID - XADD сам выбирает id записи
+	AutoStreamID = "*"
+	// LastStreamID - последний id потока: XREAD ... $ и XGROUP CREATE ... $
+	LastStreamID = "$"
+	// NewEntriesID - XREADGROUP ... > читает записи, еще не выданные группе
+	NewEntriesID = ">"
+)
+
+// StreamID - id записи потока: время добавления в unix ms и номер записи в пределах этой миллисекунды
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+// MaxStreamID - наибольший возможный id, граница "+" в XRANGE
+var MaxStreamID = StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+
+// ParseStreamID - "ms-seq" или "ms", у которого seq 0
+func ParseStreamID(s string) (StreamID, error) {
+	ms, seq, hasSeq := strings.Cut(s, "-")
+
+	var (
+		id  StreamID
+		err error
+	)
+	if id.Ms, err = strconv.ParseUint(ms, 10, 64); err != nil {
+		return StreamID{}, fmt.Errorf("%w: stream id %s", ErrInvalidQueryArg, s)
+	}
+
+	if hasSeq {
+		if id.Seq, err = strconv.ParseUint(seq, 10, 64); err != nil {
+			return StreamID{}, fmt.Errorf("%w: stream id %s", ErrInvalidQueryArg, s)
+		}
+	}
+
+	return id, nil
+}
+
+func (id StreamID) String() string {
+	return fmt.Sprintf("%d-%d", id.Ms, id.Seq)
+}
+
+func (id StreamID) Compare(other StreamID) int {
+	return cmp.Or(cmp.Compare(id.Ms, other.Ms), cmp.Compare(id.Seq, other.Seq))
+}
+
+// IsZero - id 0-0, меньше любой записи
+func (id StreamID) IsZero() bool {
+	return id == StreamID{}
+}
+
+// parseStreamBound - граница XRANGE и XPENDING: "-", "+", "ms-seq" или "ms". У end без seq берется
+// последний номер в этой миллисекунде
+func parseStreamBound(s string, end bool) (StreamID, error) {
+	switch s {
+	case "-":
+		return StreamID{}, nil
+	case "+":
+		return MaxStreamID, nil
+	}
+
+	id, err := ParseStreamID(s)
+	if err != nil {
+		return StreamID{}, err
+	}
+
+	if end && !strings.Contains(s, "-") {
+		id.Seq = math.MaxUint64
+	}
+
+	return id, nil
+}
+
+// XAddOptions - разобранный XADD key [MAXLEN n] id|* field value [field value ...]
+type XAddOptions struct {
+	MaxLen int // < 0 - без ограничения
+	// ID - id записи или AutoStreamID
+	ID     string
+	Fields [][2]string
+}
+
+func parseXAddOptions(args []string) (XAddOptions, error) {
+	opts := XAddOptions{MaxLen: -1}
+
+	if len(args) > 0 && args[0] == MaxLenOption {
+		if len(args) < 2 {
+			return XAddOptions{}, fmt.Errorf("%w: %s without value", ErrInvalidQueryOption, MaxLenOption)
+		}
+
+		maxLen, err := strconv.Atoi(args[1])
+		if err != nil || maxLen < 0 {
+			return XAddOptions{}, fmt.Errorf("%w: %s %s", ErrInvalidQueryOption, MaxLenOption, args[1])
+		}
+
+		opts.MaxLen, args = maxLen, args[2:]
+	}
+
+	if len(args) < 3 || len(args)%2 != 1 {
+		return XAddOptions{}, fmt.Errorf("%w: expected id and field value pairs", ErrQueryArgsCount)
+	}
+
+	opts.ID = args[0]
+	if opts.ID != AutoStreamID {
+		if _, err := ParseStreamID(opts.ID); err != nil {
+			return XAddOptions{}, err
+		}
+	}
+
+	for i := 1; i+1 < len(args); i += 2 {
+		opts.Fields = append(opts.Fields, [2]string{args[i], args[i+1]})
+	}
+
+	return opts, nil
+}
+
+// XReadOptions - разобранные XREAD [COUNT n] STREAMS key [key ...] id [id ...] и
+// XREADGROUP GROUP group consumer [COUNT n] [NOACK] STREAMS key [key ...] id [id ...]
+type XReadOptions struct {
+	Count    int // 0 - без ограничения
+	Group    string
+	Consumer string
+	NoAck    bool
+	Keys     []string
+	// IDs - после какого id читать каждый ключ: id, LastStreamID для XREAD или NewEntriesID для XREADGROUP
+	IDs []string
+}
+
+func parseXReadOptions(args []string, group bool) (XReadOptions, error) {
+	var opts XReadOptions
+
+	if group {
+		if len(args) < 3 || args[0] != GroupOption {
+			return XReadOptions{}, fmt.Errorf("%w: expected %s group consumer", ErrInvalidQueryOption, GroupOption)
+		}
+
+		opts.Group, opts.Consumer, args = args[1], args[2], args[3:]
+	}
+
+	for len(args) > 0 && args[0] != StreamsOption {
+		switch {
+		case args[0] == CountOption && len(args) > 1:
+			count, err := strconv.Atoi(args[1])
+			if err != nil || count <= 0 {
+				return XReadOptions{}, fmt.Errorf("%w: %s %s", ErrInvalidQueryOption, CountOption, args[1])
+			}
+
+			opts.Count, args = count, args[2:]
+		case args[0] == NoAckOption && group:
+			opts.NoAck, args = true, args[1:]
+		default:
+			return XReadOptions{}, fmt.Errorf("%w: %s", ErrInvalidQueryOption, args[0])
+		}
+	}
+
+	if len(args) == 0 {
+		return XReadOptions{}, fmt.Errorf("%w: %s is required", ErrInvalidQueryOption, StreamsOption)
+	}
+
+	streams := args[1:]
+	if len(streams) == 0 || len(streams)%2 != 0 {
+		return XReadOptions{}, fmt.Errorf("%w: expected the same number of keys and ids", ErrQueryArgsCount)
+	}
+
+	opts.Keys, opts.IDs = streams[:len(streams)/2], streams[len(streams)/2:]
+	for _, id := range opts.IDs {
+		if (!group && id == LastStreamID) || (group && id == NewEntriesID) {
+			continue
+		}
+
+		if _, err := ParseStreamID(id); err != nil {
+			return XReadOptions{}, err
+		}
+	}
+
+	return opts, nil
+}
+
+// XPendingRange - необязательная часть XPENDING key group [start end count [consumer]]
+type XPendingRange struct {
+	Start    StreamID
+	End      StreamID
+	Count    int
+	Consumer string // пустой - все потребители
+}
+
+// parseXPendingRange - ok=false, если диапазона нет и XPENDING возвращает сводку
+func parseXPendingRange(args []string) (XPendingRange, bool, error) {
+	switch len(args) {
+	case 0:
+		return XPendingRange{}, false, nil
+	case 3, 4:
+	default:
+		return XPendingRange{}, false, fmt.Errorf("%w: expected start end count [consumer]", ErrQueryArgsCount)
+	}
+
+	start, err := parseStreamBound(args[0], false)
+	if err != nil {
+		return XPendingRange{}, false, err
+	}
+
+	end, err := parseStreamBound(args[1], true)
+	if err != nil {
+		return XPendingRange{}, false, err
+	}
+
+	count, err := strconv.Atoi(args[2])
+	if err != nil || count <= 0 {
+		return XPendingRange{}, false, fmt.Errorf("%w: count %s", ErrInvalidQueryArg, args[2])
+	}
+
+	pending := XPendingRange{Start: start, End: end, Count: count}
+	if len(args) == 4 {
+		pending.Consumer = args[3]
+	}
+
+	return pending, true, nil
+}
+
+// validateStreamArgs - аргументы команд потоков, которые не проверяет Arity
+func (q *Query) validateStreamArgs() error {
+	switch q.id {
+	case XAddCommandId:
+		_, err := parseXAddOptions(q.args[1:])
+		return err
+	case XRangeCommandId:
+		if _, _, _, err := q.parseXRange(); err != nil {
+			return err
+		}
+	case XReadCommandId, XReadGroupCommandId:
+		_, err := parseXReadOptions(q.args, q.id == XReadGroupCommandId)
+		return err
+	case XGroupCommandId:
+		return q.validateXGroupArgs()
+	case XAckCommandId:
+		_, err := q.streamIDs(2)
+		return err
+	case XPendingCommandId:
+		_, _, err := parseXPendingRange(q.args[2:])
+		return err
+	case XClaimCommandId:
+		if idle, err := strconv.ParseInt(q.args[3], 10, 64); err != nil || idle < 0 {
+			return fmt.Errorf("%w: min-idle-time %s", ErrInvalidQueryArg, q.args[3])
+		}
+
+		_, err := q.streamIDs(4)
+		return err
+	}
+
+	return nil
+}
+
+// validateXGroupArgs - XGROUP CREATE key group id|$ [MKSTREAM] и XGROUP DESTROY key group
+func (q *Query) validateXGroupArgs() error {
+	switch q.args[0] {
+	case CreateOption:
+		if len(q.args) < 4 {
+			return fmt.Errorf("%w: expected %s key group id", ErrQueryArgsCount, CreateOption)
+		}
+
+		if len(q.args) == 5 && q.args[4] != MkStreamOption {
+			return fmt.Errorf("%w: %s", ErrInvalidQueryOption, q.args[4])
+		}
+
+		if q.args[3] != LastStreamID {
+			if _, err := ParseStreamID(q.args[3]); err != nil {
+				return err
+			}
+		}
+	case DestroyOption:
+		if len(q.args) != 3 {
+			return fmt.Errorf("%w: expected %s key group", ErrQueryArgsCount, DestroyOption)
+		}
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidQueryOption, q.args[0])
+	}
+
+	return nil
+}
+
+// XAddOptions - разобранный XADD. Вызывать после Validate
+func (q *Query) XAddOptions() XAddOptions {
+	opts, _ := parseXAddOptions(q.args[1:])
+	return opts
+}
+
+// XRange - границы и COUNT из XRANGE key start end [COUNT n], count 0 - без ограничения. Вызывать после Validate
+func (q *Query) XRange() (StreamID, StreamID, int) {
+	start, end, count, _ := q.parseXRange()
+	return start, end, count
+}
+
+func (q *Query) parseXRange() (StreamID, StreamID, int, error) {
+	start, err := parseStreamBound(q.args[1], false)
+	if err != nil {
+		return StreamID{}, StreamID{}, 0, err
+	}
+
+	end, err := parseStreamBound(q.args[2], true)
+	if err != nil {
+		return StreamID{}, StreamID{}, 0, err
+	}
+
+	if len(q.args) == 3 {
+		return start, end, 0, nil
+	}
+
+	if len(q.args) != 5 || q.args[3] != CountOption {
+		return StreamID{}, StreamID{}, 0, fmt.Errorf("%w: %v", ErrInvalidQueryOption, q.args[3:])
+	}
+
+	count, err := strconv.Atoi(q.args[4])
+	if err != nil || count <= 0 {
+		return StreamID{}, StreamID{}, 0, fmt.Errorf("%w: %s %s", ErrInvalidQueryOption, CountOption, q.args[4])
+	}
+
+	return start, end, count, nil
+}
+
+// XReadOptions - разобранные XREAD и XREADGROUP. Вызывать после Validate
+func (q *Query) XReadOptions() XReadOptions {
+	opts, _ := parseXReadOptions(q.args, q.id == XReadGroupCommandId)
+	return opts
+}
+
+// XPendingRange - диапазон XPENDING, ok=false для сводки. Вызывать после Validate
+func (q *Query) XPendingRange() (XPendingRange, bool) {
+	pending, ok, _ := parseXPendingRange(q.args[2:])
+	return pending, ok
+}
+
+// StreamIDs - id записей, начиная с аргумента from: XACK key group id ..., XCLAIM key group consumer min-idle id ...
+// Вызывать после Validate
+func (q *Query) StreamIDs(from int) []StreamID {
+	ids, _ := q.streamIDs(from)
+	return ids
+}
+
+func (q *Query) streamIDs(from int) ([]StreamID, error) {
+	ids := make([]StreamID, 0, len(q.args)-from)
+	for _, arg := range q.args[from:] {
+		id, err := ParseStreamID(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
@@ -4,14 +4,40 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/TimonKK/inmemory-db/internal/config"
+	"github.com/TimonKK/inmemory-db/internal/database/acl"
 	"github.com/TimonKK/inmemory-db/internal/database/compute"
+	"github.com/TimonKK/inmemory-db/internal/database/dataset"
+	"github.com/TimonKK/inmemory-db/internal/database/network"
+	"github.com/TimonKK/inmemory-db/internal/database/pubsub"
+	"github.com/TimonKK/inmemory-db/internal/database/storage"
 	"github.com/TimonKK/inmemory-db/internal/database/storage/engine"
 	"go.uber.org/zap"
 )
 
 var (
-	ErrUnknownQuery = errors.New("unknown query type")
+	ErrUnknownQuery   = errors.New("unknown query type")
+	ErrNoSession      = errors.New("subscriptions require a client connection")
+	ErrExportDisabled = errors.New("export directory is not configured")
+	ErrExportPath     = errors.New("export file must be a relative path inside the export directory")
+	ErrMigrate        = errors.New("migrate failed")
+	ErrAuthDisabled   = errors.New("AUTH called without any users configured")
+)
+
+const (
+	// importBatchSize - сколько ключей IMPORT записывает одной транзакцией и одной пачкой WAL
+	importBatchSize = 256
+	// migrateTimeout - сколько MIGRATE ждет подключения к серверу-получателю и ответа на каждый ключ
+	migrateTimeout = 5 * time.Second
 )
 
 // TODO вынести интерфейс Query куда-то
@@ -21,31 +47,130 @@ type Compute interface {
 
 type Storage interface {
 	Start(ctx context.Context) error
-	Set(context.Context, compute.Query) error
+	Set(context.Context, compute.Query) (storage.SetResult, error)
 	Get(context.Context, compute.Query) (string, error)
 	Delete(context.Context, compute.Query) error
+	Range(context.Context, compute.Query) ([]storage.KeyValue, error)
+	Prefix(context.Context, compute.Query) ([]storage.KeyValue, error)
+	Scan(context.Context, compute.Query) (string, []string, error)
+	Keys(context.Context, compute.Query) ([]string, error)
+	DBSize(context.Context) (int, error)
+	MGet(context.Context, compute.Query) ([]storage.KeyValue, error)
+	MSet(context.Context, compute.Query) error
+	MSetNX(context.Context, compute.Query) (bool, error)
+	MDel(context.Context, compute.Query) (int, error)
+	GetSet(context.Context, compute.Query) (string, error)
+	GetDel(context.Context, compute.Query) (string, error)
+	GetEx(context.Context, compute.Query) (string, error)
+	TTL(context.Context, compute.Query) (int64, error)
+	Exists(context.Context, compute.Query) (int, error)
+	Rename(context.Context, compute.Query) error
+	Copy(context.Context, compute.Query) (bool, error)
+	Type(context.Context, compute.Query) (string, error)
+	FlushDB(context.Context, compute.Query) error
+	Append(context.Context, compute.Query) (int, error)
+	StrLen(context.Context, compute.Query) (int, error)
+	GetRange(context.Context, compute.Query) (string, error)
+	SetRange(context.Context, compute.Query) (int, error)
+	Push(context.Context, compute.Query) (int, error)
+	Pop(context.Context, compute.Query) ([]string, error)
+	LLen(context.Context, compute.Query) (int, error)
+	LRange(context.Context, compute.Query) ([]string, error)
+	LIndex(context.Context, compute.Query) (string, error)
+	LTrim(context.Context, compute.Query) error
+	LMove(context.Context, compute.Query) (string, error)
+	BPop(context.Context, compute.Query) (storage.KeyValue, error)
+	BLMove(context.Context, compute.Query) (string, error)
+	HSet(context.Context, compute.Query) (int, error)
+	HGet(context.Context, compute.Query) (string, error)
+	HDel(context.Context, compute.Query) (int, error)
+	HGetAll(context.Context, compute.Query) ([]storage.KeyValue, error)
+	HLen(context.Context, compute.Query) (int, error)
+	HIncrBy(context.Context, compute.Query) (int64, error)
+	HScan(context.Context, compute.Query) (string, []storage.KeyValue, error)
+	HExpire(context.Context, compute.Query) (int, error)
+	HTTL(context.Context, compute.Query) (int64, error)
+	SAdd(context.Context, compute.Query) (int, error)
+	SRem(context.Context, compute.Query) (int, error)
+	SIsMember(context.Context, compute.Query) (bool, error)
+	SMembers(context.Context, compute.Query) ([]string, error)
+	SCard(context.Context, compute.Query) (int, error)
+	SetOp(context.Context, compute.Query) ([]string, error)
+	SetStore(context.Context, compute.Query) (int, error)
+	SScan(context.Context, compute.Query) (string, []string, error)
+	ZAdd(context.Context, compute.Query) (int, error)
+	ZIncrBy(context.Context, compute.Query) (float64, error)
+	ZRem(context.Context, compute.Query) (int, error)
+	ZScore(context.Context, compute.Query) (float64, error)
+	ZCard(context.Context, compute.Query) (int, error)
+	ZRank(context.Context, compute.Query) (int, error)
+	ZRange(context.Context, compute.Query) ([]compute.ScoreMember, error)
+	ZRangeStore(context.Context, compute.Query) (int, error)
+	ZPop(context.Context, compute.Query) ([]compute.ScoreMember, error)
+	XAdd(context.Context, compute.Query) (compute.StreamID, error)
+	XLen(context.Context, compute.Query) (int, error)
+	XRange(context.Context, compute.Query) ([]storage.StreamEntry, error)
+	XRead(context.Context, compute.Query) ([]storage.StreamRead, error)
+	XGroup(context.Context, compute.Query) (int, error)
+	XReadGroup(context.Context, compute.Query) ([]storage.StreamRead, error)
+	XAck(context.Context, compute.Query) (int, error)
+	XPending(context.Context, compute.Query) ([]storage.PendingEntry, error)
+	XClaim(context.Context, compute.Query) ([]storage.StreamEntry, error)
+	Changes(ctx context.Context, from uint64, fn func(compute.Change) error) error
+	Export(ctx context.Context, fn func(storage.KeyEntry) error) error
+	Import(ctx context.Context, entries []storage.KeyEntry, replace bool) (int, error)
+	Dump(context.Context, compute.Query) (string, error)
+	Restore(context.Context, compute.Query) error
+	DeleteUnchanged(ctx context.Context, dumps []storage.KeyDump) (int, error)
 }
 
 type Database struct {
 	compute Compute
 	storage Storage
+	broker  *pubsub.Broker
 	logger  *zap.Logger
+
+	// exportDir - каталог файлов EXPORT и IMPORT, пустой - команды выключены
+	exportDir string
+	// linkTLS - TLS исходящих соединений к другим серверам (MIGRATE)
+	linkTLS config.TLSConfig
+	// acl - пользователи и их права, nil - аутентификация выключена
+	acl *acl.ACL
+	// tlsUsers - клиент с проверенным TLS сертификатом входит пользователем из CommonName
+	tlsUsers bool
 }
 
-func NewDatabase(compute Compute, storage Storage, logger *zap.Logger) *Database {
+func NewDatabase(compute Compute, storage Storage, broker *pubsub.Broker, logger *zap.Logger) *Database {
 	return &Database{
 		compute: compute,
 		storage: storage,
+		broker:  broker,
 		logger:  logger,
 	}
 }
 
+// SetLinkTLS - TLS для соединений с другими серверами, обычно тот же, что у самого сервера
+func (db *Database) SetLinkTLS(tls config.TLSConfig) {
+	db.linkTLS = tls
+}
+
+// SetACL - включает аутентификацию и проверку прав. С tlsUsers клиент с проверенным TLS сертификатом
+// входит пользователем с именем из CommonName без AUTH
+func (db *Database) SetACL(users *acl.ACL, tlsUsers bool) {
+	db.acl, db.tlsUsers = users, tlsUsers
+}
+
+// SetExportDirectory - каталог, в котором EXPORT и IMPORT читают и пишут файлы
+func (db *Database) SetExportDirectory(dir string) {
+	db.exportDir = dir
+}
+
 func (db *Database) Start(ctx context.Context) error {
 	return db.storage.Start(ctx)
 }
 
 func (db *Database) ExecQuery(ctx context.Context, queryStr string) (result string, err error) {
-	db.logger.Debug("ExecQuery start", zap.String("query", queryStr))
+	db.logger.Debug("ExecQuery start", zap.String("query", compute.Redact(queryStr)))
 	defer db.logger.Debug("ExecQuery", zap.String("result", result))
 
 	query, err := db.compute.ParseQuery(queryStr)
@@ -53,7 +178,18 @@ func (db *Database) ExecQuery(ctx context.Context, queryStr string) (result stri
 		return "", err
 	}
 
-	db.logger.Info("ExecQuery parsed", zap.String("query", query.String()))
+	db.logger.Info("ExecQuery parsed", zap.String("query", query.Redacted()))
+
+	if err := db.authorize(ctx, query); err != nil {
+		return "", err
+	}
+
+	// ожидание данных не должно задерживать остановку сервера
+	if query.Blocking() {
+		var cancel context.CancelFunc
+		ctx, cancel = network.Interruptible(ctx)
+		defer cancel()
+	}
 
 	switch query.CommandId() {
 	case compute.GetCommandId:
@@ -62,37 +198,1274 @@ func (db *Database) ExecQuery(ctx context.Context, queryStr string) (result stri
 		return db.ExecSet(ctx, query)
 	case compute.DeleteCommandId:
 		return db.ExecDelete(ctx, query)
+	case compute.RangeCommandId:
+		return db.ExecRange(ctx, query)
+	case compute.PrefixCommandId:
+		return db.ExecPrefix(ctx, query)
+	case compute.ScanCommandId:
+		return db.ExecScan(ctx, query)
+	case compute.KeysCommandId:
+		return db.ExecKeys(ctx, query)
+	case compute.DBSizeCommandId:
+		return db.ExecDBSize(ctx)
+	case compute.MGetCommandId:
+		return db.ExecMGet(ctx, query)
+	case compute.MSetCommandId:
+		return db.ExecMSet(ctx, query)
+	case compute.MSetNXCommandId:
+		return db.ExecMSetNX(ctx, query)
+	case compute.MDelCommandId:
+		return db.ExecMDel(ctx, query)
+	case compute.GetSetCommandId:
+		return db.ExecGetSet(ctx, query)
+	case compute.GetDelCommandId:
+		return db.ExecGetDel(ctx, query)
+	case compute.GetExCommandId:
+		return db.ExecGetEx(ctx, query)
+	case compute.TTLCommandId, compute.PTTLCommandId:
+		return db.ExecTTL(ctx, query)
+	case compute.ExistsCommandId:
+		return db.ExecExists(ctx, query)
+	case compute.RenameCommandId:
+		return db.ExecRename(ctx, query)
+	case compute.CopyCommandId:
+		return db.ExecCopy(ctx, query)
+	case compute.TypeCommandId:
+		return db.ExecType(ctx, query)
+	case compute.FlushDBCommandId:
+		return db.ExecFlushDB(ctx, query)
+	case compute.AppendCommandId:
+		return db.ExecAppend(ctx, query)
+	case compute.StrLenCommandId:
+		return db.ExecStrLen(ctx, query)
+	case compute.GetRangeCommandId:
+		return db.ExecGetRange(ctx, query)
+	case compute.SetRangeCommandId:
+		return db.ExecSetRange(ctx, query)
+	case compute.LPushCommandId, compute.RPushCommandId:
+		return db.ExecPush(ctx, query)
+	case compute.LPopCommandId, compute.RPopCommandId:
+		return db.ExecPop(ctx, query)
+	case compute.LLenCommandId:
+		return db.ExecLLen(ctx, query)
+	case compute.LRangeCommandId:
+		return db.ExecLRange(ctx, query)
+	case compute.LIndexCommandId:
+		return db.ExecLIndex(ctx, query)
+	case compute.LTrimCommandId:
+		return db.ExecLTrim(ctx, query)
+	case compute.LMoveCommandId:
+		return db.ExecLMove(ctx, query)
+	case compute.BLPopCommandId, compute.BRPopCommandId:
+		return db.ExecBPop(ctx, query)
+	case compute.BLMoveCommandId:
+		return db.ExecBLMove(ctx, query)
+	case compute.HSetCommandId:
+		return db.ExecHSet(ctx, query)
+	case compute.HGetCommandId:
+		return db.ExecHGet(ctx, query)
+	case compute.HDelCommandId:
+		return db.ExecHDel(ctx, query)
+	case compute.HGetAllCommandId:
+		return db.ExecHGetAll(ctx, query)
+	case compute.HLenCommandId:
+		return db.ExecHLen(ctx, query)
+	case compute.HIncrByCommandId:
+		return db.ExecHIncrBy(ctx, query)
+	case compute.HScanCommandId:
+		return db.ExecHScan(ctx, query)
+	case compute.HExpireCommandId:
+		return db.ExecHExpire(ctx, query)
+	case compute.HTTLCommandId:
+		return db.ExecHTTL(ctx, query)
+	case compute.SAddCommandId:
+		return db.ExecSAdd(ctx, query)
+	case compute.SRemCommandId:
+		return db.ExecSRem(ctx, query)
+	case compute.SIsMemberCommandId:
+		return db.ExecSIsMember(ctx, query)
+	case compute.SMembersCommandId:
+		return db.ExecSMembers(ctx, query)
+	case compute.SCardCommandId:
+		return db.ExecSCard(ctx, query)
+	case compute.SInterCommandId, compute.SUnionCommandId, compute.SDiffCommandId:
+		return db.ExecSetOp(ctx, query)
+	case compute.SInterStoreCommandId, compute.SUnionStoreCommandId, compute.SDiffStoreCommandId:
+		return db.ExecSetStore(ctx, query)
+	case compute.SScanCommandId:
+		return db.ExecSScan(ctx, query)
+	case compute.ZAddCommandId:
+		return db.ExecZAdd(ctx, query)
+	case compute.ZIncrByCommandId:
+		return db.ExecZIncrBy(ctx, query)
+	case compute.ZRemCommandId:
+		return db.ExecZRem(ctx, query)
+	case compute.ZScoreCommandId:
+		return db.ExecZScore(ctx, query)
+	case compute.ZCardCommandId:
+		return db.ExecZCard(ctx, query)
+	case compute.ZRankCommandId, compute.ZRevRankCommandId:
+		return db.ExecZRank(ctx, query)
+	case compute.ZRangeCommandId:
+		return db.ExecZRange(ctx, query)
+	case compute.ZRangeStoreCommandId:
+		return db.ExecZRangeStore(ctx, query)
+	case compute.ZPopMinCommandId, compute.ZPopMaxCommandId:
+		return db.ExecZPop(ctx, query)
+	case compute.XAddCommandId:
+		return db.ExecXAdd(ctx, query)
+	case compute.XLenCommandId:
+		return db.ExecXLen(ctx, query)
+	case compute.XRangeCommandId:
+		return db.ExecXRange(ctx, query)
+	case compute.XReadCommandId:
+		return db.ExecXRead(ctx, query)
+	case compute.XGroupCommandId:
+		return db.ExecXGroup(ctx, query)
+	case compute.XReadGroupCommandId:
+		return db.ExecXReadGroup(ctx, query)
+	case compute.XAckCommandId:
+		return db.ExecXAck(ctx, query)
+	case compute.XPendingCommandId:
+		return db.ExecXPending(ctx, query)
+	case compute.XClaimCommandId:
+		return db.ExecXClaim(ctx, query)
+	case compute.SubscribeCommandId, compute.PSubscribeCommandId,
+		compute.UnsubscribeCommandId, compute.PUnsubscribeCommandId:
+		return db.ExecSubscribe(ctx, query)
+	case compute.PublishCommandId:
+		return db.ExecPublish(ctx, query)
+	case compute.CDCCommandId:
+		return db.ExecCDC(ctx, query)
+	case compute.ExportCommandId:
+		return db.ExecExport(ctx, query)
+	case compute.ImportCommandId:
+		return db.ExecImport(ctx, query)
+	case compute.DumpCommandId:
+		return db.ExecDump(ctx, query)
+	case compute.RestoreCommandId:
+		return db.ExecRestore(ctx, query)
+	case compute.MigrateCommandId:
+		return db.ExecMigrate(ctx, query)
+	case compute.AuthCommandId:
+		return db.ExecAuth(ctx, query)
+	case compute.ACLCommandId:
+		return db.ExecACL(ctx, query)
 	default:
 		return "", fmt.Errorf("%w: %s", ErrUnknownQuery, queryStr)
 	}
 }
 
 func (db *Database) ExecGet(ctx context.Context, query compute.Query) (string, error) {
-	value, err := db.storage.Get(ctx, query)
+	return formatValue(db.storage.Get(ctx, query))
+}
+
+// ExecSet - "ok" после записи. Если не выполнилось условие NX/XX - "not set".
+// С GET вместо этого возвращается прежнее значение
+func (db *Database) ExecSet(ctx context.Context, query compute.Query) (string, error) {
+	result, err := db.storage.Set(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	if query.SetOptions().Get {
+		if !result.Found {
+			return "no data", nil
+		}
+
+		return formatValue(result.Old, nil)
+	}
+
+	if !result.Written {
+		return "not set", nil
+	}
+
+	return "ok", nil
+}
+
+func (db *Database) ExecGetSet(ctx context.Context, query compute.Query) (string, error) {
+	return formatValue(db.storage.GetSet(ctx, query))
+}
+
+func (db *Database) ExecGetDel(ctx context.Context, query compute.Query) (string, error) {
+	return formatValue(db.storage.GetDel(ctx, query))
+}
+
+func (db *Database) ExecGetEx(ctx context.Context, query compute.Query) (string, error) {
+	return formatValue(db.storage.GetEx(ctx, query))
+}
+
+// ExecTTL - "result: N" в секундах для TTL и в миллисекундах для PTTL, -1 - бессрочный ключ
+func (db *Database) ExecTTL(ctx context.Context, query compute.Query) (string, error) {
+	ttl, err := db.storage.TTL(ctx, query)
+	if err != nil || query.CommandId() == compute.TTLCommandId {
+		return formatTTL(ttl, err)
+	}
+
+	return fmt.Sprintf("result: %d", ttl), nil
+}
+
+// formatTTL - срок жизни из миллисекунд в секундах с округлением, "no data" для отсутствующего ключа
+func formatTTL(ttl int64, err error) (string, error) {
 	if errors.Is(err, engine.ErrKeyNotFound) {
 		return "no data", nil
 	}
 
-	if value == "" {
-		return "empty", nil
+	if err != nil {
+		return "", err
 	}
 
-	return fmt.Sprintf("result: %s", value), nil
+	if ttl > 0 {
+		ttl = (ttl + 500) / 1000
+	}
+
+	return fmt.Sprintf("result: %d", ttl), nil
+}
+func (db *Database) ExecDelete(ctx context.Context, query compute.Query) (string, error) {
+	err := db.storage.Delete(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return "ok", nil
 }
 
-func (db *Database) ExecSet(ctx context.Context, query compute.Query) (string, error) {
-	err := db.storage.Set(ctx, query)
+func (db *Database) ExecRange(ctx context.Context, query compute.Query) (string, error) {
+	pairs, err := db.storage.Range(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return formatKeyValues(pairs), nil
+}
+
+func (db *Database) ExecPrefix(ctx context.Context, query compute.Query) (string, error) {
+	pairs, err := db.storage.Prefix(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return formatKeyValues(pairs), nil
+}
+
+// ExecScan - ответ "result: <следующий курсор> k1 k2 ..."
+func (db *Database) ExecScan(ctx context.Context, query compute.Query) (string, error) {
+	cursor, keys, err := db.storage.Scan(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("result: %s", strings.Join(append([]string{cursor}, keys...), " ")), nil
+}
+
+func (db *Database) ExecKeys(ctx context.Context, query compute.Query) (string, error) {
+	keys, err := db.storage.Keys(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	if len(keys) == 0 {
+		return "no data", nil
+	}
+
+	return fmt.Sprintf("result: %s", strings.Join(keys, " ")), nil
+}
+
+func (db *Database) ExecDBSize(ctx context.Context) (string, error) {
+	size, err := db.storage.DBSize(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("result: %d", size), nil
+}
+
+// ExecMGet - найденные ключи в порядке запроса: "result: k1=v1 k3=v3"
+func (db *Database) ExecMGet(ctx context.Context, query compute.Query) (string, error) {
+	pairs, err := db.storage.MGet(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return formatKeyValues(pairs), nil
+}
+
+func (db *Database) ExecMSet(ctx context.Context, query compute.Query) (string, error) {
+	err := db.storage.MSet(ctx, query)
 	if err != nil {
 		return "", err
 	}
 
 	return "ok", nil
 }
-func (db *Database) ExecDelete(ctx context.Context, query compute.Query) (string, error) {
-	err := db.storage.Delete(ctx, query)
+
+// ExecMSetNX - "result: 1", если ключи записаны, и "result: 0", если хотя бы один уже был
+func (db *Database) ExecMSetNX(ctx context.Context, query compute.Query) (string, error) {
+	written, err := db.storage.MSetNX(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	if !written {
+		return "result: 0", nil
+	}
+
+	return "result: 1", nil
+}
+
+// ExecMDel - "result: N", где N - число удаленных ключей
+func (db *Database) ExecMDel(ctx context.Context, query compute.Query) (string, error) {
+	deleted, err := db.storage.MDel(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("result: %d", deleted), nil
+}
+
+// ExecExists - "result: N", где N - число существующих ключей из запроса
+func (db *Database) ExecExists(ctx context.Context, query compute.Query) (string, error) {
+	count, err := db.storage.Exists(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("result: %d", count), nil
+}
+
+func (db *Database) ExecRename(ctx context.Context, query compute.Query) (string, error) {
+	err := db.storage.Rename(ctx, query)
+	if errors.Is(err, engine.ErrKeyNotFound) {
+		return "no data", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return "ok", nil
+}
+
+// ExecCopy - "result: 1", если ключ скопирован, "result: 0", если исходного ключа нет или dst занят без REPLACE
+func (db *Database) ExecCopy(ctx context.Context, query compute.Query) (string, error) {
+	copied, err := db.storage.Copy(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	if !copied {
+		return "result: 0", nil
+	}
+
+	return "result: 1", nil
+}
+
+// ExecType - "result: string" или "result: none" для отсутствующего ключа
+func (db *Database) ExecType(ctx context.Context, query compute.Query) (string, error) {
+	valueType, err := db.storage.Type(ctx, query)
+	if errors.Is(err, engine.ErrKeyNotFound) {
+		return "result: none", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("result: %s", valueType), nil
+}
+
+func (db *Database) ExecFlushDB(ctx context.Context, query compute.Query) (string, error) {
+	err := db.storage.FlushDB(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return "ok", nil
+}
+
+// ExecAppend - "result: N", где N - новая длина строки
+func (db *Database) ExecAppend(ctx context.Context, query compute.Query) (string, error) {
+	return formatInt(db.storage.Append(ctx, query))
+}
+
+func (db *Database) ExecStrLen(ctx context.Context, query compute.Query) (string, error) {
+	return formatInt(db.storage.StrLen(ctx, query))
+}
+
+// ExecSetRange - "result: N", где N - новая длина строки
+func (db *Database) ExecSetRange(ctx context.Context, query compute.Query) (string, error) {
+	return formatInt(db.storage.SetRange(ctx, query))
+}
+
+// ExecGetRange - подстрока, "empty" для пустого результата и отсутствующего ключа
+func (db *Database) ExecGetRange(ctx context.Context, query compute.Query) (string, error) {
+	return formatValue(db.storage.GetRange(ctx, query))
+}
+
+// ExecPush - "result: N", где N - длина списка после LPUSH/RPUSH
+func (db *Database) ExecPush(ctx context.Context, query compute.Query) (string, error) {
+	return formatInt(db.storage.Push(ctx, query))
+}
+
+// ExecPop - снятые элементы "result: v1 v2" или "no data", если списка нет
+func (db *Database) ExecPop(ctx context.Context, query compute.Query) (string, error) {
+	values, err := db.storage.Pop(ctx, query)
+	if errors.Is(err, engine.ErrKeyNotFound) {
+		return "no data", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return formatValues(values), nil
+}
+
+func (db *Database) ExecLLen(ctx context.Context, query compute.Query) (string, error) {
+	return formatInt(db.storage.LLen(ctx, query))
+}
+
+// ExecLRange - элементы по порядку "result: v1 v2", "no data" для пустого диапазона и отсутствующего ключа
+func (db *Database) ExecLRange(ctx context.Context, query compute.Query) (string, error) {
+	values, err := db.storage.LRange(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return formatValues(values), nil
+}
+
+func (db *Database) ExecLIndex(ctx context.Context, query compute.Query) (string, error) {
+	return formatValue(db.storage.LIndex(ctx, query))
+}
+
+func (db *Database) ExecLTrim(ctx context.Context, query compute.Query) (string, error) {
+	err := db.storage.LTrim(ctx, query)
 	if err != nil {
 		return "", err
 	}
 
 	return "ok", nil
 }
+
+// ExecLMove - переложенный элемент или "no data", если исходного списка нет
+func (db *Database) ExecLMove(ctx context.Context, query compute.Query) (string, error) {
+	return formatValue(db.storage.LMove(ctx, query))
+}
+
+// ExecBPop - "result: key=value" со списком, из которого снят элемент, или "no data" по таймауту.
+// Запрос блокирует соединение, пока элемент не появится
+func (db *Database) ExecBPop(ctx context.Context, query compute.Query) (string, error) {
+	pair, err := db.storage.BPop(ctx, query)
+	if errors.Is(err, engine.ErrKeyNotFound) {
+		return "no data", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return formatKeyValues([]storage.KeyValue{pair}), nil
+}
+
+// ExecBLMove - переложенный элемент или "no data" по таймауту
+func (db *Database) ExecBLMove(ctx context.Context, query compute.Query) (string, error) {
+	return formatValue(db.storage.BLMove(ctx, query))
+}
+
+// ExecHSet - "result: N", где N - число новых полей
+func (db *Database) ExecHSet(ctx context.Context, query compute.Query) (string, error) {
+	return formatInt(db.storage.HSet(ctx, query))
+}
+
+func (db *Database) ExecHGet(ctx context.Context, query compute.Query) (string, error) {
+	return formatValue(db.storage.HGet(ctx, query))
+}
+
+// ExecHDel - "result: N", где N - число удаленных полей
+func (db *Database) ExecHDel(ctx context.Context, query compute.Query) (string, error) {
+	return formatInt(db.storage.HDel(ctx, query))
+}
+
+func (db *Database) ExecHLen(ctx context.Context, query compute.Query) (string, error) {
+	return formatInt(db.storage.HLen(ctx, query))
+}
+
+// ExecHExpire - "result: N", где N - число полей, которым поставлен срок жизни
+func (db *Database) ExecHExpire(ctx context.Context, query compute.Query) (string, error) {
+	return formatInt(db.storage.HExpire(ctx, query))
+}
+
+// ExecHTTL - срок жизни поля в секундах, -1 - бессрочное поле, "no data" - нет ключа или поля
+func (db *Database) ExecHTTL(ctx context.Context, query compute.Query) (string, error) {
+	return formatTTL(db.storage.HTTL(ctx, query))
+}
+
+// ExecHGetAll - поля по порядку имен "result: f1=v1 f2=v2"
+func (db *Database) ExecHGetAll(ctx context.Context, query compute.Query) (string, error) {
+	pairs, err := db.storage.HGetAll(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return formatKeyValues(pairs), nil
+}
+
+// ExecHIncrBy - "result: N", где N - новое значение поля
+func (db *Database) ExecHIncrBy(ctx context.Context, query compute.Query) (string, error) {
+	value, err := db.storage.HIncrBy(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("result: %d", value), nil
+}
+
+// ExecHScan - ответ "result: <следующий курсор> f1=v1 f2=v2"
+func (db *Database) ExecHScan(ctx context.Context, query compute.Query) (string, error) {
+	cursor, pairs, err := db.storage.HScan(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	parts := []string{cursor}
+	for _, pair := range pairs {
+		parts = append(parts, pair.Key+"="+pair.Value)
+	}
+
+	return fmt.Sprintf("result: %s", strings.Join(parts, " ")), nil
+}
+
+// ExecSAdd - "result: N", где N - число новых элементов
+func (db *Database) ExecSAdd(ctx context.Context, query compute.Query) (string, error) {
+	return formatInt(db.storage.SAdd(ctx, query))
+}
+
+// ExecSRem - "result: N", где N - число удаленных элементов
+func (db *Database) ExecSRem(ctx context.Context, query compute.Query) (string, error) {
+	return formatInt(db.storage.SRem(ctx, query))
+}
+
+// ExecSIsMember - "result: 1", если элемент есть в множестве, иначе "result: 0"
+func (db *Database) ExecSIsMember(ctx context.Context, query compute.Query) (string, error) {
+	found, err := db.storage.SIsMember(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	if !found {
+		return "result: 0", nil
+	}
+
+	return "result: 1", nil
+}
+
+func (db *Database) ExecSMembers(ctx context.Context, query compute.Query) (string, error) {
+	members, err := db.storage.SMembers(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return formatValues(members), nil
+}
+
+func (db *Database) ExecSCard(ctx context.Context, query compute.Query) (string, error) {
+	return formatInt(db.storage.SCard(ctx, query))
+}
+
+// ExecSetOp - результат SINTER, SUNION или SDIFF "result: m1 m2", "no data" для пустого результата
+func (db *Database) ExecSetOp(ctx context.Context, query compute.Query) (string, error) {
+	members, err := db.storage.SetOp(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return formatValues(members), nil
+}
+
+// ExecSetStore - "result: N", где N - размер записанного множества
+func (db *Database) ExecSetStore(ctx context.Context, query compute.Query) (string, error) {
+	return formatInt(db.storage.SetStore(ctx, query))
+}
+
+// ExecSScan - ответ "result: <следующий курсор> m1 m2"
+func (db *Database) ExecSScan(ctx context.Context, query compute.Query) (string, error) {
+	cursor, members, err := db.storage.SScan(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("result: %s", strings.Join(append([]string{cursor}, members...), " ")), nil
+}
+
+// ExecZAdd - "result: N", где N - число добавленных элементов, с CH - добавленных и измененных
+func (db *Database) ExecZAdd(ctx context.Context, query compute.Query) (string, error) {
+	return formatInt(db.storage.ZAdd(ctx, query))
+}
+
+// ExecZIncrBy - новый score элемента
+func (db *Database) ExecZIncrBy(ctx context.Context, query compute.Query) (string, error) {
+	score, err := db.storage.ZIncrBy(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("result: %s", compute.FormatScore(score)), nil
+}
+
+func (db *Database) ExecZRem(ctx context.Context, query compute.Query) (string, error) {
+	return formatInt(db.storage.ZRem(ctx, query))
+}
+
+// ExecZScore - score элемента, "no data" если нет ключа или элемента
+func (db *Database) ExecZScore(ctx context.Context, query compute.Query) (string, error) {
+	score, err := db.storage.ZScore(ctx, query)
+	return formatValue(compute.FormatScore(score), err)
+}
+
+func (db *Database) ExecZCard(ctx context.Context, query compute.Query) (string, error) {
+	return formatInt(db.storage.ZCard(ctx, query))
+}
+
+// ExecZRank - позиция элемента с нуля для ZRANK и ZREVRANK, "no data" если нет ключа или элемента
+func (db *Database) ExecZRank(ctx context.Context, query compute.Query) (string, error) {
+	rank, err := db.storage.ZRank(ctx, query)
+	return formatValue(strconv.Itoa(rank), err)
+}
+
+// ExecZRange - "result: m1 m2", с WITHSCORES - "result: m1=s1 m2=s2"
+func (db *Database) ExecZRange(ctx context.Context, query compute.Query) (string, error) {
+	members, err := db.storage.ZRange(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	if query.ZRangeOptions().WithScores {
+		return formatScoreMembers(members), nil
+	}
+
+	values := make([]string, 0, len(members))
+	for _, m := range members {
+		values = append(values, m.Member)
+	}
+
+	return formatValues(values), nil
+}
+
+// ExecZRangeStore - "result: N", где N - размер записанного множества
+func (db *Database) ExecZRangeStore(ctx context.Context, query compute.Query) (string, error) {
+	return formatInt(db.storage.ZRangeStore(ctx, query))
+}
+
+// ExecZPop - снятые элементы со score "result: m1=s1 m2=s2"
+func (db *Database) ExecZPop(ctx context.Context, query compute.Query) (string, error) {
+	members, err := db.storage.ZPop(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return formatScoreMembers(members), nil
+}
+
+// ExecXAdd - id добавленной записи
+func (db *Database) ExecXAdd(ctx context.Context, query compute.Query) (string, error) {
+	id, err := db.storage.XAdd(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("result: %s", id), nil
+}
+
+func (db *Database) ExecXLen(ctx context.Context, query compute.Query) (string, error) {
+	return formatInt(db.storage.XLen(ctx, query))
+}
+
+// ExecXRange - записи "result: id1 f1=v1 f2=v2, id2 f1=v1"
+func (db *Database) ExecXRange(ctx context.Context, query compute.Query) (string, error) {
+	entries, err := db.storage.XRange(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return formatStreamEntries(entries), nil
+}
+
+// ExecXRead - записи по ключам "result: key1: id1 f=v, id2 f=v; key2: id3 f=v"
+func (db *Database) ExecXRead(ctx context.Context, query compute.Query) (string, error) {
+	reads, err := db.storage.XRead(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return formatStreamReads(reads), nil
+}
+
+// ExecXGroup - "ok" для XGROUP CREATE, число удаленных групп для XGROUP DESTROY
+func (db *Database) ExecXGroup(ctx context.Context, query compute.Query) (string, error) {
+	n, err := db.storage.XGroup(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	if query.Args()[0] == compute.CreateOption {
+		return "ok", nil
+	}
+
+	return formatInt(n, nil)
+}
+
+// ExecXReadGroup - выданные потребителю записи в формате XREAD
+func (db *Database) ExecXReadGroup(ctx context.Context, query compute.Query) (string, error) {
+	reads, err := db.storage.XReadGroup(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return formatStreamReads(reads), nil
+}
+
+// ExecXAck - "result: N", где N - число подтвержденных записей
+func (db *Database) ExecXAck(ctx context.Context, query compute.Query) (string, error) {
+	return formatInt(db.storage.XAck(ctx, query))
+}
+
+// ExecXPending - сводка "result: <число> <min id> <max id> consumer1=N consumer2=M" или, с диапазоном,
+// записи "result: id1 consumer idle=ms deliveries=N, id2 ..."
+func (db *Database) ExecXPending(ctx context.Context, query compute.Query) (string, error) {
+	pending, err := db.storage.XPending(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	if _, ok := query.XPendingRange(); ok {
+		if len(pending) == 0 {
+			return "no data", nil
+		}
+
+		now := storage.NowMillis()
+		parts := make([]string, 0, len(pending))
+		for _, p := range pending {
+			parts = append(parts, fmt.Sprintf("%s %s idle=%d deliveries=%d", p.ID, p.Consumer, p.Idle(now), p.Deliveries))
+		}
+
+		return fmt.Sprintf("result: %s", strings.Join(parts, ", ")), nil
+	}
+
+	if len(pending) == 0 {
+		return "result: 0", nil
+	}
+
+	var consumers []string
+	counts := make(map[string]int)
+	for _, p := range pending {
+		if counts[p.Consumer] == 0 {
+			consumers = append(consumers, p.Consumer)
+		}
+		counts[p.Consumer]++
+	}
+	slices.Sort(consumers)
+
+	parts := []string{strconv.Itoa(len(pending)), pending[0].ID.String(), pending[len(pending)-1].ID.String()}
+	for _, consumer := range consumers {
+		parts = append(parts, fmt.Sprintf("%s=%d", consumer, counts[consumer]))
+	}
+
+	return fmt.Sprintf("result: %s", strings.Join(parts, " ")), nil
+}
+
+// ExecXClaim - переданные потребителю записи в формате XRANGE
+func (db *Database) ExecXClaim(ctx context.Context, query compute.Query) (string, error) {
+	entries, err := db.storage.XClaim(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return formatStreamEntries(entries), nil
+}
+
+// ExecSubscribe - SUBSCRIBE, PSUBSCRIBE, UNSUBSCRIBE и PUNSUBSCRIBE. Отвечает числом подписок соединения.
+// Пока подписки есть, соединение в push mode и получает сообщения каналов без запроса
+func (db *Database) ExecSubscribe(ctx context.Context, query compute.Query) (string, error) {
+	session, ok := network.SessionFromContext(ctx)
+	if !ok {
+		return "", ErrNoSession
+	}
+
+	var n int
+	switch query.CommandId() {
+	case compute.SubscribeCommandId:
+		session.SetPushMode(true)
+		n = db.broker.Subscribe(session, query.Args()...)
+	case compute.PSubscribeCommandId:
+		session.SetPushMode(true)
+		n = db.broker.PSubscribe(session, query.Args()...)
+	case compute.UnsubscribeCommandId:
+		n = db.broker.Unsubscribe(session, query.Args()...)
+	case compute.PUnsubscribeCommandId:
+		n = db.broker.PUnsubscribe(session, query.Args()...)
+	}
+
+	if n == 0 {
+		session.SetPushMode(false)
+	}
+
+	return formatInt(n, nil)
+}
+
+// ExecPublish - PUBLISH channel message, отвечает числом получателей
+func (db *Database) ExecPublish(_ context.Context, query compute.Query) (string, error) {
+	return formatInt(db.broker.Publish(query.Key(), query.Value()), nil)
+}
+
+// ExecCDC - CDC seq, пишет в соединение изменения из WAL начиная с записи seq, по строке "change ..."
+// на изменение. Ответа нет: команда занимает соединение, пока клиент его не закроет.
+// Медленный клиент тормозит только чтение WAL, изменения не копятся в памяти сервера
+func (db *Database) ExecCDC(ctx context.Context, query compute.Query) (string, error) {
+	session, ok := network.SessionFromContext(ctx)
+	if !ok {
+		return "", ErrNoSession
+	}
+
+	err := db.storage.Changes(ctx, query.CDCFrom(), func(change compute.Change) error {
+		return session.Write(change.String())
+	})
+
+	return "", err
+}
+
+// ExecExport - EXPORT file, выгружает все ключи в файл каталога выгрузок, "result: N" - число ключей
+func (db *Database) ExecExport(ctx context.Context, query compute.Query) (string, error) {
+	return formatInt(db.Export(ctx, query.Key()))
+}
+
+// Export - выгружает все ключи в файл name каталога выгрузок и возвращает их число. Файл пишется во временный
+// и переименовывается в конце, поэтому недописанной выгрузки не бывает
+func (db *Database) Export(ctx context.Context, name string) (int, error) {
+	file, err := db.exportPath(name)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return 0, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		// после переименования временного файла уже нет
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	writer := dataset.NewWriter(tmp, dataset.FormatOf(file))
+	n := 0
+	err = db.storage.Export(ctx, func(entry storage.KeyEntry) error {
+		record, err := dataset.Encode(entry, storage.NowMillis())
+		if err != nil {
+			return err
+		}
+
+		n++
+		return writer.Write(record)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := writer.Flush(); err != nil {
+		return 0, err
+	}
+	if err := tmp.Sync(); err != nil {
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// ExecImport - IMPORT file [REPLACE], загружает ключи из файла каталога выгрузок пачками по importBatchSize.
+// Без REPLACE существующие ключи остаются как есть. "result: N" - число записанных ключей.
+// При ошибке уже записанные пачки остаются в базе
+func (db *Database) ExecImport(ctx context.Context, query compute.Query) (string, error) {
+	file, err := db.exportPath(query.Key())
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	reader := dataset.NewReader(f, dataset.FormatOf(file))
+	replace := query.ImportReplace()
+
+	imported := 0
+	batch := make([]storage.KeyEntry, 0, importBatchSize)
+	for {
+		record, err := reader.Read()
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+
+		if err == nil {
+			entry, err := record.Decode()
+			if err != nil {
+				return "", err
+			}
+
+			batch = append(batch, entry)
+			if len(batch) < importBatchSize {
+				continue
+			}
+		}
+
+		if len(batch) > 0 {
+			n, importErr := db.storage.Import(ctx, batch, replace)
+			imported += n
+			if importErr != nil {
+				return "", importErr
+			}
+		}
+
+		if err != nil {
+			db.logger.Info("ExecImport: done", zap.String("file", file), zap.Int("keys", imported))
+			return formatInt(imported, nil)
+		}
+
+		batch = batch[:0]
+	}
+}
+
+// ExecDump - payload ключа для RESTORE или "no data", если ключа нет
+func (db *Database) ExecDump(ctx context.Context, query compute.Query) (string, error) {
+	return formatValue(db.storage.Dump(ctx, query))
+}
+
+// ExecRestore - "ok" после записи ключа из payload DUMP
+func (db *Database) ExecRestore(ctx context.Context, query compute.Query) (string, error) {
+	if err := db.storage.Restore(ctx, query); err != nil {
+		return "", err
+	}
+
+	return "ok", nil
+}
+
+// ExecMigrate - MIGRATE host port key [key ...] [COPY] [REPLACE], переносит ключи на другой сервер командами RESTORE.
+// "ok" - только после того, как получатель записал все ключи; без COPY они затем удаляются здесь.
+// Ключ, измененный во время переноса, остается на обоих серверах. "no data", если ни одного ключа нет.
+// При ошибке уже перенесенные ключи тоже удаляются, остальные остаются здесь
+func (db *Database) ExecMigrate(ctx context.Context, query compute.Query) (string, error) {
+	opts := query.MigrateOptions()
+
+	dumps := make([]storage.KeyDump, 0, len(opts.Keys))
+	for _, key := range opts.Keys {
+		payload, err := db.storage.Dump(ctx, compute.NewQuery(compute.DumpCommandId, []string{key}))
+		if errors.Is(err, engine.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		dumps = append(dumps, storage.KeyDump{Key: key, Payload: payload})
+	}
+
+	if len(dumps) == 0 {
+		return "no data", nil
+	}
+
+	address := net.JoinHostPort(opts.Host, opts.Port)
+	client, err := network.NewTCPClient(&config.ClientNetworkConfig{
+		Address:     address,
+		DialTimeout: migrateTimeout,
+		TLS:         db.linkTLS,
+	}, db.logger)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrMigrate, err)
+	}
+	defer func() { _ = client.Close() }()
+
+	// отмена запроса прерывает ожидание ответа получателя
+	stop := context.AfterFunc(ctx, func() { _ = client.SetDeadline(time.Now()) })
+	defer stop()
+
+	moved := 0
+	for _, dump := range dumps {
+		if err = db.restoreRemote(client, dump, opts.Replace); err != nil {
+			err = fmt.Errorf("%w: %s: %w", ErrMigrate, dump.Key, err)
+			break
+		}
+		moved++
+	}
+
+	if !opts.Copy && moved > 0 {
+		deleted, deleteErr := db.storage.DeleteUnchanged(ctx, dumps[:moved])
+		if deleteErr != nil {
+			return "", errors.Join(err, deleteErr)
+		}
+
+		if deleted < moved {
+			db.logger.Warn("ExecMigrate: keys changed during migration were kept",
+				zap.String("address", address), zap.Int("kept", moved-deleted))
+		}
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return "ok", nil
+}
+
+// restoreRemote - RESTORE ключа на сервере-получателе. Ошибка команды, например BUSYKEY, приходит ответом
+// "error: <msg>" и возвращается с текстом получателя
+func (db *Database) restoreRemote(client *network.TCPClient, dump storage.KeyDump, replace bool) error {
+	restore := []string{string(compute.RestoreCommandId), dump.Key, "0", dump.Payload}
+	if replace {
+		restore = append(restore, compute.ReplaceOption)
+	}
+
+	if err := client.SetDeadline(time.Now().Add(migrateTimeout)); err != nil {
+		return err
+	}
+
+	response, err := client.Send(strings.Join(restore, " "))
+	if err != nil {
+		return err
+	}
+
+	response = strings.TrimSpace(response)
+	if message, ok := strings.CutPrefix(response, network.ErrorResponsePrefix); ok {
+		return errors.New(message)
+	}
+
+	if response != "ok" {
+		return fmt.Errorf("unexpected response %q", response)
+	}
+
+	return nil
+}
+
+// exportPath - путь к файлу внутри каталога выгрузок. Выйти за его пределы нельзя
+func (db *Database) exportPath(name string) (string, error) {
+	if db.exportDir == "" {
+		return "", ErrExportDisabled
+	}
+
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("%w: %s", ErrExportPath, name)
+	}
+
+	return filepath.Join(db.exportDir, name), nil
+}
+
+// authorize - может ли клиент выполнить запрос. Без ACL и для запросов не по сети (без сессии) можно все.
+// AUTH и ACL WHOAMI доступны всегда. Клиент, не вызывавший AUTH, работает пользователем из сертификата
+// (если включен tlsUsers) или пользователем default, если тот входит без пароля
+func (db *Database) authorize(ctx context.Context, query compute.Query) error {
+	if db.acl == nil {
+		return nil
+	}
+
+	session, ok := network.SessionFromContext(ctx)
+	if !ok || query.CommandId() == compute.AuthCommandId {
+		return nil
+	}
+
+	user, err := db.sessionUser(session)
+	if err != nil {
+		return err
+	}
+
+	if query.CommandId() == compute.ACLCommandId && query.Key() == compute.ACLWhoAmI {
+		return nil
+	}
+
+	return db.acl.Check(user, query)
+}
+
+// sessionUser - пользователь клиента, acl.ErrNoAuth, если клиент должен вызвать AUTH
+func (db *Database) sessionUser(session *network.Session) (string, error) {
+	if user := session.User(); user != "" {
+		return user, nil
+	}
+
+	if identity := session.Identity(); db.tlsUsers && identity != "" && db.acl.Exists(identity) {
+		return identity, nil
+	}
+
+	if db.acl.NoPassword(compute.DefaultUser) {
+		return compute.DefaultUser, nil
+	}
+
+	return "", acl.ErrNoAuth
+}
+
+// ExecAuth - AUTH [user] password, "ok" после входа. ErrAuthDisabled, если пользователей нет
+func (db *Database) ExecAuth(ctx context.Context, query compute.Query) (string, error) {
+	if db.acl == nil {
+		return "", ErrAuthDisabled
+	}
+
+	session, ok := network.SessionFromContext(ctx)
+	if !ok {
+		return "", ErrNoSession
+	}
+
+	user, password := query.AuthUser()
+	if err := db.acl.Authenticate(user, password); err != nil {
+		db.logger.Warn("auth failed", zap.String("user", user), zap.String("remote", session.RemoteAddr()))
+		return "", err
+	}
+	session.SetUser(user)
+
+	return "ok", nil
+}
+
+// ExecACL - ACL WHOAMI - текущий пользователь, ACL LIST - пользователи через "; ", ACL SETUSER user rule ... -
+// "ok". Изменения SETUSER живут до перезапуска и не пишутся ни в конфиг, ни в ACL файл
+func (db *Database) ExecACL(ctx context.Context, query compute.Query) (string, error) {
+	if db.acl == nil {
+		return "", ErrAuthDisabled
+	}
+
+	args := query.Args()
+	switch args[0] {
+	case compute.ACLWhoAmI:
+		session, ok := network.SessionFromContext(ctx)
+		if !ok {
+			return "", ErrNoSession
+		}
+
+		user, err := db.sessionUser(session)
+		if err != nil {
+			return "", err
+		}
+
+		return "result: " + user, nil
+	case compute.ACLList:
+		return "result: " + strings.Join(db.acl.List(), "; "), nil
+	default:
+		if err := db.acl.SetUser(args[1], args[2:]); err != nil {
+			return "", err
+		}
+
+		return "ok", nil
+	}
+}
+
+// Disconnect - снимает подписки закрытого соединения
+func (db *Database) Disconnect(ctx context.Context) {
+	if session, ok := network.SessionFromContext(ctx); ok {
+		db.broker.UnsubscribeAll(session)
+	}
+}
+
+// formatInt - ответ "result: N" для команд, возвращающих число
+func formatInt(n int, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("result: %d", n), nil
+}
+
+// formatValue - ответ на чтение одного значения
+func formatValue(value string, err error) (string, error) {
+	if errors.Is(err, engine.ErrKeyNotFound) {
+		return "no data", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if value == "" {
+		return "empty", nil
+	}
+
+	return fmt.Sprintf("result: %s", value), nil
+}
+
+// formatValues - список значений в одну строку: "result: v1 v2"
+func formatValues(values []string) string {
+	if len(values) == 0 {
+		return "no data"
+	}
+
+	return fmt.Sprintf("result: %s", strings.Join(values, " "))
+}
+
+// formatKeyValues - ответ на обход в одну строку: "result: k1=v1 k2=v2"
+func formatKeyValues(pairs []storage.KeyValue) string {
+	if len(pairs) == 0 {
+		return "no data"
+	}
+
+	parts := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		parts = append(parts, pair.Key+"="+pair.Value)
+	}
+
+	return fmt.Sprintf("result: %s", strings.Join(parts, " "))
+}
+
+// formatScoreMembers - элементы сортированного множества со score "result: m1=s1 m2=s2"
+func formatScoreMembers(members []compute.ScoreMember) string {
+	pairs := make([]storage.KeyValue, 0, len(members))
+	for _, m := range members {
+		pairs = append(pairs, storage.KeyValue{Key: m.Member, Value: compute.FormatScore(m.Score)})
+	}
+
+	return formatKeyValues(pairs)
+}
+
+// formatStreamEntries - записи потока "result: id1 f1=v1 f2=v2, id2 f1=v1"
+func formatStreamEntries(entries []storage.StreamEntry) string {
+	if len(entries) == 0 {
+		return "no data"
+	}
+
+	return fmt.Sprintf("result: %s", joinStreamEntries(entries))
+}
+
+// formatStreamReads - записи нескольких потоков "result: key1: id1 f=v, id2 f=v; key2: id3 f=v"
+func formatStreamReads(reads []storage.StreamRead) string {
+	if len(reads) == 0 {
+		return "no data"
+	}
+
+	parts := make([]string, 0, len(reads))
+	for _, read := range reads {
+		parts = append(parts, read.Key+": "+joinStreamEntries(read.Entries))
+	}
+
+	return fmt.Sprintf("result: %s", strings.Join(parts, "; "))
+}
+
+// joinStreamEntries - у записи, которой уже нет в потоке, выводится только id
+func joinStreamEntries(entries []storage.StreamEntry) string {
+	parts := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		part := []string{entry.ID.String()}
+		for _, field := range entry.Fields {
+			part = append(part, field.Key+"="+field.Value)
+		}
+
+		parts = append(parts, strings.Join(part, " "))
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -1,14 +1,26 @@
 package database
 
 import (
+	"bufio"
 	"context"
 	"errors"
+	"fmt"
+	"net"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/TimonKK/inmemory-db/internal/config"
+	"github.com/TimonKK/inmemory-db/internal/database/acl"
 	"github.com/TimonKK/inmemory-db/internal/database/compute"
+	"github.com/TimonKK/inmemory-db/internal/database/network"
+	"github.com/TimonKK/inmemory-db/internal/database/pubsub"
+	"github.com/TimonKK/inmemory-db/internal/database/storage"
+	"github.com/TimonKK/inmemory-db/internal/database/storage/engine"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
 
@@ -29,9 +41,9 @@ func (m *MockStorage) Start(_ context.Context) error {
 	return nil
 }
 
-func (m *MockStorage) Set(_ context.Context, query compute.Query) error {
+func (m *MockStorage) Set(_ context.Context, query compute.Query) (storage.SetResult, error) {
 	args := m.Called(query)
-	return args.Error(0)
+	return args.Get(0).(storage.SetResult), args.Error(1)
 }
 
 func (m *MockStorage) Get(_ context.Context, query compute.Query) (string, error) {
@@ -44,6 +56,372 @@ func (m *MockStorage) Delete(_ context.Context, query compute.Query) error {
 	return args.Error(0)
 }
 
+func (m *MockStorage) Range(_ context.Context, query compute.Query) ([]storage.KeyValue, error) {
+	args := m.Called(query)
+	return args.Get(0).([]storage.KeyValue), args.Error(1)
+}
+
+func (m *MockStorage) Prefix(_ context.Context, query compute.Query) ([]storage.KeyValue, error) {
+	args := m.Called(query)
+	return args.Get(0).([]storage.KeyValue), args.Error(1)
+}
+
+func (m *MockStorage) Scan(_ context.Context, query compute.Query) (string, []string, error) {
+	args := m.Called(query)
+	return args.String(0), args.Get(1).([]string), args.Error(2)
+}
+
+func (m *MockStorage) Keys(_ context.Context, query compute.Query) ([]string, error) {
+	args := m.Called(query)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockStorage) DBSize(_ context.Context) (int, error) {
+	args := m.Called()
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) MGet(_ context.Context, query compute.Query) ([]storage.KeyValue, error) {
+	args := m.Called(query)
+	return args.Get(0).([]storage.KeyValue), args.Error(1)
+}
+
+func (m *MockStorage) MSet(_ context.Context, query compute.Query) error {
+	args := m.Called(query)
+	return args.Error(0)
+}
+
+func (m *MockStorage) MSetNX(_ context.Context, query compute.Query) (bool, error) {
+	args := m.Called(query)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStorage) MDel(_ context.Context, query compute.Query) (int, error) {
+	args := m.Called(query)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) GetSet(_ context.Context, query compute.Query) (string, error) {
+	args := m.Called(query)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockStorage) GetDel(_ context.Context, query compute.Query) (string, error) {
+	args := m.Called(query)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockStorage) GetEx(_ context.Context, query compute.Query) (string, error) {
+	args := m.Called(query)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockStorage) TTL(_ context.Context, query compute.Query) (int64, error) {
+	args := m.Called(query)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockStorage) Exists(_ context.Context, query compute.Query) (int, error) {
+	args := m.Called(query)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) Rename(_ context.Context, query compute.Query) error {
+	args := m.Called(query)
+	return args.Error(0)
+}
+
+func (m *MockStorage) Copy(_ context.Context, query compute.Query) (bool, error) {
+	args := m.Called(query)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStorage) Type(_ context.Context, query compute.Query) (string, error) {
+	args := m.Called(query)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockStorage) FlushDB(_ context.Context, query compute.Query) error {
+	args := m.Called(query)
+	return args.Error(0)
+}
+
+func (m *MockStorage) Append(_ context.Context, query compute.Query) (int, error) {
+	args := m.Called(query)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) StrLen(_ context.Context, query compute.Query) (int, error) {
+	args := m.Called(query)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) GetRange(_ context.Context, query compute.Query) (string, error) {
+	args := m.Called(query)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockStorage) SetRange(_ context.Context, query compute.Query) (int, error) {
+	args := m.Called(query)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) Push(_ context.Context, query compute.Query) (int, error) {
+	args := m.Called(query)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) Pop(_ context.Context, query compute.Query) ([]string, error) {
+	args := m.Called(query)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockStorage) LLen(_ context.Context, query compute.Query) (int, error) {
+	args := m.Called(query)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) LRange(_ context.Context, query compute.Query) ([]string, error) {
+	args := m.Called(query)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockStorage) LIndex(_ context.Context, query compute.Query) (string, error) {
+	args := m.Called(query)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockStorage) LTrim(_ context.Context, query compute.Query) error {
+	args := m.Called(query)
+	return args.Error(0)
+}
+
+func (m *MockStorage) LMove(_ context.Context, query compute.Query) (string, error) {
+	args := m.Called(query)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockStorage) BPop(_ context.Context, query compute.Query) (storage.KeyValue, error) {
+	args := m.Called(query)
+	return args.Get(0).(storage.KeyValue), args.Error(1)
+}
+
+func (m *MockStorage) BLMove(_ context.Context, query compute.Query) (string, error) {
+	args := m.Called(query)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockStorage) HSet(_ context.Context, query compute.Query) (int, error) {
+	args := m.Called(query)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) HGet(_ context.Context, query compute.Query) (string, error) {
+	args := m.Called(query)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockStorage) HDel(_ context.Context, query compute.Query) (int, error) {
+	args := m.Called(query)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) HLen(_ context.Context, query compute.Query) (int, error) {
+	args := m.Called(query)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) HExpire(_ context.Context, query compute.Query) (int, error) {
+	args := m.Called(query)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) HIncrBy(_ context.Context, query compute.Query) (int64, error) {
+	args := m.Called(query)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockStorage) HTTL(_ context.Context, query compute.Query) (int64, error) {
+	args := m.Called(query)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockStorage) HGetAll(_ context.Context, query compute.Query) ([]storage.KeyValue, error) {
+	args := m.Called(query)
+	return args.Get(0).([]storage.KeyValue), args.Error(1)
+}
+
+func (m *MockStorage) HScan(_ context.Context, query compute.Query) (string, []storage.KeyValue, error) {
+	args := m.Called(query)
+	return args.String(0), args.Get(1).([]storage.KeyValue), args.Error(2)
+}
+
+func (m *MockStorage) SAdd(_ context.Context, query compute.Query) (int, error) {
+	args := m.Called(query)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) SRem(_ context.Context, query compute.Query) (int, error) {
+	args := m.Called(query)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) SIsMember(_ context.Context, query compute.Query) (bool, error) {
+	args := m.Called(query)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStorage) SMembers(_ context.Context, query compute.Query) ([]string, error) {
+	args := m.Called(query)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockStorage) SCard(_ context.Context, query compute.Query) (int, error) {
+	args := m.Called(query)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) SetOp(_ context.Context, query compute.Query) ([]string, error) {
+	args := m.Called(query)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockStorage) SetStore(_ context.Context, query compute.Query) (int, error) {
+	args := m.Called(query)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) SScan(_ context.Context, query compute.Query) (string, []string, error) {
+	args := m.Called(query)
+	return args.String(0), args.Get(1).([]string), args.Error(2)
+}
+
+func (m *MockStorage) ZAdd(_ context.Context, query compute.Query) (int, error) {
+	args := m.Called(query)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) ZIncrBy(_ context.Context, query compute.Query) (float64, error) {
+	args := m.Called(query)
+	return args.Get(0).(float64), args.Error(1)
+}
+
+func (m *MockStorage) ZRem(_ context.Context, query compute.Query) (int, error) {
+	args := m.Called(query)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) ZScore(_ context.Context, query compute.Query) (float64, error) {
+	args := m.Called(query)
+	return args.Get(0).(float64), args.Error(1)
+}
+
+func (m *MockStorage) ZCard(_ context.Context, query compute.Query) (int, error) {
+	args := m.Called(query)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) ZRank(_ context.Context, query compute.Query) (int, error) {
+	args := m.Called(query)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) ZRange(_ context.Context, query compute.Query) ([]compute.ScoreMember, error) {
+	args := m.Called(query)
+	return args.Get(0).([]compute.ScoreMember), args.Error(1)
+}
+
+func (m *MockStorage) ZRangeStore(_ context.Context, query compute.Query) (int, error) {
+	args := m.Called(query)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) ZPop(_ context.Context, query compute.Query) ([]compute.ScoreMember, error) {
+	args := m.Called(query)
+	return args.Get(0).([]compute.ScoreMember), args.Error(1)
+}
+
+func (m *MockStorage) XAdd(_ context.Context, query compute.Query) (compute.StreamID, error) {
+	args := m.Called(query)
+	return args.Get(0).(compute.StreamID), args.Error(1)
+}
+
+func (m *MockStorage) XLen(_ context.Context, query compute.Query) (int, error) {
+	args := m.Called(query)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) XRange(_ context.Context, query compute.Query) ([]storage.StreamEntry, error) {
+	args := m.Called(query)
+	return args.Get(0).([]storage.StreamEntry), args.Error(1)
+}
+
+func (m *MockStorage) XRead(_ context.Context, query compute.Query) ([]storage.StreamRead, error) {
+	args := m.Called(query)
+	return args.Get(0).([]storage.StreamRead), args.Error(1)
+}
+
+func (m *MockStorage) XGroup(_ context.Context, query compute.Query) (int, error) {
+	args := m.Called(query)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) XReadGroup(_ context.Context, query compute.Query) ([]storage.StreamRead, error) {
+	args := m.Called(query)
+	return args.Get(0).([]storage.StreamRead), args.Error(1)
+}
+
+func (m *MockStorage) XAck(_ context.Context, query compute.Query) (int, error) {
+	args := m.Called(query)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) XPending(_ context.Context, query compute.Query) ([]storage.PendingEntry, error) {
+	args := m.Called(query)
+	return args.Get(0).([]storage.PendingEntry), args.Error(1)
+}
+
+func (m *MockStorage) XClaim(_ context.Context, query compute.Query) ([]storage.StreamEntry, error) {
+	args := m.Called(query)
+	return args.Get(0).([]storage.StreamEntry), args.Error(1)
+}
+
+func (m *MockStorage) Changes(_ context.Context, from uint64, _ func(compute.Change) error) error {
+	args := m.Called(from)
+	return args.Error(0)
+}
+
+func (m *MockStorage) Export(_ context.Context, fn func(storage.KeyEntry) error) error {
+	args := m.Called()
+	for _, entry := range args.Get(0).([]storage.KeyEntry) {
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	return args.Error(1)
+}
+
+func (m *MockStorage) Import(_ context.Context, entries []storage.KeyEntry, replace bool) (int, error) {
+	args := m.Called(entries, replace)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) Dump(_ context.Context, query compute.Query) (string, error) {
+	args := m.Called(query)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockStorage) Restore(_ context.Context, query compute.Query) error {
+	args := m.Called(query)
+	return args.Error(0)
+}
+
+func (m *MockStorage) DeleteUnchanged(_ context.Context, dumps []storage.KeyDump) (int, error) {
+	args := m.Called(dumps)
+	return args.Int(0), args.Error(1)
+}
+
 func TestDatabase_Execute(t *testing.T) {
 	logger := zap.NewNop()
 
@@ -73,7 +451,8 @@ func TestDatabase_Execute(t *testing.T) {
 					Return(compute.NewQuery(compute.SetCommandId, []string{"bbb", "123"}), nil)
 			},
 			mockStorage: func(m *MockStorage) {
-				m.On("Set", compute.NewQuery(compute.SetCommandId, []string{"bbb", "123"})).Return(nil)
+				m.On("Set", compute.NewQuery(compute.SetCommandId, []string{"bbb", "123"})).
+					Return(storage.SetResult{Written: true}, nil)
 			},
 		},
 		{
@@ -87,6 +466,323 @@ func TestDatabase_Execute(t *testing.T) {
 				m.On("Delete", compute.NewQuery(compute.DeleteCommandId, []string{"ccc"})).Return(nil)
 			},
 		},
+		{
+			name:  "successful RANGE",
+			query: "RANGE a c",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "RANGE a c").
+					Return(compute.NewQuery(compute.RangeCommandId, []string{"a", "c"}), nil)
+			},
+			mockStorage: func(m *MockStorage) {
+				m.On("Range", compute.NewQuery(compute.RangeCommandId, []string{"a", "c"})).
+					Return([]storage.KeyValue{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}}, nil)
+			},
+		},
+		{
+			name:  "PREFIX on unordered engine",
+			query: "PREFIX user",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "PREFIX user").
+					Return(compute.NewQuery(compute.PrefixCommandId, []string{"user"}), nil)
+			},
+			mockStorage: func(m *MockStorage) {
+				m.On("Prefix", compute.NewQuery(compute.PrefixCommandId, []string{"user"})).
+					Return([]storage.KeyValue(nil), storage.ErrIterationUnsupported)
+			},
+			expectedError: storage.ErrIterationUnsupported,
+		},
+		{
+			name:  "successful SCAN",
+			query: "SCAN 0 MATCH user* COUNT 100",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "SCAN 0 MATCH user* COUNT 100").
+					Return(compute.NewQuery(compute.ScanCommandId, []string{"0", "MATCH", "user*", "COUNT", "100"}), nil)
+			},
+			mockStorage: func(m *MockStorage) {
+				m.On("Scan", compute.NewQuery(compute.ScanCommandId, []string{"0", "MATCH", "user*", "COUNT", "100"})).
+					Return("17", []string{"user1"}, nil)
+			},
+		},
+		{
+			name:  "successful DBSIZE",
+			query: "DBSIZE",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "DBSIZE").
+					Return(compute.NewQuery(compute.DBSizeCommandId, []string{}), nil)
+			},
+			mockStorage: func(m *MockStorage) {
+				m.On("DBSize").Return(3, nil)
+			},
+		},
+		{
+			name:  "successful MGET",
+			query: "MGET a b",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "MGET a b").
+					Return(compute.NewQuery(compute.MGetCommandId, []string{"a", "b"}), nil)
+			},
+			mockStorage: func(m *MockStorage) {
+				m.On("MGet", compute.NewQuery(compute.MGetCommandId, []string{"a", "b"})).
+					Return([]storage.KeyValue{{Key: "a", Value: "1"}}, nil)
+			},
+		},
+		{
+			name:  "successful MSETNX",
+			query: "MSETNX a 1 b 2",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "MSETNX a 1 b 2").
+					Return(compute.NewQuery(compute.MSetNXCommandId, []string{"a", "1", "b", "2"}), nil)
+			},
+			mockStorage: func(m *MockStorage) {
+				m.On("MSetNX", compute.NewQuery(compute.MSetNXCommandId, []string{"a", "1", "b", "2"})).Return(false, nil)
+			},
+		},
+		{
+			name:  "GETDEL missing key",
+			query: "GETDEL a",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "GETDEL a").
+					Return(compute.NewQuery(compute.GetDelCommandId, []string{"a"}), nil)
+			},
+			mockStorage: func(m *MockStorage) {
+				m.On("GetDel", compute.NewQuery(compute.GetDelCommandId, []string{"a"})).Return("", storage.ErrKeyNotFound)
+			},
+		},
+		{
+			name:  "RENAME missing key",
+			query: "RENAME a b",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "RENAME a b").
+					Return(compute.NewQuery(compute.RenameCommandId, []string{"a", "b"}), nil)
+			},
+			mockStorage: func(m *MockStorage) {
+				m.On("Rename", compute.NewQuery(compute.RenameCommandId, []string{"a", "b"})).Return(storage.ErrKeyNotFound)
+			},
+		},
+		{
+			name:  "successful FLUSHDB",
+			query: "FLUSHDB",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "FLUSHDB").
+					Return(compute.NewQuery(compute.FlushDBCommandId, []string{}), nil)
+			},
+			mockStorage: func(m *MockStorage) {
+				m.On("FlushDB", compute.NewQuery(compute.FlushDBCommandId, []string{})).Return(nil)
+			},
+		},
+		{
+			name:  "successful APPEND",
+			query: "APPEND log line",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "APPEND log line").
+					Return(compute.NewQuery(compute.AppendCommandId, []string{"log", "line"}), nil)
+			},
+			mockStorage: func(m *MockStorage) {
+				m.On("Append", compute.NewQuery(compute.AppendCommandId, []string{"log", "line"})).Return(4, nil)
+			},
+		},
+		{
+			name:  "successful RPUSH",
+			query: "RPUSH jobs a b",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "RPUSH jobs a b").
+					Return(compute.NewQuery(compute.RPushCommandId, []string{"jobs", "a", "b"}), nil)
+			},
+			mockStorage: func(m *MockStorage) {
+				m.On("Push", compute.NewQuery(compute.RPushCommandId, []string{"jobs", "a", "b"})).Return(2, nil)
+			},
+		},
+		{
+			name:  "LPOP on missing list",
+			query: "LPOP jobs",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "LPOP jobs").
+					Return(compute.NewQuery(compute.LPopCommandId, []string{"jobs"}), nil)
+			},
+			mockStorage: func(m *MockStorage) {
+				m.On("Pop", compute.NewQuery(compute.LPopCommandId, []string{"jobs"})).
+					Return([]string(nil), storage.ErrKeyNotFound)
+			},
+		},
+		{
+			name:  "LRANGE on string",
+			query: "LRANGE name 0 -1",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "LRANGE name 0 -1").
+					Return(compute.NewQuery(compute.LRangeCommandId, []string{"name", "0", "-1"}), nil)
+			},
+			mockStorage: func(m *MockStorage) {
+				m.On("LRange", compute.NewQuery(compute.LRangeCommandId, []string{"name", "0", "-1"})).
+					Return([]string(nil), storage.ErrWrongType)
+			},
+			expectedError: storage.ErrWrongType,
+		},
+		{
+			name:  "BLPOP timed out",
+			query: "BLPOP jobs 1",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "BLPOP jobs 1").
+					Return(compute.NewQuery(compute.BLPopCommandId, []string{"jobs", "1"}), nil)
+			},
+			mockStorage: func(m *MockStorage) {
+				m.On("BPop", compute.NewQuery(compute.BLPopCommandId, []string{"jobs", "1"})).
+					Return(storage.KeyValue{}, storage.ErrKeyNotFound)
+			},
+		},
+		{
+			name:  "successful HSET",
+			query: "HSET user name bob age 42",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "HSET user name bob age 42").
+					Return(compute.NewQuery(compute.HSetCommandId, []string{"user", "name", "bob", "age", "42"}), nil)
+			},
+			mockStorage: func(m *MockStorage) {
+				m.On("HSet", compute.NewQuery(compute.HSetCommandId, []string{"user", "name", "bob", "age", "42"})).Return(2, nil)
+			},
+		},
+		{
+			name:  "HINCRBY on non-integer field",
+			query: "HINCRBY user name 1",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "HINCRBY user name 1").
+					Return(compute.NewQuery(compute.HIncrByCommandId, []string{"user", "name", "1"}), nil)
+			},
+			mockStorage: func(m *MockStorage) {
+				m.On("HIncrBy", compute.NewQuery(compute.HIncrByCommandId, []string{"user", "name", "1"})).
+					Return(int64(0), storage.ErrNotInteger)
+			},
+			expectedError: storage.ErrNotInteger,
+		},
+		{
+			name:  "successful HSCAN",
+			query: "HSCAN user 0",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "HSCAN user 0").
+					Return(compute.NewQuery(compute.HScanCommandId, []string{"user", "0"}), nil)
+			},
+			mockStorage: func(m *MockStorage) {
+				m.On("HScan", compute.NewQuery(compute.HScanCommandId, []string{"user", "0"})).
+					Return("0", []storage.KeyValue{{Key: "name", Value: "bob"}}, nil)
+			},
+		},
+		{
+			name:  "successful SINTERSTORE",
+			query: "SINTERSTORE common a b",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "SINTERSTORE common a b").
+					Return(compute.NewQuery(compute.SInterStoreCommandId, []string{"common", "a", "b"}), nil)
+			},
+			mockStorage: func(m *MockStorage) {
+				m.On("SetStore", compute.NewQuery(compute.SInterStoreCommandId, []string{"common", "a", "b"})).Return(2, nil)
+			},
+		},
+		{
+			name:  "SISMEMBER on list",
+			query: "SISMEMBER jobs a",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "SISMEMBER jobs a").
+					Return(compute.NewQuery(compute.SIsMemberCommandId, []string{"jobs", "a"}), nil)
+			},
+			mockStorage: func(m *MockStorage) {
+				m.On("SIsMember", compute.NewQuery(compute.SIsMemberCommandId, []string{"jobs", "a"})).
+					Return(false, storage.ErrWrongType)
+			},
+			expectedError: storage.ErrWrongType,
+		},
+		{
+			name:  "successful ZRANGE WITHSCORES",
+			query: "ZRANGE board 0 -1 WITHSCORES",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "ZRANGE board 0 -1 WITHSCORES").
+					Return(compute.NewQuery(compute.ZRangeCommandId, []string{"board", "0", "-1", "WITHSCORES"}), nil)
+			},
+			mockStorage: func(m *MockStorage) {
+				m.On("ZRange", compute.NewQuery(compute.ZRangeCommandId, []string{"board", "0", "-1", "WITHSCORES"})).
+					Return([]compute.ScoreMember{{Score: 1.5, Member: "bob"}}, nil)
+			},
+		},
+		{
+			name:  "ZINCRBY to NaN",
+			query: "ZINCRBY board -inf bob",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "ZINCRBY board -inf bob").
+					Return(compute.NewQuery(compute.ZIncrByCommandId, []string{"board", "-inf", "bob"}), nil)
+			},
+			mockStorage: func(m *MockStorage) {
+				m.On("ZIncrBy", compute.NewQuery(compute.ZIncrByCommandId, []string{"board", "-inf", "bob"})).
+					Return(float64(0), storage.ErrScoreNaN)
+			},
+			expectedError: storage.ErrScoreNaN,
+		},
+		{
+			name:  "successful XREADGROUP",
+			query: "XREADGROUP GROUP workers w1 STREAMS events >",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "XREADGROUP GROUP workers w1 STREAMS events >").
+					Return(compute.NewQuery(compute.XReadGroupCommandId, []string{"GROUP", "workers", "w1", "STREAMS", "events", ">"}), nil)
+			},
+			mockStorage: func(m *MockStorage) {
+				m.On("XReadGroup", compute.NewQuery(compute.XReadGroupCommandId, []string{"GROUP", "workers", "w1", "STREAMS", "events", ">"})).
+					Return([]storage.StreamRead{{Key: "events", Entries: []storage.StreamEntry{
+						{ID: compute.StreamID{Ms: 1, Seq: 0}, Fields: []storage.KeyValue{{Key: "type", Value: "signup"}}},
+					}}}, nil)
+			},
+		},
+		{
+			name:  "XPENDING without group",
+			query: "XPENDING events workers",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "XPENDING events workers").
+					Return(compute.NewQuery(compute.XPendingCommandId, []string{"events", "workers"}), nil)
+			},
+			mockStorage: func(m *MockStorage) {
+				m.On("XPending", compute.NewQuery(compute.XPendingCommandId, []string{"events", "workers"})).
+					Return([]storage.PendingEntry(nil), storage.ErrNoGroup)
+			},
+			expectedError: storage.ErrNoGroup,
+		},
+		{
+			name:  "RESTORE existing key",
+			query: "RESTORE user 0 AQAAbm9uZQ",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "RESTORE user 0 AQAAbm9uZQ").
+					Return(compute.NewQuery(compute.RestoreCommandId, []string{"user", "0", "AQAAbm9uZQ"}), nil)
+			},
+			mockStorage: func(m *MockStorage) {
+				m.On("Restore", compute.NewQuery(compute.RestoreCommandId, []string{"user", "0", "AQAAbm9uZQ"})).
+					Return(storage.ErrBusyKey)
+			},
+			expectedError: storage.ErrBusyKey,
+		},
+		{
+			name:  "SUBSCRIBE outside of connection",
+			query: "SUBSCRIBE news",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "SUBSCRIBE news").
+					Return(compute.NewQuery(compute.SubscribeCommandId, []string{"news"}), nil)
+			},
+			mockStorage:   func(m *MockStorage) {},
+			expectedError: ErrNoSession,
+		},
+		{
+			name:  "CDC outside of connection",
+			query: "CDC 1",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "CDC 1").
+					Return(compute.NewQuery(compute.CDCCommandId, []string{"1"}), nil)
+			},
+			mockStorage:   func(m *MockStorage) {},
+			expectedError: ErrNoSession,
+		},
+		{
+			name:  "PUBLISH without subscribers",
+			query: "PUBLISH news hello",
+			mockParse: func(m *MockCompute) {
+				m.On("ParseQuery", "PUBLISH news hello").
+					Return(compute.NewQuery(compute.PublishCommandId, []string{"news", "hello"}), nil)
+			},
+			mockStorage: func(m *MockStorage) {},
+		},
 		{
 			name:  "parse error",
 			query: "ГЕТ",
@@ -107,7 +803,7 @@ func TestDatabase_Execute(t *testing.T) {
 			tt.mockParse(mockCompute)
 			tt.mockStorage(mockStorage)
 
-			db := NewDatabase(mockCompute, mockStorage, logger)
+			db := NewDatabase(mockCompute, mockStorage, pubsub.NewBroker(), logger)
 			_, err := db.ExecQuery(context.TODO(), tt.query)
 
 			if tt.expectedError != nil {
@@ -122,3 +818,350 @@ func TestDatabase_Execute(t *testing.T) {
 		})
 	}
 }
+
+func TestDatabase_ExportImport(t *testing.T) {
+	ctx := context.Background()
+	entries := []storage.KeyEntry{
+		{Key: "name", Entry: storage.Entry{Value: "alice", ExpireAt: 1700000000000}},
+		{Key: "tags", Entry: storage.NewCollectionEntry(storage.NewSet("x", "y"))},
+	}
+
+	for _, file := range []string{"dump.jsonl", "dump.csv"} {
+		t.Run(file, func(t *testing.T) {
+			mockStorage := new(MockStorage)
+			mockStorage.On("Export").Return(entries, nil)
+			mockStorage.On("Import", entries, true).Return(2, nil)
+
+			db := NewDatabase(compute.NewCompute(zap.NewNop()), mockStorage, pubsub.NewBroker(), zap.NewNop())
+			db.SetExportDirectory(t.TempDir())
+
+			result, err := db.ExecQuery(ctx, "EXPORT "+file)
+			require.NoError(t, err)
+			assert.Equal(t, "result: 2", result)
+
+			result, err = db.ExecQuery(ctx, "IMPORT "+file+" REPLACE")
+			require.NoError(t, err)
+			assert.Equal(t, "result: 2", result)
+
+			mockStorage.AssertExpectations(t)
+		})
+	}
+
+	t.Run("batches", func(t *testing.T) {
+		many := make([]storage.KeyEntry, importBatchSize+1)
+		for i := range many {
+			many[i] = storage.KeyEntry{Key: fmt.Sprintf("key%d", i), Entry: storage.NewEntry("v")}
+		}
+
+		mockStorage := new(MockStorage)
+		mockStorage.On("Export").Return(many, nil)
+		mockStorage.On("Import", many[:importBatchSize], false).Return(importBatchSize, nil).Once()
+		mockStorage.On("Import", many[importBatchSize:], false).Return(1, nil).Once()
+
+		db := NewDatabase(compute.NewCompute(zap.NewNop()), mockStorage, pubsub.NewBroker(), zap.NewNop())
+		db.SetExportDirectory(t.TempDir())
+
+		_, err := db.ExecQuery(ctx, "EXPORT many.jsonl")
+		require.NoError(t, err)
+
+		result, err := db.ExecQuery(ctx, "IMPORT many.jsonl")
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("result: %d", importBatchSize+1), result)
+
+		mockStorage.AssertExpectations(t)
+	})
+
+	t.Run("paths", func(t *testing.T) {
+		db := NewDatabase(compute.NewCompute(zap.NewNop()), new(MockStorage), pubsub.NewBroker(), zap.NewNop())
+
+		_, err := db.ExecQuery(ctx, "EXPORT dump.jsonl")
+		assert.ErrorIs(t, err, ErrExportDisabled)
+
+		db.SetExportDirectory(t.TempDir())
+		_, err = db.ExecQuery(ctx, "IMPORT ../dump.jsonl")
+		assert.ErrorIs(t, err, ErrExportPath)
+	})
+}
+
+// migrateTarget - сервер-получатель MIGRATE: отвечает "ok" на каждый запрос, кроме содержащих reject,
+// на них - ошибкой BUSYKEY, как сервер при ошибке команды
+func migrateTarget(t *testing.T, reject string) (string, string, <-chan string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	requests := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			line = strings.TrimSpace(line)
+			requests <- line
+
+			response := "ok\n"
+			if strings.Contains(line, reject) {
+				response = network.ErrorResponse(storage.ErrBusyKey) + "\n"
+			}
+
+			if _, err := conn.Write([]byte(response)); err != nil {
+				return
+			}
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+
+	return host, port, requests
+}
+
+func TestDatabase_Migrate(t *testing.T) {
+	ctx := context.Background()
+	dumpQuery := func(key string) compute.Query {
+		return compute.NewQuery(compute.DumpCommandId, []string{key})
+	}
+
+	t.Run("move", func(t *testing.T) {
+		host, port, requests := migrateTarget(t, "-")
+
+		mockStorage := new(MockStorage)
+		mockStorage.On("Dump", dumpQuery("a")).Return("payloadA", nil)
+		mockStorage.On("Dump", dumpQuery("missing")).Return("", storage.ErrKeyNotFound)
+		mockStorage.On("Dump", dumpQuery("b")).Return("payloadB", nil)
+		mockStorage.On("DeleteUnchanged", []storage.KeyDump{{Key: "a", Payload: "payloadA"}, {Key: "b", Payload: "payloadB"}}).
+			Return(2, nil)
+
+		db := NewDatabase(compute.NewCompute(zap.NewNop()), mockStorage, pubsub.NewBroker(), zap.NewNop())
+		result, err := db.ExecQuery(ctx, fmt.Sprintf("MIGRATE %s %s a missing b REPLACE", host, port))
+		require.NoError(t, err)
+		assert.Equal(t, "ok", result)
+		assert.Equal(t, "RESTORE a 0 payloadA REPLACE", <-requests)
+		assert.Equal(t, "RESTORE b 0 payloadB REPLACE", <-requests)
+
+		mockStorage.AssertExpectations(t)
+	})
+
+	t.Run("rejected key", func(t *testing.T) {
+		host, port, _ := migrateTarget(t, "payloadB")
+
+		// перенесенный до ошибки ключ удаляется, отклоненный остается
+		mockStorage := new(MockStorage)
+		mockStorage.On("Dump", dumpQuery("a")).Return("payloadA", nil)
+		mockStorage.On("Dump", dumpQuery("b")).Return("payloadB", nil)
+		mockStorage.On("DeleteUnchanged", []storage.KeyDump{{Key: "a", Payload: "payloadA"}}).Return(1, nil)
+
+		db := NewDatabase(compute.NewCompute(zap.NewNop()), mockStorage, pubsub.NewBroker(), zap.NewNop())
+		_, err := db.ExecQuery(ctx, fmt.Sprintf("MIGRATE %s %s a b", host, port))
+		assert.ErrorIs(t, err, ErrMigrate)
+		assert.ErrorContains(t, err, "BUSYKEY")
+
+		mockStorage.AssertExpectations(t)
+	})
+
+	t.Run("copy", func(t *testing.T) {
+		host, port, requests := migrateTarget(t, "-")
+
+		mockStorage := new(MockStorage)
+		mockStorage.On("Dump", dumpQuery("a")).Return("payloadA", nil)
+
+		db := NewDatabase(compute.NewCompute(zap.NewNop()), mockStorage, pubsub.NewBroker(), zap.NewNop())
+		result, err := db.ExecQuery(ctx, fmt.Sprintf("MIGRATE %s %s a COPY", host, port))
+		require.NoError(t, err)
+		assert.Equal(t, "ok", result)
+		assert.Equal(t, "RESTORE a 0 payloadA", <-requests)
+
+		mockStorage.AssertExpectations(t)
+	})
+
+	t.Run("no keys", func(t *testing.T) {
+		mockStorage := new(MockStorage)
+		mockStorage.On("Dump", dumpQuery("a")).Return("", storage.ErrKeyNotFound)
+
+		db := NewDatabase(compute.NewCompute(zap.NewNop()), mockStorage, pubsub.NewBroker(), zap.NewNop())
+		result, err := db.ExecQuery(ctx, "MIGRATE 127.0.0.1 1 a")
+		require.NoError(t, err)
+		assert.Equal(t, "no data", result)
+	})
+}
+
+func TestDatabase_ACL(t *testing.T) {
+	users, err := acl.New([]string{
+		"user default on nopass ~cache:* allchannels +@read",
+		"user admin on >secret allkeys allcommands",
+	})
+	require.NoError(t, err)
+
+	mockStorage := new(MockStorage)
+	mockStorage.On("Get", compute.NewQuery(compute.GetCommandId, []string{"cache:1"})).Return("v", nil)
+	mockStorage.On("Delete", compute.NewQuery(compute.DeleteCommandId, []string{"cache:1"})).Return(nil)
+
+	db := NewDatabase(compute.NewCompute(zap.NewNop()), mockStorage, pubsub.NewBroker(), zap.NewNop())
+	db.SetACL(users, false)
+
+	conn, peer := net.Pipe()
+	defer func() { _ = peer.Close() }()
+	session := network.NewSession(conn, 0, zap.NewNop())
+	defer session.Close()
+	ctx := network.WithSession(context.Background(), session)
+
+	// без AUTH клиент работает пользователем default
+	result, err := db.ExecQuery(ctx, "GET cache:1")
+	require.NoError(t, err)
+	assert.Equal(t, "result: v", result)
+
+	_, err = db.ExecQuery(ctx, "GET user:1")
+	assert.ErrorIs(t, err, acl.ErrNoPerm)
+	_, err = db.ExecQuery(ctx, "DEL cache:1")
+	assert.ErrorIs(t, err, acl.ErrNoPerm)
+
+	// команды по всем ключам не обходят шаблоны ключей
+	for _, query := range []string{"KEYS *", "SCAN 0", "RANGE a z", "PREFIX cache"} {
+		_, err = db.ExecQuery(ctx, query)
+		assert.ErrorIs(t, err, acl.ErrNoPerm, query)
+	}
+
+	// и через уведомления о ключах
+	for _, query := range []string{"PSUBSCRIBE __key*__:*", "SUBSCRIBE __keyevent@0__:set"} {
+		_, err = db.ExecQuery(ctx, query)
+		assert.ErrorIs(t, err, acl.ErrNoPerm, query)
+	}
+
+	_, err = db.ExecQuery(ctx, "AUTH admin wrong")
+	assert.ErrorIs(t, err, acl.ErrWrongPass)
+
+	result, err = db.ExecQuery(ctx, "AUTH admin secret")
+	require.NoError(t, err)
+	assert.Equal(t, "ok", result)
+
+	result, err = db.ExecQuery(ctx, "ACL WHOAMI")
+	require.NoError(t, err)
+	assert.Equal(t, "result: admin", result)
+
+	_, err = db.ExecQuery(ctx, "DEL cache:1")
+	assert.NoError(t, err)
+
+	// пользователь default с паролем требует AUTH от новых клиентов
+	result, err = db.ExecQuery(ctx, "ACL SETUSER default resetpass >guest")
+	require.NoError(t, err)
+	assert.Equal(t, "ok", result)
+
+	other, otherPeer := net.Pipe()
+	defer func() { _ = otherPeer.Close() }()
+	anonymous := network.NewSession(other, 0, zap.NewNop())
+	defer anonymous.Close()
+
+	_, err = db.ExecQuery(network.WithSession(context.Background(), anonymous), "GET cache:1")
+	assert.ErrorIs(t, err, acl.ErrNoAuth)
+
+	// внутренние запросы без сессии не проверяются
+	_, err = db.ExecQuery(context.Background(), "DEL cache:1")
+	assert.NoError(t, err)
+
+	mockStorage.AssertExpectations(t)
+}
+
+// TestDatabase_ACLOverNetwork - ошибки прав приходят клиенту ответом, соединение остается открытым
+func TestDatabase_ACLOverNetwork(t *testing.T) {
+	users, err := acl.New([]string{
+		"user default on nopass ~cache:* +@read",
+		"user admin on >secret allkeys allcommands",
+	})
+	require.NoError(t, err)
+
+	mockStorage := new(MockStorage)
+	mockStorage.On("Get", compute.NewQuery(compute.GetCommandId, []string{"cache:1"})).Return("v", nil)
+
+	db := NewDatabase(compute.NewCompute(zap.NewNop()), mockStorage, pubsub.NewBroker(), zap.NewNop())
+	db.SetACL(users, false)
+
+	server, err := network.NewTCPServer(config.NetworkConfig{
+		Address:        "127.0.0.1:0",
+		MaxMessageSize: 1024,
+		IdleTimeout:    time.Second,
+	}, zap.NewNop())
+	require.NoError(t, err)
+	server.SetDisconnectHandler(db.Disconnect)
+	go server.HandleConnect(context.Background(), db.ExecQuery)
+	t.Cleanup(func() { _ = server.Shutdown(context.Background()) })
+
+	exchange := func(steps [][2]string) {
+		t.Helper()
+
+		conn, err := net.Dial("tcp", server.Addr().String())
+		require.NoError(t, err)
+		defer func() { _ = conn.Close() }()
+		reader := bufio.NewReader(conn)
+
+		for _, step := range steps {
+			_, err := conn.Write([]byte(step[0] + "\n"))
+			require.NoError(t, err)
+
+			response, err := reader.ReadString('\n')
+			require.NoError(t, err, step[0])
+			assert.Equal(t, step[1], strings.TrimSpace(response), step[0])
+		}
+	}
+
+	exchange([][2]string{
+		{"GET user:1", "error: NOPERM User default has no permissions to access the 'user:1' key"},
+		{"GET cache:1", "result: v"},
+		{"ACL SETUSER default resetpass >guest", "error: NOPERM User default has no permissions to run the 'ACL' command"},
+		{"AUTH admin wrong", "error: " + acl.ErrWrongPass.Error()},
+		{"AUTH admin secret", "ok"},
+		{"ACL SETUSER default resetpass >guest", "ok"},
+	})
+
+	exchange([][2]string{
+		{"GET cache:1", "error: " + acl.ErrNoAuth.Error()},
+		{"AUTH default guest", "ok"},
+		{"GET cache:1", "result: v"},
+	})
+
+	mockStorage.AssertExpectations(t)
+}
+
+// TestDatabase_ShutdownBlockedRequest - BLPOP без таймаута прерывается в начале остановки сервера
+// и не задерживает её на весь grace period
+func TestDatabase_ShutdownBlockedRequest(t *testing.T) {
+	st, err := storage.NewStorage(engine.NewMemoryEngine(), nil, nil, zap.NewNop())
+	require.NoError(t, err)
+	db := NewDatabase(compute.NewCompute(zap.NewNop()), st, pubsub.NewBroker(), zap.NewNop())
+
+	server, err := network.NewTCPServer(config.NetworkConfig{
+		Address:        "127.0.0.1:0",
+		MaxMessageSize: 1024,
+		IdleTimeout:    time.Minute,
+	}, zap.NewNop())
+	require.NoError(t, err)
+	go server.HandleConnect(context.Background(), db.ExecQuery)
+
+	conn, err := net.Dial("tcp", server.Addr().String())
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	_, err = conn.Write([]byte("BLPOP jobs 0\n"))
+	require.NoError(t, err)
+	// BLPOP успевает заблокироваться
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, server.Shutdown(ctx))
+
+	reader := bufio.NewReader(conn)
+	response, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, network.ErrorResponse(network.ErrShuttingDown)+"\n", response)
+}
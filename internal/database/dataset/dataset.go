@@ -0,0 +1,363 @@
+package dataset
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+	"github.com/TimonKK/inmemory-db/internal/database/storage"
+)
+
+var ErrInvalidDataset = errors.New("invalid dataset record")
+
+// Format - формат файла выгрузки
+type Format int
+
+const (
+	// FormatJSONL - JSON Lines, объект Record на строку
+	FormatJSONL Format = iota
+	// FormatCSV - колонки key,type,expire_at,value. Значение строки пишется как есть,
+	// составного типа - тем же JSON, что и value в JSON Lines
+	FormatCSV
+)
+
+// FormatOf - формат по расширению файла: .csv - CSV, остальные - JSON Lines
+func FormatOf(file string) Format {
+	if strings.EqualFold(path.Ext(file), ".csv") {
+		return FormatCSV
+	}
+
+	return FormatJSONL
+}
+
+var csvHeader = []string{"key", "type", "expire_at", "value"}
+
+// Record - ключ в выгрузке. ExpireAt - срок жизни в unix ms, поэтому загрузка позже выгрузки
+// не продлевает жизнь ключей. Value зависит от типа:
+//
+//	string - "value"
+//	list   - ["a", "b"]
+//	hash   - [{"field": "f", "value": "v", "expire_at": 0}]
+//	set    - ["a", "b"]
+//	zset   - [{"member": "m", "score": "1.5"}], score строкой, чтобы сохранить inf
+//	stream - {"entries": [{"id": "1-1", "fields": ["f", "v"]}], "groups": [{"name": "g", "last_id": "0-0"}]}
+type Record struct {
+	Key      string          `json:"key"`
+	Type     string          `json:"type"`
+	ExpireAt int64           `json:"expire_at,omitempty"`
+	Value    json.RawMessage `json:"value"`
+}
+
+type hashField struct {
+	Field    string `json:"field"`
+	Value    string `json:"value"`
+	ExpireAt int64  `json:"expire_at,omitempty"`
+}
+
+type zsetMember struct {
+	Member string `json:"member"`
+	Score  string `json:"score"`
+}
+
+type streamValue struct {
+	Entries []streamEntry `json:"entries"`
+	Groups  []streamGroup `json:"groups,omitempty"`
+}
+
+type streamEntry struct {
+	ID     string   `json:"id"`
+	Fields []string `json:"fields"`
+}
+
+type streamGroup struct {
+	Name   string `json:"name"`
+	LastID string `json:"last_id"`
+}
+
+// Encode - запись выгрузки для ключа. now нужен, чтобы не выгружать истекшие поля хешей
+func Encode(e storage.KeyEntry, now int64) (Record, error) {
+	var value any
+	switch data := e.Entry.Data.(type) {
+	case nil:
+		value = e.Entry.Value
+	case *storage.List:
+		value = data.Values()
+	case *storage.Hash:
+		fields := make([]hashField, 0)
+		for _, f := range data.Fields(now) {
+			fields = append(fields, hashField{Field: f.Name, Value: f.Value, ExpireAt: f.ExpireAt})
+		}
+		value = fields
+	case *storage.Set:
+		value = data.Members()
+	case *storage.SortedSet:
+		members := make([]zsetMember, 0, data.Len())
+		for _, m := range data.Members() {
+			members = append(members, zsetMember{Member: m.Member, Score: compute.FormatScore(m.Score)})
+		}
+		value = members
+	case *storage.Stream:
+		stream := streamValue{Entries: make([]streamEntry, 0, data.Len())}
+		for _, entry := range data.Entries() {
+			if entry.Fields == nil {
+				continue
+			}
+
+			fields := make([]string, 0, 2*len(entry.Fields))
+			for _, field := range entry.Fields {
+				fields = append(fields, field.Key, field.Value)
+			}
+			stream.Entries = append(stream.Entries, streamEntry{ID: entry.ID.String(), Fields: fields})
+		}
+		for _, g := range data.Groups() {
+			stream.Groups = append(stream.Groups, streamGroup{Name: g.Name, LastID: g.LastID.String()})
+		}
+		value = stream
+	default:
+		return Record{}, fmt.Errorf("%w: %s has unsupported type", ErrInvalidDataset, e.Key)
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return Record{}, err
+	}
+
+	return Record{Key: e.Key, Type: e.Entry.Type().String(), ExpireAt: e.Entry.ExpireAt, Value: raw}, nil
+}
+
+// Decode - ключ и значение из записи выгрузки
+func (r Record) Decode() (storage.KeyEntry, error) {
+	if r.Key == "" {
+		return storage.KeyEntry{}, fmt.Errorf("%w: empty key", ErrInvalidDataset)
+	}
+
+	entry, err := r.decodeValue()
+	if err != nil {
+		return storage.KeyEntry{}, fmt.Errorf("%w: %s: %w", ErrInvalidDataset, r.Key, err)
+	}
+	entry.ExpireAt = r.ExpireAt
+
+	return storage.KeyEntry{Key: r.Key, Entry: entry}, nil
+}
+
+func (r Record) decodeValue() (storage.Entry, error) {
+	switch r.Type {
+	case storage.TypeString.String():
+		var value string
+		err := json.Unmarshal(r.Value, &value)
+		return storage.NewEntry(value), err
+	case storage.TypeList.String():
+		var values []string
+		err := json.Unmarshal(r.Value, &values)
+		return storage.NewCollectionEntry(storage.NewList(values...)), err
+	case storage.TypeHash.String():
+		var fields []hashField
+		if err := json.Unmarshal(r.Value, &fields); err != nil {
+			return storage.Entry{}, err
+		}
+
+		hash := storage.NewHash()
+		for _, f := range fields {
+			hash.Set(f.Field, f.Value)
+			if f.ExpireAt != 0 {
+				hash.Expire(f.Field, f.ExpireAt)
+			}
+		}
+
+		return storage.NewCollectionEntry(hash), nil
+	case storage.TypeSet.String():
+		var members []string
+		err := json.Unmarshal(r.Value, &members)
+		return storage.NewCollectionEntry(storage.NewSet(members...)), err
+	case storage.TypeSortedSet.String():
+		var members []zsetMember
+		if err := json.Unmarshal(r.Value, &members); err != nil {
+			return storage.Entry{}, err
+		}
+
+		zset := storage.NewSortedSet()
+		for _, m := range members {
+			score, err := compute.ParseScore(m.Score)
+			if err != nil {
+				return storage.Entry{}, err
+			}
+			zset.Add(m.Member, score)
+		}
+
+		return storage.NewCollectionEntry(zset), nil
+	case storage.TypeStream.String():
+		return decodeStream(r.Value)
+	}
+
+	return storage.Entry{}, fmt.Errorf("unknown type %q", r.Type)
+}
+
+func decodeStream(raw json.RawMessage) (storage.Entry, error) {
+	var value streamValue
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return storage.Entry{}, err
+	}
+
+	stream := storage.NewStream(compute.StreamID{}, nil)
+	for _, entry := range value.Entries {
+		id, err := compute.ParseStreamID(entry.ID)
+		if err != nil {
+			return storage.Entry{}, err
+		}
+
+		if len(entry.Fields) == 0 || len(entry.Fields)%2 != 0 {
+			return storage.Entry{}, fmt.Errorf("stream entry %s: fields must be non-empty pairs", entry.ID)
+		}
+
+		fields := make([]storage.KeyValue, 0, len(entry.Fields)/2)
+		for i := 0; i < len(entry.Fields); i += 2 {
+			fields = append(fields, storage.KeyValue{Key: entry.Fields[i], Value: entry.Fields[i+1]})
+		}
+
+		// Add проверяет, что id возрастают
+		if err := stream.Add(id, fields); err != nil {
+			return storage.Entry{}, err
+		}
+	}
+
+	for _, g := range value.Groups {
+		lastID, err := compute.ParseStreamID(g.LastID)
+		if err != nil {
+			return storage.Entry{}, err
+		}
+		stream.CreateGroup(g.Name, lastID)
+	}
+
+	return storage.NewCollectionEntry(stream), nil
+}
+
+// Writer - пишет выгрузку в выбранном формате
+type Writer struct {
+	format Format
+	buf    *bufio.Writer
+	json   *json.Encoder
+	csv    *csv.Writer
+	header bool
+}
+
+func NewWriter(w io.Writer, format Format) *Writer {
+	buf := bufio.NewWriter(w)
+	return &Writer{format: format, buf: buf, json: json.NewEncoder(buf), csv: csv.NewWriter(buf)}
+}
+
+func (w *Writer) Write(record Record) error {
+	if w.format == FormatJSONL {
+		return w.json.Encode(record)
+	}
+
+	if !w.header {
+		if err := w.csv.Write(csvHeader); err != nil {
+			return err
+		}
+		w.header = true
+	}
+
+	value := string(record.Value)
+	if record.Type == storage.TypeString.String() {
+		if err := json.Unmarshal(record.Value, &value); err != nil {
+			return err
+		}
+	}
+
+	expireAt := ""
+	if record.ExpireAt != 0 {
+		expireAt = strconv.FormatInt(record.ExpireAt, 10)
+	}
+
+	return w.csv.Write([]string{record.Key, record.Type, expireAt, value})
+}
+
+// Flush - дописывает буферизованные записи
+func (w *Writer) Flush() error {
+	if w.format == FormatCSV {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return err
+		}
+	}
+
+	return w.buf.Flush()
+}
+
+// Reader - читает выгрузку в выбранном формате
+type Reader struct {
+	format Format
+	json   *json.Decoder
+	csv    *csv.Reader
+	header bool
+}
+
+func NewReader(r io.Reader, format Format) *Reader {
+	reader := &Reader{format: format}
+	if format == FormatCSV {
+		reader.csv = csv.NewReader(r)
+		reader.csv.FieldsPerRecord = len(csvHeader)
+	} else {
+		reader.json = json.NewDecoder(r)
+	}
+
+	return reader
+}
+
+// Read - следующая запись, io.EOF в конце файла
+func (r *Reader) Read() (Record, error) {
+	if r.format == FormatJSONL {
+		var record Record
+		if err := r.json.Decode(&record); err != nil {
+			if errors.Is(err, io.EOF) {
+				return Record{}, io.EOF
+			}
+
+			return Record{}, fmt.Errorf("%w: %w", ErrInvalidDataset, err)
+		}
+
+		return record, nil
+	}
+
+	if !r.header {
+		if _, err := r.csv.Read(); err != nil {
+			return Record{}, r.csvError(err)
+		}
+		r.header = true
+	}
+
+	row, err := r.csv.Read()
+	if err != nil {
+		return Record{}, r.csvError(err)
+	}
+
+	record := Record{Key: row[0], Type: row[1], Value: json.RawMessage(row[3])}
+	if row[2] != "" {
+		if record.ExpireAt, err = strconv.ParseInt(row[2], 10, 64); err != nil {
+			return Record{}, fmt.Errorf("%w: expire_at %s", ErrInvalidDataset, row[2])
+		}
+	}
+
+	if record.Type == storage.TypeString.String() {
+		if record.Value, err = json.Marshal(row[3]); err != nil {
+			return Record{}, err
+		}
+	}
+
+	return record, nil
+}
+
+func (r *Reader) csvError(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.EOF
+	}
+
+	return fmt.Errorf("%w: %w", ErrInvalidDataset, err)
+}
@@ -0,0 +1,107 @@
+package network
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/TimonKK/inmemory-db/internal/utils"
+)
+
+var (
+	ErrMaxClients      = errors.New("max number of clients reached")
+	ErrMaxClientsPerIP = errors.New("max number of clients per ip reached")
+)
+
+// AdmissionStats - счетчики допуска соединений
+type AdmissionStats struct {
+	// Connections - открытые соединения
+	Connections int
+	// RejectedMaxClients - отклонено, потому что открыто max_connections соединений
+	RejectedMaxClients uint64
+	// RejectedPerIP - отклонено, потому что с адреса клиента открыто max_connections_per_ip соединений
+	RejectedPerIP uint64
+}
+
+// admission - допуск новых соединений. Не блокирует: если мест нет, соединение сразу отклоняется,
+// и цикл приема продолжает принимать остальных
+type admission struct {
+	// semaphore - общий лимит, nil - без ограничения
+	semaphore *utils.Semaphore
+	// perIP - лимит соединений с одного IP, 0 - без ограничения
+	perIP int
+
+	mu          sync.Mutex
+	byIP        map[string]int
+	connections int
+
+	rejectedMaxClients atomic.Uint64
+	rejectedPerIP      atomic.Uint64
+}
+
+func newAdmission(maxConnections, perIP int) *admission {
+	a := &admission{perIP: perIP, byIP: make(map[string]int)}
+	if maxConnections != 0 {
+		a.semaphore = utils.NewSemaphore(maxConnections)
+	}
+
+	return a
+}
+
+// admit - занимает место для соединения с адреса ip. ErrMaxClientsPerIP или ErrMaxClients, если мест нет
+func (a *admission) admit(ip string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.perIP != 0 && a.byIP[ip] >= a.perIP {
+		a.rejectedPerIP.Add(1)
+		return ErrMaxClientsPerIP
+	}
+
+	if a.semaphore != nil && !a.semaphore.TryAcquire() {
+		a.rejectedMaxClients.Add(1)
+		return ErrMaxClients
+	}
+
+	a.byIP[ip]++
+	a.connections++
+
+	return nil
+}
+
+// release - освобождает место соединения, допущенного admit
+func (a *admission) release(ip string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.semaphore != nil {
+		a.semaphore.Release()
+	}
+
+	a.connections--
+	if a.byIP[ip]--; a.byIP[ip] <= 0 {
+		delete(a.byIP, ip)
+	}
+}
+
+func (a *admission) stats() AdmissionStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return AdmissionStats{
+		Connections:        a.connections,
+		RejectedMaxClients: a.rejectedMaxClients.Load(),
+		RejectedPerIP:      a.rejectedPerIP.Load(),
+	}
+}
+
+// remoteIP - IP клиента без порта, по нему считается лимит на адрес
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+
+	return host
+}
@@ -0,0 +1,158 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TimonKK/inmemory-db/internal/config"
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+	"go.uber.org/zap"
+)
+
+// DefaultCDCRetryInterval - пауза перед переподключением CDCConsumer после разрыва соединения
+const DefaultCDCRetryInterval = time.Second
+
+// CDCConsumer - читает ленту изменений CDC. После разрыва соединения переподключается и продолжает
+// с записи, следующей за последней полученной, поэтому изменения не теряются и не повторяются
+type CDCConsumer struct {
+	config *config.ClientNetworkConfig
+	logger *zap.Logger
+	client *TCPClient
+
+	// next - номер следующего ожидаемого изменения
+	next          uint64
+	retryInterval time.Duration
+}
+
+// NewCDCConsumer - from - номер первого нужного изменения, 0 или 1 - с начала WAL.
+// Подключается при первом вызове Next
+func NewCDCConsumer(config *config.ClientNetworkConfig, from uint64, logger *zap.Logger) *CDCConsumer {
+	return &CDCConsumer{
+		config:        config,
+		logger:        logger,
+		next:          max(from, 1),
+		retryInterval: DefaultCDCRetryInterval,
+	}
+}
+
+// Next - следующее изменение. Ждет, пока оно появится, или отмены ctx. Сетевые ошибки не возвращаются:
+// после них Next переподключается сам
+func (c *CDCConsumer) Next(ctx context.Context) (compute.Change, error) {
+	for {
+		if ctx.Err() != nil {
+			return compute.Change{}, ctx.Err()
+		}
+
+		if c.client == nil {
+			if err := c.connect(); err != nil {
+				c.logger.Warn("CDCConsumer: failed to connect", zap.Error(err))
+				if err := c.wait(ctx); err != nil {
+					return compute.Change{}, err
+				}
+
+				continue
+			}
+		}
+
+		line, err := c.receive(ctx)
+		if err != nil {
+			c.disconnect()
+			if ctx.Err() != nil {
+				return compute.Change{}, ctx.Err()
+			}
+
+			c.logger.Warn("CDCConsumer: connection lost", zap.Uint64("next", c.next), zap.Error(err))
+			if err := c.wait(ctx); err != nil {
+				return compute.Change{}, err
+			}
+
+			continue
+		}
+
+		change, err := compute.ParseChange(line)
+		if err != nil {
+			return compute.Change{}, err
+		}
+
+		if change.Seq != c.next {
+			return compute.Change{}, fmt.Errorf("%w: expected change %d, got %d", compute.ErrInvalidRecord, c.next, change.Seq)
+		}
+		c.next++
+
+		return change, nil
+	}
+}
+
+// NextSeq - номер следующего изменения, с него можно продолжить в новом CDCConsumer
+func (c *CDCConsumer) NextSeq() uint64 {
+	return c.next
+}
+
+func (c *CDCConsumer) Close() error {
+	if c.client == nil {
+		return nil
+	}
+
+	err := c.client.Close()
+	c.client = nil
+
+	return err
+}
+
+func (c *CDCConsumer) connect() error {
+	client, err := NewTCPClient(c.config, c.logger)
+	if err != nil {
+		return err
+	}
+
+	if err := client.write(string(compute.CDCCommandId) + " " + strconv.FormatUint(c.next, 10)); err != nil {
+		_ = client.Close()
+		return err
+	}
+
+	c.client = client
+
+	return nil
+}
+
+// receive - следующая строка ленты. Отмена ctx прерывает ожидание. Ответ об ошибке заканчивает ленту,
+// как и разрыв соединения
+func (c *CDCConsumer) receive(ctx context.Context) (string, error) {
+	conn := c.client.conn
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	line, err := c.client.Receive()
+	if err != nil {
+		return "", err
+	}
+
+	if message, ok := strings.CutPrefix(line, ErrorResponsePrefix); ok {
+		return "", fmt.Errorf("stream closed by server: %s", strings.TrimSpace(message))
+	}
+
+	return line, nil
+}
+
+func (c *CDCConsumer) disconnect() {
+	if err := c.Close(); err != nil {
+		c.logger.Warn("CDCConsumer: failed to close connection", zap.Error(err))
+	}
+}
+
+func (c *CDCConsumer) wait(ctx context.Context) error {
+	timer := time.NewTimer(c.retryInterval)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,83 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TimonKK/inmemory-db/internal/config"
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestCDCConsumer_Reconnect(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []string
+		connects atomic.Int32
+	)
+
+	address := startTestTCPServer(t, func(ctx context.Context, query string) (string, error) {
+		mu.Lock()
+		requests = append(requests, strings.TrimSpace(query))
+		mu.Unlock()
+
+		from, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(query), "CDC "), 10, 64)
+		if err != nil {
+			return "", err
+		}
+
+		session, _ := SessionFromContext(ctx)
+		// первое соединение отдает два изменения и заканчивается ошибкой, второе - продолжает ленту
+		to := from + 1
+		if connects.Add(1) > 1 {
+			to = from
+		}
+		for seq := from; seq <= to; seq++ {
+			if err := session.Write(fmt.Sprintf("change %d 0 SET k%d v", seq, seq)); err != nil {
+				return "", err
+			}
+		}
+
+		if connects.Load() == 1 {
+			return "", errors.New("connection reset")
+		}
+
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+
+	consumer := NewCDCConsumer(&config.ClientNetworkConfig{Address: address, DialTimeout: time.Second}, 0, zap.NewNop())
+	consumer.retryInterval = 10 * time.Millisecond
+	defer func() { _ = consumer.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for seq := uint64(1); seq <= 3; seq++ {
+		change, err := consumer.Next(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, seq, change.Seq)
+		assert.Equal(t, compute.SetCommandId, change.Op())
+		assert.Equal(t, "k"+strconv.FormatUint(seq, 10), change.Key())
+	}
+
+	assert.Equal(t, uint64(4), consumer.NextSeq())
+	mu.Lock()
+	assert.Equal(t, []string{"CDC 1", "CDC 3"}, requests)
+	mu.Unlock()
+
+	// отмена контекста прерывает ожидание следующего изменения
+	cancelCtx, cancelNext := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancelNext)
+	_, err := consumer.Next(cancelCtx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,210 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+type sessionKey struct{}
+
+// Session - соединение клиента. Кроме ответов на запросы сервер может писать в него сообщения без запроса
+// (push mode, например pub/sub). Обработчик запроса получает сессию через SessionFromContext
+type Session struct {
+	conn net.Conn
+	// outputLimit - сколько байт push сообщений может ждать отправки, 0 - без ограничения
+	outputLimit int
+	logger      *zap.Logger
+
+	// writeMu - ответы и push сообщения не должны перемешиваться внутри строки
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	user     string
+	pushMode bool
+	queue    []string
+	queued   int
+	closed   bool
+
+	wake      chan struct{}
+	done      chan struct{}
+	writer    sync.Once
+	closeOnce sync.Once
+}
+
+func NewSession(conn net.Conn, outputLimit int, logger *zap.Logger) *Session {
+	return &Session{
+		conn:        conn,
+		outputLimit: outputLimit,
+		logger:      logger,
+		wake:        make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+}
+
+// WithSession - контекст запроса с сессией клиента
+func WithSession(ctx context.Context, session *Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, session)
+}
+
+// SessionFromContext - сессия клиента, ok=false если запрос пришел не по сети
+func SessionFromContext(ctx context.Context) (*Session, bool) {
+	session, ok := ctx.Value(sessionKey{}).(*Session)
+	return session, ok
+}
+
+// Identity - имя клиента из проверенного TLS сертификата (CommonName), пустое без него
+func (s *Session) Identity() string {
+	if cert := s.PeerCertificate(); cert != nil {
+		return cert.Subject.CommonName
+	}
+
+	return ""
+}
+
+// PeerCertificate - проверенный TLS сертификат клиента, nil без TLS или если клиент его не прислал
+func (s *Session) PeerCertificate() *x509.Certificate {
+	tlsConn, ok := s.conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+
+	state := tlsConn.ConnectionState()
+	if len(state.VerifiedChains) == 0 {
+		return nil
+	}
+
+	return state.VerifiedChains[0][0]
+}
+
+// SetUser - пользователь ACL, которым клиент вошел через AUTH
+func (s *Session) SetUser(user string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.user = user
+}
+
+// User - пользователь ACL, пустой, если клиент еще не входил
+func (s *Session) User() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.user
+}
+
+// RemoteAddr - адрес клиента
+func (s *Session) RemoteAddr() string {
+	return s.conn.RemoteAddr().String()
+}
+
+// SetPushMode - включает или выключает push mode. В push mode сервер пишет сообщения из Push
+// и не отключает клиента по IdleTimeout
+func (s *Session) SetPushMode(on bool) {
+	s.mu.Lock()
+	s.pushMode = on
+	s.mu.Unlock()
+
+	if on {
+		s.writer.Do(func() {
+			go s.writePushes()
+		})
+	}
+}
+
+func (s *Session) PushMode() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pushMode
+}
+
+// Push - ставит сообщение в очередь отправки, не блокируясь. Если очередь превысила outputLimit,
+// клиент не успевает читать: соединение закрывается, а Push возвращает false
+func (s *Session) Push(message string) bool {
+	s.mu.Lock()
+	if s.closed || !s.pushMode {
+		s.mu.Unlock()
+		return false
+	}
+
+	if s.outputLimit > 0 && s.queued+len(message)+1 > s.outputLimit {
+		s.mu.Unlock()
+
+		s.logger.Warn(
+			"session: output buffer limit exceeded, disconnecting slow consumer",
+			zap.String("remote", s.RemoteAddr()),
+			zap.Int("limit", s.outputLimit),
+		)
+		s.Close()
+
+		return false
+	}
+
+	s.queue = append(s.queue, message)
+	s.queued += len(message) + 1
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	return true
+}
+
+// Write - пишет ответ на запрос
+func (s *Session) Write(response string) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	_, err := s.conn.Write([]byte(response + "\n"))
+	return err
+}
+
+// Close - закрывает соединение, сообщения из очереди отброшены
+func (s *Session) Close() {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.closed, s.queue, s.queued = true, nil, 0
+		s.mu.Unlock()
+
+		close(s.done)
+		if err := s.conn.Close(); err != nil {
+			s.logger.Warn("session: failed to close connection", zap.Error(err))
+		}
+	})
+}
+
+// writePushes - отправляет очередь push сообщений, пока соединение открыто
+func (s *Session) writePushes() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		}
+
+		s.mu.Lock()
+		queue := s.queue
+		s.queue = nil
+		s.mu.Unlock()
+
+		for _, message := range queue {
+			if err := s.Write(message); err != nil {
+				s.logger.Warn("session: failed to push message", zap.String("remote", s.RemoteAddr()), zap.Error(err))
+				s.Close()
+				return
+			}
+
+			// байты считаются в очереди, пока не записаны: медленный клиент держит их в буфере сервера
+			s.mu.Lock()
+			s.queued = max(s.queued-len(message)-1, 0)
+			s.mu.Unlock()
+		}
+	}
+}
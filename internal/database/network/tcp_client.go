@@ -2,18 +2,23 @@ package network
 
 import (
 	"bufio"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"github.com/TimonKK/inmemory-db/internal/config"
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
 	"go.uber.org/zap"
 	"io"
 	"net"
+	"time"
 )
 
 type TCPClient struct {
 	config *config.ClientNetworkConfig
 	logger *zap.Logger
 	conn   net.Conn
+	// reader - общий для всех ответов: в push mode сервер может прислать несколько строк подряд
+	reader *bufio.Reader
 }
 
 func NewTCPClient(config *config.ClientNetworkConfig, logger *zap.Logger) (*TCPClient, error) {
@@ -32,12 +37,28 @@ func NewTCPClient(config *config.ClientNetworkConfig, logger *zap.Logger) (*TCPC
 
 // Connect - подключает клиента к базе. Потоконебезопастнный
 func (c *TCPClient) сonnect() error {
-	conn, err := net.Dial("tcp", c.config.Address)
-	if err != nil {
-		return err
+	dialer := &net.Dialer{Timeout: c.config.DialTimeout}
+
+	var conn net.Conn
+	if c.config.TLS.Enabled {
+		tlsConfig, err := NewClientTLSConfig(c.config.TLS, c.config.Address, c.logger)
+		if err != nil {
+			return err
+		}
+
+		// рукопожатие сразу, чтобы ошибка сертификата была ошибкой подключения, а не первого запроса
+		if conn, err = tls.DialWithDialer(dialer, "tcp", c.config.Address, tlsConfig); err != nil {
+			return err
+		}
+	} else {
+		var err error
+		if conn, err = dialer.Dial("tcp", c.config.Address); err != nil {
+			return err
+		}
 	}
 
 	c.conn = conn
+	c.reader = bufio.NewReader(conn)
 
 	c.logger.Info("Connected to server", zap.String("address", c.config.Address))
 
@@ -45,7 +66,16 @@ func (c *TCPClient) сonnect() error {
 }
 
 func (c *TCPClient) Send(query string) (string, error) {
-	c.logger.Info("Sending query", zap.String("query", query))
+	if err := c.write(query); err != nil {
+		return "", err
+	}
+
+	return c.Receive()
+}
+
+// write - отправляет запрос, не дожидаясь ответа
+func (c *TCPClient) write(query string) error {
+	c.logger.Info("Sending query", zap.String("query", compute.Redact(query)))
 
 	// TODO подумать что делать если запись упала:
 	// 1) реконнект от греха подальше
@@ -56,22 +86,27 @@ func (c *TCPClient) Send(query string) (string, error) {
 		switch {
 		case errors.Is(err, net.ErrClosed):
 			c.logger.Error("Connection already closed")
-			return "", err
+			return err
 		case errors.Is(err, io.ErrShortWrite):
 			c.logger.Error("Partial write occurred")
-			return "", err
+			return err
 		default:
 			c.logger.Error("Network write error: %v", zap.Error(err))
-			return "", fmt.Errorf("network error: %w", err)
+			return fmt.Errorf("network error: %w", err)
 		}
 	}
 
 	if bytesWritten != (len(query) + 1) {
 		c.logger.Warn("Partial write: %d of %d bytes", zap.Int("bytesWritten", bytesWritten), zap.Int("query", len(query)))
-		return "", fmt.Errorf("partial write")
+		return fmt.Errorf("partial write")
 	}
 
-	response, err := bufio.NewReader(c.conn).ReadString('\n')
+	return nil
+}
+
+// Receive - читает следующую строку от сервера: ответ или push сообщение подписки
+func (c *TCPClient) Receive() (string, error) {
+	response, err := c.reader.ReadString('\n')
 	if err != nil {
 		return "", err
 	}
@@ -79,6 +114,11 @@ func (c *TCPClient) Send(query string) (string, error) {
 	return response, nil
 }
 
+// SetDeadline - срок для записи запросов и чтения ответов, нулевое время - без срока
+func (c *TCPClient) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
 func (c *TCPClient) Close() error {
 	if c.conn != nil {
 		err := c.conn.Close()
@@ -13,6 +13,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 // mockTCPServer мок сервера
@@ -245,3 +246,23 @@ func TestTCPClient_Close_NotConnected(t *testing.T) {
 	_, err := NewTCPClient(cfg, logger)
 	require.Error(t, err, " connect: connection refused")
 }
+
+func TestTCPClient_RedactsSecrets(t *testing.T) {
+	server := newMockTCPServer(t, func(conn net.Conn) {
+		_, _ = bufio.NewReader(conn).ReadString('\n')
+		_, _ = conn.Write([]byte("ok\n"))
+	})
+	defer server.Close()
+
+	core, logs := observer.New(zap.InfoLevel)
+	client, err := NewTCPClient(&config.ClientNetworkConfig{Address: server.address, IdleTimeout: time.Second}, zap.New(core))
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	_, err = client.Send("AUTH alice hunter2")
+	require.NoError(t, err)
+
+	sent := logs.FilterMessage("Sending query").All()
+	require.Len(t, sent, 1)
+	assert.Equal(t, "AUTH ***", sent[0].ContextMap()["query"])
+}
@@ -3,21 +3,90 @@ package network
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/TimonKK/inmemory-db/internal/config"
-	"github.com/TimonKK/inmemory-db/internal/utils"
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
 	"go.uber.org/zap"
 	"io"
 	"net"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const (
+	// rejectTimeout - сколько сервер пытается отправить ответ отклоненному клиенту
+	rejectTimeout = time.Second
+
+	// ErrorResponsePrefix - начало ответа об ошибке
+	ErrorResponsePrefix = "error: "
+)
+
+var (
+	// ErrShuttingDown - причина отключения клиентов при остановке сервера
+	ErrShuttingDown = errors.New("server is shutting down")
+	// ErrShutdownTimeout - за время ожидания не все запросы завершились, их соединения закрыты принудительно
+	ErrShutdownTimeout = errors.New("shutdown grace period expired")
+
+	// errDisconnected - клиент отключился во время запроса, ответ на ошибку отправлять некому
+	errDisconnected = errors.New("client disconnected during request")
+)
+
+// RequestHandler - обработчик запроса. Ошибка отправляется клиенту ответом "error: <msg>", и сессия продолжается.
+// Соединение закрывается, только если клиент отключился или ответ не удалось записать
 type RequestHandler = func(context.Context, string) (string, error)
 
+type (
+	stoppingKey struct{}
+	watchKey    struct{}
+)
+
+// Interruptible - контекст запроса, который ждет данных без ограничения по времени (BLPOP, CDC). Кроме ctx
+// он отменяется в начале остановки сервера, иначе такой запрос задержал бы Shutdown на весь grace period,
+// и при отключении клиента, иначе команда ждала бы и снимала элемент для клиента, которого уже нет.
+// Вне сервера это просто дочерний контекст ctx
+func Interruptible(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	if watch, ok := ctx.Value(watchKey{}).(*disconnectWatch); ok {
+		watch.start(cancel)
+	}
+
+	stopping, ok := ctx.Value(stoppingKey{}).(context.Context)
+	if !ok {
+		return ctx, cancel
+	}
+
+	stop := context.AfterFunc(stopping, cancel)
+
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// DisconnectHandler - вызывается после закрытия соединения с контекстом, в котором лежит его Session
+type DisconnectHandler = func(context.Context)
+
 type TCPServer struct {
 	// TODO указатель?!
 	listener  net.Listener
-	semaphore *utils.Semaphore
+	admission *admission
+
+	disconnectHandler DisconnectHandler
+
+	// closing - сервер останавливается: соединения закрываются после текущего запроса
+	closing atomic.Bool
+	// stopping - отменяется в начале Shutdown, по нему прерываются запросы из Interruptible
+	stopping context.Context
+	stop     context.CancelFunc
+	// conns - открытые соединения и отмена их запросов, handlers - их обработчики. Shutdown ждет handlers
+	mu       sync.Mutex
+	conns    map[net.Conn]context.CancelFunc
+	handlers sync.WaitGroup
 
 	config config.NetworkConfig
 	logger *zap.Logger
@@ -29,31 +98,109 @@ func NewTCPServer(config config.NetworkConfig, logger *zap.Logger) (*TCPServer,
 		return nil, fmt.Errorf("%w: failed to listen %s", err, config.Address)
 	}
 
+	if config.TLS.Enabled {
+		tlsConfig, err := NewServerTLSConfig(config.TLS, logger)
+		if err != nil {
+			_ = listener.Close()
+			return nil, err
+		}
+
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
 	server := &TCPServer{
-		listener: listener,
+		listener:  listener,
+		admission: newAdmission(config.MaxConnections, config.MaxConnectionsPerIP),
+		conns:     make(map[net.Conn]context.CancelFunc),
 
 		config: config,
 		logger: logger,
 	}
-
-	if config.MaxConnections != 0 {
-		server.semaphore = utils.NewSemaphore(config.MaxConnections)
-	}
+	server.stopping, server.stop = context.WithCancel(context.Background())
 
 	return server, nil
 }
 
+// SetDisconnectHandler - обработчик закрытия соединений, задается до HandleConnect
+func (s *TCPServer) SetDisconnectHandler(handler DisconnectHandler) {
+	s.disconnectHandler = handler
+}
+
 func (s *TCPServer) Start() error {
 	return nil
 }
 
-func (s *TCPServer) Shutdown() error {
-	err := s.listener.Close()
-	if err != nil {
+// Shutdown - перестает принимать соединения и ждет, пока выполняемые запросы завершатся. Клиенты, которые ждут
+// между запросами (и подписчики pub/sub), получают ErrShuttingDown и отключаются сразу, остальные - после ответа
+// на текущий запрос. Запросы, которые ждут данных без ограничения (Interruptible: BLPOP, CDC), отменяются сразу,
+// их клиенты тоже получают ErrShuttingDown. Когда ctx отменяется, оставшиеся соединения закрываются, их запросы отменяются,
+// а Shutdown возвращает ErrShutdownTimeout после того, как обработчики вышли
+func (s *TCPServer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing.Store(true)
+	s.stop()
+	conns := make([]net.Conn, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	s.mu.Unlock()
+
+	var err error
+	if closeErr := s.listener.Close(); closeErr != nil && !errors.Is(closeErr, net.ErrClosed) {
+		err = closeErr
+	}
+
+	// прерывает ожидание следующего запроса, соединение с запросом в работе заметит closing после ответа
+	for _, conn := range conns {
+		_ = conn.SetReadDeadline(time.Now())
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.handlers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
 		return err
+	case <-ctx.Done():
 	}
 
-	return nil
+	s.mu.Lock()
+	s.logger.Warn("shutdown: grace period expired, closing connections", zap.Int("connections", len(s.conns)))
+	for conn, cancel := range s.conns {
+		cancel()
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+	<-done
+
+	return errors.Join(err, ErrShutdownTimeout)
+}
+
+// track - регистрирует соединение, cancel отменяет его запросы. false - сервер уже останавливается
+// и соединение не обслуживается
+func (s *TCPServer) track(conn net.Conn, cancel context.CancelFunc) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closing.Load() {
+		return false
+	}
+
+	s.conns[conn] = cancel
+	s.handlers.Add(1)
+
+	return true
+}
+
+func (s *TCPServer) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+
+	s.handlers.Done()
 }
 
 func (s *TCPServer) HandleConnect(ctx context.Context, handler RequestHandler) {
@@ -64,19 +211,36 @@ func (s *TCPServer) HandleConnect(ctx context.Context, handler RequestHandler) {
 
 		conn, err := s.listener.Accept()
 		if err != nil {
-			s.logger.Error("failed to accept connection", zap.Error(err))
+			if s.closing.Load() {
+				s.logger.Info("handleConnect: listener closed, no longer accepting connections")
+			} else {
+				s.logger.Error("failed to accept connection", zap.Error(err))
+			}
 			break
 		}
 
-		// TODO добавить методв TryAcquire, чтобы если нельзя - ответить клиенту ошибкой что нельзя
-		s.tryAcquire()
+		ip := remoteIP(conn)
+		if err := s.admission.admit(ip); err != nil {
+			go s.reject(conn, err)
+			continue
+		}
+
+		connCtx, cancel := context.WithCancel(ctx)
+		if !s.track(conn, cancel) {
+			cancel()
+			s.admission.release(ip)
+			go s.reject(conn, ErrShuttingDown)
+			continue
+		}
 
 		s.logger.Info("handleConnect: handling new connection", zap.String("remote", conn.RemoteAddr().String()))
 
 		go func() {
-			defer s.Release()
+			defer s.untrack(conn)
+			defer cancel()
+			defer s.admission.release(ip)
 
-			err := s.handleConnect(ctx, conn, handler)
+			err := s.handleConnect(connCtx, conn, handler)
 			if err != nil {
 				// TODO добавить контексту, а что за коннект: ip, какие данные может успели прочитать
 				s.logger.Error("failed to handle connect", zap.Error(err))
@@ -87,26 +251,52 @@ func (s *TCPServer) HandleConnect(ctx context.Context, handler RequestHandler) {
 }
 
 func (s *TCPServer) handleConnect(ctx context.Context, conn net.Conn, handler RequestHandler) error {
+	if err := s.handshake(conn); err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	session := NewSession(conn, int(s.config.MaxOutputBuffer), s.logger)
+	ctx = context.WithValue(WithSession(ctx, session), stoppingKey{}, s.stopping)
+
 	defer func() {
 		if v := recover(); v != nil {
 			s.logger.Error("handleConnect: captured panic", zap.Any("panic", v))
 		}
 
-		if err := conn.Close(); err != nil {
-			s.logger.Warn("handleConnect: failed to close connection", zap.Error(err))
+		session.Close()
+
+		if s.disconnectHandler != nil {
+			s.disconnectHandler(ctx)
 		}
 	}()
 
+	reader := bufio.NewReader(conn)
+
 	for {
-		if s.config.IdleTimeout != 0 {
-			if err := conn.SetReadDeadline(time.Now().Add(s.config.IdleTimeout)); err != nil {
-				s.logger.Error("failed to set read deadline", zap.Duration("IdleTimeout", s.config.IdleTimeout), zap.Error(err))
-				return err
-			}
+		// IdleTimeout считается только между запросами: клиент, ждущий ответа на блокирующую команду, не простаивает.
+		// Подписчик в push mode может вообще ничего не присылать
+		var deadline time.Time
+		if s.config.IdleTimeout != 0 && !session.PushMode() {
+			deadline = time.Now().Add(s.config.IdleTimeout)
 		}
 
-		query, err := bufio.NewReader(conn).ReadString('\n')
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			s.logger.Error("failed to set read deadline", zap.Duration("IdleTimeout", s.config.IdleTimeout), zap.Error(err))
+			return err
+		}
+
+		// проверка после установки срока чтения: Shutdown, начавшийся позже, прервет чтение своим сроком
+		if s.closing.Load() {
+			return s.goodbye(session)
+		}
+
+		query, err := reader.ReadString('\n')
 		if err != nil {
+			if s.closing.Load() {
+				return s.goodbye(session)
+			}
+
 			if err != io.EOF {
 				s.logger.Error("handleConnect: failed to read data", zap.Error(err))
 			} else if len(query) >= int(s.config.MaxMessageSize) {
@@ -115,15 +305,25 @@ func (s *TCPServer) handleConnect(ctx context.Context, conn net.Conn, handler Re
 			return err
 		}
 
-		s.logger.Info("handleConnect: request", zap.String("request", query))
-		res, err := handler(ctx, query)
+		s.logger.Info("handleConnect: request", zap.String("request", compute.Redact(query)))
+		res, err := s.handleRequest(ctx, conn, reader, query, handler)
 		if err != nil {
-			s.logger.Error("handleConnect: failed to handle request", zap.Error(err))
-			return err
+			if errors.Is(err, errDisconnected) {
+				s.logger.Info("handleConnect: failed to handle request", zap.Error(err))
+				return err
+			}
+
+			// запрос прерван остановкой сервера
+			if s.closing.Load() && errors.Is(err, context.Canceled) {
+				return s.goodbye(session)
+			}
+
+			s.logger.Info("handleConnect: request failed", zap.Error(err))
+			res = ErrorResponse(err)
 		}
 		s.logger.Info("handleConnect: response", zap.String("response", res))
 
-		if _, err := conn.Write([]byte(res + "\n")); err != nil {
+		if err := session.Write(res); err != nil {
 			s.logger.Error(
 				"handleConnect: failed to write data",
 				zap.String("address", conn.RemoteAddr().String()),
@@ -136,14 +336,145 @@ func (s *TCPServer) handleConnect(ctx context.Context, conn net.Conn, handler Re
 	}
 }
 
-func (s *TCPServer) tryAcquire() {
-	if s.semaphore != nil {
-		s.semaphore.Acquire()
+// goodbye - сообщает клиенту об остановке сервера перед закрытием соединения
+func (s *TCPServer) goodbye(session *Session) error {
+	if err := session.Write(ErrorResponse(ErrShuttingDown)); err != nil {
+		s.logger.Debug("handleConnect: failed to write shutdown notice", zap.Error(err))
 	}
+
+	return nil
 }
 
-func (s *TCPServer) Release() {
-	if s.semaphore != nil {
-		s.semaphore.Release()
+// handshake - TLS рукопожатие до первого запроса, чтобы сертификат клиента был известен сессии.
+// Клиент, который не закончил его за IdleTimeout, отключается
+func (s *TCPServer) handshake(conn net.Conn) error {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
 	}
+
+	var deadline time.Time
+	if s.config.IdleTimeout != 0 {
+		deadline = time.Now().Add(s.config.IdleTimeout)
+	}
+
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	if err := tlsConn.Handshake(); err != nil {
+		return fmt.Errorf("tls handshake with %s: %w", conn.RemoteAddr(), err)
+	}
+
+	return conn.SetDeadline(time.Time{})
+}
+
+// handleRequest - выполняет запрос. Ждущий запрос (Interruptible) следит за отключением клиента,
+// его ошибка у отключившегося клиента оборачивается в errDisconnected. Остальные запросы соединение не трогают
+func (s *TCPServer) handleRequest(
+	ctx context.Context,
+	conn net.Conn,
+	reader *bufio.Reader,
+	query string,
+	handler RequestHandler,
+) (res string, err error) {
+	watch := &disconnectWatch{conn: conn, reader: reader, logger: s.logger}
+	defer func() {
+		if watch.stop() && err != nil {
+			err = fmt.Errorf("%w: %w", errDisconnected, err)
+		}
+	}()
+
+	return handler(context.WithValue(ctx, watchKey{}, watch), query)
+}
+
+// disconnectWatch - следит во время запроса, не закрыл ли клиент соединение. Запускается только из Interruptible:
+// обычному запросу отдельная горутина и смена read deadline не нужны. Вызывается в горутине запроса
+type disconnectWatch struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	logger *zap.Logger
+
+	done         chan struct{}
+	disconnected bool
+}
+
+// start - отменяет запрос через cancel, если клиент отключится. Повторный вызов ничего не делает
+func (w *disconnectWatch) start(cancel context.CancelFunc) {
+	if w.done != nil {
+		return
+	}
+	w.done = make(chan struct{})
+
+	// между запросами действует IdleTimeout, ждущий запрос он не ограничивает
+	if err := w.conn.SetReadDeadline(time.Time{}); err != nil {
+		w.disconnected = true
+		close(w.done)
+		cancel()
+		return
+	}
+
+	go func() {
+		defer close(w.done)
+
+		// Peek не забирает данные, следующий запрос, если клиент его уже прислал, останется в reader
+		if _, err := w.reader.Peek(1); err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+			w.logger.Info("handleConnect: client disconnected during request", zap.Error(err))
+			w.disconnected = true
+			cancel()
+		}
+	}()
+}
+
+// stop - останавливает наблюдение и сообщает, отключился ли клиент
+func (w *disconnectWatch) stop() bool {
+	if w.done == nil {
+		return false
+	}
+
+	// прерывает Peek, если клиент ничего не прислал
+	if err := w.conn.SetReadDeadline(time.Now()); err != nil {
+		w.logger.Warn("handleConnect: failed to interrupt disconnect watcher", zap.Error(err))
+	}
+	<-w.done
+
+	return w.disconnected
+}
+
+// ErrorResponse - ответ клиенту об ошибке: "error: <msg>"
+func ErrorResponse(err error) string {
+	return ErrorResponsePrefix + err.Error()
+}
+
+// reject - отвечает клиенту, почему его не приняли, и закрывает соединение. Клиент, который не читает ответ,
+// не задерживает сервер дольше rejectTimeout
+func (s *TCPServer) reject(conn net.Conn, reason error) {
+	stats := s.admission.stats()
+	s.logger.Warn(
+		"handleConnect: connection rejected",
+		zap.String("remote", conn.RemoteAddr().String()),
+		zap.Error(reason),
+		zap.Uint64("rejected_max_clients", stats.RejectedMaxClients),
+		zap.Uint64("rejected_per_ip", stats.RejectedPerIP),
+	)
+
+	defer func() { _ = conn.Close() }()
+
+	if err := conn.SetDeadline(time.Now().Add(rejectTimeout)); err != nil {
+		return
+	}
+
+	if _, err := conn.Write([]byte(ErrorResponse(reason) + "\n")); err != nil {
+		s.logger.Debug("handleConnect: failed to write rejection", zap.Error(err))
+	}
+}
+
+// Addr - адрес, на котором сервер принимает соединения
+func (s *TCPServer) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// AdmissionStats - открытые соединения и счетчики отклоненных
+func (s *TCPServer) AdmissionStats() AdmissionStats {
+	return s.admission.stats()
 }
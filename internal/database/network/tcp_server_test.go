@@ -0,0 +1,394 @@
+package network
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TimonKK/inmemory-db/internal/config"
+	"github.com/TimonKK/inmemory-db/internal/database/pubsub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func startTestTCPServer(t *testing.T, handler RequestHandler) string {
+	t.Helper()
+
+	server, err := NewTCPServer(config.NetworkConfig{
+		Address:         "127.0.0.1:0",
+		MaxMessageSize:  1024,
+		IdleTimeout:     time.Second,
+		MaxOutputBuffer: 4096,
+	}, zap.NewNop())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go server.HandleConnect(ctx, handler)
+
+	t.Cleanup(func() {
+		cancel()
+		_ = server.Shutdown(context.Background())
+	})
+
+	return server.listener.Addr().String()
+}
+
+func TestTCPServer_PipelinedRequests(t *testing.T) {
+	address := startTestTCPServer(t, func(_ context.Context, query string) (string, error) {
+		return "echo " + strings.TrimSpace(query), nil
+	})
+
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	// оба запроса одной записью: второй не должен потеряться в буфере чтения
+	_, err = conn.Write([]byte("GET a\nGET b\n"))
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(conn)
+	for _, want := range []string{"echo GET a\n", "echo GET b\n"} {
+		response, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, want, response)
+	}
+}
+
+func TestTCPServer_ErrorResponse(t *testing.T) {
+	errWrongType := errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	address := startTestTCPServer(t, func(_ context.Context, query string) (string, error) {
+		if strings.HasPrefix(query, "LPUSH") {
+			return "", errWrongType
+		}
+
+		return "echo " + strings.TrimSpace(query), nil
+	})
+
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	// ошибка команды - ответ, сессия продолжается
+	reader := bufio.NewReader(conn)
+	for _, step := range [][2]string{
+		{"LPUSH s a", "error: " + errWrongType.Error() + "\n"},
+		{"GET s", "echo GET s\n"},
+	} {
+		_, err = conn.Write([]byte(step[0] + "\n"))
+		require.NoError(t, err)
+
+		response, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, step[1], response)
+	}
+}
+
+func TestTCPServer_CancelOnDisconnect(t *testing.T) {
+	started, cancelled := make(chan struct{}), make(chan struct{})
+	address := startTestTCPServer(t, func(ctx context.Context, _ string) (string, error) {
+		// за отключением следят только ждущие запросы
+		ctx, cancel := Interruptible(ctx)
+		defer cancel()
+
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+
+		return "", ctx.Err()
+	})
+
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+
+	_, err = conn.Write([]byte("BLPOP jobs 0\n"))
+	require.NoError(t, err)
+
+	<-started
+	require.NoError(t, conn.Close())
+
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request context was not cancelled after client disconnect")
+	}
+}
+
+// subscribeHandler - SUBSCRIBE channel переводит соединение в push mode, остальные запросы - "ok"
+func subscribeHandler(broker *pubsub.Broker, subscribed chan<- *Session) RequestHandler {
+	return func(ctx context.Context, query string) (string, error) {
+		channel, ok := strings.CutPrefix(strings.TrimSpace(query), "SUBSCRIBE ")
+		if !ok {
+			return "ok", nil
+		}
+
+		session, _ := SessionFromContext(ctx)
+		session.SetPushMode(true)
+		broker.Subscribe(session, channel)
+		subscribed <- session
+
+		return "result: 1", nil
+	}
+}
+
+func TestTCPServer_PushMode(t *testing.T) {
+	broker, subscribed := pubsub.NewBroker(), make(chan *Session, 1)
+	address := startTestTCPServer(t, subscribeHandler(broker, subscribed))
+
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	_, err = conn.Write([]byte("SUBSCRIBE news\n"))
+	require.NoError(t, err)
+	<-subscribed
+
+	reader := bufio.NewReader(conn)
+	response, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "result: 1\n", response)
+
+	// дольше IdleTimeout: подписчик в push mode не отключается
+	time.Sleep(1500 * time.Millisecond)
+	assert.Equal(t, 1, broker.Publish("news", "hello"))
+
+	response, err = reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "message news hello\n", response)
+
+	// в push mode соединение по-прежнему принимает запросы
+	_, err = conn.Write([]byte("PING\n"))
+	require.NoError(t, err)
+
+	response, err = reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "ok\n", response)
+}
+
+func TestTCPServer_SlowConsumer(t *testing.T) {
+	broker, subscribed := pubsub.NewBroker(), make(chan *Session, 1)
+	address := startTestTCPServer(t, subscribeHandler(broker, subscribed))
+
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	_, err = conn.Write([]byte("SUBSCRIBE news\n"))
+	require.NoError(t, err)
+	session := <-subscribed
+
+	// клиент ничего не читает: когда заполнятся буферы сокета, очередь упрется в MaxOutputBuffer
+	message := strings.Repeat("x", 1000)
+	disconnected := false
+	for range 1_000_000 {
+		if !session.Push(message) {
+			disconnected = true
+			break
+		}
+	}
+	require.True(t, disconnected)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = io.Copy(io.Discard, conn)
+	assert.NoError(t, err, "server should close the connection")
+}
+
+func TestTCPServer_Admission(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxConnections int
+		perIP          int
+		wantErr        error
+		want           AdmissionStats
+	}{
+		{
+			name:           "max clients",
+			maxConnections: 1,
+			wantErr:        ErrMaxClients,
+			want:           AdmissionStats{Connections: 1, RejectedMaxClients: 1},
+		},
+		{
+			name:           "max clients per ip",
+			maxConnections: 10,
+			perIP:          1,
+			wantErr:        ErrMaxClientsPerIP,
+			want:           AdmissionStats{Connections: 1, RejectedPerIP: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := NewTCPServer(config.NetworkConfig{
+				Address:             "127.0.0.1:0",
+				MaxConnections:      tt.maxConnections,
+				MaxConnectionsPerIP: tt.perIP,
+				MaxMessageSize:      1024,
+				IdleTimeout:         time.Second,
+			}, zap.NewNop())
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			go server.HandleConnect(ctx, func(_ context.Context, query string) (string, error) {
+				return strings.TrimSpace(query), nil
+			})
+			t.Cleanup(func() {
+				cancel()
+				_ = server.Shutdown(context.Background())
+			})
+			address := server.listener.Addr().String()
+
+			send := func(conn net.Conn, query string) (string, error) {
+				if _, err := conn.Write([]byte(query + "\n")); err != nil {
+					return "", err
+				}
+				return bufio.NewReader(conn).ReadString('\n')
+			}
+
+			first, err := net.Dial("tcp", address)
+			require.NoError(t, err)
+			response, err := send(first, "PING")
+			require.NoError(t, err)
+			assert.Equal(t, "PING\n", response)
+
+			// лишний клиент сразу получает ошибку, а не ждет в очереди
+			second, err := net.Dial("tcp", address)
+			require.NoError(t, err)
+			defer func() { _ = second.Close() }()
+
+			reader := bufio.NewReader(second)
+			response, err = reader.ReadString('\n')
+			require.NoError(t, err)
+			assert.Equal(t, "error: "+tt.wantErr.Error()+"\n", response)
+			_, err = reader.ReadString('\n')
+			assert.ErrorIs(t, err, io.EOF)
+			assert.Equal(t, tt.want, server.AdmissionStats())
+
+			// место освобождается после закрытия соединения
+			require.NoError(t, first.Close())
+			assert.Eventually(t, func() bool {
+				return server.AdmissionStats().Connections == 0
+			}, 5*time.Second, 10*time.Millisecond)
+
+			third, err := net.Dial("tcp", address)
+			require.NoError(t, err)
+			defer func() { _ = third.Close() }()
+			response, err = send(third, "PING")
+			require.NoError(t, err)
+			assert.Equal(t, "PING\n", response)
+		})
+	}
+}
+
+func TestTCPServer_Shutdown(t *testing.T) {
+	newServer := func(t *testing.T, handler RequestHandler) (*TCPServer, string) {
+		t.Helper()
+
+		server, err := NewTCPServer(config.NetworkConfig{
+			Address:        "127.0.0.1:0",
+			MaxMessageSize: 1024,
+			IdleTimeout:    time.Minute,
+		}, zap.NewNop())
+		require.NoError(t, err)
+
+		go server.HandleConnect(context.Background(), handler)
+
+		return server, server.listener.Addr().String()
+	}
+
+	t.Run("drain", func(t *testing.T) {
+		started, release := make(chan struct{}), make(chan struct{})
+		server, address := newServer(t, func(_ context.Context, query string) (string, error) {
+			if strings.TrimSpace(query) == "SLOW" {
+				close(started)
+				<-release
+				return "done", nil
+			}
+
+			return "ok", nil
+		})
+
+		idle, err := net.Dial("tcp", address)
+		require.NoError(t, err)
+		defer func() { _ = idle.Close() }()
+		idleReader := bufio.NewReader(idle)
+		_, err = idle.Write([]byte("PING\n"))
+		require.NoError(t, err)
+		response, err := idleReader.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "ok\n", response)
+
+		busy, err := net.Dial("tcp", address)
+		require.NoError(t, err)
+		defer func() { _ = busy.Close() }()
+		_, err = busy.Write([]byte("SLOW\n"))
+		require.NoError(t, err)
+		<-started
+
+		shutdown := make(chan error, 1)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			shutdown <- server.Shutdown(ctx)
+		}()
+
+		// клиент между запросами отключается сразу
+		response, err = idleReader.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "error: "+ErrShuttingDown.Error()+"\n", response)
+		_, err = idleReader.ReadString('\n')
+		assert.ErrorIs(t, err, io.EOF)
+
+		select {
+		case err := <-shutdown:
+			t.Fatalf("shutdown returned before the request finished: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		// запрос в работе получает ответ, потом соединение закрывается
+		close(release)
+		busyReader := bufio.NewReader(busy)
+		for _, want := range []string{"done\n", "error: " + ErrShuttingDown.Error() + "\n"} {
+			response, err := busyReader.ReadString('\n')
+			require.NoError(t, err)
+			assert.Equal(t, want, response)
+		}
+
+		require.NoError(t, <-shutdown)
+
+		_, err = net.Dial("tcp", address)
+		assert.Error(t, err)
+	})
+
+	t.Run("grace period expired", func(t *testing.T) {
+		started, cancelled := make(chan struct{}), make(chan struct{})
+		server, address := newServer(t, func(ctx context.Context, _ string) (string, error) {
+			close(started)
+			<-ctx.Done()
+			close(cancelled)
+
+			return "", ctx.Err()
+		})
+
+		conn, err := net.Dial("tcp", address)
+		require.NoError(t, err)
+		defer func() { _ = conn.Close() }()
+		_, err = conn.Write([]byte("BLPOP jobs 0\n"))
+		require.NoError(t, err)
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, server.Shutdown(ctx), ErrShutdownTimeout)
+
+		select {
+		case <-cancelled:
+		default:
+			t.Fatal("request was not cancelled after the grace period")
+		}
+	})
+}
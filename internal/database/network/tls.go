@@ -0,0 +1,179 @@
+package network
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/TimonKK/inmemory-db/internal/config"
+	"go.uber.org/zap"
+)
+
+// fileStamp - по нему видно, что файл изменился
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// tlsFiles - сертификат, ключ и CA из файлов. Перед каждым рукопожатием проверяется, не изменились ли файлы,
+// и если изменились - они перечитываются. Испорченные файлы не заменяют уже загруженные
+type tlsFiles struct {
+	config config.TLSConfig
+	logger *zap.Logger
+
+	mu     sync.Mutex
+	stamps map[string]fileStamp
+	cert   *tls.Certificate
+	pool   *x509.CertPool
+}
+
+func newTLSFiles(cfg config.TLSConfig, logger *zap.Logger) (*tlsFiles, error) {
+	files := &tlsFiles{config: cfg, logger: logger}
+
+	stamps, err := files.stat()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", config.ErrTLSConfig, err)
+	}
+
+	if err := files.load(stamps); err != nil {
+		return nil, fmt.Errorf("%w: %w", config.ErrTLSConfig, err)
+	}
+
+	return files, nil
+}
+
+// current - сертификат (nil, если не задан) и CA (nil - системные). Файлы перечитываются, если изменились
+func (f *tlsFiles) current() (*tls.Certificate, *x509.CertPool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stamps, err := f.stat()
+	if err != nil {
+		f.logger.Warn("tls: failed to check certificate files, keeping loaded ones", zap.Error(err))
+		return f.cert, f.pool
+	}
+
+	for name, stamp := range stamps {
+		if f.stamps[name] != stamp {
+			if err := f.load(stamps); err != nil {
+				f.logger.Warn("tls: failed to reload certificate files, keeping loaded ones", zap.Error(err))
+			} else {
+				f.logger.Info("tls: certificate files reloaded")
+			}
+			break
+		}
+	}
+
+	return f.cert, f.pool
+}
+
+func (f *tlsFiles) stat() (map[string]fileStamp, error) {
+	stamps := make(map[string]fileStamp, 3)
+	for _, name := range []string{f.config.CertFile, f.config.KeyFile, f.config.CAFile} {
+		if name == "" {
+			continue
+		}
+
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		stamps[name] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+
+	return stamps, nil
+}
+
+// load - читает файлы. Запоминает stamps только при успехе, иначе следующая проверка попробует снова
+func (f *tlsFiles) load(stamps map[string]fileStamp) error {
+	var cert *tls.Certificate
+	if f.config.CertFile != "" || f.config.KeyFile != "" {
+		loaded, err := tls.LoadX509KeyPair(f.config.CertFile, f.config.KeyFile)
+		if err != nil {
+			return err
+		}
+		cert = &loaded
+	}
+
+	var pool *x509.CertPool
+	if f.config.CAFile != "" {
+		pem, err := os.ReadFile(f.config.CAFile)
+		if err != nil {
+			return err
+		}
+
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates in %s", f.config.CAFile)
+		}
+	}
+
+	f.cert, f.pool, f.stamps = cert, pool, stamps
+
+	return nil
+}
+
+// NewServerTLSConfig - TLS сервера. Сертификат и CA берутся при каждом подключении, поэтому замена файлов
+// действует на новые соединения без перезапуска
+func NewServerTLSConfig(cfg config.TLSConfig, logger *zap.Logger) (*tls.Config, error) {
+	if err := cfg.ValidateServer(); err != nil {
+		return nil, err
+	}
+
+	files, err := newTLSFiles(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	clientAuth := tls.NoClientCert
+	switch cfg.ClientAuth {
+	case config.ClientAuthRequest:
+		clientAuth = tls.VerifyClientCertIfGiven
+	case config.ClientAuthRequire:
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := files.current()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				ClientCAs:    pool,
+				ClientAuth:   clientAuth,
+			}, nil
+		},
+	}, nil
+}
+
+// NewClientTLSConfig - TLS клиента для подключения к address. Файлы читаются при каждом вызове,
+// поэтому новое подключение видит их последнюю версию
+func NewClientTLSConfig(cfg config.TLSConfig, address string, logger *zap.Logger) (*tls.Config, error) {
+	files, err := newTLSFiles(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	serverName := cfg.ServerName
+	if serverName == "" {
+		if serverName, _, err = net.SplitHostPort(address); err != nil {
+			return nil, err
+		}
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    files.pool,
+		ServerName: serverName,
+	}
+	if files.cert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*files.cert}
+	}
+
+	return tlsConfig, nil
+}
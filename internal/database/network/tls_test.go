@@ -0,0 +1,203 @@
+package network
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TimonKK/inmemory-db/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// testCA - CA, который выпускает сертификаты для тестов
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	ca := &testCA{cert: cert, key: key, dir: t.TempDir()}
+	writePEM(t, ca.path("ca.crt"), "CERTIFICATE", der)
+
+	return ca
+}
+
+func (ca *testCA) path(name string) string {
+	return filepath.Join(ca.dir, name)
+}
+
+// issue - пишет сертификат name.crt и ключ name.key для 127.0.0.1 с CommonName cn
+func (ca *testCA) issue(t *testing.T, name, cn string) config.TLSConfig {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	writePEM(t, ca.path(name+".crt"), "CERTIFICATE", der)
+	writePEM(t, ca.path(name+".key"), "EC PRIVATE KEY", keyDER)
+
+	return config.TLSConfig{
+		Enabled:  true,
+		CertFile: ca.path(name + ".crt"),
+		KeyFile:  ca.path(name + ".key"),
+		CAFile:   ca.path("ca.crt"),
+	}
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+func startTLSServer(t *testing.T, tlsConfig config.TLSConfig, handler RequestHandler) string {
+	t.Helper()
+
+	server, err := NewTCPServer(config.NetworkConfig{
+		Address:        "127.0.0.1:0",
+		MaxMessageSize: 1024,
+		IdleTimeout:    time.Second,
+		TLS:            tlsConfig,
+	}, zap.NewNop())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go server.HandleConnect(ctx, handler)
+
+	t.Cleanup(func() {
+		cancel()
+		_ = server.Shutdown(context.Background())
+	})
+
+	return server.listener.Addr().String()
+}
+
+// identityHandler - отвечает именем клиента из его сертификата
+func identityHandler(ctx context.Context, _ string) (string, error) {
+	session, _ := SessionFromContext(ctx)
+	return "identity " + session.Identity(), nil
+}
+
+func TestTCPServer_MutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	serverTLS := ca.issue(t, "server", "server")
+	serverTLS.ClientAuth = config.ClientAuthRequire
+	address := startTLSServer(t, serverTLS, identityHandler)
+
+	clientTLS := ca.issue(t, "client", "reporting")
+	client, err := NewTCPClient(&config.ClientNetworkConfig{Address: address, TLS: clientTLS}, zap.NewNop())
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	response, err := client.Send("WHOAMI")
+	require.NoError(t, err)
+	assert.Equal(t, "identity reporting\n", response)
+
+	// без клиентского сертификата сервер обрывает соединение на рукопожатии
+	anonymous, err := NewTCPClient(&config.ClientNetworkConfig{
+		Address: address,
+		TLS:     config.TLSConfig{Enabled: true, CAFile: ca.path("ca.crt")},
+	}, zap.NewNop())
+	if err == nil {
+		_, err = anonymous.Send("WHOAMI")
+		_ = anonymous.Close()
+	}
+	assert.Error(t, err)
+
+	// сертификат сервера проверяется по CA
+	_, err = NewTCPClient(&config.ClientNetworkConfig{Address: address, TLS: config.TLSConfig{Enabled: true}}, zap.NewNop())
+	assert.Error(t, err)
+
+	// версии ниже TLS 1.2 не принимаются
+	cert, err := tls.LoadX509KeyPair(clientTLS.CertFile, clientTLS.KeyFile)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	_, err = tls.Dial("tcp", address, &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{cert},
+		MaxVersion:   tls.VersionTLS11,
+	})
+	assert.Error(t, err)
+}
+
+func TestTCPServer_TLSReload(t *testing.T) {
+	ca := newTestCA(t)
+	serverTLS := ca.issue(t, "server", "server v1")
+	address := startTLSServer(t, serverTLS, func(_ context.Context, query string) (string, error) {
+		return strings.TrimSpace(query), nil
+	})
+
+	serverName := func() string {
+		pool := x509.NewCertPool()
+		pool.AddCert(ca.cert)
+
+		conn, err := tls.Dial("tcp", address, &tls.Config{RootCAs: pool})
+		require.NoError(t, err)
+		defer func() { _ = conn.Close() }()
+
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+	assert.Equal(t, "server v1", serverName())
+
+	// испорченный файл не заменяет загруженный сертификат
+	require.NoError(t, os.WriteFile(serverTLS.CertFile, []byte("garbage"), 0o600))
+	assert.Equal(t, "server v1", serverName())
+
+	ca.issue(t, "server", "server v2")
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(serverTLS.CertFile, future, future))
+	assert.Equal(t, "server v2", serverName())
+}
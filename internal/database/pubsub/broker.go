@@ -0,0 +1,232 @@
+package pubsub
+
+import (
+	"sync"
+
+	"github.com/TimonKK/inmemory-db/internal/utils"
+)
+
+// Subscriber - получатель сообщений. Push не должен блокироваться: получателя, который не успевает
+// их забирать, он отключает сам и возвращает false
+type Subscriber interface {
+	Push(message string) bool
+}
+
+// subscriptions - каналы и шаблоны одного получателя
+type subscriptions struct {
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+func (s *subscriptions) count() int {
+	return len(s.channels) + len(s.patterns)
+}
+
+// Broker - подписки на каналы и glob шаблоны каналов. Сообщения не хранятся: PUBLISH доставляет сообщение
+// только тем, кто подписан в этот момент
+type Broker struct {
+	mu sync.RWMutex
+
+	channels    map[string]map[Subscriber]struct{}
+	patterns    map[string]map[Subscriber]struct{}
+	subscribers map[Subscriber]*subscriptions
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		channels:    make(map[string]map[Subscriber]struct{}),
+		patterns:    make(map[string]map[Subscriber]struct{}),
+		subscribers: make(map[Subscriber]*subscriptions),
+	}
+}
+
+// Subscribe - подписывает на каналы, возвращает общее число подписок получателя
+func (b *Broker) Subscribe(sub Subscriber, channels ...string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subs := b.subscriptionsOf(sub)
+	for _, channel := range channels {
+		subscribe(b.channels, channel, sub)
+		subs.channels[channel] = struct{}{}
+	}
+
+	return subs.count()
+}
+
+// PSubscribe - подписывает на каналы, подходящие под glob шаблоны, возвращает общее число подписок получателя
+func (b *Broker) PSubscribe(sub Subscriber, patterns ...string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subs := b.subscriptionsOf(sub)
+	for _, pattern := range patterns {
+		subscribe(b.patterns, pattern, sub)
+		subs.patterns[pattern] = struct{}{}
+	}
+
+	return subs.count()
+}
+
+// Unsubscribe - отписывает от каналов, без каналов - от всех. Возвращает оставшееся число подписок получателя
+func (b *Broker) Unsubscribe(sub Subscriber, channels ...string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subs, ok := b.subscribers[sub]
+	if !ok {
+		return 0
+	}
+
+	if len(channels) == 0 {
+		for channel := range subs.channels {
+			channels = append(channels, channel)
+		}
+	}
+
+	for _, channel := range channels {
+		unsubscribe(b.channels, channel, sub)
+		delete(subs.channels, channel)
+	}
+
+	return b.release(sub, subs)
+}
+
+// PUnsubscribe - отписывает от шаблонов, без шаблонов - от всех. Возвращает оставшееся число подписок получателя
+func (b *Broker) PUnsubscribe(sub Subscriber, patterns ...string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subs, ok := b.subscribers[sub]
+	if !ok {
+		return 0
+	}
+
+	if len(patterns) == 0 {
+		for pattern := range subs.patterns {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	for _, pattern := range patterns {
+		unsubscribe(b.patterns, pattern, sub)
+		delete(subs.patterns, pattern)
+	}
+
+	return b.release(sub, subs)
+}
+
+// UnsubscribeAll - снимает все подписки получателя, например когда он отключился
+func (b *Broker) UnsubscribeAll(sub Subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subs, ok := b.subscribers[sub]
+	if !ok {
+		return
+	}
+
+	for channel := range subs.channels {
+		unsubscribe(b.channels, channel, sub)
+	}
+	for pattern := range subs.patterns {
+		unsubscribe(b.patterns, pattern, sub)
+	}
+
+	delete(b.subscribers, sub)
+}
+
+// Publish - отправляет сообщение подписчикам канала и подходящих шаблонов. Возвращает число получателей,
+// которым сообщение поставлено в очередь. Получатель, подписанный и на канал, и на шаблон, получит его дважды
+func (b *Broker) Publish(channel, message string) int {
+	type delivery struct {
+		sub     Subscriber
+		message string
+	}
+
+	// Push вызывается без блокировки: отключение медленного получателя снимает его подписки
+	b.mu.RLock()
+	deliveries := make([]delivery, 0, len(b.channels[channel]))
+	for sub := range b.channels[channel] {
+		deliveries = append(deliveries, delivery{sub: sub, message: Message(channel, message)})
+	}
+	for pattern, subs := range b.patterns {
+		if !utils.MatchGlob(pattern, channel) {
+			continue
+		}
+
+		for sub := range subs {
+			deliveries = append(deliveries, delivery{sub: sub, message: PatternMessage(pattern, channel, message)})
+		}
+	}
+	b.mu.RUnlock()
+
+	n := 0
+	for _, d := range deliveries {
+		if d.sub.Push(d.message) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// HasSubscribers - есть ли хоть одна подписка
+func (b *Broker) HasSubscribers() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return len(b.subscribers) > 0
+}
+
+// Message - push сообщение подписчику канала: "message channel payload"
+func Message(channel, message string) string {
+	return "message " + channel + " " + message
+}
+
+// PatternMessage - push сообщение подписчику шаблона: "pmessage pattern channel payload"
+func PatternMessage(pattern, channel, message string) string {
+	return "pmessage " + pattern + " " + channel + " " + message
+}
+
+func (b *Broker) subscriptionsOf(sub Subscriber) *subscriptions {
+	subs, ok := b.subscribers[sub]
+	if !ok {
+		subs = &subscriptions{channels: make(map[string]struct{}), patterns: make(map[string]struct{})}
+		b.subscribers[sub] = subs
+	}
+
+	return subs
+}
+
+// release - забывает получателя без подписок, возвращает число его подписок
+func (b *Broker) release(sub Subscriber, subs *subscriptions) int {
+	n := subs.count()
+	if n == 0 {
+		delete(b.subscribers, sub)
+	}
+
+	return n
+}
+
+func subscribe(index map[string]map[Subscriber]struct{}, name string, sub Subscriber) {
+	subs, ok := index[name]
+	if !ok {
+		subs = make(map[Subscriber]struct{})
+		index[name] = subs
+	}
+
+	subs[sub] = struct{}{}
+}
+
+func unsubscribe(index map[string]map[Subscriber]struct{}, name string, sub Subscriber) {
+	subs, ok := index[name]
+	if !ok {
+		return
+	}
+
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(index, name)
+	}
+}
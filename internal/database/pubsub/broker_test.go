@@ -0,0 +1,54 @@
+package pubsub
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testSubscriber struct {
+	mu       sync.Mutex
+	messages []string
+	full     bool
+}
+
+func (s *testSubscriber) Push(message string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.full {
+		return false
+	}
+
+	s.messages = append(s.messages, message)
+
+	return true
+}
+
+func TestBroker(t *testing.T) {
+	broker := NewBroker()
+	news, all, slow := &testSubscriber{}, &testSubscriber{}, &testSubscriber{full: true}
+
+	assert.Equal(t, 1, broker.Subscribe(news, "news"))
+	assert.Equal(t, 2, broker.Subscribe(news, "sport", "news"))
+	assert.Equal(t, 1, broker.PSubscribe(all, "news*"))
+	assert.Equal(t, 1, broker.Subscribe(slow, "news"))
+
+	assert.Equal(t, 2, broker.Publish("news", "hello"))
+	assert.Equal(t, 1, broker.Publish("newsroom", "hi"))
+	assert.Equal(t, 0, broker.Publish("weather", "rain"))
+
+	assert.Equal(t, []string{"message news hello"}, news.messages)
+	assert.Equal(t, []string{"pmessage news* news hello", "pmessage news* newsroom hi"}, all.messages)
+
+	assert.Equal(t, 1, broker.Unsubscribe(news, "news"))
+	assert.Equal(t, 0, broker.Unsubscribe(news))
+	assert.Equal(t, 0, broker.PUnsubscribe(all))
+	broker.UnsubscribeAll(slow)
+
+	assert.Equal(t, 0, broker.Publish("news", "bye"))
+	assert.Empty(t, broker.channels)
+	assert.Empty(t, broker.patterns)
+	assert.Empty(t, broker.subscribers)
+}
@@ -0,0 +1,382 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+)
+
+// blockedClient - клиент, ждущий элемент в одном из списков keys. query - исходная BLPOP, BRPOP или BLMOVE
+type blockedClient struct {
+	keys   []string
+	query  compute.Query
+	result chan blockedResult
+	// served - элемент для клиента уже снят, результат придет в result
+	served bool
+}
+
+type blockedResult struct {
+	pair KeyValue
+	err  error
+}
+
+// wakeup - результат для клиента, который отдается после записи WAL
+type wakeup struct {
+	client *blockedClient
+	result blockedResult
+}
+
+// blockedClients - заблокированные клиенты по ключам в порядке блокировки. Клиент регистрируется и обслуживается
+// под блокировкой движка, а снимается по таймауту без нее, поэтому у очереди своя блокировка
+type blockedClients struct {
+	mu    sync.Mutex
+	byKey map[string][]*blockedClient
+	count int
+}
+
+func newBlockedClients() *blockedClients {
+	return &blockedClients{byKey: make(map[string][]*blockedClient)}
+}
+
+func (b *blockedClients) add(query compute.Query) *blockedClient {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	client := &blockedClient{
+		keys:   slices.Clone(query.BlockKeys()),
+		query:  query,
+		result: make(chan blockedResult, 1),
+	}
+
+	for _, key := range client.keys {
+		b.byKey[key] = append(b.byKey[key], client)
+	}
+	b.count++
+
+	return client
+}
+
+// claim - снимает с очереди первого клиента, ждущего key. Клиент убирается из очередей всех своих ключей
+func (b *blockedClients) claim(key string) *blockedClient {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	queue := b.byKey[key]
+	if len(queue) == 0 {
+		return nil
+	}
+
+	client := queue[0]
+	client.served = true
+	b.removeLocked(client)
+
+	return client
+}
+
+// remove - убирает клиента из очередей. false, если клиент уже обслужен и его результат в пути
+func (b *blockedClients) remove(client *blockedClient) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if client.served {
+		return false
+	}
+
+	b.removeLocked(client)
+
+	return true
+}
+
+func (b *blockedClients) removeLocked(client *blockedClient) {
+	b.count--
+
+	for _, key := range client.keys {
+		queue := slices.DeleteFunc(b.byKey[key], func(c *blockedClient) bool {
+			return c == client
+		})
+
+		if len(queue) == 0 {
+			delete(b.byKey, key)
+		} else {
+			b.byKey[key] = queue
+		}
+	}
+}
+
+func (b *blockedClients) waiting(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.byKey[key]) > 0
+}
+
+func (b *blockedClients) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.count
+}
+
+// BlockedClients - число клиентов, ждущих элемент в блокирующих командах
+func (s *Storage) BlockedClients() int {
+	return s.blocked.len()
+}
+
+// LMove - LMOVE src dst LEFT|RIGHT LEFT|RIGHT, перекладывает элемент между списками и возвращает его.
+// ErrKeyNotFound, если исходного списка нет
+func (s *Storage) LMove(ctx context.Context, query compute.Query) (string, error) {
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	var value string
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		var err error
+		if value, err = applyMoveRecord(tx, query); err != nil {
+			return nil, err
+		}
+
+		return []compute.Query{query}, nil
+	})
+
+	return value, err
+}
+
+// BPop - BLPOP и BRPOP. Снимает элемент из первого непустого списка, а если все пусты - ждет, пока элемент
+// появится, истечет таймаут или отменится ctx. ErrKeyNotFound по таймауту
+func (s *Storage) BPop(ctx context.Context, query compute.Query) (KeyValue, error) {
+	if ctx.Err() != nil {
+		return KeyValue{}, ctx.Err()
+	}
+
+	var (
+		pair   KeyValue
+		found  bool
+		client *blockedClient
+	)
+
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		for _, key := range query.BlockKeys() {
+			_, err := getList(tx, key)
+			if errors.Is(err, ErrKeyNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			record := blockedRecord(query, key)
+			popped, err := applyListRecord(tx, record)
+			if err != nil {
+				return nil, err
+			}
+			pair, found = KeyValue{Key: key, Value: popped[0]}, true
+
+			return []compute.Query{record}, nil
+		}
+
+		// регистрация под блокировкой движка: элемент, добавленный после проверки, не будет пропущен
+		client = s.blocked.add(query)
+
+		return nil, nil
+	})
+	if err != nil || found {
+		return pair, err
+	}
+
+	return s.wait(ctx, client)
+}
+
+// BLMove - блокирующий LMOVE, ждет элемент в src как BPop
+func (s *Storage) BLMove(ctx context.Context, query compute.Query) (string, error) {
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	var (
+		value  string
+		found  bool
+		client *blockedClient
+	)
+
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		_, err := getList(tx, query.Key())
+		if errors.Is(err, ErrKeyNotFound) {
+			client = s.blocked.add(query)
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		record := blockedRecord(query, query.Key())
+		if value, err = applyMoveRecord(tx, record); err != nil {
+			return nil, err
+		}
+		found = true
+
+		return []compute.Query{record}, nil
+	})
+	if err != nil || found {
+		return value, err
+	}
+
+	pair, err := s.wait(ctx, client)
+
+	return pair.Value, err
+}
+
+func (s *Storage) wait(ctx context.Context, client *blockedClient) (KeyValue, error) {
+	var timeout <-chan time.Time
+	if d := client.query.BlockTimeout(); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case result := <-client.result:
+		return result.pair, result.err
+	case <-timeout:
+	case <-ctx.Done():
+	}
+
+	if !s.blocked.remove(client) {
+		// элемент уже снят для этого клиента, отдать его важнее, чем уложиться в таймаут
+		result := <-client.result
+		return result.pair, result.err
+	}
+
+	if ctx.Err() != nil {
+		return KeyValue{}, ctx.Err()
+	}
+
+	return KeyValue{}, ErrKeyNotFound
+}
+
+// serveBlocked - отдает элементы списков, в которые добавили records, заблокированным клиентам в порядке очереди.
+// Вызывается в той же транзакции, что и добавление, поэтому элемент не успеет забрать неблокирующий клиент.
+// Возвращает записи WAL для снятых элементов и результаты, которые нужно отдать после записи WAL
+func (s *Storage) serveBlocked(tx Tx, records []compute.Query) ([]compute.Query, []wakeup, error) {
+	var (
+		served  []compute.Query
+		wakeups []wakeup
+	)
+
+	ready := pushedKeys(records)
+	for len(ready) > 0 {
+		key := ready[0]
+		ready = ready[1:]
+
+		for s.blocked.waiting(key) {
+			if _, err := getList(tx, key); err != nil {
+				if errors.Is(err, ErrKeyNotFound) || errors.Is(err, ErrWrongType) {
+					break
+				}
+
+				return served, wakeups, err
+			}
+
+			client := s.blocked.claim(key)
+			if client == nil {
+				break
+			}
+
+			record := blockedRecord(client.query, key)
+
+			var value string
+			if record.CommandId() == compute.LMoveCommandId {
+				var err error
+				if value, err = applyMoveRecord(tx, record); err != nil {
+					wakeups = append(wakeups, wakeup{client: client, result: blockedResult{err: err}})
+
+					// dst другого типа - ошибка только этого клиента, список src не изменился
+					if errors.Is(err, ErrWrongType) {
+						continue
+					}
+
+					return served, wakeups, err
+				}
+
+				// переложенный элемент может разбудить клиентов, ждущих dst
+				ready = append(ready, record.Value())
+			} else {
+				popped, err := applyListRecord(tx, record)
+				if err != nil {
+					wakeups = append(wakeups, wakeup{client: client, result: blockedResult{err: err}})
+					return served, wakeups, err
+				}
+				value = popped[0]
+			}
+
+			served = append(served, record)
+			wakeups = append(wakeups, wakeup{client: client, result: blockedResult{pair: KeyValue{Key: key, Value: value}}})
+		}
+	}
+
+	return served, wakeups, nil
+}
+
+// blockedRecord - неблокирующая запись WAL, которой обслуживается блокирующая команда на ключе key
+func blockedRecord(query compute.Query, key string) compute.Query {
+	switch query.CommandId() {
+	case compute.BLMoveCommandId:
+		return compute.NewQuery(compute.LMoveCommandId, query.Args()[:4])
+	case compute.BRPopCommandId:
+		return compute.NewQuery(compute.RPopCommandId, []string{key, "1"})
+	default:
+		return compute.NewQuery(compute.LPopCommandId, []string{key, "1"})
+	}
+}
+
+// pushedKeys - ключи, в которые записи могли добавить элементы списков
+func pushedKeys(records []compute.Query) []string {
+	var keys []string
+	for _, record := range records {
+		switch record.CommandId() {
+		case compute.LPushCommandId, compute.RPushCommandId, compute.RestoreCommandId:
+			keys = append(keys, record.Key())
+		case compute.LMoveCommandId, compute.RenameCommandId, compute.CopyCommandId:
+			keys = append(keys, record.Value())
+		}
+	}
+
+	return keys
+}
+
+// applyMoveRecord - LMOVE. Тип dst проверяется до того, как снять элемент из src
+func applyMoveRecord(tx Tx, record compute.Query) (string, error) {
+	src, dst := record.Key(), record.Value()
+	from, to := record.MoveSides()
+
+	if _, err := getList(tx, src); err != nil {
+		return "", err
+	}
+
+	if _, err := getList(tx, dst); err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return "", err
+	}
+
+	pop, push := compute.LPopCommandId, compute.LPushCommandId
+	if from == compute.RightOption {
+		pop = compute.RPopCommandId
+	}
+	if to == compute.RightOption {
+		push = compute.RPushCommandId
+	}
+
+	popped, err := applyListRecord(tx, compute.NewQuery(pop, []string{src, "1"}))
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := applyListRecord(tx, compute.NewQuery(push, []string{dst, popped[0]})); err != nil {
+		return "", err
+	}
+
+	return popped[0], nil
+}
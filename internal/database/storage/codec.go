@@ -0,0 +1,461 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+)
+
+// Формат значения в персистентных движках (в SSTable и в файлах bitcask) и в DUMP:
+//
+//	type u8 | flags u8 | expireAt u64, если есть флаг | payload
+//
+// payload строки - сами байты значения, списка - uvarint число элементов и элементы как uvarint длина | байты,
+// хеша - uvarint число полей и поля как имя | значение | expireAt uvarint (строки в том же виде, что у списка),
+// множества - encoding u8 и элементы: у intset числа varint по возрастанию, иначе строки как у списка,
+// сортированного множества - uvarint число элементов и элементы как строка | score float64 по возрастанию,
+// потока - последний id, записи как id | поля, группы как имя | последний выданный id | потребители | PEL.
+// id пишется как uvarint ms | uvarint seq, времена - uvarint unix ms
+const (
+	entryTypeString = byte(TypeString)
+	entryTypeList   = byte(TypeList)
+	entryTypeHash   = byte(TypeHash)
+	entryTypeSet    = byte(TypeSet)
+	entryTypeZSet   = byte(TypeSortedSet)
+	entryTypeStream = byte(TypeStream)
+
+	setEncodingIntset  byte = 0
+	setEncodingMembers byte = 1
+
+	entryFlagExpire byte = 1
+
+	entryHeaderSize = 2
+)
+
+var (
+	ErrCorruptedEntry = errors.New("stored entry is corrupted")
+)
+
+// EncodeEntry - значение ключа в двоичном виде
+func EncodeEntry(entry Entry) string {
+	var flags byte
+	if entry.ExpireAt != 0 {
+		flags |= entryFlagExpire
+	}
+
+	data := make([]byte, 0, entryHeaderSize+8+len(entry.Value))
+	data = append(data, byte(entry.Type()), flags)
+	if entry.ExpireAt != 0 {
+		data = binary.LittleEndian.AppendUint64(data, uint64(entry.ExpireAt))
+	}
+
+	switch value := entry.Data.(type) {
+	case nil:
+		data = append(data, entry.Value...)
+	case *List:
+		data = appendStrings(data, value.Values())
+	case *Hash:
+		data = appendHash(data, value)
+	case *Set:
+		data = appendSet(data, value)
+	case *SortedSet:
+		data = appendSortedSet(data, value)
+	case *Stream:
+		data = appendStream(data, value)
+	}
+
+	return string(data)
+}
+
+// DecodeEntry - значение из EncodeEntry, ErrCorruptedEntry если данные испорчены
+func DecodeEntry(data string) (Entry, error) {
+	valueType, expireAt, payload, err := decodeEntryHeader(data)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	entry := Entry{ExpireAt: expireAt}
+	switch valueType {
+	case entryTypeString:
+		entry.Value = payload
+	case entryTypeList:
+		values, err := decodeStrings(payload)
+		if err != nil {
+			return Entry{}, err
+		}
+		entry.Data = NewList(values...)
+	case entryTypeHash:
+		hash, err := decodeHash(payload)
+		if err != nil {
+			return Entry{}, err
+		}
+		entry.Data = hash
+	case entryTypeSet:
+		set, err := decodeSet(payload)
+		if err != nil {
+			return Entry{}, err
+		}
+		entry.Data = set
+	case entryTypeZSet:
+		zset, err := decodeSortedSet(payload)
+		if err != nil {
+			return Entry{}, err
+		}
+		entry.Data = zset
+	case entryTypeStream:
+		stream, err := decodeStream(payload)
+		if err != nil {
+			return Entry{}, err
+		}
+		entry.Data = stream
+	default:
+		return Entry{}, ErrCorruptedEntry
+	}
+
+	return entry, nil
+}
+
+// DecodeExpireAt - срок жизни значения из EncodeEntry без разбора самого значения
+func DecodeExpireAt(data string) (int64, error) {
+	_, expireAt, _, err := decodeEntryHeader(data)
+	return expireAt, err
+}
+
+// decodeEntryHeader - тип, срок жизни и payload без разбора самого значения
+func decodeEntryHeader(data string) (byte, int64, string, error) {
+	if len(data) < entryHeaderSize {
+		return 0, 0, "", ErrCorruptedEntry
+	}
+
+	valueType, flags, rest := data[0], data[1], data[entryHeaderSize:]
+	if flags&entryFlagExpire == 0 {
+		return valueType, 0, rest, nil
+	}
+
+	if len(rest) < 8 {
+		return 0, 0, "", ErrCorruptedEntry
+	}
+
+	return valueType, int64(binary.LittleEndian.Uint64([]byte(rest[:8]))), rest[8:], nil
+}
+
+func appendStrings(data []byte, values []string) []byte {
+	data = binary.AppendUvarint(data, uint64(len(values)))
+	for _, value := range values {
+		data = appendString(data, value)
+	}
+
+	return data
+}
+
+func decodeStrings(payload string) ([]string, error) {
+	r := &payloadReader{data: []byte(payload)}
+
+	count := r.count()
+	values := make([]string, 0, count)
+	for range count {
+		values = append(values, r.string())
+	}
+
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// appendHash - поля пишутся с истекшими вместе, их удалит следующая запись в хеш
+func appendHash(data []byte, hash *Hash) []byte {
+	fields := hash.Fields(0)
+
+	data = binary.AppendUvarint(data, uint64(len(fields)))
+	for _, field := range fields {
+		data = appendString(data, field.Name)
+		data = appendString(data, field.Value)
+		data = binary.AppendUvarint(data, uint64(field.ExpireAt))
+	}
+
+	return data
+}
+
+func decodeHash(payload string) (*Hash, error) {
+	r := &payloadReader{data: []byte(payload)}
+
+	count := r.count()
+	fields := make([]HashField, 0, count)
+	for range count {
+		fields = append(fields, HashField{Name: r.string(), Value: r.string(), ExpireAt: int64(r.uvarint())})
+	}
+
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+
+	return NewHash(fields...), nil
+}
+
+func appendSet(data []byte, set *Set) []byte {
+	if !set.IsIntset() {
+		return appendStrings(append(data, setEncodingMembers), set.Members())
+	}
+
+	ints := set.Ints()
+	data = append(data, setEncodingIntset)
+	data = binary.AppendUvarint(data, uint64(len(ints)))
+	for _, n := range ints {
+		data = binary.AppendVarint(data, n)
+	}
+
+	return data
+}
+
+func decodeSet(payload string) (*Set, error) {
+	if len(payload) == 0 {
+		return nil, ErrCorruptedEntry
+	}
+
+	if payload[0] == setEncodingMembers {
+		members, err := decodeStrings(payload[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		return NewSet(members...), nil
+	}
+
+	if payload[0] != setEncodingIntset {
+		return nil, ErrCorruptedEntry
+	}
+
+	r := &payloadReader{data: []byte(payload[1:])}
+
+	count := r.count()
+	ints := make([]int64, 0, count)
+	for range count {
+		n := r.varint()
+		if len(ints) > 0 && n <= ints[len(ints)-1] {
+			return nil, ErrCorruptedEntry
+		}
+		ints = append(ints, n)
+	}
+
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+
+	return NewIntset(ints), nil
+}
+
+func appendSortedSet(data []byte, zset *SortedSet) []byte {
+	members := zset.Members()
+
+	data = binary.AppendUvarint(data, uint64(len(members)))
+	for _, m := range members {
+		data = appendString(data, m.Member)
+		data = binary.LittleEndian.AppendUint64(data, math.Float64bits(m.Score))
+	}
+
+	return data
+}
+
+func decodeSortedSet(payload string) (*SortedSet, error) {
+	r := &payloadReader{data: []byte(payload)}
+
+	count := r.count()
+	members := make([]compute.ScoreMember, 0, count)
+	for range count {
+		members = append(members, compute.ScoreMember{Member: r.string(), Score: r.float()})
+	}
+
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+
+	return NewSortedSet(members...), nil
+}
+
+func appendStream(data []byte, stream *Stream) []byte {
+	data = appendStreamID(data, stream.LastID())
+
+	data = binary.AppendUvarint(data, uint64(stream.Len()))
+	for _, entry := range stream.Entries() {
+		data = appendStreamID(data, entry.ID)
+		data = binary.AppendUvarint(data, uint64(len(entry.Fields)))
+		for _, field := range entry.Fields {
+			data = appendString(data, field.Key)
+			data = appendString(data, field.Value)
+		}
+	}
+
+	groups := stream.Groups()
+	data = binary.AppendUvarint(data, uint64(len(groups)))
+	for _, g := range groups {
+		data = appendString(data, g.Name)
+		data = appendStreamID(data, g.LastID)
+
+		consumers := g.Consumers()
+		data = binary.AppendUvarint(data, uint64(len(consumers)))
+		for _, c := range consumers {
+			data = appendString(data, c.Name)
+			data = binary.AppendUvarint(data, uint64(c.SeenAt))
+		}
+
+		pending := g.Pending(compute.StreamID{}, compute.MaxStreamID, 0, "")
+		data = binary.AppendUvarint(data, uint64(len(pending)))
+		for _, p := range pending {
+			data = appendStreamID(data, p.ID)
+			data = appendString(data, p.Consumer)
+			data = binary.AppendUvarint(data, uint64(p.DeliveredAt))
+			data = binary.AppendUvarint(data, uint64(p.Deliveries))
+		}
+	}
+
+	return data
+}
+
+func decodeStream(payload string) (*Stream, error) {
+	r := &payloadReader{data: []byte(payload)}
+
+	lastID := r.streamID()
+
+	count := r.count()
+	entries := make([]StreamEntry, 0, count)
+	for range count {
+		entry := StreamEntry{ID: r.streamID()}
+
+		fields := r.count()
+		entry.Fields = make([]KeyValue, 0, fields)
+		for range fields {
+			entry.Fields = append(entry.Fields, KeyValue{Key: r.string(), Value: r.string()})
+		}
+
+		entries = append(entries, entry)
+	}
+
+	count = r.count()
+	groups := make([]*ConsumerGroup, 0, count)
+	for range count {
+		name, groupLastID := r.string(), r.streamID()
+
+		consumers := make([]StreamConsumer, r.count())
+		for i := range consumers {
+			consumers[i] = StreamConsumer{Name: r.string(), SeenAt: int64(r.uvarint())}
+		}
+
+		pending := make([]PendingEntry, r.count())
+		for i := range pending {
+			pending[i] = PendingEntry{
+				ID:          r.streamID(),
+				Consumer:    r.string(),
+				DeliveredAt: int64(r.uvarint()),
+				Deliveries:  int(r.uvarint()),
+			}
+		}
+
+		groups = append(groups, NewConsumerGroup(name, groupLastID, consumers, pending))
+	}
+
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+
+	return NewStream(lastID, entries, groups...), nil
+}
+
+func appendStreamID(data []byte, id compute.StreamID) []byte {
+	data = binary.AppendUvarint(data, id.Ms)
+	return binary.AppendUvarint(data, id.Seq)
+}
+
+func appendString(data []byte, value string) []byte {
+	data = binary.AppendUvarint(data, uint64(len(value)))
+	return append(data, value...)
+}
+
+// payloadReader - чтение payload составного значения. После первой ошибки все чтения возвращают нулевые
+// значения, ошибку возвращает done
+type payloadReader struct {
+	data    []byte
+	corrupt bool
+}
+
+func (r *payloadReader) uvarint() uint64 {
+	if r.corrupt {
+		return 0
+	}
+
+	n, size := binary.Uvarint(r.data)
+	if size <= 0 {
+		r.corrupt = true
+		return 0
+	}
+	r.data = r.data[size:]
+
+	return n
+}
+
+func (r *payloadReader) varint() int64 {
+	if r.corrupt {
+		return 0
+	}
+
+	n, size := binary.Varint(r.data)
+	if size <= 0 {
+		r.corrupt = true
+		return 0
+	}
+	r.data = r.data[size:]
+
+	return n
+}
+
+func (r *payloadReader) float() float64 {
+	if r.corrupt || len(r.data) < 8 {
+		r.corrupt = true
+		return 0
+	}
+
+	n := binary.LittleEndian.Uint64(r.data)
+	r.data = r.data[8:]
+
+	return math.Float64frombits(n)
+}
+
+func (r *payloadReader) streamID() compute.StreamID {
+	return compute.StreamID{Ms: r.uvarint(), Seq: r.uvarint()}
+}
+
+// count - число элементов. Каждый элемент занимает хотя бы байт, поэтому большее число - порча данных
+func (r *payloadReader) count() int {
+	n := r.uvarint()
+	if n > uint64(len(r.data)) {
+		r.corrupt = true
+		return 0
+	}
+
+	return int(n)
+}
+
+func (r *payloadReader) string() string {
+	size := r.uvarint()
+	if r.corrupt || size > uint64(len(r.data)) {
+		r.corrupt = true
+		return ""
+	}
+
+	value := string(r.data[:size])
+	r.data = r.data[size:]
+
+	return value
+}
+
+// done - ошибка, если данные испорчены или после значения остались лишние байты
+func (r *payloadReader) done() error {
+	if r.corrupt || len(r.data) != 0 {
+		return ErrCorruptedEntry
+	}
+
+	return nil
+}
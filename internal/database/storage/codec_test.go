@@ -0,0 +1,65 @@
+package storage_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+	"github.com/TimonKK/inmemory-db/internal/database/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntryCodec(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry storage.Entry
+	}{
+		{name: "string", entry: storage.NewEntry("value")},
+		{name: "empty string", entry: storage.NewEntry("")},
+		{name: "string with expire", entry: storage.Entry{Value: "value", ExpireAt: 1700000000000}},
+		{name: "list", entry: storage.NewCollectionEntry(storage.NewList("a", "", "ccc"))},
+		{name: "list with expire", entry: storage.Entry{Data: storage.NewList("a"), ExpireAt: 1700000000000}},
+		{name: "hash", entry: storage.NewCollectionEntry(storage.NewHash(
+			storage.HashField{Name: "name", Value: "bob"},
+			storage.HashField{Name: "visits", Value: "3", ExpireAt: 1700000000000},
+		))},
+		{name: "intset", entry: storage.NewCollectionEntry(storage.NewSet("-5", "3", "100000000000"))},
+		{name: "set", entry: storage.NewCollectionEntry(storage.NewSet("go", "1", ""))},
+		{name: "stream", entry: storage.NewCollectionEntry(storage.NewStream(
+			compute.StreamID{Ms: 1700000000000, Seq: 3},
+			[]storage.StreamEntry{
+				{ID: compute.StreamID{Ms: 1700000000000, Seq: 1}, Fields: []storage.KeyValue{{Key: "type", Value: "signup"}}},
+				{ID: compute.StreamID{Ms: 1700000000000, Seq: 2}, Fields: []storage.KeyValue{{Key: "a", Value: ""}, {Key: "b", Value: "c"}}},
+			},
+			storage.NewConsumerGroup("workers", compute.StreamID{Ms: 1700000000000, Seq: 2},
+				[]storage.StreamConsumer{{Name: "w1", SeenAt: 1700000000100}},
+				[]storage.PendingEntry{{ID: compute.StreamID{Ms: 1700000000000, Seq: 1}, Consumer: "w1", DeliveredAt: 1700000000100, Deliveries: 2}},
+			),
+		))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := storage.DecodeEntry(storage.EncodeEntry(tt.entry))
+			require.NoError(t, err)
+			assert.Equal(t, tt.entry, decoded)
+		})
+	}
+
+	// у skiplist случайная высота узлов, поэтому сортированное множество сравнивается по элементам
+	zset := storage.NewSortedSet(
+		compute.ScoreMember{Score: 1.5, Member: "bob"},
+		compute.ScoreMember{Score: math.Inf(-1), Member: "alice"},
+	)
+	decoded, err := storage.DecodeEntry(storage.EncodeEntry(storage.Entry{Data: zset, ExpireAt: 1700000000000}))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1700000000000), decoded.ExpireAt)
+	require.IsType(t, &storage.SortedSet{}, decoded.Data)
+	assert.Equal(t, zset.Members(), decoded.Data.(*storage.SortedSet).Members())
+
+	for _, data := range []string{"", "\x07\x00", "\x00\x01abc", "\x01\x00\x02\x01a", "\x03\x00\x00\x02\x04\x02"} {
+		_, err := storage.DecodeEntry(data)
+		assert.ErrorIs(t, err, storage.ErrCorruptedEntry, "%q", data)
+	}
+}
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+)
+
+var (
+	ErrInvalidDump = errors.New("DUMP payload version or checksum are wrong")
+	ErrBusyKey     = errors.New("BUSYKEY Target key name already exists")
+)
+
+// Формат DUMP:
+//
+//	version u8 | значение в формате EncodeEntry | crc32 u32 от version и значения
+//
+// целиком в base64 без выравнивания, чтобы payload был допустимым аргументом команды и записи WAL.
+// Срок жизни хранится абсолютным, в unix ms
+const (
+	dumpVersion      byte = 1
+	dumpChecksumSize      = 4
+)
+
+// KeyDump - ключ и его значение в формате DUMP
+type KeyDump struct {
+	Key     string
+	Payload string
+}
+
+// EncodeDump - значение в формате DUMP
+func EncodeDump(entry Entry) string {
+	data := append([]byte{dumpVersion}, EncodeEntry(entry)...)
+	data = binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeDump - значение из EncodeDump. ErrInvalidDump, если payload другой версии или испорчен
+func DecodeDump(payload string) (Entry, error) {
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || len(data) < 1+dumpChecksumSize {
+		return Entry{}, ErrInvalidDump
+	}
+
+	body, sum := data[:len(data)-dumpChecksumSize], data[len(data)-dumpChecksumSize:]
+	if body[0] != dumpVersion || crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(sum) {
+		return Entry{}, ErrInvalidDump
+	}
+
+	return DecodeEntry(string(body[1:]))
+}
+
+// Dump - DUMP key, значение ключа вместе с типом и сроком жизни. ErrKeyNotFound, если ключа нет
+func (s *Storage) Dump(ctx context.Context, query compute.Query) (string, error) {
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	var payload string
+	err := s.view(ctx, func(tx Tx) error {
+		entry, err := tx.Get(query.Key())
+		if err != nil {
+			return err
+		}
+
+		payload = EncodeDump(entry)
+		return nil
+	})
+
+	return payload, err
+}
+
+// Restore - RESTORE key ttl payload [REPLACE]. ttl в миллисекундах заменяет срок из payload, 0 - срок
+// из payload. Без REPLACE существующий ключ - ErrBusyKey. Уже истекший ключ не создается.
+// В WAL пишется RESTORE с ttl 0 и итоговым сроком в payload, поэтому повтор WAL не зависит от времени
+func (s *Storage) Restore(ctx context.Context, query compute.Query) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	opts := query.RestoreOptions()
+	entry, err := DecodeDump(opts.Payload)
+	if err != nil {
+		return err
+	}
+
+	return s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		_, err := tx.Get(query.Key())
+		if err != nil && !errors.Is(err, ErrKeyNotFound) {
+			return nil, err
+		}
+		exists := err == nil
+
+		if exists && !opts.Replace {
+			return nil, ErrBusyKey
+		}
+
+		if opts.TTL > 0 {
+			entry.ExpireAt = tx.Now() + opts.TTL
+		}
+
+		record := compute.NewQuery(compute.RestoreCommandId, []string{query.Key(), "0", EncodeDump(entry)})
+		if entry.Expired(tx.Now()) {
+			if !exists {
+				return nil, nil
+			}
+
+			// прежнее значение при REPLACE заменяется истекшим, то есть удаляется
+			record = compute.NewQuery(compute.DeleteCommandId, []string{query.Key()})
+		}
+
+		if err := applyRecord(tx, record); err != nil {
+			return nil, err
+		}
+
+		return []compute.Query{record}, nil
+	})
+}
+
+// DeleteUnchanged - удаляет ключи, значения которых все еще совпадают с payload. Ключ, измененный
+// после DUMP, остается. Возвращает число удаленных ключей
+func (s *Storage) DeleteUnchanged(ctx context.Context, dumps []KeyDump) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var deleted []string
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		for _, dump := range dumps {
+			entry, err := tx.Get(dump.Key)
+			if errors.Is(err, ErrKeyNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			if EncodeDump(entry) == dump.Payload {
+				deleted = append(deleted, dump.Key)
+			}
+		}
+
+		if len(deleted) == 0 {
+			return nil, nil
+		}
+
+		record := compute.NewQuery(compute.MDelCommandId, deleted)
+		if err := applyRecord(tx, record); err != nil {
+			return nil, err
+		}
+
+		return []compute.Query{record}, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(deleted), nil
+}
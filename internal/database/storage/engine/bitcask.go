@@ -0,0 +1,522 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TimonKK/inmemory-db/internal/config"
+	"github.com/TimonKK/inmemory-db/internal/database/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultBitcaskMaxFileSize   = 64 << 20
+	defaultBitcaskMergeInterval = time.Minute
+	defaultBitcaskMergeTrigger  = 0.5
+
+	bitcaskDataFileExt = ".data"
+	bitcaskHintFileExt = ".hint"
+	bitcaskFilenameFmt = "%06d"
+)
+
+// bitcaskFile - файл данных. Запись идет только в активный файл, остальные неизменяемы
+type bitcaskFile struct {
+	id   uint32
+	file *os.File
+	size int64
+}
+
+// BitcaskEngine - лог-структурированный хеш движок: все ключи в памяти (keydir), значения в append-only файлах.
+// Чтение значения - один pread, мертвые записи убирает фоновое слияние
+type BitcaskEngine struct {
+	cfg    config.BitcaskConfig
+	logger *zap.Logger
+
+	mu         sync.RWMutex
+	keydir     *bucketMap[bitcaskLocation]
+	files      map[uint32]*bitcaskFile
+	active     *bitcaskFile
+	nextFileID uint32
+	seq        uint64
+	// checkpoint - число записей WAL, изменения которых уже в файлах. Пишется в активный файл записью checkpoint
+	checkpoint uint64
+	totalBytes int64
+	deadBytes  int64
+	// generation - меняется при очистке, чтобы слияние не вернуло файлы, начатые до неё
+	generation uint64
+
+	mergeMu   sync.Mutex
+	closeCh   chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+func NewBitcaskEngine(cfg config.BitcaskConfig, logger *zap.Logger) (*BitcaskEngine, error) {
+	cfg = withBitcaskDefaults(cfg)
+
+	if err := os.MkdirAll(cfg.DataDirectory, 0755); err != nil {
+		return nil, err
+	}
+
+	e := &BitcaskEngine{
+		cfg:     cfg,
+		logger:  logger,
+		keydir:  newBucketMap[bitcaskLocation](),
+		files:   make(map[uint32]*bitcaskFile),
+		closeCh: make(chan struct{}),
+	}
+
+	if err := e.open(); err != nil {
+		e.closeFiles()
+		return nil, err
+	}
+
+	e.startMerger()
+
+	return e, nil
+}
+
+func withBitcaskDefaults(cfg config.BitcaskConfig) config.BitcaskConfig {
+	if cfg.DataDirectory == "" {
+		cfg.DataDirectory = "bitcask"
+	}
+	if cfg.MaxFileSize == 0 {
+		cfg.MaxFileSize = defaultBitcaskMaxFileSize
+	}
+	if cfg.MergeInterval == 0 {
+		cfg.MergeInterval = defaultBitcaskMergeInterval
+	}
+	if cfg.MergeTrigger == 0 {
+		cfg.MergeTrigger = defaultBitcaskMergeTrigger
+	}
+
+	return cfg
+}
+
+// open - восстанавливает keydir из hint файлов, а где их нет - сканированием файлов данных
+func (e *BitcaskEngine) open() error {
+	ids, err := e.listDataFiles()
+	if err != nil {
+		return err
+	}
+
+	latest := make(map[string]bitcaskScanEntry)
+	var checkpointSeq uint64
+	for _, id := range ids {
+		f, err := e.openFile(id)
+		if err != nil {
+			return err
+		}
+		e.files[id] = f
+		e.totalBytes += f.size
+		e.nextFileID = id + 1
+
+		entries, err := e.loadFile(f)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			e.seq = max(e.seq, entry.loc.seq+1)
+
+			if entry.checkpoint {
+				if entry.loc.seq >= checkpointSeq {
+					e.checkpoint, checkpointSeq = entry.walSeq, entry.loc.seq
+				}
+				continue
+			}
+
+			if current, ok := latest[entry.key]; !ok || entry.loc.seq >= current.loc.seq {
+				latest[entry.key] = entry
+			}
+		}
+	}
+
+	var liveBytes int64
+	for key, entry := range latest {
+		if entry.tombstone {
+			continue
+		}
+
+		e.keydir.set(key, entry.loc)
+		liveBytes += int64(entry.loc.size)
+	}
+	e.deadBytes = e.totalBytes - liveBytes
+
+	// в последний файл можно дописывать, если это не результат слияния с hint файлом
+	if len(ids) > 0 {
+		last := e.files[ids[len(ids)-1]]
+		if _, err := os.Stat(e.hintPath(last.id)); os.IsNotExist(err) && last.size < int64(e.cfg.MaxFileSize) {
+			e.active = last
+		}
+	}
+
+	if e.active == nil {
+		if err := e.rotateLocked(); err != nil {
+			return err
+		}
+	}
+
+	e.logger.Info("bitcask: opened", zap.String("dir", e.cfg.DataDirectory), zap.Int("files", len(e.files)), zap.Int("keys", e.keydir.len()))
+
+	return nil
+}
+
+// loadFile - читает hint файл, а если его нет или он поврежден - сам файл данных.
+// Недописанный хвост файла данных отрезается
+func (e *BitcaskEngine) loadFile(f *bitcaskFile) ([]bitcaskScanEntry, error) {
+	entries, err := readBitcaskHints(f.id, e.hintPath(f.id))
+	if err == nil {
+		return entries, nil
+	}
+
+	if !os.IsNotExist(err) {
+		e.logger.Warn("bitcask: invalid hint file, scanning data file", zap.Uint32("file", f.id), zap.Error(err))
+	}
+
+	entries, end, err := scanBitcaskFile(f.id, f.file)
+	if err != nil {
+		return nil, err
+	}
+
+	if end < f.size {
+		e.logger.Warn("bitcask: truncating torn tail", zap.Uint32("file", f.id), zap.Int64("size", f.size), zap.Int64("end", end))
+		if err := f.file.Truncate(end); err != nil {
+			return nil, err
+		}
+		f.size = end
+	}
+
+	return entries, nil
+}
+
+func (e *BitcaskEngine) Get(_ context.Context, key string) (string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return getValue(e, key)
+}
+
+func (e *BitcaskEngine) Set(_ context.Context, key string, value string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.setLocked(key, storage.NewEntry(value))
+}
+
+func (e *BitcaskEngine) Delete(_ context.Context, key string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.deleteLocked(key)
+}
+
+func (e *BitcaskEngine) Update(ctx context.Context, fn func(storage.Tx) error) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return fn(newUpdateTx(ctx, e))
+}
+
+func (e *BitcaskEngine) View(ctx context.Context, fn func(storage.Tx) error) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return fn(newViewTx(ctx, e))
+}
+
+// Iterate - keydir это хеш таблица без порядка, обход по диапазону не поддерживается
+func (e *BitcaskEngine) Iterate(_ context.Context, _ storage.IterOptions) (storage.Iterator, error) {
+	return nil, storage.ErrIterationUnsupported
+}
+
+func (e *BitcaskEngine) Scan(_ context.Context, cursor string, count int) (string, []string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	now := storage.NowMillis()
+
+	return e.keydir.scan(cursor, count, func(loc bitcaskLocation) bool {
+		return loc.expired(now)
+	})
+}
+
+func (e *BitcaskEngine) ScanExpired(_ context.Context, cursor string, count int, now int64) (string, []string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.keydir.sample(cursor, count, func(loc bitcaskLocation) bool {
+		return loc.expired(now)
+	})
+}
+
+func (e *BitcaskEngine) Len(_ context.Context) (int, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	now := storage.NowMillis()
+
+	return e.keydir.count(func(loc bitcaskLocation) bool {
+		return !loc.expired(now)
+	}), nil
+}
+
+// Checkpoint - число записей WAL, изменения которых уже в файлах данных
+func (e *BitcaskEngine) Checkpoint() uint64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.checkpoint
+}
+
+func (e *BitcaskEngine) SetCheckpoint(seq uint64) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.setCheckpointLocked(seq)
+}
+
+// Close - останавливает слияние и закрывает файлы
+func (e *BitcaskEngine) Close() error {
+	var err error
+
+	e.closeOnce.Do(func() {
+		close(e.closeCh)
+		e.wg.Wait()
+
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		err = e.active.file.Sync()
+		e.closeFiles()
+	})
+
+	return err
+}
+
+func (e *BitcaskEngine) getLocked(key string) (storage.Entry, bool, error) {
+	loc, ok := e.keydir.get(key)
+	if !ok {
+		return storage.Entry{}, false, nil
+	}
+
+	// истекшую запись не читаем с диска
+	if loc.expired(storage.NowMillis()) {
+		return storage.Entry{ExpireAt: loc.expireAt}, true, nil
+	}
+
+	record, err := e.readRecord(loc)
+	if err != nil {
+		return storage.Entry{}, false, err
+	}
+
+	entry, err := storage.DecodeEntry(record.value)
+	if err != nil {
+		return storage.Entry{}, false, err
+	}
+
+	return entry, true, nil
+}
+
+func (e *BitcaskEngine) setLocked(key string, entry storage.Entry) error {
+	return e.appendLocked(bitcaskRecord{key: key, value: storage.EncodeEntry(entry)}, entry.ExpireAt)
+}
+
+func (e *BitcaskEngine) deleteLocked(key string) error {
+	if _, ok := e.keydir.get(key); !ok {
+		return nil
+	}
+
+	return e.appendLocked(bitcaskRecord{key: key, tombstone: true}, 0)
+}
+
+// clearLocked - удаляет все файлы и начинает новый активный. Вызывается под блокировкой
+func (e *BitcaskEngine) clearLocked() error {
+	obsolete := e.files
+
+	e.keydir = newBucketMap[bitcaskLocation]()
+	e.files = make(map[uint32]*bitcaskFile)
+	e.active = nil
+	e.totalBytes, e.deadBytes = 0, 0
+	e.generation++
+
+	for _, f := range obsolete {
+		if err := f.file.Close(); err != nil {
+			e.logger.Warn("bitcask: failed to close file", zap.Uint32("file", f.id), zap.Error(err))
+		}
+
+		for _, name := range []string{e.dataPath(f.id), e.hintPath(f.id)} {
+			if err := removeFile(name); err != nil {
+				e.logger.Warn("bitcask: failed to remove file", zap.String("path", name), zap.Error(err))
+			}
+		}
+	}
+
+	e.logger.Info("bitcask: cleared")
+
+	if err := e.rotateLocked(); err != nil {
+		return err
+	}
+
+	return e.keepCheckpointLocked()
+}
+
+// setCheckpointLocked - дописывает запись checkpoint после изменений транзакции. Вызывается под блокировкой
+func (e *BitcaskEngine) setCheckpointLocked(seq uint64) error {
+	if err := e.appendLocked(checkpointRecord(seq), 0); err != nil {
+		return err
+	}
+
+	e.checkpoint = seq
+
+	return nil
+}
+
+// keepCheckpointLocked - повторяет checkpoint в новом активном файле: файлы с прежней записью
+// удаляются очисткой или слиянием. Вызывается под блокировкой
+func (e *BitcaskEngine) keepCheckpointLocked() error {
+	if e.checkpoint == 0 {
+		return nil
+	}
+
+	return e.setCheckpointLocked(e.checkpoint)
+}
+
+// appendLocked - дописывает запись в активный файл и обновляет keydir. Вызывается под блокировкой
+func (e *BitcaskEngine) appendLocked(record bitcaskRecord, expireAt int64) error {
+	if e.active.size >= int64(e.cfg.MaxFileSize) {
+		if err := e.rotateLocked(); err != nil {
+			return err
+		}
+	}
+
+	record.seq = e.seq
+	data := encodeBitcaskRecord(record)
+
+	if _, err := e.active.file.Write(data); err != nil {
+		return err
+	}
+
+	if e.cfg.SyncOnWrite {
+		if err := e.active.file.Sync(); err != nil {
+			return err
+		}
+	}
+
+	loc := bitcaskLocation{fileID: e.active.id, offset: e.active.size, size: uint32(len(data)), seq: record.seq, expireAt: expireAt}
+	e.seq++
+	e.active.size += int64(len(data))
+	e.totalBytes += int64(len(data))
+
+	if record.checkpoint {
+		e.deadBytes += int64(len(data))
+		return nil
+	}
+
+	if old, ok := e.keydir.get(record.key); ok {
+		e.deadBytes += int64(old.size)
+	}
+
+	if record.tombstone {
+		e.keydir.delete(record.key)
+		e.deadBytes += int64(len(data))
+	} else {
+		e.keydir.set(record.key, loc)
+	}
+
+	return nil
+}
+
+// rotateLocked - делает активный файл неизменяемым и открывает новый. Вызывается под блокировкой
+func (e *BitcaskEngine) rotateLocked() error {
+	if e.active != nil {
+		if err := e.active.file.Sync(); err != nil {
+			return err
+		}
+	}
+
+	f, err := e.openFile(e.nextFileID)
+	if err != nil {
+		return err
+	}
+
+	e.nextFileID++
+	e.files[f.id] = f
+	e.active = f
+
+	return nil
+}
+
+func (e *BitcaskEngine) readRecord(loc bitcaskLocation) (bitcaskRecord, error) {
+	f, ok := e.files[loc.fileID]
+	if !ok {
+		return bitcaskRecord{}, fmt.Errorf("%w: unknown file %d", ErrCorruptedRecord, loc.fileID)
+	}
+
+	data := make([]byte, loc.size)
+	if _, err := f.file.ReadAt(data, loc.offset); err != nil {
+		return bitcaskRecord{}, err
+	}
+
+	return decodeBitcaskRecord(data)
+}
+
+func (e *BitcaskEngine) openFile(id uint32) (*bitcaskFile, error) {
+	file, err := os.OpenFile(e.dataPath(id), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return &bitcaskFile{id: id, file: file, size: info.Size()}, nil
+}
+
+func (e *BitcaskEngine) listDataFiles() ([]uint32, error) {
+	names, err := filepath.Glob(path.Join(e.cfg.DataDirectory, "*"+bitcaskDataFileExt))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint32, 0, len(names))
+	for _, name := range names {
+		id, err := strconv.ParseUint(strings.TrimSuffix(path.Base(name), bitcaskDataFileExt), 10, 32)
+		if err != nil {
+			continue
+		}
+
+		ids = append(ids, uint32(id))
+	}
+
+	slices.Sort(ids)
+
+	return ids, nil
+}
+
+func (e *BitcaskEngine) dataPath(id uint32) string {
+	return path.Join(e.cfg.DataDirectory, fmt.Sprintf(bitcaskFilenameFmt, id)+bitcaskDataFileExt)
+}
+
+func (e *BitcaskEngine) hintPath(id uint32) string {
+	return path.Join(e.cfg.DataDirectory, fmt.Sprintf(bitcaskFilenameFmt, id)+bitcaskHintFileExt)
+}
+
+func (e *BitcaskEngine) closeFiles() {
+	for _, f := range e.files {
+		if err := f.file.Close(); err != nil {
+			e.logger.Warn("bitcask: failed to close file", zap.Uint32("file", f.id), zap.Error(err))
+		}
+	}
+}
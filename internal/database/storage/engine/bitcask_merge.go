@@ -0,0 +1,223 @@
+package engine
+
+import (
+	"bufio"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func (e *BitcaskEngine) startMerger() {
+	e.wg.Add(1)
+
+	go func() {
+		defer e.wg.Done()
+
+		ticker := time.NewTicker(e.cfg.MergeInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-e.closeCh:
+				return
+			case <-ticker.C:
+				if !e.needMerge() {
+					continue
+				}
+
+				if err := e.Merge(); err != nil {
+					e.logger.Error("bitcask: merge failed", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+func (e *BitcaskEngine) needMerge() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.totalBytes == 0 {
+		return false
+	}
+
+	return float64(e.deadBytes)/float64(e.totalBytes) >= e.cfg.MergeTrigger
+}
+
+// Merge - переписывает живые записи всех неизменяемых файлов в новые файлы с hint файлами и удаляет старые.
+// Запись в активный файл во время слияния не блокируется
+func (e *BitcaskEngine) Merge() error {
+	e.mergeMu.Lock()
+	defer e.mergeMu.Unlock()
+
+	e.mu.Lock()
+	if err := e.rotateLocked(); err != nil {
+		e.mu.Unlock()
+		return err
+	}
+
+	if err := e.keepCheckpointLocked(); err != nil {
+		e.mu.Unlock()
+		return err
+	}
+
+	inputs := make([]*bitcaskFile, 0, len(e.files))
+	for _, f := range e.files {
+		if f != e.active {
+			inputs = append(inputs, f)
+		}
+	}
+
+	generation := e.generation
+	snapshot := make(map[string]bitcaskLocation, e.keydir.len())
+	e.keydir.each(func(key string, loc bitcaskLocation) bool {
+		if loc.fileID != e.active.id {
+			snapshot[key] = loc
+		}
+		return true
+	})
+	e.mu.Unlock()
+
+	e.logger.Info("bitcask: merge start", zap.Int("files", len(inputs)), zap.Int("keys", len(snapshot)))
+
+	outputs, moved, err := e.writeMerged(snapshot)
+	if err != nil {
+		for _, f := range outputs {
+			_ = f.file.Close()
+			_ = removeFile(e.dataPath(f.id))
+			_ = removeFile(e.hintPath(f.id))
+		}
+
+		return err
+	}
+
+	e.mu.Lock()
+	if generation != e.generation {
+		e.mu.Unlock()
+
+		// база очищена во время слияния, входных файлов уже нет
+		for _, f := range outputs {
+			_ = f.file.Close()
+			_ = removeFile(e.dataPath(f.id))
+			_ = removeFile(e.hintPath(f.id))
+		}
+
+		return nil
+	}
+
+	for key, loc := range moved {
+		// ключ могли перезаписать или удалить во время слияния, тогда новое место уже не актуально
+		if current, ok := e.keydir.get(key); ok && current == snapshot[key] {
+			e.keydir.set(key, loc)
+		}
+	}
+
+	for _, f := range inputs {
+		delete(e.files, f.id)
+		e.totalBytes -= f.size
+	}
+
+	var liveBytes int64
+	for _, f := range outputs {
+		e.files[f.id] = f
+		e.totalBytes += f.size
+	}
+	e.keydir.each(func(_ string, loc bitcaskLocation) bool {
+		liveBytes += int64(loc.size)
+		return true
+	})
+	e.deadBytes = e.totalBytes - liveBytes
+	e.mu.Unlock()
+
+	for _, f := range inputs {
+		if err := f.file.Close(); err != nil {
+			e.logger.Warn("bitcask: failed to close file", zap.Uint32("file", f.id), zap.Error(err))
+		}
+
+		for _, name := range []string{e.dataPath(f.id), e.hintPath(f.id)} {
+			if err := removeFile(name); err != nil {
+				e.logger.Warn("bitcask: failed to remove file", zap.String("path", name), zap.Error(err))
+			}
+		}
+	}
+
+	e.logger.Info("bitcask: merge end", zap.Int("files", len(outputs)), zap.Int("keys", len(moved)))
+
+	return nil
+}
+
+// writeMerged - пишет записи снимка keydir в новые файлы. Входные файлы не меняются и не удаляются,
+// пока держится mergeMu, поэтому читаются без общей блокировки
+func (e *BitcaskEngine) writeMerged(snapshot map[string]bitcaskLocation) ([]*bitcaskFile, map[string]bitcaskLocation, error) {
+	outputs := make([]*bitcaskFile, 0)
+	moved := make(map[string]bitcaskLocation, len(snapshot))
+
+	var (
+		out    *bitcaskFile
+		writer *bufio.Writer
+		hints  []byte
+	)
+
+	finish := func() error {
+		if out == nil {
+			return nil
+		}
+
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+
+		if err := out.file.Sync(); err != nil {
+			return err
+		}
+
+		return writeFileAtomic(e.hintPath(out.id), hints)
+	}
+
+	for key, loc := range snapshot {
+		e.mu.RLock()
+		f := e.files[loc.fileID]
+		e.mu.RUnlock()
+
+		data := make([]byte, loc.size)
+		if _, err := f.file.ReadAt(data, loc.offset); err != nil {
+			return outputs, nil, err
+		}
+
+		if out == nil || out.size >= int64(e.cfg.MaxFileSize) {
+			if err := finish(); err != nil {
+				return outputs, nil, err
+			}
+
+			e.mu.Lock()
+			id := e.nextFileID
+			e.nextFileID++
+			e.mu.Unlock()
+
+			var err error
+			out, err = e.openFile(id)
+			if err != nil {
+				return outputs, nil, err
+			}
+
+			outputs = append(outputs, out)
+			writer = bufio.NewWriter(out.file)
+			hints = hints[:0]
+		}
+
+		if _, err := writer.Write(data); err != nil {
+			return outputs, nil, err
+		}
+
+		newLoc := bitcaskLocation{fileID: out.id, offset: out.size, size: loc.size, seq: loc.seq, expireAt: loc.expireAt}
+		hints = append(hints, encodeBitcaskHint(key, newLoc)...)
+		moved[key] = newLoc
+		out.size += int64(loc.size)
+	}
+
+	if err := finish(); err != nil {
+		return outputs, nil, err
+	}
+
+	return outputs, moved, nil
+}
@@ -0,0 +1,229 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/TimonKK/inmemory-db/internal/database/storage"
+)
+
+// Формат записи файла данных:
+//
+//	crc32 | seq u64 | flags u8 | keySize u32 | valueSize u32 | key | value
+//
+// crc считается по всему, что идет после него. seq - сквозной номер записи, по нему при старте
+// выбирается самая свежая версия ключа независимо от порядка файлов. Запись с флагом checkpoint
+// не относится к ключу: её значение - число записей WAL (u64), изменения которых уже в файлах.
+//
+// Формат записи hint файла (только живые ключи, без tombstones):
+//
+//	seq u64 | offset u64 | size u32 | expireAt u64 | keySize u32 | key
+const (
+	bitcaskHeaderSize     = 21
+	bitcaskHintHeaderSize = 32
+
+	bitcaskFlagTombstone  byte = 1
+	bitcaskFlagCheckpoint byte = 2
+)
+
+var (
+	ErrCorruptedRecord = errors.New("bitcask record is corrupted")
+)
+
+type bitcaskRecord struct {
+	seq        uint64
+	key        string
+	value      string
+	tombstone  bool
+	checkpoint bool
+}
+
+// bitcaskLocation - элемент keydir: где лежит последняя версия ключа
+type bitcaskLocation struct {
+	fileID uint32
+	offset int64
+	size   uint32
+	seq    uint64
+	// expireAt - срок жизни значения, чтобы SCAN не читал записи с диска
+	expireAt int64
+}
+
+func (loc bitcaskLocation) expired(now int64) bool {
+	return loc.expireAt != 0 && loc.expireAt <= now
+}
+
+// bitcaskScanEntry - запись, прочитанная при старте из файла данных или hint файла.
+// Для записи checkpoint в walSeq её значение
+type bitcaskScanEntry struct {
+	key        string
+	loc        bitcaskLocation
+	tombstone  bool
+	checkpoint bool
+	walSeq     uint64
+}
+
+func checkpointRecord(seq uint64) bitcaskRecord {
+	return bitcaskRecord{value: string(binary.LittleEndian.AppendUint64(nil, seq)), checkpoint: true}
+}
+
+func encodeBitcaskRecord(record bitcaskRecord) []byte {
+	var flags byte
+	if record.tombstone {
+		flags |= bitcaskFlagTombstone
+	}
+	if record.checkpoint {
+		flags |= bitcaskFlagCheckpoint
+	}
+
+	data := make([]byte, 4, bitcaskHeaderSize+len(record.key)+len(record.value))
+	data = binary.LittleEndian.AppendUint64(data, record.seq)
+	data = append(data, flags)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(record.key)))
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(record.value)))
+	data = append(data, record.key...)
+	data = append(data, record.value...)
+
+	binary.LittleEndian.PutUint32(data, crc32.ChecksumIEEE(data[4:]))
+
+	return data
+}
+
+func decodeBitcaskRecord(data []byte) (bitcaskRecord, error) {
+	if len(data) < bitcaskHeaderSize {
+		return bitcaskRecord{}, ErrCorruptedRecord
+	}
+
+	keySize := binary.LittleEndian.Uint32(data[13:])
+	valueSize := binary.LittleEndian.Uint32(data[17:])
+	if uint64(len(data)) != bitcaskHeaderSize+uint64(keySize)+uint64(valueSize) {
+		return bitcaskRecord{}, ErrCorruptedRecord
+	}
+
+	if crc32.ChecksumIEEE(data[4:]) != binary.LittleEndian.Uint32(data) {
+		return bitcaskRecord{}, fmt.Errorf("%w: checksum mismatch", ErrCorruptedRecord)
+	}
+
+	body := data[bitcaskHeaderSize:]
+
+	return bitcaskRecord{
+		seq:        binary.LittleEndian.Uint64(data[4:]),
+		key:        string(body[:keySize]),
+		value:      string(body[keySize:]),
+		tombstone:  data[12]&bitcaskFlagTombstone != 0,
+		checkpoint: data[12]&bitcaskFlagCheckpoint != 0,
+	}, nil
+}
+
+// scanBitcaskFile - читает все записи файла данных. Возвращает смещение конца последней целой записи,
+// чтобы можно было отрезать недописанный хвост
+func scanBitcaskFile(id uint32, file *os.File) ([]bitcaskScanEntry, int64, error) {
+	entries := make([]bitcaskScanEntry, 0)
+	reader := bufio.NewReader(io.NewSectionReader(file, 0, 1<<62))
+	header := make([]byte, bitcaskHeaderSize)
+
+	var offset int64
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return entries, offset, nil
+			}
+
+			return nil, 0, err
+		}
+
+		size := bitcaskHeaderSize + int(binary.LittleEndian.Uint32(header[13:])) + int(binary.LittleEndian.Uint32(header[17:]))
+		data := make([]byte, size)
+		copy(data, header)
+		if _, err := io.ReadFull(reader, data[bitcaskHeaderSize:]); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return entries, offset, nil
+			}
+
+			return nil, 0, err
+		}
+
+		record, err := decodeBitcaskRecord(data)
+		if err != nil {
+			return entries, offset, nil
+		}
+
+		if record.checkpoint {
+			if len(record.value) != 8 {
+				return entries, offset, nil
+			}
+
+			entries = append(entries, bitcaskScanEntry{
+				loc:        bitcaskLocation{fileID: id, offset: offset, size: uint32(size), seq: record.seq},
+				checkpoint: true,
+				walSeq:     binary.LittleEndian.Uint64([]byte(record.value)),
+			})
+			offset += int64(size)
+
+			continue
+		}
+
+		var expireAt int64
+		if !record.tombstone {
+			expireAt, err = storage.DecodeExpireAt(record.value)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+
+		entries = append(entries, bitcaskScanEntry{
+			key:       record.key,
+			loc:       bitcaskLocation{fileID: id, offset: offset, size: uint32(size), seq: record.seq, expireAt: expireAt},
+			tombstone: record.tombstone,
+		})
+		offset += int64(size)
+	}
+}
+
+func encodeBitcaskHint(key string, loc bitcaskLocation) []byte {
+	data := make([]byte, 0, bitcaskHintHeaderSize+len(key))
+	data = binary.LittleEndian.AppendUint64(data, loc.seq)
+	data = binary.LittleEndian.AppendUint64(data, uint64(loc.offset))
+	data = binary.LittleEndian.AppendUint32(data, loc.size)
+	data = binary.LittleEndian.AppendUint64(data, uint64(loc.expireAt))
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(key)))
+
+	return append(data, key...)
+}
+
+func readBitcaskHints(id uint32, name string) ([]bitcaskScanEntry, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]bitcaskScanEntry, 0)
+	for len(data) > 0 {
+		if len(data) < bitcaskHintHeaderSize {
+			return nil, ErrCorruptedRecord
+		}
+
+		keySize := int(binary.LittleEndian.Uint32(data[28:]))
+		if len(data) < bitcaskHintHeaderSize+keySize {
+			return nil, ErrCorruptedRecord
+		}
+
+		entries = append(entries, bitcaskScanEntry{
+			key: string(data[bitcaskHintHeaderSize : bitcaskHintHeaderSize+keySize]),
+			loc: bitcaskLocation{
+				fileID:   id,
+				seq:      binary.LittleEndian.Uint64(data),
+				offset:   int64(binary.LittleEndian.Uint64(data[8:])),
+				size:     binary.LittleEndian.Uint32(data[16:]),
+				expireAt: int64(binary.LittleEndian.Uint64(data[20:])),
+			},
+		})
+		data = data[bitcaskHintHeaderSize+keySize:]
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,197 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/TimonKK/inmemory-db/internal/config"
+	"github.com/TimonKK/inmemory-db/internal/database/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestBitcaskEngine(t *testing.T, cfg config.BitcaskConfig) *BitcaskEngine {
+	t.Helper()
+
+	e, err := NewBitcaskEngine(cfg, zap.NewNop())
+	require.NoError(t, err)
+
+	return e
+}
+
+func TestBitcaskEngine_GetSetDelete(t *testing.T) {
+	e := newTestBitcaskEngine(t, config.BitcaskConfig{DataDirectory: t.TempDir()})
+	defer func() {
+		_ = e.Close()
+	}()
+
+	_, err := e.Get(ctx, "missing")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	require.NoError(t, e.Set(ctx, "key", "old"))
+	require.NoError(t, e.Set(ctx, "key", "new"))
+
+	value, err := e.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "new", value)
+
+	require.NoError(t, e.Delete(ctx, "key"))
+	_, err = e.Get(ctx, "key")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	require.NoError(t, e.Delete(ctx, "missing"))
+}
+
+func TestBitcaskEngine_Reopen(t *testing.T) {
+	cfg := config.BitcaskConfig{DataDirectory: t.TempDir(), MaxFileSize: 256}
+
+	e := newTestBitcaskEngine(t, cfg)
+	for i := range 50 {
+		require.NoError(t, e.Set(ctx, fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i)))
+	}
+	require.NoError(t, e.Delete(ctx, "key10"))
+	require.NoError(t, e.Close())
+
+	// недописанная запись в конце последнего файла должна быть отрезана при старте
+	file, err := os.OpenFile(e.dataPath(e.active.id), os.O_APPEND|os.O_WRONLY, 0666)
+	require.NoError(t, err)
+	_, err = file.Write(encodeBitcaskRecord(bitcaskRecord{key: "torn", value: "tail"})[:10])
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	e = newTestBitcaskEngine(t, cfg)
+	defer func() {
+		_ = e.Close()
+	}()
+
+	assert.Greater(t, len(e.files), 1)
+	for i := range 50 {
+		value, err := e.Get(ctx, fmt.Sprintf("key%d", i))
+		if i == 10 {
+			assert.ErrorIs(t, err, ErrKeyNotFound)
+			continue
+		}
+
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("value%d", i), value)
+	}
+
+	require.NoError(t, e.Set(ctx, "after", "reopen"))
+	value, err := e.Get(ctx, "after")
+	require.NoError(t, err)
+	assert.Equal(t, "reopen", value)
+}
+
+func TestBitcaskEngine_Merge(t *testing.T) {
+	cfg := config.BitcaskConfig{DataDirectory: t.TempDir(), MaxFileSize: 512}
+
+	e := newTestBitcaskEngine(t, cfg)
+	for round := range 5 {
+		for i := range 20 {
+			require.NoError(t, e.Set(ctx, fmt.Sprintf("key%d", i), fmt.Sprintf("value%d_%d", i, round)))
+		}
+	}
+	for i := 0; i < 20; i += 2 {
+		require.NoError(t, e.Delete(ctx, fmt.Sprintf("key%d", i)))
+	}
+
+	totalBefore := e.totalBytes
+	require.NoError(t, e.Merge())
+	assert.Less(t, e.totalBytes, totalBefore)
+	assert.Zero(t, e.deadBytes)
+
+	check := func(e *BitcaskEngine) {
+		for i := range 20 {
+			value, err := e.Get(ctx, fmt.Sprintf("key%d", i))
+			if i%2 == 0 {
+				assert.ErrorIs(t, err, ErrKeyNotFound)
+				continue
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("value%d_4", i), value)
+		}
+	}
+
+	check(e)
+	require.NoError(t, e.Close())
+
+	// после слияния keydir восстанавливается из hint файлов
+	e = newTestBitcaskEngine(t, cfg)
+	defer func() {
+		_ = e.Close()
+	}()
+
+	check(e)
+}
+
+func TestBitcaskEngine_Expire(t *testing.T) {
+	cfg := config.BitcaskConfig{DataDirectory: t.TempDir()}
+
+	e := newTestBitcaskEngine(t, cfg)
+	require.NoError(t, e.Update(ctx, func(tx storage.Tx) error {
+		if err := tx.Set("live", storage.Entry{Value: "v", ExpireAt: tx.Now() + 60_000}); err != nil {
+			return err
+		}
+
+		return tx.Set("expired", storage.Entry{Value: "v", ExpireAt: tx.Now() - 1})
+	}))
+
+	check := func(e *BitcaskEngine) {
+		require.NoError(t, e.View(ctx, func(tx storage.Tx) error {
+			entry, err := tx.Get("live")
+			require.NoError(t, err)
+			assert.Greater(t, entry.ExpireAt, tx.Now())
+
+			_, err = tx.Get("expired")
+			assert.ErrorIs(t, err, ErrKeyNotFound)
+
+			return nil
+		}))
+
+		_, keys, err := e.Scan(ctx, "0", 100)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"live"}, keys)
+	}
+
+	check(e)
+
+	// срок жизни восстанавливается и из файла данных, и из hint файла после слияния
+	require.NoError(t, e.Close())
+	e = newTestBitcaskEngine(t, cfg)
+	check(e)
+
+	require.NoError(t, e.Merge())
+	require.NoError(t, e.Close())
+	e = newTestBitcaskEngine(t, cfg)
+	defer func() {
+		_ = e.Close()
+	}()
+	check(e)
+}
+
+func TestBitcaskEngine_Clear(t *testing.T) {
+	cfg := config.BitcaskConfig{DataDirectory: t.TempDir(), MaxFileSize: 256}
+
+	e := newTestBitcaskEngine(t, cfg)
+	for i := range 20 {
+		require.NoError(t, e.Set(ctx, fmt.Sprintf("key%d", i), "value"))
+	}
+
+	require.NoError(t, e.Update(ctx, func(tx storage.Tx) error {
+		return tx.Clear()
+	}))
+	require.NoError(t, e.Set(ctx, "after", "value"))
+	require.NoError(t, e.Close())
+
+	e = newTestBitcaskEngine(t, cfg)
+	defer func() {
+		_ = e.Close()
+	}()
+
+	_, keys, err := e.Scan(ctx, "0", 100)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"after"}, keys)
+}
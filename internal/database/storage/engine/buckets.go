@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+
+	"github.com/TimonKK/inmemory-db/internal/database/storage"
+)
+
+const scanBucketsCount = 4096
+
+// bucketMap - map, разбитая на фиксированное число корзин по хешу ключа. Корзина ключа никогда не меняется,
+// поэтому номер корзины служит курсором SCAN: сервер не хранит состояние обхода, а ключ, который был в базе
+// всё время обхода, будет отдан ровно один раз
+type bucketMap[V any] struct {
+	buckets [scanBucketsCount]map[string]V
+	length  int
+}
+
+func newBucketMap[V any]() *bucketMap[V] {
+	return &bucketMap[V]{}
+}
+
+func (m *bucketMap[V]) get(key string) (V, bool) {
+	value, ok := m.buckets[bucketIndex(key)][key]
+	return value, ok
+}
+
+func (m *bucketMap[V]) set(key string, value V) {
+	i := bucketIndex(key)
+	if m.buckets[i] == nil {
+		m.buckets[i] = make(map[string]V)
+	}
+
+	if _, ok := m.buckets[i][key]; !ok {
+		m.length++
+	}
+	m.buckets[i][key] = value
+}
+
+func (m *bucketMap[V]) delete(key string) bool {
+	i := bucketIndex(key)
+	if _, ok := m.buckets[i][key]; !ok {
+		return false
+	}
+
+	delete(m.buckets[i], key)
+	m.length--
+
+	return true
+}
+
+func (m *bucketMap[V]) len() int {
+	return m.length
+}
+
+// each - обходит все записи, пока fn возвращает true
+func (m *bucketMap[V]) each(fn func(key string, value V) bool) {
+	for _, bucket := range m.buckets {
+		for key, value := range bucket {
+			if !fn(key, value) {
+				return
+			}
+		}
+	}
+}
+
+// scan - ключи целых корзин, начиная с корзины cursor, пока не наберется count ключей.
+// Записи, для которых skip вернул true, пропускаются. Возвращает курсор следующей корзины, "0" - обход закончен
+func (m *bucketMap[V]) scan(cursor string, count int, skip func(V) bool) (string, []string, error) {
+	start, err := strconv.ParseUint(cursor, 10, 64)
+	if err != nil || start >= scanBucketsCount {
+		return "", nil, fmt.Errorf("%w: %s", storage.ErrInvalidCursor, cursor)
+	}
+
+	keys := make([]string, 0, count)
+	i := int(start)
+	for ; i < scanBucketsCount && len(keys) < count; i++ {
+		for key, value := range m.buckets[i] {
+			if skip == nil || !skip(value) {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	if i == scanBucketsCount {
+		return "0", keys, nil
+	}
+
+	return strconv.Itoa(i), keys, nil
+}
+
+// sample - как scan, но отдает только записи, для которых match вернул true, а count ограничивает число
+// просмотренных записей, а не отданных. Так вызов не обходит всю карту, даже если подходящих записей нет
+func (m *bucketMap[V]) sample(cursor string, count int, match func(V) bool) (string, []string, error) {
+	start, err := strconv.ParseUint(cursor, 10, 64)
+	if err != nil || start >= scanBucketsCount {
+		return "", nil, fmt.Errorf("%w: %s", storage.ErrInvalidCursor, cursor)
+	}
+
+	var keys []string
+	scanned, i := 0, int(start)
+	for ; i < scanBucketsCount && scanned < count; i++ {
+		for key, value := range m.buckets[i] {
+			if match(value) {
+				keys = append(keys, key)
+			}
+		}
+		scanned += len(m.buckets[i])
+	}
+
+	if i == scanBucketsCount {
+		return "0", keys, nil
+	}
+
+	return strconv.Itoa(i), keys, nil
+}
+
+// count - число записей, для которых match вернул true
+func (m *bucketMap[V]) count(match func(V) bool) int {
+	n := 0
+	m.each(func(_ string, value V) bool {
+		if match(value) {
+			n++
+		}
+
+		return true
+	})
+
+	return n
+}
+
+func bucketIndex(key string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+
+	return int(h.Sum32() % scanBucketsCount)
+}
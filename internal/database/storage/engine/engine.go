@@ -3,17 +3,37 @@ package engine
 import (
 	"errors"
 	"fmt"
+
+	"github.com/TimonKK/inmemory-db/internal/config"
 	"github.com/TimonKK/inmemory-db/internal/database/storage"
+	"go.uber.org/zap"
 )
 
 var (
 	ErrUnknowEngine = errors.New("unknow engine")
 )
 
-func NewEngine(t string) (storage.Engine, error) {
-	if t == "in_memory" {
+func NewEngine(cfg *config.EngineConfig, logger *zap.Logger) (storage.Engine, error) {
+	switch cfg.Type {
+	case "in_memory":
 		return NewMemoryEngine(), nil
+	case "ordered":
+		return NewOrderedEngine(), nil
+	case "lsm":
+		lsm, err := NewLSMEngine(cfg.LSM, logger)
+		if err != nil {
+			return nil, err
+		}
+
+		return lsm, nil
+	case "bitcask":
+		bitcask, err := NewBitcaskEngine(cfg.Bitcask, logger)
+		if err != nil {
+			return nil, err
+		}
+
+		return bitcask, nil
 	}
 
-	return nil, fmt.Errorf("%w: type %s", ErrUnknowEngine, t)
+	return nil, fmt.Errorf("%w: type %s", ErrUnknowEngine, cfg.Type)
 }
@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"errors"
+	"os"
+)
+
+func removeFile(name string) error {
+	err := os.Remove(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// writeFileAtomic - пишет файл через временный, чтобы недописанный файл не был виден под своим именем
+func writeFileAtomic(name string, data []byte) error {
+	tmpName := name + ".tmp"
+	file, err := os.OpenFile(tmpName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpName, name)
+}
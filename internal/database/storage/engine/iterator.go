@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"github.com/TimonKK/inmemory-db/internal/database/storage"
+)
+
+const iteratorBatchSize = 128
+
+// fetchFunc - читает до n записей диапазона opts под блокировкой движка.
+// last - ключ, до которого (включительно) диапазон уже просмотрен, more - есть ли что читать дальше
+type fetchFunc func(opts storage.IterOptions, n int) (pairs []storage.KeyValue, last string, more bool, err error)
+
+// batchIterator - итератор, читающий движок пачками. Блокировка движка берется только на время чтения
+// пачки, поэтому долгий обход не мешает записи. Каждая пачка согласована, весь обход - нет
+type batchIterator struct {
+	opts  storage.IterOptions
+	fetch fetchFunc
+	batch []storage.KeyValue
+	pos   int
+	more  bool
+	err   error
+}
+
+func newBatchIterator(opts storage.IterOptions, fetch fetchFunc) *batchIterator {
+	return &batchIterator{
+		opts:  opts,
+		fetch: fetch,
+		pos:   -1,
+		more:  true,
+	}
+}
+
+func (it *batchIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	it.pos++
+	for it.pos >= len(it.batch) {
+		if !it.more {
+			return false
+		}
+
+		pairs, last, more, err := it.fetch(it.opts, iteratorBatchSize)
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		it.batch, it.pos, it.more = pairs, 0, more
+		if !more {
+			continue
+		}
+
+		// меньше пустого ключа ничего нет
+		if it.opts.Reverse && last == "" {
+			it.more = false
+			continue
+		}
+
+		// следующая пачка начинается строго после просмотренного ключа
+		if it.opts.Reverse {
+			it.opts.End = last
+		} else {
+			it.opts.Start = last + "\x00"
+		}
+	}
+
+	return true
+}
+
+func (it *batchIterator) Key() string {
+	return it.batch[it.pos].Key
+}
+
+func (it *batchIterator) Value() string {
+	return it.batch[it.pos].Value
+}
+
+func (it *batchIterator) Err() error {
+	return it.err
+}
+
+func (it *batchIterator) Close() error {
+	it.batch, it.more = nil, false
+
+	return nil
+}
@@ -0,0 +1,530 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/TimonKK/inmemory-db/internal/config"
+	"github.com/TimonKK/inmemory-db/internal/database/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultLSMMemtableSize        = 4 << 20
+	defaultLSMBlockSize           = 4 << 10
+	defaultLSMTargetFileSize      = 2 << 20
+	defaultLSMBloomBitsPerKey     = 10
+	defaultLSML0CompactionTrigger = 4
+	defaultLSMBaseLevelSize       = 10 << 20
+	defaultLSMLevelSizeMultiplier = 10
+	defaultLSMMaxLevels           = 7
+)
+
+// LSMEngine - персистентный движок на LSM дереве: memtable в памяти (её сохранность обеспечивает WAL),
+// неизменяемые SSTable на диске и фоновая уровневая компакция
+type LSMEngine struct {
+	cfg    config.LSMConfig
+	logger *zap.Logger
+
+	mu       sync.RWMutex
+	memtable *memtable
+	// levels[0] - таблицы от старых к новым, могут пересекаться.
+	// levels[1:] - таблицы не пересекаются и отсортированы по minKey
+	levels          [][]*sstable
+	compactPointers []string
+	nextFileID      atomic.Uint64
+	// applied - номер последней записи WAL, примененной к memtable, checkpoint - сохраненный в манифесте
+	// номер последней записи WAL, изменения которой уже в таблицах
+	applied    uint64
+	checkpoint uint64
+	// generation - меняется при очистке, чтобы компакция не вернула таблицы, начатые до неё
+	generation uint64
+
+	compactCh chan struct{}
+	closeCh   chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+func NewLSMEngine(cfg config.LSMConfig, logger *zap.Logger) (*LSMEngine, error) {
+	cfg = withLSMDefaults(cfg)
+
+	if err := os.MkdirAll(cfg.DataDirectory, 0755); err != nil {
+		return nil, err
+	}
+
+	e := &LSMEngine{
+		cfg:             cfg,
+		logger:          logger,
+		memtable:        newMemtable(),
+		levels:          make([][]*sstable, cfg.MaxLevels),
+		compactPointers: make([]string, cfg.MaxLevels),
+		compactCh:       make(chan struct{}, 1),
+		closeCh:         make(chan struct{}),
+	}
+
+	if err := e.open(); err != nil {
+		e.closeTables()
+		return nil, err
+	}
+
+	e.startCompaction()
+	e.scheduleCompaction()
+
+	return e, nil
+}
+
+func withLSMDefaults(cfg config.LSMConfig) config.LSMConfig {
+	if cfg.DataDirectory == "" {
+		cfg.DataDirectory = "lsm"
+	}
+	if cfg.MemtableSize == 0 {
+		cfg.MemtableSize = defaultLSMMemtableSize
+	}
+	if cfg.BlockSize == 0 {
+		cfg.BlockSize = defaultLSMBlockSize
+	}
+	if cfg.TargetFileSize == 0 {
+		cfg.TargetFileSize = defaultLSMTargetFileSize
+	}
+	if cfg.BloomBitsPerKey == 0 {
+		cfg.BloomBitsPerKey = defaultLSMBloomBitsPerKey
+	}
+	if cfg.L0CompactionTrigger == 0 {
+		cfg.L0CompactionTrigger = defaultLSML0CompactionTrigger
+	}
+	if cfg.BaseLevelSize == 0 {
+		cfg.BaseLevelSize = defaultLSMBaseLevelSize
+	}
+	if cfg.LevelSizeMultiplier == 0 {
+		cfg.LevelSizeMultiplier = defaultLSMLevelSizeMultiplier
+	}
+	if cfg.MaxLevels == 0 {
+		cfg.MaxLevels = defaultLSMMaxLevels
+	}
+
+	return cfg
+}
+
+// open - открывает таблицы из манифеста и удаляет файлы, которых в манифесте нет
+func (e *LSMEngine) open() error {
+	manifest, err := loadManifest(e.cfg.DataDirectory)
+	if err != nil {
+		return err
+	}
+	e.nextFileID.Store(manifest.NextFileID)
+	e.applied, e.checkpoint = manifest.Checkpoint, manifest.Checkpoint
+
+	known := make(map[string]bool)
+	for level, ids := range manifest.Levels {
+		if level >= len(e.levels) {
+			return errors.New("lsm manifest has more levels than max_levels")
+		}
+
+		for _, id := range ids {
+			table, err := openSSTable(id, sstablePath(e.cfg.DataDirectory, id))
+			if err != nil {
+				return err
+			}
+
+			e.levels[level] = append(e.levels[level], table)
+			known[table.path] = true
+		}
+	}
+
+	files, err := filepath.Glob(path.Join(e.cfg.DataDirectory, "*.sst*"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if known[file] {
+			continue
+		}
+
+		e.logger.Info("lsm: removing orphan file", zap.String("path", file))
+		if err := removeFile(file); err != nil {
+			return err
+		}
+	}
+
+	e.logger.Info("lsm: opened", zap.String("dir", e.cfg.DataDirectory), zap.Int("tables", len(known)))
+
+	return nil
+}
+
+func (e *LSMEngine) Get(_ context.Context, key string) (string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return getValue(e, key)
+}
+
+func (e *LSMEngine) Set(_ context.Context, key string, value string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.setLocked(key, storage.NewEntry(value)); err != nil {
+		return err
+	}
+
+	return e.maybeFlushLocked()
+}
+
+func (e *LSMEngine) Delete(_ context.Context, key string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.deleteLocked(key); err != nil {
+		return err
+	}
+
+	return e.maybeFlushLocked()
+}
+
+// Update - memtable сбрасывается только после транзакции, чтобы таблица не получила половину её изменений
+// раньше, чем checkpoint в манифесте дойдет до её записи WAL
+func (e *LSMEngine) Update(ctx context.Context, fn func(storage.Tx) error) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := fn(newUpdateTx(ctx, e)); err != nil {
+		return err
+	}
+
+	return e.maybeFlushLocked()
+}
+
+// Checkpoint - число записей WAL, изменения которых уже в таблицах. Остальные при старте повторяются в memtable
+func (e *LSMEngine) Checkpoint() uint64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.checkpoint
+}
+
+func (e *LSMEngine) SetCheckpoint(seq uint64) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.applied, e.checkpoint = seq, seq
+
+	return e.saveManifestLocked()
+}
+
+func (e *LSMEngine) View(ctx context.Context, fn func(storage.Tx) error) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return fn(newViewTx(ctx, e))
+}
+
+func (e *LSMEngine) Iterate(_ context.Context, opts storage.IterOptions) (storage.Iterator, error) {
+	return newBatchIterator(opts, e.fetch), nil
+}
+
+func (e *LSMEngine) Scan(ctx context.Context, cursor string, count int) (string, []string, error) {
+	return scanOrdered(ctx, e, cursor, count)
+}
+
+// Len - число живых ключей. Из-за перекрытий между уровнями считается полным обходом
+func (e *LSMEngine) Len(ctx context.Context) (int, error) {
+	return countOrdered(ctx, e)
+}
+
+func (e *LSMEngine) ScanExpired(_ context.Context, cursor string, count int, now int64) (string, []string, error) {
+	return sampleOrdered(cursor, count, func(opts storage.IterOptions, n int) ([]storage.KeyValue, string, bool, error) {
+		return e.fetchWhere(opts, n, func(entry storage.Entry) bool {
+			return entry.Expired(now)
+		})
+	})
+}
+
+func (e *LSMEngine) fetch(opts storage.IterOptions, n int) ([]storage.KeyValue, string, bool, error) {
+	now := storage.NowMillis()
+
+	return e.fetchWhere(opts, n, func(entry storage.Entry) bool {
+		return !entry.Expired(now)
+	})
+}
+
+// fetchWhere - читает пачку диапазона из всех уровней и отдает записи, для которых match вернул true.
+// Каждый источник отдает не больше n записей, поэтому результат достоверен только до ближайшего ключа,
+// на котором обрезался какой-либо источник
+func (e *LSMEngine) fetchWhere(opts storage.IterOptions, n int, match func(storage.Entry) bool) ([]storage.KeyValue, string, bool, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	sources := make([][]lsmEntry, 0, len(e.levels[0])+len(e.levels))
+	sources = append(sources, e.memtable.rangeEntries(opts, n))
+
+	for i := len(e.levels[0]) - 1; i >= 0; i-- {
+		entries, err := e.levels[0][i].rangeEntries(opts, n)
+		if err != nil {
+			return nil, "", false, err
+		}
+
+		sources = append(sources, entries)
+	}
+
+	for _, tables := range e.levels[1:] {
+		entries, err := levelRangeEntries(tables, opts, n)
+		if err != nil {
+			return nil, "", false, err
+		}
+
+		sources = append(sources, entries)
+	}
+
+	var (
+		bound     string
+		truncated bool
+	)
+	for _, entries := range sources {
+		if len(entries) < n {
+			continue
+		}
+
+		last := entries[len(entries)-1].key
+		if !truncated || (last < bound) != opts.Reverse {
+			bound = last
+		}
+		truncated = true
+	}
+
+	pairs := make([]storage.KeyValue, 0, n)
+	for _, entry := range mergeEntries(sources, opts.Reverse) {
+		if truncated && entry.key != bound && (entry.key > bound) != opts.Reverse {
+			break
+		}
+
+		if entry.tombstone {
+			continue
+		}
+
+		decoded, err := storage.DecodeEntry(entry.value)
+		if err != nil {
+			return nil, "", false, err
+		}
+
+		if match(decoded) {
+			pairs = append(pairs, storage.KeyValue{Key: entry.key, Value: decoded.String()})
+		}
+	}
+
+	return pairs, bound, truncated, nil
+}
+
+// Close - останавливает компакцию, сбрасывает memtable на диск и закрывает таблицы
+func (e *LSMEngine) Close() error {
+	var err error
+
+	e.closeOnce.Do(func() {
+		close(e.closeCh)
+		e.wg.Wait()
+
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		err = e.flushLocked()
+		e.closeTables()
+	})
+
+	return err
+}
+
+// lookup - ищет ключ от самых свежих данных к самым старым. Вызывается под блокировкой
+func (e *LSMEngine) lookup(key string) (lsmEntry, bool, error) {
+	if entry, ok := e.memtable.get(key); ok {
+		return entry, true, nil
+	}
+
+	for i := len(e.levels[0]) - 1; i >= 0; i-- {
+		entry, ok, err := e.levels[0][i].get(key)
+		if err != nil || ok {
+			return entry, ok, err
+		}
+	}
+
+	for _, tables := range e.levels[1:] {
+		for _, table := range tables {
+			if key < table.minKey {
+				break
+			}
+
+			if key <= table.maxKey {
+				entry, ok, err := table.get(key)
+				if err != nil || ok {
+					return entry, ok, err
+				}
+				break
+			}
+		}
+	}
+
+	return lsmEntry{}, false, nil
+}
+
+func (e *LSMEngine) getLocked(key string) (storage.Entry, bool, error) {
+	entry, ok, err := e.lookup(key)
+	if err != nil || !ok || entry.tombstone {
+		return storage.Entry{}, false, err
+	}
+
+	decoded, err := storage.DecodeEntry(entry.value)
+	if err != nil {
+		return storage.Entry{}, false, err
+	}
+
+	return decoded, true, nil
+}
+
+func (e *LSMEngine) setLocked(key string, entry storage.Entry) error {
+	e.memtable.put(lsmEntry{key: key, value: storage.EncodeEntry(entry)})
+	return nil
+}
+
+func (e *LSMEngine) deleteLocked(key string) error {
+	e.memtable.put(lsmEntry{key: key, tombstone: true})
+	return nil
+}
+
+// clearLocked - удаляет все данные: memtable и все таблицы. Вызывается под блокировкой
+func (e *LSMEngine) clearLocked() error {
+	obsolete := e.levels
+
+	e.memtable = newMemtable()
+	e.levels = make([][]*sstable, e.cfg.MaxLevels)
+	e.compactPointers = make([]string, e.cfg.MaxLevels)
+	e.generation++
+
+	if err := e.saveManifestLocked(); err != nil {
+		return err
+	}
+
+	for _, tables := range obsolete {
+		for _, table := range tables {
+			if err := table.close(); err != nil {
+				e.logger.Warn("lsm: failed to close table", zap.String("path", table.path), zap.Error(err))
+			}
+
+			if err := removeFile(table.path); err != nil {
+				e.logger.Warn("lsm: failed to remove table", zap.String("path", table.path), zap.Error(err))
+			}
+		}
+	}
+
+	e.logger.Info("lsm: cleared")
+
+	return nil
+}
+
+func (e *LSMEngine) setCheckpointLocked(seq uint64) error {
+	e.applied = seq
+	return nil
+}
+
+// maybeFlushLocked - сбрасывает memtable, если она выросла до memtable_size. Вызывается под блокировкой
+func (e *LSMEngine) maybeFlushLocked() error {
+	if e.memtable.size < int(e.cfg.MemtableSize) {
+		return nil
+	}
+
+	return e.flushLocked()
+}
+
+// flushLocked - сбрасывает memtable в новую таблицу L0 и переносит checkpoint в манифест.
+// Вызывается под блокировкой
+func (e *LSMEngine) flushLocked() error {
+	if e.memtable.len() == 0 {
+		if e.applied == e.checkpoint {
+			return nil
+		}
+
+		e.checkpoint = e.applied
+		return e.saveManifestLocked()
+	}
+
+	checkpoint := e.checkpoint
+	e.checkpoint = e.applied
+
+	table, err := e.writeTable(e.memtable.sorted())
+	if err != nil {
+		return err
+	}
+
+	e.levels[0] = append(e.levels[0], table)
+	if err := e.saveManifestLocked(); err != nil {
+		e.checkpoint = checkpoint
+		return err
+	}
+
+	e.logger.Info("lsm: memtable flushed", zap.String("path", table.path), zap.Int("keys", e.memtable.len()))
+
+	e.memtable = newMemtable()
+	e.scheduleCompaction()
+
+	return nil
+}
+
+func (e *LSMEngine) writeTable(entries []lsmEntry) (*sstable, error) {
+	id := e.nextFileID.Add(1) - 1
+
+	return writeSSTable(id, sstablePath(e.cfg.DataDirectory, id), entries, int(e.cfg.BlockSize), e.cfg.BloomBitsPerKey)
+}
+
+func (e *LSMEngine) saveManifestLocked() error {
+	manifest := lsmManifest{
+		NextFileID: e.nextFileID.Load(),
+		Levels:     make([][]uint64, len(e.levels)),
+		Checkpoint: e.checkpoint,
+	}
+
+	for level, tables := range e.levels {
+		manifest.Levels[level] = make([]uint64, 0, len(tables))
+		for _, table := range tables {
+			manifest.Levels[level] = append(manifest.Levels[level], table.id)
+		}
+	}
+
+	return saveManifest(e.cfg.DataDirectory, manifest)
+}
+
+// levelRangeEntries - до n записей диапазона из уровня с непересекающимися таблицами
+func levelRangeEntries(tables []*sstable, opts storage.IterOptions, n int) ([]lsmEntry, error) {
+	entries := make([]lsmEntry, 0)
+
+	for i := range tables {
+		table := tables[i]
+		if opts.Reverse {
+			table = tables[len(tables)-1-i]
+		}
+
+		tableEntries, err := table.rangeEntries(opts, n-len(entries))
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, tableEntries...)
+		if len(entries) == n {
+			break
+		}
+	}
+
+	return entries, nil
+}
+
+func (e *LSMEngine) closeTables() {
+	for _, tables := range e.levels {
+		for _, table := range tables {
+			if err := table.close(); err != nil {
+				e.logger.Warn("lsm: failed to close table", zap.String("path", table.path), zap.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+const maxBloomHashes = 30
+
+// bloomFilter - фильтр Блума SSTable, позволяет не читать блоки таблицы, в которой ключа точно нет
+type bloomFilter struct {
+	bits []byte
+	k    uint8
+}
+
+func newBloomFilter(keys int, bitsPerKey int) *bloomFilter {
+	bitsCount := keys * bitsPerKey
+	if bitsCount < 64 {
+		bitsCount = 64
+	}
+
+	// оптимальное число хешей k = ln2 * bits/keys
+	k := int(math.Round(float64(bitsPerKey) * math.Ln2))
+	k = max(1, min(k, maxBloomHashes))
+
+	return &bloomFilter{
+		bits: make([]byte, (bitsCount+7)/8),
+		k:    uint8(k),
+	}
+}
+
+func (b *bloomFilter) add(key string) {
+	h1, h2 := bloomHash(key)
+	m := uint32(len(b.bits) * 8)
+
+	for i := uint32(0); i < uint32(b.k); i++ {
+		bit := (h1 + i*h2) % m
+		b.bits[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// mayContain - false означает, что ключа точно нет, true - что ключ может быть
+func (b *bloomFilter) mayContain(key string) bool {
+	if len(b.bits) == 0 {
+		return true
+	}
+
+	h1, h2 := bloomHash(key)
+	m := uint32(len(b.bits) * 8)
+
+	for i := uint32(0); i < uint32(b.k); i++ {
+		bit := (h1 + i*h2) % m
+		if b.bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// encode - биты фильтра, последним байтом число хешей
+func (b *bloomFilter) encode() []byte {
+	data := make([]byte, 0, len(b.bits)+1)
+	data = append(data, b.bits...)
+
+	return append(data, b.k)
+}
+
+func decodeBloomFilter(data []byte) *bloomFilter {
+	if len(data) < 2 {
+		return &bloomFilter{}
+	}
+
+	return &bloomFilter{
+		bits: data[:len(data)-1],
+		k:    data[len(data)-1],
+	}
+}
+
+// bloomHash - двойное хеширование: k хешей получаются как h1 + i*h2
+func bloomHash(key string) (uint32, uint32) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	sum := h.Sum64()
+
+	return uint32(sum), uint32(sum>>32) | 1
+}
@@ -0,0 +1,365 @@
+package engine
+
+import (
+	"container/heap"
+	"slices"
+	"strings"
+
+	"github.com/TimonKK/inmemory-db/internal/database/storage"
+	"go.uber.org/zap"
+)
+
+// compactionTask - компакция таблиц inputs уровня level вместе с пересекающимися таблицами overlap уровня level+1.
+// Результат пишется в level+1
+type compactionTask struct {
+	generation uint64
+	level      int
+	inputs     []*sstable
+	overlap    []*sstable
+	// bottom - ниже level+1 данных нет, tombstones больше ничего не перекрывают и их можно выбросить
+	bottom bool
+}
+
+func (e *LSMEngine) startCompaction() {
+	e.wg.Add(1)
+
+	go func() {
+		defer e.wg.Done()
+
+		for {
+			select {
+			case <-e.closeCh:
+				return
+			case <-e.compactCh:
+				for {
+					compacted, err := e.compactOnce()
+					if err != nil {
+						e.logger.Error("lsm: compaction failed", zap.Error(err))
+						break
+					}
+
+					if !compacted {
+						break
+					}
+				}
+			}
+		}
+	}()
+}
+
+// scheduleCompaction - будит фоновую компакцию, не блокируясь
+func (e *LSMEngine) scheduleCompaction() {
+	select {
+	case e.compactCh <- struct{}{}:
+	default:
+	}
+}
+
+// compactOnce - выполняет одну компакцию, если она нужна. Таблицы читаются и пишутся без блокировки,
+// под блокировкой только подменяется набор таблиц
+func (e *LSMEngine) compactOnce() (bool, error) {
+	select {
+	case <-e.closeCh:
+		return false, nil
+	default:
+	}
+
+	e.mu.RLock()
+	task := e.pickCompaction()
+	e.mu.RUnlock()
+
+	if task == nil {
+		return false, nil
+	}
+
+	e.logger.Info(
+		"lsm: compaction start",
+		zap.Int("level", task.level),
+		zap.Int("inputs", len(task.inputs)),
+		zap.Int("overlap", len(task.overlap)),
+	)
+
+	outputs, err := e.runCompaction(task)
+	if err != nil {
+		return false, err
+	}
+
+	e.mu.Lock()
+	if task.generation != e.generation {
+		e.mu.Unlock()
+
+		// база очищена во время компакции, входных таблиц уже нет
+		for _, table := range outputs {
+			_ = table.close()
+			_ = removeFile(table.path)
+		}
+
+		return true, nil
+	}
+
+	obsolete := append(slices.Clone(task.inputs), task.overlap...)
+	e.levels[task.level] = removeTables(e.levels[task.level], task.inputs)
+	next := append(removeTables(e.levels[task.level+1], task.overlap), outputs...)
+	slices.SortFunc(next, func(a, b *sstable) int {
+		return strings.Compare(a.minKey, b.minKey)
+	})
+	e.levels[task.level+1] = next
+	err = e.saveManifestLocked()
+	e.mu.Unlock()
+
+	if err != nil {
+		return false, err
+	}
+
+	// читатели держат RLock на всё время чтения, поэтому после подмены старые таблицы никто не использует
+	for _, table := range obsolete {
+		if err := table.close(); err != nil {
+			e.logger.Warn("lsm: failed to close table", zap.String("path", table.path), zap.Error(err))
+		}
+
+		if err := removeFile(table.path); err != nil {
+			e.logger.Warn("lsm: failed to remove table", zap.String("path", table.path), zap.Error(err))
+		}
+	}
+
+	e.logger.Info("lsm: compaction end", zap.Int("level", task.level+1), zap.Int("outputs", len(outputs)))
+
+	return true, nil
+}
+
+// pickCompaction - выбирает компакцию. Вызывается под блокировкой
+func (e *LSMEngine) pickCompaction() *compactionTask {
+	var task *compactionTask
+
+	if len(e.levels[0]) >= e.cfg.L0CompactionTrigger {
+		// таблицы L0 пересекаются между собой, поэтому компактятся все сразу
+		inputs := slices.Clone(e.levels[0])
+		minKey, maxKey := keyRange(inputs)
+		task = &compactionTask{
+			level:   0,
+			inputs:  inputs,
+			overlap: overlapping(e.levels[1], minKey, maxKey),
+		}
+	} else {
+		maxBytes := int64(e.cfg.BaseLevelSize)
+		for level := 1; level < len(e.levels)-1; level++ {
+			if levelSize(e.levels[level]) > maxBytes {
+				input := e.pickLevelInput(level)
+				task = &compactionTask{
+					level:   level,
+					inputs:  []*sstable{input},
+					overlap: overlapping(e.levels[level+1], input.minKey, input.maxKey),
+				}
+				break
+			}
+
+			maxBytes *= int64(e.cfg.LevelSizeMultiplier)
+		}
+	}
+
+	if task == nil {
+		return nil
+	}
+
+	task.generation = e.generation
+	task.bottom = true
+	for level := task.level + 2; level < len(e.levels); level++ {
+		if len(e.levels[level]) > 0 {
+			task.bottom = false
+			break
+		}
+	}
+
+	return task
+}
+
+// pickLevelInput - выбирает таблицы уровня по кругу, чтобы компакция равномерно проходила по всему диапазону ключей
+func (e *LSMEngine) pickLevelInput(level int) *sstable {
+	tables := e.levels[level]
+	pointer := e.compactPointers[level]
+
+	input := tables[0]
+	for _, table := range tables {
+		if table.minKey > pointer {
+			input = table
+			break
+		}
+	}
+
+	e.compactPointers[level] = input.maxKey
+
+	return input
+}
+
+func (e *LSMEngine) runCompaction(task *compactionTask) ([]*sstable, error) {
+	// источники от новых к старым: в L0 более новые таблицы в конце списка
+	tables := make([]*sstable, 0, len(task.inputs)+len(task.overlap))
+	if task.level == 0 {
+		for i := len(task.inputs) - 1; i >= 0; i-- {
+			tables = append(tables, task.inputs[i])
+		}
+	} else {
+		tables = append(tables, task.inputs...)
+	}
+	tables = append(tables, task.overlap...)
+
+	sources := make([][]lsmEntry, 0, len(tables))
+	for _, table := range tables {
+		entries, err := table.entries()
+		if err != nil {
+			return nil, err
+		}
+
+		sources = append(sources, entries)
+	}
+
+	merged := mergeEntries(sources, false)
+
+	// истекшие значения становятся tombstones: выше нижнего уровня они перекрывают старые версии ключа,
+	// а в нижнем выбрасываются вместе с остальными tombstones
+	now := storage.NowMillis()
+	for i, entry := range merged {
+		if entry.tombstone {
+			continue
+		}
+
+		expireAt, err := storage.DecodeExpireAt(entry.value)
+		if err != nil {
+			return nil, err
+		}
+
+		if expireAt != 0 && expireAt <= now {
+			merged[i] = lsmEntry{key: entry.key, tombstone: true}
+		}
+	}
+
+	if task.bottom {
+		merged = slices.DeleteFunc(merged, func(entry lsmEntry) bool {
+			return entry.tombstone
+		})
+	}
+
+	outputs := make([]*sstable, 0)
+	for len(merged) > 0 {
+		n, size := 0, 0
+		for n < len(merged) && (n == 0 || size < int(e.cfg.TargetFileSize)) {
+			size += merged[n].size()
+			n++
+		}
+
+		table, err := e.writeTable(merged[:n])
+		if err != nil {
+			for _, output := range outputs {
+				_ = output.close()
+				_ = removeFile(output.path)
+			}
+
+			return nil, err
+		}
+
+		outputs = append(outputs, table)
+		merged = merged[n:]
+	}
+
+	return outputs, nil
+}
+
+// mergeEntries - слияние отсортированных источников. Источники упорядочены от новых к старым,
+// для одинаковых ключей остается запись из самого нового. reverse - источники отсортированы по убыванию
+func mergeEntries(sources [][]lsmEntry, reverse bool) []lsmEntry {
+	h := &mergeHeap{reverse: reverse}
+	for priority, entries := range sources {
+		if len(entries) > 0 {
+			h.cursors = append(h.cursors, &mergeCursor{entries: entries, priority: priority})
+		}
+	}
+	heap.Init(h)
+
+	merged := make([]lsmEntry, 0)
+	for h.Len() > 0 {
+		cursor := h.cursors[0]
+		entry := cursor.entries[cursor.pos]
+
+		if len(merged) == 0 || merged[len(merged)-1].key != entry.key {
+			merged = append(merged, entry)
+		}
+
+		cursor.pos++
+		if cursor.pos == len(cursor.entries) {
+			heap.Pop(h)
+		} else {
+			heap.Fix(h, 0)
+		}
+	}
+
+	return merged
+}
+
+type mergeCursor struct {
+	entries  []lsmEntry
+	pos      int
+	priority int
+}
+
+type mergeHeap struct {
+	cursors []*mergeCursor
+	reverse bool
+}
+
+func (h *mergeHeap) Len() int { return len(h.cursors) }
+
+func (h *mergeHeap) Less(i, j int) bool {
+	a, b := h.cursors[i].entries[h.cursors[i].pos].key, h.cursors[j].entries[h.cursors[j].pos].key
+	if a != b {
+		return (a < b) != h.reverse
+	}
+
+	return h.cursors[i].priority < h.cursors[j].priority
+}
+
+func (h *mergeHeap) Swap(i, j int) { h.cursors[i], h.cursors[j] = h.cursors[j], h.cursors[i] }
+
+func (h *mergeHeap) Push(x any) { h.cursors = append(h.cursors, x.(*mergeCursor)) }
+
+func (h *mergeHeap) Pop() any {
+	item := h.cursors[len(h.cursors)-1]
+	h.cursors = h.cursors[:len(h.cursors)-1]
+
+	return item
+}
+
+func removeTables(tables []*sstable, remove []*sstable) []*sstable {
+	return slices.DeleteFunc(slices.Clone(tables), func(table *sstable) bool {
+		return slices.Contains(remove, table)
+	})
+}
+
+func overlapping(tables []*sstable, minKey, maxKey string) []*sstable {
+	result := make([]*sstable, 0)
+	for _, table := range tables {
+		if table.overlaps(minKey, maxKey) {
+			result = append(result, table)
+		}
+	}
+
+	return result
+}
+
+func keyRange(tables []*sstable) (string, string) {
+	minKey, maxKey := tables[0].minKey, tables[0].maxKey
+	for _, table := range tables[1:] {
+		minKey = min(minKey, table.minKey)
+		maxKey = max(maxKey, table.maxKey)
+	}
+
+	return minKey, maxKey
+}
+
+func levelSize(tables []*sstable) int64 {
+	var size int64
+	for _, table := range tables {
+		size += table.size
+	}
+
+	return size
+}
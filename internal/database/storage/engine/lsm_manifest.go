@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+)
+
+const (
+	lsmManifestFilename = "MANIFEST"
+	sstableFilenameFmt  = "%06d.sst"
+)
+
+// lsmManifest - список таблиц по уровням. Только таблицы из манифеста считаются частью дерева,
+// остальные файлы в директории - мусор после прерванного сброса или компакции.
+// Checkpoint - число записей WAL, изменения которых уже есть в таблицах
+type lsmManifest struct {
+	NextFileID uint64     `json:"next_file_id"`
+	Levels     [][]uint64 `json:"levels"`
+	Checkpoint uint64     `json:"checkpoint,omitempty"`
+}
+
+func sstablePath(dir string, id uint64) string {
+	return path.Join(dir, fmt.Sprintf(sstableFilenameFmt, id))
+}
+
+func loadManifest(dir string) (lsmManifest, error) {
+	data, err := os.ReadFile(path.Join(dir, lsmManifestFilename))
+	if errors.Is(err, os.ErrNotExist) {
+		return lsmManifest{NextFileID: 1}, nil
+	}
+	if err != nil {
+		return lsmManifest{}, err
+	}
+
+	var manifest lsmManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return lsmManifest{}, fmt.Errorf("failed to parse lsm manifest: %w", err)
+	}
+
+	return manifest, nil
+}
+
+// saveManifest - атомарно заменяет манифест
+func saveManifest(dir string, manifest lsmManifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path.Join(dir, lsmManifestFilename), data)
+}
@@ -0,0 +1,68 @@
+package engine
+
+import "github.com/TimonKK/inmemory-db/internal/database/storage"
+
+// lsmEntryOverhead - примерный размер служебных данных записи, используется для оценки размеров
+const lsmEntryOverhead = 16
+
+// lsmEntry - запись LSM дерева. Удаление хранится как tombstone, чтобы перекрывать значения в нижних уровнях
+type lsmEntry struct {
+	key       string
+	value     string
+	tombstone bool
+}
+
+func (e lsmEntry) size() int {
+	return len(e.key) + len(e.value) + lsmEntryOverhead
+}
+
+// memtable - изменяемая часть LSM дерева, хранится в памяти до сброса в SSTable.
+// Сохранность данных до сброса обеспечивает WAL
+type memtable struct {
+	data *skiplist[lsmEntry]
+	size int
+}
+
+func newMemtable() *memtable {
+	return &memtable{
+		data: newSkiplist[lsmEntry](),
+	}
+}
+
+func (m *memtable) get(key string) (lsmEntry, bool) {
+	return m.data.get(key)
+}
+
+func (m *memtable) put(entry lsmEntry) {
+	if old, ok := m.data.set(entry.key, entry); ok {
+		m.size -= old.size()
+	}
+
+	m.size += entry.size()
+}
+
+func (m *memtable) len() int {
+	return m.data.len()
+}
+
+// sorted - записи, отсортированные по ключу, в том виде, в каком они попадут в SSTable
+func (m *memtable) sorted() []lsmEntry {
+	entries := make([]lsmEntry, 0, m.data.len())
+	m.data.scan(storage.IterOptions{}, func(_ string, entry lsmEntry) bool {
+		entries = append(entries, entry)
+		return true
+	})
+
+	return entries
+}
+
+// rangeEntries - до n записей диапазона в порядке обхода
+func (m *memtable) rangeEntries(opts storage.IterOptions, n int) []lsmEntry {
+	entries := make([]lsmEntry, 0)
+	m.data.scan(opts, func(_ string, entry lsmEntry) bool {
+		entries = append(entries, entry)
+		return len(entries) < n
+	})
+
+	return entries
+}
@@ -0,0 +1,447 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/TimonKK/inmemory-db/internal/database/storage"
+)
+
+// Формат SSTable:
+//
+//	[блок данных][crc32 блока] ... [индекс][фильтр Блума][футер]
+//
+// Запись в блоке: uvarint(len(key)) key kind uvarint(len(value)) value.
+// Индекс: uvarint(len(minKey)) minKey uvarint(blocks), затем для каждого блока
+// uvarint(len(lastKey)) lastKey uvarint(offset) uvarint(size).
+// Футер: indexOffset, indexSize, bloomOffset, bloomSize, magic - по 8 байт little endian.
+const (
+	sstableMagic      uint64 = 0x4c534d5353544142
+	sstableFooterSize        = 40
+	blockChecksumSize        = 4
+
+	entryKindValue     byte = 0
+	entryKindTombstone byte = 1
+)
+
+var (
+	ErrCorruptedTable = errors.New("sstable is corrupted")
+)
+
+// blockHandle - положение блока данных в файле. size включает контрольную сумму
+type blockHandle struct {
+	lastKey string
+	offset  uint64
+	size    uint64
+}
+
+// sstable - неизменяемая отсортированная таблица на диске. Индекс блоков и фильтр Блума держатся в памяти,
+// сами блоки читаются через ReadAt
+type sstable struct {
+	id     uint64
+	path   string
+	file   *os.File
+	size   int64
+	minKey string
+	maxKey string
+	index  []blockHandle
+	bloom  *bloomFilter
+}
+
+// writeSSTable - записывает отсортированные записи в новый файл и открывает его на чтение.
+// Файл пишется во временный и переименовывается, поэтому недописанная таблица никогда не видна под своим именем
+func writeSSTable(id uint64, path string, entries []lsmEntry, blockSize int, bitsPerKey int) (*sstable, error) {
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: empty table %s", ErrCorruptedTable, path)
+	}
+
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeSSTableData(file, entries, blockSize, bitsPerKey)
+	if err != nil {
+		_ = file.Close()
+		_ = os.Remove(tmpPath)
+		return nil, err
+	}
+
+	if err := file.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return nil, err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return nil, err
+	}
+
+	return openSSTable(id, path)
+}
+
+func writeSSTableData(file *os.File, entries []lsmEntry, blockSize int, bitsPerKey int) error {
+	w := bufio.NewWriter(file)
+	bloom := newBloomFilter(len(entries), bitsPerKey)
+	index := make([]blockHandle, 0)
+
+	var offset uint64
+	block := make([]byte, 0, blockSize)
+
+	flushBlock := func(lastKey string) error {
+		block = binary.LittleEndian.AppendUint32(block, crc32.ChecksumIEEE(block))
+		if _, err := w.Write(block); err != nil {
+			return err
+		}
+
+		index = append(index, blockHandle{lastKey: lastKey, offset: offset, size: uint64(len(block))})
+		offset += uint64(len(block))
+		block = block[:0]
+
+		return nil
+	}
+
+	for i, entry := range entries {
+		bloom.add(entry.key)
+		block = appendEntry(block, entry)
+
+		if len(block) >= blockSize || i == len(entries)-1 {
+			if err := flushBlock(entry.key); err != nil {
+				return err
+			}
+		}
+	}
+
+	indexData := binary.AppendUvarint(nil, uint64(len(entries[0].key)))
+	indexData = append(indexData, entries[0].key...)
+	indexData = binary.AppendUvarint(indexData, uint64(len(index)))
+	for _, h := range index {
+		indexData = binary.AppendUvarint(indexData, uint64(len(h.lastKey)))
+		indexData = append(indexData, h.lastKey...)
+		indexData = binary.AppendUvarint(indexData, h.offset)
+		indexData = binary.AppendUvarint(indexData, h.size)
+	}
+
+	bloomData := bloom.encode()
+
+	footer := make([]byte, 0, sstableFooterSize)
+	footer = binary.LittleEndian.AppendUint64(footer, offset)
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(len(indexData)))
+	footer = binary.LittleEndian.AppendUint64(footer, offset+uint64(len(indexData)))
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(len(bloomData)))
+	footer = binary.LittleEndian.AppendUint64(footer, sstableMagic)
+
+	for _, data := range [][]byte{indexData, bloomData, footer} {
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
+
+func openSSTable(id uint64, path string) (*sstable, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := readSSTableMeta(id, path, file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return table, nil
+}
+
+func readSSTableMeta(id uint64, path string, file *os.File) (*sstable, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Size() < sstableFooterSize {
+		return nil, fmt.Errorf("%w: %s too small", ErrCorruptedTable, path)
+	}
+
+	footer := make([]byte, sstableFooterSize)
+	if _, err := file.ReadAt(footer, info.Size()-sstableFooterSize); err != nil {
+		return nil, err
+	}
+
+	indexOffset := binary.LittleEndian.Uint64(footer[0:])
+	indexSize := binary.LittleEndian.Uint64(footer[8:])
+	bloomOffset := binary.LittleEndian.Uint64(footer[16:])
+	bloomSize := binary.LittleEndian.Uint64(footer[24:])
+	if binary.LittleEndian.Uint64(footer[32:]) != sstableMagic {
+		return nil, fmt.Errorf("%w: %s bad magic", ErrCorruptedTable, path)
+	}
+
+	if bloomOffset+bloomSize+sstableFooterSize != uint64(info.Size()) || indexOffset+indexSize != bloomOffset {
+		return nil, fmt.Errorf("%w: %s bad footer", ErrCorruptedTable, path)
+	}
+
+	meta := make([]byte, indexSize+bloomSize)
+	if _, err := file.ReadAt(meta, int64(indexOffset)); err != nil {
+		return nil, err
+	}
+
+	minKey, index, err := decodeIndex(meta[:indexSize])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrCorruptedTable, path, err)
+	}
+
+	if len(index) == 0 {
+		return nil, fmt.Errorf("%w: %s has no blocks", ErrCorruptedTable, path)
+	}
+
+	return &sstable{
+		id:     id,
+		path:   path,
+		file:   file,
+		size:   info.Size(),
+		minKey: minKey,
+		maxKey: index[len(index)-1].lastKey,
+		index:  index,
+		bloom:  decodeBloomFilter(meta[indexSize:]),
+	}, nil
+}
+
+// get - ищет ключ в таблице. Найденный tombstone тоже считается результатом
+func (t *sstable) get(key string) (lsmEntry, bool, error) {
+	if key < t.minKey || key > t.maxKey || !t.bloom.mayContain(key) {
+		return lsmEntry{}, false, nil
+	}
+
+	i := sort.Search(len(t.index), func(i int) bool {
+		return t.index[i].lastKey >= key
+	})
+	if i == len(t.index) {
+		return lsmEntry{}, false, nil
+	}
+
+	entries, err := t.readBlock(t.index[i])
+	if err != nil {
+		return lsmEntry{}, false, err
+	}
+
+	for _, entry := range entries {
+		if entry.key == key {
+			return entry, true, nil
+		}
+	}
+
+	return lsmEntry{}, false, nil
+}
+
+// entries - все записи таблицы по порядку
+func (t *sstable) entries() ([]lsmEntry, error) {
+	entries := make([]lsmEntry, 0)
+	for _, h := range t.index {
+		block, err := t.readBlock(h)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, block...)
+	}
+
+	return entries, nil
+}
+
+// rangeEntries - до n записей диапазона в порядке обхода, включая tombstones
+func (t *sstable) rangeEntries(opts storage.IterOptions, n int) ([]lsmEntry, error) {
+	entries := make([]lsmEntry, 0)
+	if t.maxKey < opts.Start || (opts.End != "" && t.minKey >= opts.End) {
+		return entries, nil
+	}
+
+	if !opts.Reverse {
+		i := sort.Search(len(t.index), func(i int) bool {
+			return t.index[i].lastKey >= opts.Start
+		})
+
+		for ; i < len(t.index); i++ {
+			block, err := t.readBlock(t.index[i])
+			if err != nil {
+				return nil, err
+			}
+
+			for _, entry := range block {
+				if opts.End != "" && entry.key >= opts.End {
+					return entries, nil
+				}
+
+				if entry.key >= opts.Start {
+					entries = append(entries, entry)
+					if len(entries) == n {
+						return entries, nil
+					}
+				}
+			}
+		}
+
+		return entries, nil
+	}
+
+	i := len(t.index) - 1
+	if opts.End != "" {
+		i = min(i, sort.Search(len(t.index), func(i int) bool {
+			return t.index[i].lastKey >= opts.End
+		}))
+	}
+
+	for ; i >= 0; i-- {
+		block, err := t.readBlock(t.index[i])
+		if err != nil {
+			return nil, err
+		}
+
+		for j := len(block) - 1; j >= 0; j-- {
+			entry := block[j]
+			if opts.End != "" && entry.key >= opts.End {
+				continue
+			}
+
+			if entry.key < opts.Start {
+				return entries, nil
+			}
+
+			entries = append(entries, entry)
+			if len(entries) == n {
+				return entries, nil
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+func (t *sstable) overlaps(minKey, maxKey string) bool {
+	return t.minKey <= maxKey && t.maxKey >= minKey
+}
+
+func (t *sstable) readBlock(h blockHandle) ([]lsmEntry, error) {
+	if h.size < blockChecksumSize {
+		return nil, fmt.Errorf("%w: %s block at %d", ErrCorruptedTable, t.path, h.offset)
+	}
+
+	data := make([]byte, h.size)
+	if _, err := t.file.ReadAt(data, int64(h.offset)); err != nil {
+		return nil, err
+	}
+
+	payload, checksum := data[:h.size-blockChecksumSize], data[h.size-blockChecksumSize:]
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(checksum) {
+		return nil, fmt.Errorf("%w: %s block at %d checksum mismatch", ErrCorruptedTable, t.path, h.offset)
+	}
+
+	return decodeEntries(payload)
+}
+
+func (t *sstable) close() error {
+	return t.file.Close()
+}
+
+func appendEntry(data []byte, entry lsmEntry) []byte {
+	kind := entryKindValue
+	if entry.tombstone {
+		kind = entryKindTombstone
+	}
+
+	data = binary.AppendUvarint(data, uint64(len(entry.key)))
+	data = append(data, entry.key...)
+	data = append(data, kind)
+	data = binary.AppendUvarint(data, uint64(len(entry.value)))
+
+	return append(data, entry.value...)
+}
+
+func decodeEntries(data []byte) ([]lsmEntry, error) {
+	entries := make([]lsmEntry, 0)
+
+	for len(data) > 0 {
+		key, rest, err := readUvarintBytes(data)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(rest) == 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		kind := rest[0]
+
+		value, rest, err := readUvarintBytes(rest[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, lsmEntry{
+			key:       string(key),
+			value:     string(value),
+			tombstone: kind == entryKindTombstone,
+		})
+		data = rest
+	}
+
+	return entries, nil
+}
+
+func decodeIndex(data []byte) (string, []blockHandle, error) {
+	minKey, data, err := readUvarintBytes(data)
+	if err != nil {
+		return "", nil, err
+	}
+
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return "", nil, io.ErrUnexpectedEOF
+	}
+	data = data[n:]
+
+	index := make([]blockHandle, 0, count)
+	for range count {
+		var lastKey []byte
+		lastKey, data, err = readUvarintBytes(data)
+		if err != nil {
+			return "", nil, err
+		}
+
+		offset, n := binary.Uvarint(data)
+		if n <= 0 {
+			return "", nil, io.ErrUnexpectedEOF
+		}
+		data = data[n:]
+
+		size, n := binary.Uvarint(data)
+		if n <= 0 {
+			return "", nil, io.ErrUnexpectedEOF
+		}
+		data = data[n:]
+
+		index = append(index, blockHandle{lastKey: string(lastKey), offset: offset, size: size})
+	}
+
+	return string(minKey), index, nil
+}
+
+// readUvarintBytes - читает байты, перед которыми записана их длина
+func readUvarintBytes(data []byte) ([]byte, []byte, error) {
+	size, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < size {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+
+	return data[n : n+int(size)], data[n+int(size):], nil
+}
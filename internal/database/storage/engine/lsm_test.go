@@ -0,0 +1,172 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/TimonKK/inmemory-db/internal/config"
+	"github.com/TimonKK/inmemory-db/internal/database/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestLSMEngine(t *testing.T, cfg config.LSMConfig) *LSMEngine {
+	t.Helper()
+
+	e, err := NewLSMEngine(cfg, zap.NewNop())
+	require.NoError(t, err)
+
+	return e
+}
+
+func TestLSMEngine_GetSetDelete(t *testing.T) {
+	e := newTestLSMEngine(t, config.LSMConfig{DataDirectory: t.TempDir()})
+	defer func() {
+		_ = e.Close()
+	}()
+
+	_, err := e.Get(ctx, "missing")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	require.NoError(t, e.Set(ctx, "key", "old"))
+	require.NoError(t, e.Set(ctx, "key", "new"))
+
+	value, err := e.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "new", value)
+
+	require.NoError(t, e.Delete(ctx, "key"))
+	_, err = e.Get(ctx, "key")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestLSMEngine_FlushAndReopen(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.LSMConfig{
+		DataDirectory:       dir,
+		MemtableSize:        256,
+		BlockSize:           64,
+		L0CompactionTrigger: 64,
+	}
+
+	e := newTestLSMEngine(t, cfg)
+	for i := range 100 {
+		require.NoError(t, e.Set(ctx, fmt.Sprintf("key%03d", i), fmt.Sprintf("value%d", i)))
+	}
+	require.NoError(t, e.Delete(ctx, "key050"))
+	require.NoError(t, e.Close())
+
+	e = newTestLSMEngine(t, cfg)
+	defer func() {
+		_ = e.Close()
+	}()
+
+	assert.NotEmpty(t, e.levels[0])
+
+	for i := range 100 {
+		value, err := e.Get(ctx, fmt.Sprintf("key%03d", i))
+		if i == 50 {
+			assert.ErrorIs(t, err, ErrKeyNotFound)
+			continue
+		}
+
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("value%d", i), value)
+	}
+}
+
+func TestLSMEngine_Compaction(t *testing.T) {
+	cfg := config.LSMConfig{
+		DataDirectory:       t.TempDir(),
+		MemtableSize:        512,
+		BlockSize:           128,
+		TargetFileSize:      1024,
+		L0CompactionTrigger: 2,
+		BaseLevelSize:       2048,
+		LevelSizeMultiplier: 2,
+		MaxLevels:           4,
+	}
+
+	e := newTestLSMEngine(t, cfg)
+	defer func() {
+		_ = e.Close()
+	}()
+
+	for round := range 5 {
+		for i := range 100 {
+			require.NoError(t, e.Set(ctx, fmt.Sprintf("key%03d", i), fmt.Sprintf("value%d_%d", i, round)))
+		}
+	}
+	for i := 0; i < 100; i += 2 {
+		require.NoError(t, e.Delete(ctx, fmt.Sprintf("key%03d", i)))
+	}
+
+	require.Eventually(t, func() bool {
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+
+		return len(e.levels[0]) < cfg.L0CompactionTrigger && len(e.levels[1])+len(e.levels[2])+len(e.levels[3]) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	for i := range 100 {
+		value, err := e.Get(ctx, fmt.Sprintf("key%03d", i))
+		if i%2 == 0 {
+			assert.ErrorIs(t, err, ErrKeyNotFound)
+			continue
+		}
+
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("value%d_4", i), value)
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	bloom := newBloomFilter(1000, 10)
+	for i := range 1000 {
+		bloom.add(fmt.Sprintf("key%d", i))
+	}
+
+	decoded := decodeBloomFilter(bloom.encode())
+
+	falsePositives := 0
+	for i := range 1000 {
+		assert.True(t, decoded.mayContain(fmt.Sprintf("key%d", i)))
+
+		if decoded.mayContain(fmt.Sprintf("other%d", i)) {
+			falsePositives++
+		}
+	}
+
+	assert.Less(t, falsePositives, 50)
+}
+
+func TestLSMEngine_Clear(t *testing.T) {
+	cfg := config.LSMConfig{DataDirectory: t.TempDir(), MemtableSize: 256}
+
+	// часть ключей уже в таблицах, часть в memtable
+	e := newTestLSMEngine(t, cfg)
+	for i := range 20 {
+		require.NoError(t, e.Set(ctx, fmt.Sprintf("key%d", i), "value"))
+	}
+
+	require.NoError(t, e.Update(ctx, func(tx storage.Tx) error {
+		return tx.Clear()
+	}))
+
+	size, err := e.Len(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, size)
+
+	require.NoError(t, e.Set(ctx, "after", "value"))
+	require.NoError(t, e.Close())
+
+	e = newTestLSMEngine(t, cfg)
+	defer func() {
+		_ = e.Close()
+	}()
+
+	keys := collectKeys(t, e, storage.IterOptions{})
+	assert.Equal(t, []string{"after"}, keys)
+}
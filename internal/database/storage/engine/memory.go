@@ -2,22 +2,23 @@ package engine
 
 import (
 	"context"
-	"errors"
 	"sync"
+
+	"github.com/TimonKK/inmemory-db/internal/database/storage"
 )
 
 var (
-	ErrKeyNotFound = errors.New("key not found")
+	ErrKeyNotFound = storage.ErrKeyNotFound
 )
 
 type MemoryEngine struct {
 	m    sync.RWMutex
-	data map[string]string
+	data *bucketMap[storage.Entry]
 }
 
 func NewMemoryEngine() *MemoryEngine {
 	return &MemoryEngine{
-		data: make(map[string]string),
+		data: newBucketMap[storage.Entry](),
 	}
 }
 
@@ -25,28 +26,92 @@ func (e *MemoryEngine) Get(_ context.Context, key string) (string, error) {
 	e.m.RLock()
 	defer e.m.RUnlock()
 
-	value, ok := e.data[key]
-	if ok {
-		return value, nil
-	}
-
-	return "", ErrKeyNotFound
+	return getValue(e, key)
 }
 
 func (e *MemoryEngine) Set(_ context.Context, key string, value string) error {
 	e.m.Lock()
 	defer e.m.Unlock()
 
-	e.data[key] = value
-
-	return nil
+	return e.setLocked(key, storage.NewEntry(value))
 }
 
 func (e *MemoryEngine) Delete(_ context.Context, key string) error {
 	e.m.Lock()
 	defer e.m.Unlock()
 
-	delete(e.data, key)
+	return e.deleteLocked(key)
+}
+
+func (e *MemoryEngine) Update(ctx context.Context, fn func(storage.Tx) error) error {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	return fn(newUpdateTx(ctx, e))
+}
+
+func (e *MemoryEngine) View(ctx context.Context, fn func(storage.Tx) error) error {
+	e.m.RLock()
+	defer e.m.RUnlock()
+
+	return fn(newViewTx(ctx, e))
+}
+
+// Iterate - ключи хранятся в map без порядка, обход по диапазону не поддерживается
+func (e *MemoryEngine) Iterate(_ context.Context, _ storage.IterOptions) (storage.Iterator, error) {
+	return nil, storage.ErrIterationUnsupported
+}
+
+func (e *MemoryEngine) Scan(_ context.Context, cursor string, count int) (string, []string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+
+	now := storage.NowMillis()
+
+	return e.data.scan(cursor, count, func(entry storage.Entry) bool {
+		return entry.Expired(now)
+	})
+}
+
+func (e *MemoryEngine) ScanExpired(_ context.Context, cursor string, count int, now int64) (string, []string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+
+	return e.data.sample(cursor, count, func(entry storage.Entry) bool {
+		return entry.Expired(now)
+	})
+}
+
+func (e *MemoryEngine) Len(_ context.Context) (int, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+
+	now := storage.NowMillis()
+
+	return e.data.count(func(entry storage.Entry) bool {
+		return !entry.Expired(now)
+	}), nil
+}
+
+func (e *MemoryEngine) getLocked(key string) (storage.Entry, bool, error) {
+	entry, ok := e.data.get(key)
+	return entry, ok, nil
+}
+
+func (e *MemoryEngine) setLocked(key string, entry storage.Entry) error {
+	e.data.set(key, entry)
+
+	return nil
+}
+
+func (e *MemoryEngine) deleteLocked(key string) error {
+	e.data.delete(key)
+
+	return nil
+}
+
+func (e *MemoryEngine) clearLocked() error {
+	e.data = newBucketMap[storage.Entry]()
 
 	return nil
 }
@@ -2,7 +2,7 @@ package engine
 
 import (
 	"context"
-	_ "github.com/TimonKK/inmemory-db/internal/database/storage"
+	"github.com/TimonKK/inmemory-db/internal/database/storage"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -108,3 +108,39 @@ func TestMemoryEngine_Delete(t *testing.T) {
 		assert.NoError(t, err) // Обычно удаление несуществующего ключа не считается ошибкой
 	})
 }
+
+func TestMemoryEngine_Tx(t *testing.T) {
+	engine := NewMemoryEngine()
+
+	err := engine.Update(ctx, func(tx storage.Tx) error {
+		if err := tx.Set("a", storage.NewEntry("1")); err != nil {
+			return err
+		}
+
+		if err := tx.Set("expired", storage.Entry{Value: "2", ExpireAt: tx.Now() - 1}); err != nil {
+			return err
+		}
+
+		entry, err := tx.Get("a")
+		assert.Equal(t, "1", entry.Value)
+
+		return err
+	})
+	assert.NoError(t, err)
+
+	_, err = engine.Get(ctx, "expired")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	_, keys, err := engine.Scan(ctx, "0", 100)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, keys)
+
+	err = engine.View(ctx, func(tx storage.Tx) error {
+		return tx.Delete("a")
+	})
+	assert.ErrorIs(t, err, storage.ErrReadOnlyTx)
+
+	value, err := engine.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", value)
+}
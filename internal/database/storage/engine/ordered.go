@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"context"
+	"sync"
+
+	"github.com/TimonKK/inmemory-db/internal/database/storage"
+)
+
+// OrderedEngine - движок в памяти на skiplist. В отличие от MemoryEngine хранит ключи упорядоченными
+// и поддерживает обход диапазонов в обе стороны
+type OrderedEngine struct {
+	m    sync.RWMutex
+	data *skiplist[storage.Entry]
+}
+
+func NewOrderedEngine() *OrderedEngine {
+	return &OrderedEngine{
+		data: newSkiplist[storage.Entry](),
+	}
+}
+
+func (e *OrderedEngine) Get(_ context.Context, key string) (string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+
+	return getValue(e, key)
+}
+
+func (e *OrderedEngine) Set(_ context.Context, key string, value string) error {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	return e.setLocked(key, storage.NewEntry(value))
+}
+
+func (e *OrderedEngine) Delete(_ context.Context, key string) error {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	return e.deleteLocked(key)
+}
+
+func (e *OrderedEngine) Update(ctx context.Context, fn func(storage.Tx) error) error {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	return fn(newUpdateTx(ctx, e))
+}
+
+func (e *OrderedEngine) View(ctx context.Context, fn func(storage.Tx) error) error {
+	e.m.RLock()
+	defer e.m.RUnlock()
+
+	return fn(newViewTx(ctx, e))
+}
+
+func (e *OrderedEngine) Iterate(_ context.Context, opts storage.IterOptions) (storage.Iterator, error) {
+	return newBatchIterator(opts, e.fetch), nil
+}
+
+func (e *OrderedEngine) Scan(ctx context.Context, cursor string, count int) (string, []string, error) {
+	return scanOrdered(ctx, e, cursor, count)
+}
+
+func (e *OrderedEngine) ScanExpired(_ context.Context, cursor string, count int, now int64) (string, []string, error) {
+	return sampleOrdered(cursor, count, func(opts storage.IterOptions, n int) ([]storage.KeyValue, string, bool, error) {
+		return e.fetchWhere(opts, n, func(entry storage.Entry) bool {
+			return entry.Expired(now)
+		})
+	})
+}
+
+// Len - число живых ключей, считается полным обходом
+func (e *OrderedEngine) Len(ctx context.Context) (int, error) {
+	return countOrdered(ctx, e)
+}
+
+func (e *OrderedEngine) fetch(opts storage.IterOptions, n int) ([]storage.KeyValue, string, bool, error) {
+	now := storage.NowMillis()
+
+	return e.fetchWhere(opts, n, func(entry storage.Entry) bool {
+		return !entry.Expired(now)
+	})
+}
+
+// fetchWhere - fetch, который отдает только записи, для которых match вернул true
+func (e *OrderedEngine) fetchWhere(opts storage.IterOptions, n int, match func(storage.Entry) bool) ([]storage.KeyValue, string, bool, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+
+	var (
+		last    string
+		scanned int
+	)
+
+	pairs := make([]storage.KeyValue, 0, n)
+	e.data.scan(opts, func(key string, entry storage.Entry) bool {
+		if match(entry) {
+			pairs = append(pairs, storage.KeyValue{Key: key, Value: entry.String()})
+		}
+
+		last = key
+		scanned++
+
+		return scanned < n
+	})
+
+	if scanned < n {
+		return pairs, "", false, nil
+	}
+
+	return pairs, last, true, nil
+}
+
+func (e *OrderedEngine) getLocked(key string) (storage.Entry, bool, error) {
+	entry, ok := e.data.get(key)
+	return entry, ok, nil
+}
+
+func (e *OrderedEngine) setLocked(key string, entry storage.Entry) error {
+	e.data.set(key, entry)
+
+	return nil
+}
+
+func (e *OrderedEngine) deleteLocked(key string) error {
+	e.data.delete(key)
+
+	return nil
+}
+
+func (e *OrderedEngine) clearLocked() error {
+	e.data = newSkiplist[storage.Entry]()
+
+	return nil
+}
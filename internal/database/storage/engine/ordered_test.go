@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/TimonKK/inmemory-db/internal/config"
+	"github.com/TimonKK/inmemory-db/internal/database/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func collectKeys(t *testing.T, e storage.Engine, opts storage.IterOptions) []string {
+	t.Helper()
+
+	it, err := e.Iterate(ctx, opts)
+	require.NoError(t, err)
+	defer func() {
+		_ = it.Close()
+	}()
+
+	keys := make([]string, 0)
+	for it.Next() {
+		keys = append(keys, it.Key())
+	}
+	require.NoError(t, it.Err())
+
+	return keys
+}
+
+func TestOrderedEngine_GetSetDelete(t *testing.T) {
+	e := NewOrderedEngine()
+
+	_, err := e.Get(ctx, "missing")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	require.NoError(t, e.Set(ctx, "key", "old"))
+	require.NoError(t, e.Set(ctx, "key", "new"))
+
+	value, err := e.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "new", value)
+
+	require.NoError(t, e.Delete(ctx, "key"))
+	_, err = e.Get(ctx, "key")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestOrderedEngine_Iterate(t *testing.T) {
+	e := NewOrderedEngine()
+	for _, key := range []string{"b", "a", "user/1/name", "user/1/age", "user/2/name", "c"} {
+		require.NoError(t, e.Set(ctx, key, "v"))
+	}
+	require.NoError(t, e.Delete(ctx, "c"))
+
+	tests := []struct {
+		name string
+		opts storage.IterOptions
+		want []string
+	}{
+		{
+			name: "all keys",
+			opts: storage.IterOptions{},
+			want: []string{"a", "b", "user/1/age", "user/1/name", "user/2/name"},
+		},
+		{
+			name: "all keys reverse",
+			opts: storage.IterOptions{Reverse: true},
+			want: []string{"user/2/name", "user/1/name", "user/1/age", "b", "a"},
+		},
+		{
+			name: "half-open range",
+			opts: storage.IterOptions{Start: "a", End: "user/1/name"},
+			want: []string{"a", "b", "user/1/age"},
+		},
+		{
+			name: "prefix reverse",
+			opts: storage.IterOptions{Start: "user/1/", End: storage.PrefixEnd("user/1/"), Reverse: true},
+			want: []string{"user/1/name", "user/1/age"},
+		},
+		{
+			name: "empty range",
+			opts: storage.IterOptions{Start: "x", End: "z"},
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, collectKeys(t, e, tt.opts))
+		})
+	}
+}
+
+func TestIterate_ManyBatches(t *testing.T) {
+	lsm := newTestLSMEngine(t, config.LSMConfig{DataDirectory: t.TempDir(), MemtableSize: 2048, BlockSize: 128})
+	defer func() {
+		_ = lsm.Close()
+	}()
+
+	engines := map[string]storage.Engine{
+		"ordered": NewOrderedEngine(),
+		"lsm":     lsm,
+	}
+
+	for name, e := range engines {
+		t.Run(name, func(t *testing.T) {
+			want := make([]string, 0)
+			for i := range 1000 {
+				key := fmt.Sprintf("key%04d", i)
+				require.NoError(t, e.Set(ctx, key, "v"))
+
+				if i%3 == 0 {
+					require.NoError(t, e.Delete(ctx, key))
+					continue
+				}
+				want = append(want, key)
+			}
+
+			assert.Equal(t, want, collectKeys(t, e, storage.IterOptions{}))
+
+			reversed := make([]string, 0, len(want))
+			for i := len(want) - 1; i >= 0; i-- {
+				reversed = append(reversed, want[i])
+			}
+			assert.Equal(t, reversed, collectKeys(t, e, storage.IterOptions{Reverse: true}))
+
+			assert.Equal(t, []string{"key0100", "key0101"}, collectKeys(t, e, storage.IterOptions{Start: "key0099", End: "key0102"}))
+		})
+	}
+}
+
+func TestIterate_Unsupported(t *testing.T) {
+	_, err := NewMemoryEngine().Iterate(ctx, storage.IterOptions{})
+	assert.ErrorIs(t, err, storage.ErrIterationUnsupported)
+}
@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/TimonKK/inmemory-db/internal/database/storage"
+)
+
+type iterable interface {
+	Iterate(context.Context, storage.IterOptions) (storage.Iterator, error)
+}
+
+// scanOrdered - SCAN для упорядоченных движков: курсор - hex последнего отданного ключа,
+// следующий вызов продолжает строго после него
+func scanOrdered(ctx context.Context, e iterable, cursor string, count int) (string, []string, error) {
+	opts, err := cursorOptions(cursor)
+	if err != nil {
+		return "", nil, err
+	}
+
+	it, err := e.Iterate(ctx, opts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	defer func() {
+		_ = it.Close()
+	}()
+
+	keys := make([]string, 0, count)
+	for len(keys) < count && it.Next() {
+		keys = append(keys, it.Key())
+	}
+
+	if err := it.Err(); err != nil {
+		return "", nil, err
+	}
+
+	if len(keys) < count {
+		return "0", keys, nil
+	}
+
+	return hex.EncodeToString([]byte(keys[len(keys)-1])), keys, nil
+}
+
+// sampleOrdered - ScanExpired для упорядоченных движков: fetch просматривает count ключей после курсора
+// и отдает подходящие из них. Курсор как у scanOrdered
+func sampleOrdered(cursor string, count int, fetch fetchFunc) (string, []string, error) {
+	opts, err := cursorOptions(cursor)
+	if err != nil {
+		return "", nil, err
+	}
+
+	pairs, last, more, err := fetch(opts, count)
+	if err != nil {
+		return "", nil, err
+	}
+
+	keys := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		keys = append(keys, pair.Key)
+	}
+
+	if !more || last == "" {
+		return "0", keys, nil
+	}
+
+	return hex.EncodeToString([]byte(last)), keys, nil
+}
+
+// cursorOptions - диапазон обхода, который продолжается строго после ключа из курсора
+func cursorOptions(cursor string) (storage.IterOptions, error) {
+	if cursor == "0" {
+		return storage.IterOptions{}, nil
+	}
+
+	last, err := hex.DecodeString(cursor)
+	if err != nil || len(last) == 0 {
+		return storage.IterOptions{}, fmt.Errorf("%w: %s", storage.ErrInvalidCursor, cursor)
+	}
+
+	return storage.IterOptions{Start: string(last) + "\x00"}, nil
+}
+
+// countOrdered - количество ключей полным обходом
+func countOrdered(ctx context.Context, e iterable) (int, error) {
+	it, err := e.Iterate(ctx, storage.IterOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		_ = it.Close()
+	}()
+
+	count := 0
+	for it.Next() {
+		count++
+	}
+
+	return count, it.Err()
+}
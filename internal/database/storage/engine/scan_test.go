@@ -0,0 +1,134 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/TimonKK/inmemory-db/internal/config"
+	"github.com/TimonKK/inmemory-db/internal/database/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestScan_FullPass(t *testing.T) {
+	lsm, err := NewLSMEngine(config.LSMConfig{DataDirectory: t.TempDir()}, zap.NewNop())
+	require.NoError(t, err)
+	defer func() {
+		_ = lsm.Close()
+	}()
+
+	engines := map[string]storage.Engine{
+		"memory":  NewMemoryEngine(),
+		"ordered": NewOrderedEngine(),
+		"lsm":     lsm,
+	}
+
+	for name, e := range engines {
+		t.Run(name, func(t *testing.T) {
+			const n = 500
+			for i := 0; i < n; i++ {
+				require.NoError(t, e.Set(ctx, fmt.Sprintf("key%03d", i), "v"))
+			}
+
+			size, err := e.Len(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, n, size)
+
+			seen := make(map[string]int)
+			cursor := "0"
+			for {
+				next, keys, err := e.Scan(ctx, cursor, 7)
+				require.NoError(t, err)
+
+				for _, key := range keys {
+					seen[key]++
+				}
+
+				if next == "0" {
+					break
+				}
+				cursor = next
+			}
+
+			assert.Len(t, seen, n)
+			for key, count := range seen {
+				assert.Equal(t, 1, count, key)
+			}
+
+			_, _, err = e.Scan(ctx, "not-a-cursor", 10)
+			assert.ErrorIs(t, err, storage.ErrInvalidCursor)
+		})
+	}
+}
+
+func TestScanExpired(t *testing.T) {
+	lsm, err := NewLSMEngine(config.LSMConfig{DataDirectory: t.TempDir()}, zap.NewNop())
+	require.NoError(t, err)
+	defer func() {
+		_ = lsm.Close()
+	}()
+
+	bitcask := newTestBitcaskEngine(t, config.BitcaskConfig{DataDirectory: t.TempDir()})
+	defer func() {
+		_ = bitcask.Close()
+	}()
+
+	engines := map[string]storage.Engine{
+		"memory":  NewMemoryEngine(),
+		"ordered": NewOrderedEngine(),
+		"lsm":     lsm,
+		"bitcask": bitcask,
+	}
+
+	for name, e := range engines {
+		t.Run(name, func(t *testing.T) {
+			const n = 300
+			expired := make([]string, 0, n/3)
+			require.NoError(t, e.Update(ctx, func(tx storage.Tx) error {
+				for i := 0; i < n; i++ {
+					key, entry := fmt.Sprintf("key%03d", i), storage.NewEntry("v")
+					if i%3 == 0 {
+						entry.ExpireAt = tx.Now() - 1
+						expired = append(expired, key)
+					}
+
+					if err := tx.Set(key, entry); err != nil {
+						return err
+					}
+				}
+
+				return nil
+			}))
+
+			size, err := e.Len(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, n-len(expired), size)
+
+			var (
+				found []string
+				calls int
+			)
+			cursor := "0"
+			for {
+				next, keys, err := e.ScanExpired(ctx, cursor, 10, storage.NowMillis())
+				require.NoError(t, err)
+
+				found = append(found, keys...)
+				calls++
+
+				if next == "0" {
+					break
+				}
+				cursor = next
+			}
+
+			assert.ElementsMatch(t, expired, found)
+			// каждый вызов просматривает порцию, а не всю базу
+			assert.Greater(t, calls, 1)
+
+			_, _, err = e.ScanExpired(ctx, "not-a-cursor", 10, storage.NowMillis())
+			assert.ErrorIs(t, err, storage.ErrInvalidCursor)
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package engine
+
+import (
+	"math/rand"
+
+	"github.com/TimonKK/inmemory-db/internal/database/storage"
+)
+
+const (
+	skiplistMaxLevel    = 24
+	skiplistProbability = 0.25
+)
+
+type skiplistNode[V any] struct {
+	key   string
+	value V
+	next  []*skiplistNode[V]
+	prev  *skiplistNode[V]
+}
+
+// skiplist - упорядоченный по ключу список с пропусками. Нижний уровень двусвязный для обратного обхода.
+// Не потокобезопасен, синхронизация на стороне владельца
+type skiplist[V any] struct {
+	head   *skiplistNode[V]
+	tail   *skiplistNode[V]
+	level  int
+	length int
+	rnd    *rand.Rand
+}
+
+func newSkiplist[V any]() *skiplist[V] {
+	return &skiplist[V]{
+		head:  &skiplistNode[V]{next: make([]*skiplistNode[V], skiplistMaxLevel)},
+		level: 1,
+		rnd:   rand.New(rand.NewSource(rand.Int63())),
+	}
+}
+
+func (s *skiplist[V]) len() int {
+	return s.length
+}
+
+func (s *skiplist[V]) get(key string) (V, bool) {
+	node := s.seekGE(key)
+	if node != nil && node.key == key {
+		return node.value, true
+	}
+
+	var zero V
+	return zero, false
+}
+
+// set - вставляет или заменяет значение. Возвращает старое значение, если ключ был
+func (s *skiplist[V]) set(key string, value V) (V, bool) {
+	update := s.findPredecessors(key)
+
+	if node := update[0].next[0]; node != nil && node.key == key {
+		old := node.value
+		node.value = value
+		return old, true
+	}
+
+	level := s.randomLevel()
+	if level > s.level {
+		for i := s.level; i < level; i++ {
+			update[i] = s.head
+		}
+		s.level = level
+	}
+
+	node := &skiplistNode[V]{key: key, value: value, next: make([]*skiplistNode[V], level)}
+	for i := 0; i < level; i++ {
+		node.next[i] = update[i].next[i]
+		update[i].next[i] = node
+	}
+
+	if update[0] != s.head {
+		node.prev = update[0]
+	}
+	if node.next[0] != nil {
+		node.next[0].prev = node
+	} else {
+		s.tail = node
+	}
+
+	s.length++
+
+	var zero V
+	return zero, false
+}
+
+func (s *skiplist[V]) delete(key string) (V, bool) {
+	update := s.findPredecessors(key)
+
+	node := update[0].next[0]
+	if node == nil || node.key != key {
+		var zero V
+		return zero, false
+	}
+
+	for i := 0; i < s.level; i++ {
+		if update[i].next[i] != node {
+			break
+		}
+		update[i].next[i] = node.next[i]
+	}
+
+	if node.next[0] != nil {
+		node.next[0].prev = node.prev
+	} else {
+		s.tail = node.prev
+	}
+
+	for s.level > 1 && s.head.next[s.level-1] == nil {
+		s.level--
+	}
+
+	s.length--
+
+	return node.value, true
+}
+
+// seekGE - первый узел с ключом >= key
+func (s *skiplist[V]) seekGE(key string) *skiplistNode[V] {
+	return s.findPredecessors(key)[0].next[0]
+}
+
+// seekLT - последний узел с ключом < key
+func (s *skiplist[V]) seekLT(key string) *skiplistNode[V] {
+	prev := s.findPredecessors(key)[0]
+	if prev == s.head {
+		return nil
+	}
+
+	return prev
+}
+
+// scan - обходит узлы диапазона opts в порядке обхода, пока fn возвращает true
+func (s *skiplist[V]) scan(opts storage.IterOptions, fn func(key string, value V) bool) {
+	if !opts.Reverse {
+		for node := s.seekGE(opts.Start); node != nil && (opts.End == "" || node.key < opts.End); node = node.next[0] {
+			if !fn(node.key, node.value) {
+				return
+			}
+		}
+
+		return
+	}
+
+	node := s.tail
+	if opts.End != "" {
+		node = s.seekLT(opts.End)
+	}
+
+	for ; node != nil && node.key >= opts.Start; node = node.prev {
+		if !fn(node.key, node.value) {
+			return
+		}
+	}
+}
+
+func (s *skiplist[V]) findPredecessors(key string) []*skiplistNode[V] {
+	update := make([]*skiplistNode[V], skiplistMaxLevel)
+
+	node := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && node.next[i].key < key {
+			node = node.next[i]
+		}
+		update[i] = node
+	}
+
+	return update
+}
+
+func (s *skiplist[V]) randomLevel() int {
+	level := 1
+	for level < skiplistMaxLevel && s.rnd.Float64() < skiplistProbability {
+		level++
+	}
+
+	return level
+}
@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"context"
+
+	"github.com/TimonKK/inmemory-db/internal/database/storage"
+)
+
+// lockedOps - операции движка, которые вызываются под уже взятой блокировкой.
+// getLocked возвращает запись как есть, в том числе истекшую
+type lockedOps interface {
+	getLocked(key string) (storage.Entry, bool, error)
+	setLocked(key string, entry storage.Entry) error
+	deleteLocked(key string) error
+	clearLocked() error
+}
+
+// checkpointOps - движки с данными на диске, которые запоминают номер последней примененной записи WAL
+type checkpointOps interface {
+	setCheckpointLocked(seq uint64) error
+}
+
+// engineTx - транзакция поверх lockedOps. Блокировку берет и отпускает движок в Update/View.
+// Изменения, сделанные до ошибки, не откатываются
+type engineTx struct {
+	ops      lockedOps
+	readOnly bool
+	now      int64
+	// onExpire - вызывается для истекших ключей, которые нашел Get
+	onExpire func(key string)
+}
+
+var (
+	_ storage.Tx           = (*engineTx)(nil)
+	_ storage.CheckpointTx = (*engineTx)(nil)
+)
+
+func newTx(ops lockedOps, readOnly bool, now int64) *engineTx {
+	return &engineTx{ops: ops, readOnly: readOnly, now: now}
+}
+
+// newUpdateTx - транзакция для Update: время и обработчик истекших ключей берутся из контекста
+func newUpdateTx(ctx context.Context, ops lockedOps) *engineTx {
+	tx := newTx(ops, false, storage.TxTime(ctx))
+	tx.onExpire = storage.ExpireHook(ctx)
+
+	return tx
+}
+
+// newViewTx - транзакция для View: время и обработчик истекших ключей берутся из контекста
+func newViewTx(ctx context.Context, ops lockedOps) *engineTx {
+	tx := newTx(ops, true, storage.TxTime(ctx))
+	tx.onExpire = storage.ExpireHook(ctx)
+
+	return tx
+}
+
+// Get - истекшая запись в транзакции на запись сразу удаляется, в транзакции на чтение просто не видна.
+// В обоих случаях о ней сообщается onExpire
+func (tx *engineTx) Get(key string) (storage.Entry, error) {
+	entry, ok, err := tx.ops.getLocked(key)
+	if err != nil {
+		return storage.Entry{}, err
+	}
+
+	if !ok {
+		return storage.Entry{}, ErrKeyNotFound
+	}
+
+	if entry.Expired(tx.now) {
+		if !tx.readOnly {
+			if err := tx.ops.deleteLocked(key); err != nil {
+				return storage.Entry{}, err
+			}
+		}
+
+		if tx.onExpire != nil {
+			tx.onExpire(key)
+		}
+
+		return storage.Entry{}, ErrKeyNotFound
+	}
+
+	return entry, nil
+}
+
+func (tx *engineTx) Set(key string, entry storage.Entry) error {
+	if tx.readOnly {
+		return storage.ErrReadOnlyTx
+	}
+
+	return tx.ops.setLocked(key, entry)
+}
+
+func (tx *engineTx) Delete(key string) error {
+	if tx.readOnly {
+		return storage.ErrReadOnlyTx
+	}
+
+	return tx.ops.deleteLocked(key)
+}
+
+func (tx *engineTx) Clear() error {
+	if tx.readOnly {
+		return storage.ErrReadOnlyTx
+	}
+
+	return tx.ops.clearLocked()
+}
+
+func (tx *engineTx) Now() int64 {
+	return tx.now
+}
+
+// SetCheckpoint - движки без данных на диске номер не хранят
+func (tx *engineTx) SetCheckpoint(seq uint64) error {
+	if tx.readOnly {
+		return storage.ErrReadOnlyTx
+	}
+
+	if ops, ok := tx.ops.(checkpointOps); ok {
+		return ops.setCheckpointLocked(seq)
+	}
+
+	return nil
+}
+
+// getValue - значение живой записи для Engine.Get. Вызывается под блокировкой
+func getValue(ops lockedOps, key string) (string, error) {
+	entry, err := newTx(ops, true, storage.NowMillis()).Get(key)
+	if err != nil {
+		return "", err
+	}
+
+	return entry.Value, nil
+}
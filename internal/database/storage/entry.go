@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// ValueType - тип значения ключа
+type ValueType byte
+
+const (
+	TypeString ValueType = iota
+	TypeList
+	TypeHash
+	TypeSet
+	TypeSortedSet
+	TypeStream
+)
+
+func (t ValueType) String() string {
+	switch t {
+	case TypeString:
+		return "string"
+	case TypeList:
+		return "list"
+	case TypeHash:
+		return "hash"
+	case TypeSet:
+		return "set"
+	case TypeSortedSet:
+		return "zset"
+	case TypeStream:
+		return "stream"
+	default:
+		return "unknown"
+	}
+}
+
+// Collection - значение составного типа. Команды меняют его на месте и затем записывают через Tx.Set,
+// поэтому движки в памяти хранят тот же объект, а персистентные кодируют его заново
+type Collection interface {
+	Type() ValueType
+	Clone() Collection
+}
+
+// Entry - значение ключа вместе с метаданными. У строки заполнено Value, у составного типа - Data
+type Entry struct {
+	Value string
+	Data  Collection
+	// ExpireAt - момент истечения в unix ms, 0 - бессрочно
+	ExpireAt int64
+}
+
+func NewEntry(value string) Entry {
+	return Entry{Value: value}
+}
+
+// NewCollectionEntry - запись составного типа без срока жизни
+func NewCollectionEntry(data Collection) Entry {
+	return Entry{Data: data}
+}
+
+func (e Entry) Type() ValueType {
+	if e.Data == nil {
+		return TypeString
+	}
+
+	return e.Data.Type()
+}
+
+// Clone - копия записи, не разделяющая составное значение с исходной
+func (e Entry) Clone() Entry {
+	if e.Data != nil {
+		e.Data = e.Data.Clone()
+	}
+
+	return e
+}
+
+// String - значение для вывода при обходе: строка как есть, для составных типов - имя типа
+func (e Entry) String() string {
+	if e.Data == nil {
+		return e.Value
+	}
+
+	return "(" + e.Type().String() + ")"
+}
+
+// Expired - истек ли срок жизни к моменту now (unix ms)
+func (e Entry) Expired(now int64) bool {
+	return e.ExpireAt != 0 && e.ExpireAt <= now
+}
+
+// NowMillis - текущее время в unix ms, в этих единицах хранятся сроки жизни
+func NowMillis() int64 {
+	return time.Now().UnixMilli()
+}
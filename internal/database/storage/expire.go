@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+	"go.uber.org/zap"
+)
+
+const (
+	// expireCycleInterval - как часто запускается активное удаление истекших ключей
+	expireCycleInterval = 100 * time.Millisecond
+	// expireSampleSize - сколько ключей просматривает один шаг удаления
+	expireSampleSize = 20
+	// expireCycleBudget - сколько может длиться один запуск, если истекших ключей много
+	expireCycleBudget = 25 * time.Millisecond
+)
+
+// startExpire - запускает активное удаление истекших ключей. Без него ключ, который больше не читают
+// и не пишут, оставался бы в движке и на диске навсегда
+func (s *Storage) startExpire(ctx context.Context) {
+	ctx, s.stopExpire = context.WithCancel(ctx)
+	s.expireDone = make(chan struct{})
+	s.expireCursor = "0"
+
+	go func() {
+		defer close(s.expireDone)
+
+		ticker := time.NewTicker(expireCycleInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.expireCycle(ctx); err != nil && !errors.Is(err, context.Canceled) {
+					s.logger.Warn("failed to delete expired keys", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// expireCycle - один запуск удаления, как в Redis: шаг просматривает expireSampleSize ключей подряд с места,
+// где закончил предыдущий, и удаляет истекшие. Пока истекших больше четверти, шаги повторяются,
+// но не дольше expireCycleBudget
+func (s *Storage) expireCycle(ctx context.Context) error {
+	deadline := time.Now().Add(expireCycleBudget)
+
+	for ctx.Err() == nil {
+		next, keys, err := s.engine.ScanExpired(ctx, s.expireCursor, expireSampleSize, NowMillis())
+		if err != nil {
+			s.expireCursor = "0"
+			return err
+		}
+		s.expireCursor = next
+
+		if len(keys) > 0 {
+			if err := s.deleteExpired(ctx, keys); err != nil {
+				return err
+			}
+		}
+
+		if len(keys)*4 <= expireSampleSize || time.Now().After(deadline) {
+			return nil
+		}
+	}
+
+	return ctx.Err()
+}
+
+// deleteExpired - удаляет ключи, которые все еще истекшие. Удаление делает чтение в транзакции на запись,
+// update пишет его в WAL как DEL
+func (s *Storage) deleteExpired(ctx context.Context, keys []string) error {
+	return s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		for _, key := range keys {
+			if _, err := tx.Get(key); err != nil && !errors.Is(err, ErrKeyNotFound) {
+				return nil, err
+			}
+		}
+
+		return nil, nil
+	})
+}
+
+// Close - останавливает активное удаление истекших ключей и ждет текущий запуск. Вызывается до закрытия WAL
+func (s *Storage) Close() {
+	if s.stopExpire == nil {
+		return
+	}
+
+	s.stopExpire()
+	<-s.expireDone
+}
@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+)
+
+var ErrInvalidImport = errors.New("invalid imported value")
+
+// exportScanCount - размер порции, которой Export обходит движок
+const exportScanCount = 1000
+
+// KeyEntry - ключ вместе со значением, единица выгрузки и загрузки
+type KeyEntry struct {
+	Key   string
+	Entry Entry
+}
+
+// Export - вызывает fn для каждого ключа. Ключи читаются порциями, как в SCAN, поэтому выгрузка не является
+// снимком на один момент: ключи, измененные во время обхода, попадут в нее в любом из состояний.
+// fn вызывается вне блокировки движка и получает копию значения
+func (s *Storage) Export(ctx context.Context, fn func(KeyEntry) error) error {
+	cursor := "0"
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		next, keys, err := s.engine.Scan(ctx, cursor, exportScanCount)
+		if err != nil {
+			return err
+		}
+
+		entries := make([]KeyEntry, 0, len(keys))
+		err = s.view(ctx, func(tx Tx) error {
+			for _, key := range keys {
+				entry, err := tx.Get(key)
+				if errors.Is(err, ErrKeyNotFound) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+
+				entries = append(entries, KeyEntry{Key: key, Entry: entry.Clone()})
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+
+		if next == "0" {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// Import - записывает ключи одной транзакцией: в WAL они попадают одной пачкой, ответ - после ее записи.
+// Без replace существующие ключи не меняются. Возвращает число записанных ключей.
+// В WAL пишутся обычные команды (SET, RPUSH, HSET, SADD, ZADD, XADD, XGROUP и сроки жизни), поэтому
+// у потоков переносятся записи и группы с последним выданным id, но не PEL и потребители
+func (s *Storage) Import(ctx context.Context, entries []KeyEntry, replace bool) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	imported := 0
+	var applyErr error
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		// значения проверяются до изменений: изменения, сделанные до ошибки, не откатываются
+		keyRecords := make([][]compute.Query, len(entries))
+		for i, e := range entries {
+			var err error
+			if keyRecords[i], err = ImportRecords(e.Key, e.Entry, tx.Now()); err != nil {
+				return nil, err
+			}
+		}
+
+		records := make([]compute.Query, 0, len(entries))
+		for i, e := range entries {
+			if len(keyRecords[i]) == 0 {
+				continue
+			}
+
+			_, err := tx.Get(e.Key)
+			exists := err == nil
+			if err != nil && !errors.Is(err, ErrKeyNotFound) {
+				applyErr = err
+				return records, nil
+			}
+
+			if exists {
+				if !replace {
+					continue
+				}
+
+				keyRecords[i] = append([]compute.Query{compute.NewQuery(compute.DeleteCommandId, []string{e.Key})}, keyRecords[i]...)
+			}
+
+			// примененные записи попадают в WAL и при ошибке на следующих ключах
+			for _, record := range keyRecords[i] {
+				if err := applyRecord(tx, record); err != nil {
+					applyErr = fmt.Errorf("%s: %w", e.Key, err)
+					return records, nil
+				}
+
+				records = append(records, record)
+			}
+
+			imported++
+		}
+
+		return records, nil
+	})
+
+	return imported, errors.Join(err, applyErr)
+}
+
+// ImportRecords - записи WAL, которые создают ключ с таким значением. Пустое значение и уже истекший ключ
+// записей не дают. Строки проверяются как аргументы команд: иначе запись WAL нельзя будет прочитать
+func ImportRecords(key string, entry Entry, now int64) ([]compute.Query, error) {
+	if entry.Expired(now) {
+		return nil, nil
+	}
+
+	var records []compute.Query
+	args := []string{key}
+
+	switch value := entry.Data.(type) {
+	case nil:
+		records = append(records, setRecord(key, entry.Value, entry.ExpireAt))
+		args = append(args, entry.Value)
+	case *List:
+		if value.Len() == 0 {
+			return nil, nil
+		}
+
+		push := append([]string{key}, value.Values()...)
+		records = append(records, compute.NewQuery(compute.RPushCommandId, push))
+		args = append(args, push[1:]...)
+	case *Hash:
+		fields := value.Fields(now)
+		if len(fields) == 0 {
+			return nil, nil
+		}
+
+		hset := []string{key}
+		expires := make(map[int64][]string)
+		for _, field := range fields {
+			hset = append(hset, field.Name, field.Value)
+			if field.ExpireAt != 0 {
+				expires[field.ExpireAt] = append(expires[field.ExpireAt], field.Name)
+			}
+		}
+		records = append(records, compute.NewQuery(compute.HSetCommandId, hset))
+		args = append(args, hset[1:]...)
+
+		for _, expireAt := range slices.Sorted(maps.Keys(expires)) {
+			hexpire := append([]string{key, strconv.FormatInt(expireAt, 10)}, expires[expireAt]...)
+			records = append(records, compute.NewQuery(compute.HPExpireAtCommandId, hexpire))
+		}
+	case *Set:
+		if value.Len() == 0 {
+			return nil, nil
+		}
+
+		sadd := append([]string{key}, value.Members()...)
+		records = append(records, compute.NewQuery(compute.SAddCommandId, sadd))
+		args = append(args, sadd[1:]...)
+	case *SortedSet:
+		if value.Len() == 0 {
+			return nil, nil
+		}
+
+		zadd := []string{key}
+		for _, m := range value.Members() {
+			zadd = append(zadd, compute.FormatScore(m.Score), m.Member)
+			args = append(args, m.Member)
+		}
+		records = append(records, compute.NewQuery(compute.ZAddCommandId, zadd))
+	case *Stream:
+		for _, e := range value.Entries() {
+			if e.Fields == nil {
+				continue
+			}
+
+			xadd := []string{key, e.ID.String()}
+			for _, field := range e.Fields {
+				xadd = append(xadd, field.Key, field.Value)
+				args = append(args, field.Key, field.Value)
+			}
+			records = append(records, compute.NewQuery(compute.XAddCommandId, xadd))
+		}
+
+		for _, g := range value.Groups() {
+			records = append(records, compute.NewQuery(compute.XGroupCommandId,
+				[]string{compute.CreateOption, key, g.Name, g.LastID.String(), compute.MkStreamOption}))
+			args = append(args, g.Name)
+		}
+
+		if len(records) == 0 {
+			return nil, nil
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s has unsupported type", ErrInvalidImport, key)
+	}
+
+	for _, arg := range args {
+		if !compute.ValidArg(arg) {
+			return nil, fmt.Errorf("%w: %s: %w %q", ErrInvalidImport, key, compute.ErrInvalidQueryArg, arg)
+		}
+	}
+
+	if entry.ExpireAt != 0 && entry.Data != nil {
+		records = append(records, compute.NewQuery(compute.PExpireAtCommandId,
+			[]string{key, strconv.FormatInt(entry.ExpireAt, 10)}))
+	}
+
+	return records, nil
+}
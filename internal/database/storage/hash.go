@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// HashField - поле хеша. ExpireAt - срок жизни поля в unix ms, 0 - бессрочно
+type HashField struct {
+	Name     string
+	Value    string
+	ExpireAt int64
+}
+
+func (f HashField) Expired(now int64) bool {
+	return f.ExpireAt != 0 && f.ExpireAt <= now
+}
+
+// Hash - набор полей со значениями. Истекшие поля не видны при чтении и удаляются при следующей записи в хеш
+type Hash struct {
+	fields map[string]HashField
+}
+
+var _ Collection = (*Hash)(nil)
+
+func NewHash(fields ...HashField) *Hash {
+	h := &Hash{fields: make(map[string]HashField, len(fields))}
+	for _, field := range fields {
+		h.fields[field.Name] = field
+	}
+
+	return h
+}
+
+func (h *Hash) Type() ValueType {
+	return TypeHash
+}
+
+func (h *Hash) Clone() Collection {
+	return &Hash{fields: maps.Clone(h.fields)}
+}
+
+// Len - число живых полей на момент now
+func (h *Hash) Len(now int64) int {
+	n := 0
+	for _, field := range h.fields {
+		if !field.Expired(now) {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (h *Hash) Get(name string, now int64) (HashField, bool) {
+	field, ok := h.fields[name]
+	if !ok || field.Expired(now) {
+		return HashField{}, false
+	}
+
+	return field, true
+}
+
+// Set - записывает значение и снимает срок жизни поля. Возвращает, было ли поле новым
+func (h *Hash) Set(name, value string) bool {
+	_, exists := h.fields[name]
+	h.fields[name] = HashField{Name: name, Value: value}
+
+	return !exists
+}
+
+// Update - записывает значение, сохраняя срок жизни поля
+func (h *Hash) Update(name, value string) {
+	field := h.fields[name]
+	field.Name, field.Value = name, value
+	h.fields[name] = field
+}
+
+func (h *Hash) Delete(name string) bool {
+	_, exists := h.fields[name]
+	delete(h.fields, name)
+
+	return exists
+}
+
+// Expire - ставит срок жизни полю. false, если поля нет
+func (h *Hash) Expire(name string, expireAt int64) bool {
+	field, ok := h.fields[name]
+	if !ok {
+		return false
+	}
+
+	field.ExpireAt = expireAt
+	h.fields[name] = field
+
+	return true
+}
+
+// Purge - удаляет поля, истекшие к моменту now
+func (h *Hash) Purge(now int64) {
+	maps.DeleteFunc(h.fields, func(_ string, field HashField) bool {
+		return field.Expired(now)
+	})
+}
+
+// Fields - живые на момент now поля, упорядоченные по имени. now=0 - все поля, включая истекшие
+func (h *Hash) Fields(now int64) []HashField {
+	fields := make([]HashField, 0, len(h.fields))
+	for _, field := range h.fields {
+		if now == 0 || !field.Expired(now) {
+			fields = append(fields, field)
+		}
+	}
+
+	slices.SortFunc(fields, func(a, b HashField) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return fields
+}
@@ -0,0 +1,381 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+	"github.com/TimonKK/inmemory-db/internal/utils"
+)
+
+var (
+	ErrNotInteger      = errors.New("value is not an integer or out of range")
+	ErrIntegerOverflow = errors.New("increment or decrement would overflow")
+)
+
+// HSet - HSET key field value [field value ...], создает хеш при необходимости.
+// Возвращает число новых полей. Запись поля снимает его срок жизни
+func (s *Storage) HSet(ctx context.Context, query compute.Query) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var created int64
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		var err error
+		if created, err = applyHashRecord(tx, query); err != nil {
+			return nil, err
+		}
+
+		return []compute.Query{query}, nil
+	})
+
+	return int(created), err
+}
+
+// HGet - значение поля, ErrKeyNotFound если нет ключа или поля
+func (s *Storage) HGet(ctx context.Context, query compute.Query) (string, error) {
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	var value string
+	err := s.view(ctx, func(tx Tx) error {
+		hash, err := getHash(tx, query.Key())
+		if err != nil {
+			return err
+		}
+
+		field, ok := hash.Get(query.Value(), tx.Now())
+		if !ok {
+			return ErrKeyNotFound
+		}
+		value = field.Value
+
+		return nil
+	})
+
+	return value, err
+}
+
+// HDel - удаляет поля и возвращает, сколько из них было. В WAL пишутся только существовавшие поля
+func (s *Storage) HDel(ctx context.Context, query compute.Query) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var deleted int64
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		hash, err := getHash(tx, query.Key())
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		args := []string{query.Key()}
+		for _, name := range query.Args()[1:] {
+			if _, ok := hash.Get(name, tx.Now()); ok {
+				args = append(args, name)
+			}
+		}
+
+		if len(args) == 1 {
+			return nil, nil
+		}
+
+		record := compute.NewQuery(compute.HDelCommandId, args)
+		if deleted, err = applyHashRecord(tx, record); err != nil {
+			return nil, err
+		}
+
+		return []compute.Query{record}, nil
+	})
+
+	return int(deleted), err
+}
+
+// HGetAll - все живые поля по порядку имен
+func (s *Storage) HGetAll(ctx context.Context, query compute.Query) ([]KeyValue, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	var pairs []KeyValue
+	err := s.view(ctx, func(tx Tx) error {
+		hash, err := getHash(tx, query.Key())
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		pairs = hashPairs(hash.Fields(tx.Now()))
+
+		return nil
+	})
+
+	return pairs, err
+}
+
+// HLen - число живых полей, 0 для отсутствующего ключа
+func (s *Storage) HLen(ctx context.Context, query compute.Query) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var length int
+	err := s.view(ctx, func(tx Tx) error {
+		hash, err := getHash(tx, query.Key())
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		length = hash.Len(tx.Now())
+
+		return nil
+	})
+
+	return length, err
+}
+
+// HIncrBy - прибавляет к числовому значению поля, отсутствующее поле считается нулем. Срок жизни поля сохраняется
+func (s *Storage) HIncrBy(ctx context.Context, query compute.Query) (int64, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var value int64
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		var err error
+		if value, err = applyHashRecord(tx, query); err != nil {
+			return nil, err
+		}
+
+		return []compute.Query{query}, nil
+	})
+
+	return value, err
+}
+
+// HScan - HSCAN key cursor [MATCH pattern] [COUNT n]. Курсор - позиция в упорядоченном списке полей,
+// поля, добавленные или удаленные во время обхода, могут быть пропущены или вернуться повторно
+func (s *Storage) HScan(ctx context.Context, query compute.Query) (string, []KeyValue, error) {
+	if ctx.Err() != nil {
+		return "", nil, ctx.Err()
+	}
+
+	opts := query.ScanOptions()
+	offset := query.IntArg(1)
+
+	cursor, pairs := "0", make([]KeyValue, 0)
+	err := s.view(ctx, func(tx Tx) error {
+		hash, err := getHash(tx, query.Key())
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		fields := hash.Fields(tx.Now())
+		if offset >= len(fields) {
+			return nil
+		}
+
+		end := min(offset+opts.Count, len(fields))
+		for _, field := range fields[offset:end] {
+			if opts.Match == "" || utils.MatchGlob(opts.Match, field.Name) {
+				pairs = append(pairs, KeyValue{Key: field.Name, Value: field.Value})
+			}
+		}
+
+		if end < len(fields) {
+			cursor = strconv.Itoa(end)
+		}
+
+		return nil
+	})
+
+	return cursor, pairs, err
+}
+
+// HExpire - HEXPIRE key seconds field [field ...], ставит срок жизни полям. Возвращает, скольким полям он поставлен.
+// В WAL пишется абсолютный срок только для существующих полей
+func (s *Storage) HExpire(ctx context.Context, query compute.Query) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var updated int64
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		hash, err := getHash(tx, query.Key())
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		expireAt := tx.Now() + int64(query.IntArg(1))*1000
+		args := []string{query.Key(), strconv.FormatInt(expireAt, 10)}
+		for _, name := range query.Args()[2:] {
+			if _, ok := hash.Get(name, tx.Now()); ok {
+				args = append(args, name)
+			}
+		}
+
+		if len(args) == 2 {
+			return nil, nil
+		}
+
+		record := compute.NewQuery(compute.HPExpireAtCommandId, args)
+		if updated, err = applyHashRecord(tx, record); err != nil {
+			return nil, err
+		}
+
+		return []compute.Query{record}, nil
+	})
+
+	return int(updated), err
+}
+
+// HTTL - оставшееся время жизни поля в миллисекундах, -1 - бессрочное поле. ErrKeyNotFound, если нет ключа или поля
+func (s *Storage) HTTL(ctx context.Context, query compute.Query) (int64, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var ttl int64
+	err := s.view(ctx, func(tx Tx) error {
+		hash, err := getHash(tx, query.Key())
+		if err != nil {
+			return err
+		}
+
+		field, ok := hash.Get(query.Value(), tx.Now())
+		if !ok {
+			return ErrKeyNotFound
+		}
+
+		ttl = -1
+		if field.ExpireAt != 0 {
+			ttl = field.ExpireAt - tx.Now()
+		}
+
+		return nil
+	})
+
+	return ttl, err
+}
+
+// applyHashRecord - HSET, HDEL, HINCRBY и HPEXPIREAT. Перед изменением из хеша удаляются истекшие поля,
+// опустевший хеш удаляется. Возвращает число новых полей для HSET, удаленных для HDEL,
+// обновленных для HPEXPIREAT и новое значение для HINCRBY
+func applyHashRecord(tx Tx, record compute.Query) (int64, error) {
+	id, key := record.CommandId(), record.Key()
+
+	entry, err := tx.Get(key)
+	if errors.Is(err, ErrKeyNotFound) {
+		if id != compute.HSetCommandId && id != compute.HIncrByCommandId {
+			return 0, nil
+		}
+
+		entry, err = NewCollectionEntry(NewHash()), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	hash, ok := entry.Data.(*Hash)
+	if !ok {
+		return 0, ErrWrongType
+	}
+	hash.Purge(tx.Now())
+
+	var result int64
+	switch id {
+	case compute.HSetCommandId:
+		for _, pair := range record.Pairs() {
+			if hash.Set(pair[0], pair[1]) {
+				result++
+			}
+		}
+	case compute.HDelCommandId:
+		for _, name := range record.Args()[1:] {
+			if hash.Delete(name) {
+				result++
+			}
+		}
+	case compute.HIncrByCommandId:
+		name := record.Value()
+
+		var current int64
+		if field, ok := hash.Get(name, tx.Now()); ok {
+			if current, err = strconv.ParseInt(field.Value, 10, 64); err != nil {
+				return 0, fmt.Errorf("%w: %s", ErrNotInteger, name)
+			}
+		}
+
+		increment := record.Int64Arg(2)
+		if (increment > 0 && current > math.MaxInt64-increment) || (increment < 0 && current < math.MinInt64-increment) {
+			return 0, ErrIntegerOverflow
+		}
+
+		result = current + increment
+		hash.Update(name, strconv.FormatInt(result, 10))
+	case compute.HPExpireAtCommandId:
+		expireAt, err := strconv.ParseInt(record.Value(), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s", ErrUnknownRecord, record.String())
+		}
+
+		for _, name := range record.Args()[2:] {
+			if hash.Expire(name, expireAt) {
+				result++
+			}
+		}
+
+		// поля с уже наступившим сроком удаляются сразу
+		hash.Purge(tx.Now())
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrUnknownRecord, record.String())
+	}
+
+	if hash.Len(tx.Now()) == 0 {
+		return result, tx.Delete(key)
+	}
+
+	return result, tx.Set(key, entry)
+}
+
+// getHash - хеш ключа, ErrWrongType если по ключу лежит значение другого типа
+func getHash(tx Tx, key string) (*Hash, error) {
+	entry, err := tx.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, ok := entry.Data.(*Hash)
+	if !ok {
+		return nil, ErrWrongType
+	}
+
+	return hash, nil
+}
+
+func hashPairs(fields []HashField) []KeyValue {
+	pairs := make([]KeyValue, 0, len(fields))
+	for _, field := range fields {
+		pairs = append(pairs, KeyValue{Key: field.Name, Value: field.Value})
+	}
+
+	return pairs
+}
@@ -0,0 +1,43 @@
+package storage
+
+import "errors"
+
+var (
+	ErrIterationUnsupported = errors.New("engine doesn't support ordered iteration")
+	ErrInvalidCursor        = errors.New("invalid cursor")
+)
+
+// IterOptions - границы обхода [Start, End). Пустая граница означает отсутствие ограничения
+type IterOptions struct {
+	Start   string
+	End     string
+	Reverse bool
+}
+
+// Iterator - обход ключей движка по порядку. Next нужно вызвать перед чтением первой записи
+type Iterator interface {
+	Next() bool
+	Key() string
+	Value() string
+	Err() error
+	Close() error
+}
+
+// KeyValue - пара ключ-значение, результат обхода
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// PrefixEnd - верхняя граница диапазона ключей с префиксом prefix
+func PrefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+
+	return ""
+}
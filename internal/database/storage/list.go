@@ -0,0 +1,197 @@
+package storage
+
+// listChunkSize - число элементов в одном блоке списка
+const listChunkSize = 64
+
+// listChunk - блок списка, занятые элементы лежат в items[start:end]
+type listChunk struct {
+	items      [listChunkSize]string
+	start, end int
+	prev, next *listChunk
+}
+
+func (c *listChunk) len() int {
+	return c.end - c.start
+}
+
+// List - список из связанных блоков фиксированного размера. Вставка и удаление с обоих концов за O(1):
+// блок заполняется от края, новый блок выделяется, только когда крайний заполнен
+type List struct {
+	head, tail *listChunk
+	length     int
+}
+
+var _ Collection = (*List)(nil)
+
+// NewList - список из values в том же порядке
+func NewList(values ...string) *List {
+	l := &List{}
+	for _, value := range values {
+		l.PushBack(value)
+	}
+
+	return l
+}
+
+func (l *List) Type() ValueType {
+	return TypeList
+}
+
+func (l *List) Clone() Collection {
+	return NewList(l.Values()...)
+}
+
+func (l *List) Len() int {
+	return l.length
+}
+
+func (l *List) PushFront(value string) {
+	if l.head == nil || l.head.start == 0 {
+		chunk := &listChunk{start: listChunkSize, end: listChunkSize, next: l.head}
+		if l.head != nil {
+			l.head.prev = chunk
+		} else {
+			l.tail = chunk
+		}
+		l.head = chunk
+	}
+
+	l.head.start--
+	l.head.items[l.head.start] = value
+	l.length++
+}
+
+func (l *List) PushBack(value string) {
+	if l.tail == nil || l.tail.end == listChunkSize {
+		chunk := &listChunk{prev: l.tail}
+		if l.tail != nil {
+			l.tail.next = chunk
+		} else {
+			l.head = chunk
+		}
+		l.tail = chunk
+	}
+
+	l.tail.items[l.tail.end] = value
+	l.tail.end++
+	l.length++
+}
+
+func (l *List) PopFront() (string, bool) {
+	if l.length == 0 {
+		return "", false
+	}
+
+	chunk := l.head
+	value := chunk.items[chunk.start]
+	chunk.items[chunk.start] = ""
+	chunk.start++
+	l.length--
+
+	if chunk.len() == 0 {
+		l.head = chunk.next
+		if l.head != nil {
+			l.head.prev = nil
+		} else {
+			l.tail = nil
+		}
+	}
+
+	return value, true
+}
+
+func (l *List) PopBack() (string, bool) {
+	if l.length == 0 {
+		return "", false
+	}
+
+	chunk := l.tail
+	chunk.end--
+	value := chunk.items[chunk.end]
+	chunk.items[chunk.end] = ""
+	l.length--
+
+	if chunk.len() == 0 {
+		l.tail = chunk.prev
+		if l.tail != nil {
+			l.tail.next = nil
+		} else {
+			l.head = nil
+		}
+	}
+
+	return value, true
+}
+
+// Index - элемент по индексу, отрицательный индекс отсчитывается от конца
+func (l *List) Index(i int) (string, bool) {
+	if i < 0 {
+		i += l.length
+	}
+
+	if i < 0 || i >= l.length {
+		return "", false
+	}
+
+	values := l.Range(i, i)
+
+	return values[0], true
+}
+
+// Range - элементы [start, stop] включительно, отрицательные индексы отсчитываются от конца
+func (l *List) Range(start, stop int) []string {
+	start, stop, ok := l.bounds(start, stop)
+	if !ok {
+		return []string{}
+	}
+
+	values := make([]string, 0, stop-start+1)
+	chunk, offset := l.head, start
+	for offset >= chunk.len() {
+		offset -= chunk.len()
+		chunk = chunk.next
+	}
+
+	for chunk != nil && len(values) < cap(values) {
+		n := min(chunk.len()-offset, cap(values)-len(values))
+		values = append(values, chunk.items[chunk.start+offset:chunk.start+offset+n]...)
+		chunk, offset = chunk.next, 0
+	}
+
+	return values
+}
+
+// Trim - оставляет только элементы [start, stop], индексы как в Range
+func (l *List) Trim(start, stop int) {
+	start, stop, ok := l.bounds(start, stop)
+	if !ok {
+		*l = List{}
+		return
+	}
+
+	for tail := l.length - 1 - stop; tail > 0; tail-- {
+		l.PopBack()
+	}
+
+	for ; start > 0; start-- {
+		l.PopFront()
+	}
+}
+
+func (l *List) Values() []string {
+	return l.Range(0, -1)
+}
+
+// bounds - индексы Range, приведенные к [0, length). ok=false для пустого диапазона
+func (l *List) bounds(start, stop int) (int, int, bool) {
+	if start < 0 {
+		start = max(start+l.length, 0)
+	}
+
+	if stop < 0 {
+		stop += l.length
+	}
+	stop = min(stop, l.length-1)
+
+	return start, stop, start <= stop
+}
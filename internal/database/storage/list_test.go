@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestList(t *testing.T) {
+	// несколько блоков, чтобы проверить переходы между ними
+	n := listChunkSize*3 + 5
+
+	l := NewList()
+	want := make([]string, 0, n)
+	for i := range n {
+		l.PushBack(strconv.Itoa(i))
+		want = append(want, strconv.Itoa(i))
+	}
+	for i := 1; i <= n; i++ {
+		l.PushFront(strconv.Itoa(-i))
+		want = append([]string{strconv.Itoa(-i)}, want...)
+	}
+
+	assert.Equal(t, 2*n, l.Len())
+	assert.Equal(t, want, l.Values())
+	assert.Equal(t, want[listChunkSize-2:listChunkSize+3], l.Range(listChunkSize-2, listChunkSize+2))
+	assert.Equal(t, want[len(want)-3:], l.Range(-3, -1))
+	assert.Empty(t, l.Range(5, 2))
+	assert.Empty(t, l.Range(2*n, -1))
+
+	value, ok := l.Index(-1)
+	assert.True(t, ok)
+	assert.Equal(t, want[len(want)-1], value)
+
+	_, ok = l.Index(2 * n)
+	assert.False(t, ok)
+
+	for i := range n {
+		value, ok := l.PopFront()
+		assert.True(t, ok)
+		assert.Equal(t, want[i], value)
+	}
+
+	l.Trim(10, -11)
+	assert.Equal(t, want[n+10:2*n-10], l.Values())
+
+	l.Trim(1, 0)
+	assert.Equal(t, 0, l.Len())
+
+	_, ok = l.PopBack()
+	assert.False(t, ok)
+
+	l.PushBack("a")
+	assert.Equal(t, []string{"a"}, l.Values())
+}
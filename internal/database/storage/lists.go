@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+)
+
+// Push - LPUSH и RPUSH, создает список при необходимости. Возвращает новую длину.
+// В WAL команда пишется как есть
+func (s *Storage) Push(ctx context.Context, query compute.Query) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var length int
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		if _, err := applyListRecord(tx, query); err != nil {
+			return nil, err
+		}
+
+		list, err := getList(tx, query.Key())
+		if err != nil {
+			return nil, err
+		}
+		length = list.Len()
+
+		return []compute.Query{query}, nil
+	})
+
+	return length, err
+}
+
+// Pop - LPOP и RPOP, снимает до count элементов. Пустой список удаляется.
+// ErrKeyNotFound, если ключа нет. В WAL пишется число реально снятых элементов
+func (s *Storage) Pop(ctx context.Context, query compute.Query) ([]string, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	var values []string
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		list, err := getList(tx, query.Key())
+		if err != nil {
+			return nil, err
+		}
+
+		count := min(query.PopCount(), list.Len())
+		record := compute.NewQuery(query.CommandId(), []string{query.Key(), strconv.Itoa(count)})
+		values, err = applyListRecord(tx, record)
+		if err != nil {
+			return nil, err
+		}
+
+		return []compute.Query{record}, nil
+	})
+
+	return values, err
+}
+
+// LLen - длина списка, 0 для отсутствующего ключа
+func (s *Storage) LLen(ctx context.Context, query compute.Query) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var length int
+	err := s.view(ctx, func(tx Tx) error {
+		list, err := getList(tx, query.Key())
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		length = list.Len()
+
+		return nil
+	})
+
+	return length, err
+}
+
+// LRange - элементы [start, stop] включительно, отрицательные индексы отсчитываются от конца
+func (s *Storage) LRange(ctx context.Context, query compute.Query) ([]string, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	values := make([]string, 0)
+	err := s.view(ctx, func(tx Tx) error {
+		list, err := getList(tx, query.Key())
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		values = list.Range(query.IntArg(1), query.IntArg(2))
+
+		return nil
+	})
+
+	return values, err
+}
+
+// LIndex - элемент по индексу, ErrKeyNotFound если ключа или элемента нет
+func (s *Storage) LIndex(ctx context.Context, query compute.Query) (string, error) {
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	var value string
+	err := s.view(ctx, func(tx Tx) error {
+		list, err := getList(tx, query.Key())
+		if err != nil {
+			return err
+		}
+
+		var ok bool
+		if value, ok = list.Index(query.IntArg(1)); !ok {
+			return ErrKeyNotFound
+		}
+
+		return nil
+	})
+
+	return value, err
+}
+
+// LTrim - оставляет только элементы [start, stop]. Отсутствующий ключ не ошибка, в WAL тогда ничего не пишется
+func (s *Storage) LTrim(ctx context.Context, query compute.Query) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		if _, err := getList(tx, query.Key()); err != nil {
+			if errors.Is(err, ErrKeyNotFound) {
+				return nil, nil
+			}
+
+			return nil, err
+		}
+
+		if _, err := applyListRecord(tx, query); err != nil {
+			return nil, err
+		}
+
+		return []compute.Query{query}, nil
+	})
+}
+
+// applyListRecord - LPUSH, RPUSH, LPOP, RPOP и LTRIM. Возвращает снятые элементы.
+// Опустевший список удаляется, как и в Redis пустых списков не бывает
+func applyListRecord(tx Tx, record compute.Query) ([]string, error) {
+	entry, err := tx.Get(record.Key())
+	if errors.Is(err, ErrKeyNotFound) {
+		id := record.CommandId()
+		if id != compute.LPushCommandId && id != compute.RPushCommandId {
+			return nil, err
+		}
+
+		entry, err = NewCollectionEntry(NewList()), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	list, ok := entry.Data.(*List)
+	if !ok {
+		return nil, ErrWrongType
+	}
+
+	var popped []string
+	switch record.CommandId() {
+	case compute.LPushCommandId:
+		for _, value := range record.Args()[1:] {
+			list.PushFront(value)
+		}
+	case compute.RPushCommandId:
+		for _, value := range record.Args()[1:] {
+			list.PushBack(value)
+		}
+	case compute.LPopCommandId, compute.RPopCommandId:
+		pop := list.PopFront
+		if record.CommandId() == compute.RPopCommandId {
+			pop = list.PopBack
+		}
+
+		popped = make([]string, 0, record.PopCount())
+		for range record.PopCount() {
+			value, ok := pop()
+			if !ok {
+				break
+			}
+			popped = append(popped, value)
+		}
+	case compute.LTrimCommandId:
+		list.Trim(record.IntArg(1), record.IntArg(2))
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRecord, record.String())
+	}
+
+	if list.Len() == 0 {
+		return popped, tx.Delete(record.Key())
+	}
+
+	return popped, tx.Set(record.Key(), entry)
+}
+
+// getList - список ключа, ErrWrongType если по ключу лежит значение другого типа
+func getList(tx Tx, key string) (*List, error) {
+	entry, err := tx.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	list, ok := entry.Data.(*List)
+	if !ok {
+		return nil, ErrWrongType
+	}
+
+	return list, nil
+}
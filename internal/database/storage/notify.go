@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+)
+
+var ErrInvalidNotifyFlags = errors.New("invalid keyspace events flags")
+
+const (
+	// KeyspacePrefix - канал событий одного ключа, "__keyspace@0__:key", сообщение - имя события
+	KeyspacePrefix = "__keyspace@0__:"
+	// KeyeventPrefix - канал одного события, "__keyevent@0__:del", сообщение - ключ
+	KeyeventPrefix = "__keyevent@0__:"
+)
+
+// notifyFlags - какие уведомления отправлять, как notify-keyspace-events в Redis
+type notifyFlags uint16
+
+const (
+	notifyKeyspace  notifyFlags = 1 << iota // K
+	notifyKeyevent                          // E
+	notifyGeneric                           // g: del, expire, rename и т.п.
+	notifyString                            // $
+	notifyList                              // l
+	notifySet                               // s
+	notifyHash                              // h
+	notifySortedSet                         // z
+	notifyExpired                           // x: ключ удален по сроку жизни
+	notifyStream                            // t
+
+	// notifyAll - A, все классы событий. Вытеснения (e в Redis) нет, поэтому и флага для него нет
+	notifyAll = notifyGeneric | notifyString | notifyList | notifySet | notifyHash | notifySortedSet |
+		notifyExpired | notifyStream
+)
+
+var notifyFlagChars = map[rune]notifyFlags{
+	'K': notifyKeyspace,
+	'E': notifyKeyevent,
+	'g': notifyGeneric,
+	'$': notifyString,
+	'l': notifyList,
+	's': notifySet,
+	'h': notifyHash,
+	'z': notifySortedSet,
+	'x': notifyExpired,
+	't': notifyStream,
+	'A': notifyAll,
+}
+
+// Publisher - куда отправляются уведомления, pub/sub брокер
+type Publisher interface {
+	Publish(channel, message string) int
+	// HasSubscribers - есть ли хоть один подписчик. Без них события даже не собираются
+	HasSubscribers() bool
+}
+
+// Notifier - уведомления об изменениях ключей в каналы pub/sub. Nil Notifier ничего не отправляет
+type Notifier struct {
+	publisher Publisher
+	flags     notifyFlags
+}
+
+// NewNotifier - events - флаги в формате notify-keyspace-events: K и/или E выбирают каналы,
+// остальные - классы событий. Пустая строка выключает уведомления
+func NewNotifier(publisher Publisher, events string) (*Notifier, error) {
+	var flags notifyFlags
+	for _, c := range events {
+		flag, ok := notifyFlagChars[c]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidNotifyFlags, c)
+		}
+
+		flags |= flag
+	}
+
+	// без канала или без класса событий отправлять нечего
+	if flags&(notifyKeyspace|notifyKeyevent) == 0 || flags&notifyAll == 0 {
+		flags = 0
+	}
+
+	return &Notifier{publisher: publisher, flags: flags}, nil
+}
+
+// keyEvent - событие ключа, которое отправляется после записи в WAL
+type keyEvent struct {
+	class notifyFlags
+	event string
+	key   string
+}
+
+// active - нужно ли собирать события класса class
+func (n *Notifier) active(class notifyFlags) bool {
+	return n != nil && n.flags&class != 0 && n.publisher.HasSubscribers()
+}
+
+func (n *Notifier) publish(events []keyEvent) {
+	if n == nil {
+		return
+	}
+
+	for _, e := range events {
+		if n.flags&e.class == 0 {
+			continue
+		}
+
+		if n.flags&notifyKeyspace != 0 {
+			n.publisher.Publish(KeyspacePrefix+e.key, e.event)
+		}
+		if n.flags&notifyKeyevent != 0 {
+			n.publisher.Publish(KeyeventPrefix+e.event, e.key)
+		}
+	}
+}
+
+// recordEvents - события записи WAL. Имена событий как в Redis
+func recordEvents(record compute.Query) []keyEvent {
+	args := record.Args()
+	event := strings.ToLower(string(record.CommandId()))
+
+	switch record.CommandId() {
+	case compute.SetCommandId:
+		events := []keyEvent{{class: notifyString, event: "set", key: record.Key()}}
+		if len(args) > 2 {
+			events = append(events, keyEvent{class: notifyGeneric, event: "expire", key: record.Key()})
+		}
+
+		return events
+	case compute.MSetCommandId:
+		events := make([]keyEvent, 0, len(args)/2)
+		for _, pair := range record.Pairs() {
+			events = append(events, keyEvent{class: notifyString, event: "set", key: pair[0]})
+		}
+
+		return events
+	case compute.AppendCommandId, compute.SetRangeCommandId:
+		return []keyEvent{{class: notifyString, event: event, key: record.Key()}}
+	case compute.PExpireAtCommandId:
+		if record.Value() == "0" {
+			return []keyEvent{{class: notifyGeneric, event: "persist", key: record.Key()}}
+		}
+
+		return []keyEvent{{class: notifyGeneric, event: "expire", key: record.Key()}}
+	case compute.DeleteCommandId, compute.MDelCommandId:
+		events := make([]keyEvent, 0, len(args))
+		for _, key := range args {
+			events = append(events, keyEvent{class: notifyGeneric, event: "del", key: key})
+		}
+
+		return events
+	case compute.RenameCommandId:
+		return []keyEvent{
+			{class: notifyGeneric, event: "rename_from", key: record.Key()},
+			{class: notifyGeneric, event: "rename_to", key: record.Value()},
+		}
+	case compute.CopyCommandId:
+		return []keyEvent{{class: notifyGeneric, event: "copy_to", key: record.Value()}}
+	case compute.RestoreCommandId:
+		return []keyEvent{{class: notifyGeneric, event: "restore", key: record.Key()}}
+	case compute.LPushCommandId, compute.RPushCommandId, compute.LPopCommandId, compute.RPopCommandId,
+		compute.LTrimCommandId:
+		return []keyEvent{{class: notifyList, event: event, key: record.Key()}}
+	case compute.LMoveCommandId:
+		// LMOVE src dst from to: снятие с одной стороны src и добавление с другой стороны dst
+		return []keyEvent{
+			{class: notifyList, event: strings.ToLower(args[2][:1]) + "pop", key: args[0]},
+			{class: notifyList, event: strings.ToLower(args[3][:1]) + "push", key: args[1]},
+		}
+	case compute.HSetCommandId, compute.HDelCommandId, compute.HIncrByCommandId:
+		return []keyEvent{{class: notifyHash, event: event, key: record.Key()}}
+	case compute.HPExpireAtCommandId:
+		return []keyEvent{{class: notifyHash, event: "hexpire", key: record.Key()}}
+	case compute.SAddCommandId, compute.SRemCommandId,
+		compute.SInterStoreCommandId, compute.SUnionStoreCommandId, compute.SDiffStoreCommandId:
+		return []keyEvent{{class: notifySet, event: event, key: record.Key()}}
+	case compute.ZAddCommandId, compute.ZRemCommandId, compute.ZPopMinCommandId, compute.ZPopMaxCommandId,
+		compute.ZRangeStoreCommandId:
+		return []keyEvent{{class: notifySortedSet, event: event, key: record.Key()}}
+	case compute.ZIncrByCommandId:
+		return []keyEvent{{class: notifySortedSet, event: "zincr", key: record.Key()}}
+	case compute.XAddCommandId:
+		return []keyEvent{{class: notifyStream, event: "xadd", key: record.Key()}}
+	case compute.XGroupCommandId:
+		// XGROUP CREATE|DESTROY key group ...
+		return []keyEvent{{class: notifyStream, event: "xgroup-" + strings.ToLower(args[0]), key: args[1]}}
+	}
+
+	// FLUSHDB и служебные изменения групп потоков (XREADGROUP, XACK, XCLAIM) событий не дают
+	return nil
+}
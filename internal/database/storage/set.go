@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// setMaxIntsetEntries - до скольких элементов множество из одних целых чисел хранится отсортированным массивом
+const setMaxIntsetEntries = 512
+
+// Set - множество строк. Небольшое множество из целых чисел хранится как отсортированный []int64 (intset):
+// это в разы компактнее map, а поиск остается O(log n). При добавлении не числа или переполнении
+// множество один раз переходит на map и обратно уже не возвращается
+type Set struct {
+	ints    []int64
+	members map[string]struct{}
+}
+
+var _ Collection = (*Set)(nil)
+
+func NewSet(members ...string) *Set {
+	s := &Set{}
+	for _, member := range members {
+		s.Add(member)
+	}
+
+	return s
+}
+
+func (s *Set) Type() ValueType {
+	return TypeSet
+}
+
+func (s *Set) Clone() Collection {
+	return &Set{ints: slices.Clone(s.ints), members: maps.Clone(s.members)}
+}
+
+// IsIntset - множество хранится как intset
+func (s *Set) IsIntset() bool {
+	return s.members == nil
+}
+
+func (s *Set) Len() int {
+	if s.IsIntset() {
+		return len(s.ints)
+	}
+
+	return len(s.members)
+}
+
+func (s *Set) Contains(member string) bool {
+	if !s.IsIntset() {
+		_, ok := s.members[member]
+		return ok
+	}
+
+	n, ok := intsetValue(member)
+	if !ok {
+		return false
+	}
+
+	_, found := slices.BinarySearch(s.ints, n)
+
+	return found
+}
+
+// Add - добавляет элемент, возвращает, был ли он новым
+func (s *Set) Add(member string) bool {
+	if s.IsIntset() {
+		if n, ok := intsetValue(member); ok {
+			i, found := slices.BinarySearch(s.ints, n)
+			if found {
+				return false
+			}
+
+			if len(s.ints) < setMaxIntsetEntries {
+				s.ints = slices.Insert(s.ints, i, n)
+				return true
+			}
+		}
+
+		s.convert()
+	}
+
+	if _, ok := s.members[member]; ok {
+		return false
+	}
+	s.members[member] = struct{}{}
+
+	return true
+}
+
+// Remove - удаляет элемент, возвращает, был ли он в множестве
+func (s *Set) Remove(member string) bool {
+	if !s.IsIntset() {
+		_, ok := s.members[member]
+		delete(s.members, member)
+
+		return ok
+	}
+
+	n, ok := intsetValue(member)
+	if !ok {
+		return false
+	}
+
+	i, found := slices.BinarySearch(s.ints, n)
+	if found {
+		s.ints = slices.Delete(s.ints, i, i+1)
+	}
+
+	return found
+}
+
+// Members - элементы по порядку: у intset по возрастанию чисел, иначе лексикографически
+func (s *Set) Members() []string {
+	if s.IsIntset() {
+		members := make([]string, 0, len(s.ints))
+		for _, n := range s.ints {
+			members = append(members, strconv.FormatInt(n, 10))
+		}
+
+		return members
+	}
+
+	return slices.Sorted(maps.Keys(s.members))
+}
+
+// Ints - элементы intset по возрастанию, nil если множество хранится как map
+func (s *Set) Ints() []int64 {
+	if !s.IsIntset() {
+		return nil
+	}
+
+	return s.ints
+}
+
+// NewIntset - множество из отсортированных чисел без повторов, как их вернул Ints
+func NewIntset(ints []int64) *Set {
+	return &Set{ints: ints}
+}
+
+func (s *Set) convert() {
+	s.members = make(map[string]struct{}, len(s.ints)+1)
+	for _, n := range s.ints {
+		s.members[strconv.FormatInt(n, 10)] = struct{}{}
+	}
+	s.ints = nil
+}
+
+// intsetValue - число, если строка - его каноническая запись. "007" и "+7" хранятся как строки,
+// иначе элемент вернулся бы в другом виде
+func intsetValue(member string) (int64, bool) {
+	n, err := strconv.ParseInt(member, 10, 64)
+	if err != nil || strconv.FormatInt(n, 10) != member {
+		return 0, false
+	}
+
+	return n, true
+}
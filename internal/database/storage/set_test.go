@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSet(t *testing.T) {
+	s := NewSet("3", "1", "2", "1")
+	assert.True(t, s.IsIntset())
+	assert.Equal(t, []int64{1, 2, 3}, s.Ints())
+	assert.True(t, s.Contains("2"))
+	assert.False(t, s.Contains("02"))
+
+	// неканоническая запись числа - обычная строка, intset переходит на map
+	assert.True(t, s.Add("007"))
+	assert.False(t, s.IsIntset())
+	assert.Equal(t, []string{"007", "1", "2", "3"}, s.Members())
+	assert.True(t, s.Remove("007"))
+	assert.False(t, s.IsIntset())
+
+	s = NewSet()
+	for i := range setMaxIntsetEntries {
+		s.Add(strconv.Itoa(i))
+	}
+	assert.True(t, s.IsIntset())
+	assert.False(t, s.Add("0"))
+
+	assert.True(t, s.Add(strconv.Itoa(setMaxIntsetEntries)))
+	assert.False(t, s.IsIntset())
+	assert.Equal(t, setMaxIntsetEntries+1, s.Len())
+	assert.True(t, s.Contains("511"))
+
+	clone := s.Clone().(*Set)
+	clone.Remove("0")
+	assert.True(t, s.Contains("0"))
+}
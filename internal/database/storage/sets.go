@@ -0,0 +1,283 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+	"github.com/TimonKK/inmemory-db/internal/utils"
+)
+
+// SAdd - добавляет элементы, создавая множество при необходимости. Возвращает число новых элементов
+func (s *Storage) SAdd(ctx context.Context, query compute.Query) (int, error) {
+	return s.writeSet(ctx, query)
+}
+
+// SRem - удаляет элементы и возвращает, сколько из них было. Пустое множество удаляется
+func (s *Storage) SRem(ctx context.Context, query compute.Query) (int, error) {
+	return s.writeSet(ctx, query)
+}
+
+// SetStore - SINTERSTORE, SUNIONSTORE и SDIFFSTORE. Результат атомарно записывается в dst, заменяя
+// прежнее значение любого типа. Пустой результат удаляет dst. Возвращает размер результата
+func (s *Storage) SetStore(ctx context.Context, query compute.Query) (int, error) {
+	return s.writeSet(ctx, query)
+}
+
+// writeSet - команда записи во множество, которая сама является записью WAL
+func (s *Storage) writeSet(ctx context.Context, query compute.Query) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var n int
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		var err error
+		if n, err = applySetRecord(tx, query); err != nil {
+			return nil, err
+		}
+
+		return []compute.Query{query}, nil
+	})
+
+	return n, err
+}
+
+func (s *Storage) SIsMember(ctx context.Context, query compute.Query) (bool, error) {
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+
+	var found bool
+	err := s.view(ctx, func(tx Tx) error {
+		set, err := getSet(tx, query.Key())
+		if err != nil {
+			return err
+		}
+		found = set.Contains(query.Value())
+
+		return nil
+	})
+
+	return found, err
+}
+
+// SMembers - элементы по порядку, пустой результат для отсутствующего ключа
+func (s *Storage) SMembers(ctx context.Context, query compute.Query) ([]string, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	var members []string
+	err := s.view(ctx, func(tx Tx) error {
+		set, err := getSet(tx, query.Key())
+		if err != nil {
+			return err
+		}
+		members = set.Members()
+
+		return nil
+	})
+
+	return members, err
+}
+
+func (s *Storage) SCard(ctx context.Context, query compute.Query) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var n int
+	err := s.view(ctx, func(tx Tx) error {
+		set, err := getSet(tx, query.Key())
+		if err != nil {
+			return err
+		}
+		n = set.Len()
+
+		return nil
+	})
+
+	return n, err
+}
+
+// SetOp - SINTER, SUNION и SDIFF. Отсутствующие ключи считаются пустыми множествами
+func (s *Storage) SetOp(ctx context.Context, query compute.Query) ([]string, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	var members []string
+	err := s.view(ctx, func(tx Tx) error {
+		result, err := setOperation(tx, query.CommandId(), query.Args())
+		if err != nil {
+			return err
+		}
+		members = result.Members()
+
+		return nil
+	})
+
+	return members, err
+}
+
+// SScan - SSCAN key cursor [MATCH pattern] [COUNT n]. Курсор - позиция в упорядоченном списке элементов,
+// как у HSCAN
+func (s *Storage) SScan(ctx context.Context, query compute.Query) (string, []string, error) {
+	if ctx.Err() != nil {
+		return "", nil, ctx.Err()
+	}
+
+	opts := query.ScanOptions()
+	offset := query.IntArg(1)
+
+	cursor, members := "0", make([]string, 0)
+	err := s.view(ctx, func(tx Tx) error {
+		set, err := getSet(tx, query.Key())
+		if err != nil {
+			return err
+		}
+
+		all := set.Members()
+		if offset >= len(all) {
+			return nil
+		}
+
+		end := min(offset+opts.Count, len(all))
+		for _, member := range all[offset:end] {
+			if opts.Match == "" || utils.MatchGlob(opts.Match, member) {
+				members = append(members, member)
+			}
+		}
+
+		if end < len(all) {
+			cursor = strconv.Itoa(end)
+		}
+
+		return nil
+	})
+
+	return cursor, members, err
+}
+
+// applySetRecord - SADD, SREM и *STORE. Возвращает число добавленных или удаленных элементов,
+// для *STORE - размер результата
+func applySetRecord(tx Tx, record compute.Query) (int, error) {
+	switch record.CommandId() {
+	case compute.SInterStoreCommandId, compute.SUnionStoreCommandId, compute.SDiffStoreCommandId:
+		op := map[compute.CommandId]compute.CommandId{
+			compute.SInterStoreCommandId: compute.SInterCommandId,
+			compute.SUnionStoreCommandId: compute.SUnionCommandId,
+			compute.SDiffStoreCommandId:  compute.SDiffCommandId,
+		}[record.CommandId()]
+
+		result, err := setOperation(tx, op, record.Args()[1:])
+		if err != nil {
+			return 0, err
+		}
+
+		if result.Len() == 0 {
+			return 0, tx.Delete(record.Key())
+		}
+
+		return result.Len(), tx.Set(record.Key(), NewCollectionEntry(result))
+	case compute.SAddCommandId, compute.SRemCommandId:
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrUnknownRecord, record.String())
+	}
+
+	entry, err := tx.Get(record.Key())
+	if errors.Is(err, ErrKeyNotFound) {
+		if record.CommandId() == compute.SRemCommandId {
+			return 0, nil
+		}
+
+		entry, err = NewCollectionEntry(NewSet()), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	set, ok := entry.Data.(*Set)
+	if !ok {
+		return 0, ErrWrongType
+	}
+
+	n := 0
+	for _, member := range record.Args()[1:] {
+		var changed bool
+		if record.CommandId() == compute.SAddCommandId {
+			changed = set.Add(member)
+		} else {
+			changed = set.Remove(member)
+		}
+
+		if changed {
+			n++
+		}
+	}
+
+	if set.Len() == 0 {
+		return n, tx.Delete(record.Key())
+	}
+
+	return n, tx.Set(record.Key(), entry)
+}
+
+// setOperation - пересечение, объединение или разность множеств keys
+func setOperation(tx Tx, op compute.CommandId, keys []string) (*Set, error) {
+	sets := make([]*Set, 0, len(keys))
+	for _, key := range keys {
+		set, err := getSet(tx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		sets = append(sets, set)
+	}
+
+	result := NewSet()
+	switch op {
+	case compute.SUnionCommandId:
+		for _, set := range sets {
+			for _, member := range set.Members() {
+				result.Add(member)
+			}
+		}
+	case compute.SInterCommandId, compute.SDiffCommandId:
+		for _, member := range sets[0].Members() {
+			inAll, inAny := true, false
+			for _, set := range sets[1:] {
+				contains := set.Contains(member)
+				inAll, inAny = inAll && contains, inAny || contains
+			}
+
+			if (op == compute.SInterCommandId && inAll) || (op == compute.SDiffCommandId && !inAny) {
+				result.Add(member)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// getSet - множество ключа, пустое для отсутствующего ключа. ErrWrongType, если по ключу значение другого типа.
+// Пустое множество нельзя менять: оно не записано в движок
+func getSet(tx Tx, key string) (*Set, error) {
+	entry, err := tx.Get(key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return NewSet(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	set, ok := entry.Data.(*Set)
+	if !ok {
+		return nil, ErrWrongType
+	}
+
+	return set, nil
+}
@@ -0,0 +1,365 @@
+package storage
+
+import (
+	"math/rand/v2"
+
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+)
+
+const (
+	// zsetMaxLevel - предельная высота skiplist, при zsetLevelP = 1/4 ее хватает на 2^64 элементов
+	zsetMaxLevel = 32
+	zsetLevelP   = 0.25
+)
+
+// SortedSet - элементы, упорядоченные по score, при равном score - по самому элементу.
+// Score ищется по map, порядок и ранги дает skiplist, у которого на каждом уровне хранится span -
+// число элементов, через которые перешагивает ссылка. Так ранг и элемент по рангу находятся за O(log n)
+type SortedSet struct {
+	scores map[string]float64
+	header *zsetNode
+	level  int
+}
+
+type zsetNode struct {
+	member   string
+	score    float64
+	backward *zsetNode
+	levels   []zsetLevel
+}
+
+type zsetLevel struct {
+	forward *zsetNode
+	span    int
+}
+
+var _ Collection = (*SortedSet)(nil)
+
+func NewSortedSet(members ...compute.ScoreMember) *SortedSet {
+	z := &SortedSet{
+		scores: make(map[string]float64, len(members)),
+		header: &zsetNode{levels: make([]zsetLevel, zsetMaxLevel)},
+		level:  1,
+	}
+
+	for _, m := range members {
+		z.Add(m.Member, m.Score)
+	}
+
+	return z
+}
+
+func (z *SortedSet) Type() ValueType {
+	return TypeSortedSet
+}
+
+func (z *SortedSet) Clone() Collection {
+	return NewSortedSet(z.Members()...)
+}
+
+func (z *SortedSet) Len() int {
+	return len(z.scores)
+}
+
+func (z *SortedSet) Score(member string) (float64, bool) {
+	score, ok := z.scores[member]
+	return score, ok
+}
+
+// Add - ставит элементу score. Возвращает, был ли элемент новым
+func (z *SortedSet) Add(member string, score float64) bool {
+	current, exists := z.scores[member]
+	if exists && current == score {
+		return false
+	}
+
+	// элемент удаляется и из map, пока его нет в skiplist: insert берет длину из map
+	if exists {
+		z.delete(current, member)
+		delete(z.scores, member)
+	}
+	z.insert(score, member)
+	z.scores[member] = score
+
+	return !exists
+}
+
+// Remove - удаляет элемент, возвращает, был ли он в множестве
+func (z *SortedSet) Remove(member string) bool {
+	score, ok := z.scores[member]
+	if !ok {
+		return false
+	}
+
+	z.delete(score, member)
+	delete(z.scores, member)
+
+	return true
+}
+
+// Rank - позиция элемента с нуля по возрастанию score
+func (z *SortedSet) Rank(member string) (int, bool) {
+	score, ok := z.scores[member]
+	if !ok {
+		return 0, false
+	}
+
+	rank, x := 0, z.header
+	for i := z.level - 1; i >= 0; i-- {
+		for next := x.levels[i].forward; next != nil && !zsetLess(score, member, next.score, next.member); next = x.levels[i].forward {
+			rank += x.levels[i].span
+			x = next
+		}
+
+		if x != z.header && x.member == member {
+			break
+		}
+	}
+
+	return rank - 1, true
+}
+
+// RevRank - позиция элемента с нуля по убыванию score
+func (z *SortedSet) RevRank(member string) (int, bool) {
+	rank, ok := z.Rank(member)
+	return z.Len() - 1 - rank, ok
+}
+
+// RangeByRank - элементы с позициями [start, stop] включительно, отрицательные отсчитываются от конца.
+// При reverse позиции считаются по убыванию score
+func (z *SortedSet) RangeByRank(start, stop int, reverse bool) []compute.ScoreMember {
+	n := z.Len()
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if stop < 0 {
+		stop = n + stop
+	}
+	stop = min(stop, n-1)
+
+	if start > stop {
+		return []compute.ScoreMember{}
+	}
+
+	members := make([]compute.ScoreMember, 0, stop-start+1)
+	if reverse {
+		for x := z.byRank(n - start); len(members) < cap(members); x = x.backward {
+			members = append(members, x.scoreMember())
+		}
+	} else {
+		for x := z.byRank(start + 1); len(members) < cap(members); x = x.levels[0].forward {
+			members = append(members, x.scoreMember())
+		}
+	}
+
+	return members
+}
+
+// RangeByScore - элементы со score в [min, max] с учетом исключающих границ. Первые offset пропускаются,
+// count < 0 - без ограничения
+func (z *SortedSet) RangeByScore(lo, hi compute.ScoreBound, reverse bool, offset, count int) []compute.ScoreMember {
+	aboveMin := func(x *zsetNode) bool {
+		return x.score > lo.Value || (!lo.Exclusive && x.score == lo.Value)
+	}
+	belowMax := func(x *zsetNode) bool {
+		return x.score < hi.Value || (!hi.Exclusive && x.score == hi.Value)
+	}
+
+	return z.rangeBy(aboveMin, belowMax, reverse, offset, count)
+}
+
+// RangeByLex - элементы между границами по самим элементам. Как и в Redis, осмысленно, только если у всех
+// элементов одинаковый score
+func (z *SortedSet) RangeByLex(lo, hi compute.LexBound, reverse bool, offset, count int) []compute.ScoreMember {
+	aboveMin := func(x *zsetNode) bool {
+		switch lo.Inf {
+		case -1:
+			return true
+		case 1:
+			return false
+		}
+
+		return x.member > lo.Value || (!lo.Exclusive && x.member == lo.Value)
+	}
+	belowMax := func(x *zsetNode) bool {
+		switch hi.Inf {
+		case -1:
+			return false
+		case 1:
+			return true
+		}
+
+		return x.member < hi.Value || (!hi.Exclusive && x.member == hi.Value)
+	}
+
+	return z.rangeBy(aboveMin, belowMax, reverse, offset, count)
+}
+
+// Pop - снимает до count элементов с наименьшим score, при fromMax - с наибольшим
+func (z *SortedSet) Pop(count int, fromMax bool) []compute.ScoreMember {
+	members := z.RangeByRank(0, count-1, fromMax)
+	for _, m := range members {
+		z.Remove(m.Member)
+	}
+
+	return members
+}
+
+// Members - все элементы по возрастанию
+func (z *SortedSet) Members() []compute.ScoreMember {
+	return z.RangeByRank(0, -1, false)
+}
+
+// rangeBy - элементы, для которых выполнены aboveMin и belowMax. Оба условия монотонны вдоль skiplist,
+// поэтому начало диапазона находится спуском по уровням
+func (z *SortedSet) rangeBy(aboveMin, belowMax func(*zsetNode) bool, reverse bool, offset, count int) []compute.ScoreMember {
+	members := make([]compute.ScoreMember, 0)
+
+	x := z.header
+	for i := z.level - 1; i >= 0; i-- {
+		for next := x.levels[i].forward; next != nil; next = x.levels[i].forward {
+			if (reverse && !belowMax(next)) || (!reverse && aboveMin(next)) {
+				break
+			}
+			x = next
+		}
+	}
+
+	step, inRange := func(x *zsetNode) *zsetNode { return x.levels[0].forward }, belowMax
+	if reverse {
+		step, inRange = func(x *zsetNode) *zsetNode { return x.backward }, aboveMin
+	} else {
+		x = x.levels[0].forward
+	}
+
+	if x == z.header {
+		return members
+	}
+
+	for ; x != nil && inRange(x) && count != 0; x = step(x) {
+		if offset > 0 {
+			offset--
+			continue
+		}
+
+		members = append(members, x.scoreMember())
+		count--
+	}
+
+	return members
+}
+
+// byRank - узел с позицией rank, считая с единицы
+func (z *SortedSet) byRank(rank int) *zsetNode {
+	traversed, x := 0, z.header
+	for i := z.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && traversed+x.levels[i].span <= rank {
+			traversed += x.levels[i].span
+			x = x.levels[i].forward
+		}
+
+		if traversed == rank {
+			return x
+		}
+	}
+
+	return nil
+}
+
+func (z *SortedSet) insert(score float64, member string) {
+	var (
+		update [zsetMaxLevel]*zsetNode
+		rank   [zsetMaxLevel]int
+	)
+
+	x := z.header
+	for i := z.level - 1; i >= 0; i-- {
+		if i < z.level-1 {
+			rank[i] = rank[i+1]
+		}
+
+		for next := x.levels[i].forward; next != nil && zsetLess(next.score, next.member, score, member); next = x.levels[i].forward {
+			rank[i] += x.levels[i].span
+			x = next
+		}
+		update[i] = x
+	}
+
+	level := zsetRandomLevel()
+	if level > z.level {
+		for i := z.level; i < level; i++ {
+			update[i] = z.header
+			update[i].levels[i].span = z.Len()
+		}
+		z.level = level
+	}
+
+	x = &zsetNode{member: member, score: score, levels: make([]zsetLevel, level)}
+	for i := range level {
+		x.levels[i].forward = update[i].levels[i].forward
+		update[i].levels[i].forward = x
+
+		x.levels[i].span = update[i].levels[i].span - (rank[0] - rank[i])
+		update[i].levels[i].span = rank[0] - rank[i] + 1
+	}
+
+	for i := level; i < z.level; i++ {
+		update[i].levels[i].span++
+	}
+
+	if update[0] != z.header {
+		x.backward = update[0]
+	}
+
+	if x.levels[0].forward != nil {
+		x.levels[0].forward.backward = x
+	}
+}
+
+func (z *SortedSet) delete(score float64, member string) {
+	var update [zsetMaxLevel]*zsetNode
+
+	x := z.header
+	for i := z.level - 1; i >= 0; i-- {
+		for next := x.levels[i].forward; next != nil && zsetLess(next.score, next.member, score, member); next = x.levels[i].forward {
+			x = next
+		}
+		update[i] = x
+	}
+
+	x = x.levels[0].forward
+	for i := range z.level {
+		if update[i].levels[i].forward == x {
+			update[i].levels[i].span += x.levels[i].span - 1
+			update[i].levels[i].forward = x.levels[i].forward
+		} else {
+			update[i].levels[i].span--
+		}
+	}
+
+	if x.levels[0].forward != nil {
+		x.levels[0].forward.backward = x.backward
+	}
+
+	for z.level > 1 && z.header.levels[z.level-1].forward == nil {
+		z.level--
+	}
+}
+
+func (x *zsetNode) scoreMember() compute.ScoreMember {
+	return compute.ScoreMember{Score: x.score, Member: x.member}
+}
+
+// zsetLess - стоит ли элемент (score1, member1) раньше (score2, member2)
+func zsetLess(score1 float64, member1 string, score2 float64, member2 string) bool {
+	return score1 < score2 || (score1 == score2 && member1 < member2)
+}
+
+func zsetRandomLevel() int {
+	level := 1
+	for level < zsetMaxLevel && rand.Float64() < zsetLevelP {
+		level++
+	}
+
+	return level
+}
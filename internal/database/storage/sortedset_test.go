@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"cmp"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSortedSet(t *testing.T) {
+	z := NewSortedSet()
+	scores := make(map[string]float64)
+
+	// случайные добавления, обновления и удаления сверяются с отсортированным срезом
+	rnd := rand.New(rand.NewPCG(1, 2))
+	for range 5000 {
+		member := strconv.Itoa(rnd.IntN(300))
+		if rnd.IntN(4) == 0 {
+			_, exists := scores[member]
+			assert.Equal(t, exists, z.Remove(member))
+			delete(scores, member)
+			continue
+		}
+
+		score := float64(rnd.IntN(50))
+		_, exists := scores[member]
+		assert.Equal(t, !exists, z.Add(member, score))
+		scores[member] = score
+	}
+
+	want := make([]compute.ScoreMember, 0, len(scores))
+	for member, score := range scores {
+		want = append(want, compute.ScoreMember{Score: score, Member: member})
+	}
+	slices.SortFunc(want, func(a, b compute.ScoreMember) int {
+		return cmp.Or(cmp.Compare(a.Score, b.Score), cmp.Compare(a.Member, b.Member))
+	})
+
+	require.Equal(t, len(want), z.Len())
+	assert.Equal(t, want, z.Members())
+	for i, m := range want {
+		rank, ok := z.Rank(m.Member)
+		require.True(t, ok)
+		assert.Equal(t, i, rank)
+	}
+
+	assert.Equal(t, want[3:6], z.RangeByRank(3, 5, false))
+	assert.Equal(t, []compute.ScoreMember{want[len(want)-1], want[len(want)-2]}, z.RangeByRank(0, 1, true))
+	assert.Empty(t, z.RangeByRank(5, 3, false))
+
+	var inRange []compute.ScoreMember
+	for _, m := range want {
+		if m.Score > 10 && m.Score <= 20 {
+			inRange = append(inRange, m)
+		}
+	}
+
+	lo, hi := compute.ScoreBound{Value: 10, Exclusive: true}, compute.ScoreBound{Value: 20}
+	assert.Equal(t, inRange, z.RangeByScore(lo, hi, false, 0, -1))
+	assert.Equal(t, inRange[2:4], z.RangeByScore(lo, hi, false, 2, 2))
+
+	reversed := slices.Clone(inRange)
+	slices.Reverse(reversed)
+	assert.Equal(t, reversed, z.RangeByScore(lo, hi, true, 0, -1))
+
+	popped := z.Pop(2, true)
+	assert.Equal(t, []compute.ScoreMember{want[len(want)-1], want[len(want)-2]}, popped)
+	assert.Equal(t, len(want)-2, z.Len())
+}
+
+func TestSortedSet_RangeByLex(t *testing.T) {
+	z := NewSortedSet()
+	for _, member := range []string{"a", "b", "c", "d", "e"} {
+		z.Add(member, 0)
+	}
+
+	members := func(list []compute.ScoreMember) []string {
+		values := make([]string, 0, len(list))
+		for _, m := range list {
+			values = append(values, m.Member)
+		}
+
+		return values
+	}
+
+	assert.Equal(t, []string{"b", "c"}, members(z.RangeByLex(compute.LexBound{Value: "b"}, compute.LexBound{Value: "d", Exclusive: true}, false, 0, -1)))
+	assert.Equal(t, []string{"e", "d"}, members(z.RangeByLex(compute.LexBound{Value: "c", Exclusive: true}, compute.LexBound{Inf: 1}, true, 0, -1)))
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, members(z.RangeByLex(compute.LexBound{Inf: -1}, compute.LexBound{Inf: 1}, false, 0, -1)))
+	assert.Empty(t, z.RangeByLex(compute.LexBound{Inf: 1}, compute.LexBound{Inf: -1}, false, 0, -1))
+}
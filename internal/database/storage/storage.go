@@ -2,62 +2,318 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
 	"github.com/TimonKK/inmemory-db/internal/database/compute"
+	"github.com/TimonKK/inmemory-db/internal/utils"
 	"go.uber.org/zap"
 )
 
+var (
+	ErrUnknownRecord = errors.New("unknown wal record")
+	ErrNoWAL         = errors.New("wal is disabled")
+)
+
+// keysScanCount - размер порции, которой KEYS обходит движок
+const keysScanCount = 1000
+
 type Engine interface {
 	Get(context.Context, string) (string, error)
 	Set(context.Context, string, string) error
 	Delete(context.Context, string) error
+	// Iterate - обход по порядку ключей. Движки без упорядочивания возвращают ErrIterationUnsupported
+	Iterate(context.Context, IterOptions) (Iterator, error)
+	// Scan - часть ключей начиная с курсора. Курсор "0" начинает обход, возвращенный "0" его заканчивает.
+	// Состояние обхода на сервере не хранится, блокировка берется только на одну порцию
+	Scan(ctx context.Context, cursor string, count int) (string, []string, error)
+	// ScanExpired - истекшие к моменту now ключи среди примерно count ключей после курсора. Курсор как у Scan,
+	// count ограничивает число просмотренных ключей, поэтому ответ бывает пустым и при ненулевом курсоре
+	ScanExpired(ctx context.Context, cursor string, count int, now int64) (string, []string, error)
+	// Len - число живых ключей, истекшие не считаются
+	Len(context.Context) (int, error)
+	// Update - выполняет fn под блокировкой записи движка
+	Update(context.Context, func(Tx) error) error
+	// View - выполняет fn под блокировкой чтения, запись внутри возвращает ErrReadOnlyTx
+	View(context.Context, func(Tx) error) error
 }
 
 type WAL interface {
 	Start(context.Context) error
-	LoadRecords() ([]compute.Query, error)
+	LoadRecords() ([]compute.Record, error)
 	Push(string) error
+	// Append - ставит запись в очередь, не дожидаясь записи на диск
+	Append(string) utils.Promise[error]
+	// Tail - записи с номером не меньше from, сначала записанные, затем новые по мере записи на диск
+	Tail(ctx context.Context, from uint64, fn func(seq uint64, record compute.Record) error) error
 }
 
 type Storage struct {
-	engine Engine
-	wal    WAL
-	logger *zap.Logger
+	engine   Engine
+	wal      WAL
+	blocked  *blockedClients
+	notifier *Notifier
+	logger   *zap.Logger
+	// seq - число записей WAL, изменения которых применены к движку. Меняется под блокировкой записи движка
+	seq uint64
+
+	// expireCursor - где продолжит активное удаление истекших ключей, меняется только в его горутине
+	expireCursor string
+	stopExpire   context.CancelFunc
+	expireDone   chan struct{}
 }
 
-func NewStorage(engine Engine, wal WAL, logger *zap.Logger) (*Storage, error) {
+// NewStorage - notifier может быть nil, тогда уведомления об изменениях ключей не отправляются
+func NewStorage(engine Engine, wal WAL, notifier *Notifier, logger *zap.Logger) (*Storage, error) {
 	storage := Storage{
-		engine: engine,
-		wal:    wal,
-		logger: logger,
+		engine:   engine,
+		wal:      wal,
+		blocked:  newBlockedClients(),
+		notifier: notifier,
+		logger:   logger,
 	}
 
 	return &storage, nil
 }
 
-func (s *Storage) setData(ctx context.Context, records []compute.Query) error {
-	var err error
-	for _, query := range records {
-		switch query.CommandId() {
-		case compute.SetCommandId:
-			err = s.engine.Set(ctx, query.Key(), query.Value())
-		case compute.DeleteCommandId:
-			err = s.engine.Delete(ctx, query.Key())
+// setData - повторяет записи WAL. Каждая выполняется во время исходной записи,
+// поэтому проверки сроков жизни дают тот же результат
+func (s *Storage) setData(ctx context.Context, records []compute.Record) error {
+	for _, record := range records {
+		err := s.engine.Update(WithTxTime(ctx, record.Timestamp), func(tx Tx) error {
+			if err := applyRecord(tx, record.Query); err != nil {
+				return err
+			}
+
+			s.seq++
+			return s.checkpoint(tx)
+		})
+
+		if err != nil {
+			return err
 		}
+	}
 
+	return nil
+}
+
+// checkpoint - сообщает движку, сколько записей WAL уже применено. Вызывается внутри транзакции движка
+func (s *Storage) checkpoint(tx Tx) error {
+	if cpTx, ok := tx.(CheckpointTx); ok {
+		return cpTx.SetCheckpoint(s.seq)
+	}
+
+	return nil
+}
+
+// applyRecord - применяет запись WAL. В WAL пишется уже итоговое изменение, а не исходная команда,
+// поэтому повтор не зависит от состояния на момент записи
+func applyRecord(tx Tx, record compute.Query) error {
+	switch record.CommandId() {
+	case compute.SetCommandId:
+		// в WAL у SET бывает только абсолютный срок PXAT
+		entry := NewEntry(record.Value())
+		entry.ExpireAt = record.SetOptions().Expire.Resolve(tx.Now(), 0)
+
+		return tx.Set(record.Key(), entry)
+	case compute.MSetCommandId:
+		for _, pair := range record.Pairs() {
+			if err := tx.Set(pair[0], NewEntry(pair[1])); err != nil {
+				return err
+			}
+		}
+	case compute.PExpireAtCommandId:
+		entry, err := tx.Get(record.Key())
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		expireAt, err := strconv.ParseInt(record.Value(), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrUnknownRecord, record.String())
+		}
+		entry.ExpireAt = expireAt
+
+		return tx.Set(record.Key(), entry)
+	case compute.DeleteCommandId, compute.MDelCommandId:
+		for _, key := range record.Args() {
+			if err := tx.Delete(key); err != nil {
+				return err
+			}
+		}
+	case compute.RenameCommandId, compute.CopyCommandId:
+		src, dst := record.Key(), record.Value()
+		entry, err := tx.Get(src)
+		if err != nil {
+			return err
+		}
+
+		if src == dst {
+			return nil
+		}
+
+		// у составных значений свой объект на каждый ключ, иначе изменение копии поменяет и исходный ключ
+		if record.CommandId() == compute.CopyCommandId {
+			entry = entry.Clone()
+		}
+
+		if err := tx.Set(dst, entry); err != nil {
+			return err
+		}
+
+		if record.CommandId() == compute.RenameCommandId {
+			return tx.Delete(src)
+		}
+	case compute.RestoreCommandId:
+		entry, err := DecodeDump(record.RestoreOptions().Payload)
 		if err != nil {
 			return err
 		}
+
+		return tx.Set(record.Key(), entry)
+	case compute.FlushDBCommandId:
+		return tx.Clear()
+	case compute.AppendCommandId, compute.SetRangeCommandId:
+		return applyStringRecord(tx, record)
+	case compute.LPushCommandId, compute.RPushCommandId, compute.LPopCommandId, compute.RPopCommandId, compute.LTrimCommandId:
+		_, err := applyListRecord(tx, record)
+		return err
+	case compute.LMoveCommandId:
+		_, err := applyMoveRecord(tx, record)
+		return err
+	case compute.HSetCommandId, compute.HDelCommandId, compute.HIncrByCommandId, compute.HPExpireAtCommandId:
+		_, err := applyHashRecord(tx, record)
+		return err
+	case compute.SAddCommandId, compute.SRemCommandId,
+		compute.SInterStoreCommandId, compute.SUnionStoreCommandId, compute.SDiffStoreCommandId:
+		_, err := applySetRecord(tx, record)
+		return err
+	case compute.ZAddCommandId, compute.ZIncrByCommandId, compute.ZRemCommandId,
+		compute.ZPopMinCommandId, compute.ZPopMaxCommandId, compute.ZRangeStoreCommandId:
+		_, err := applySortedSetRecord(tx, record)
+		return err
+	case compute.XAddCommandId, compute.XGroupCommandId, compute.XReadGroupCommandId,
+		compute.XAckCommandId, compute.XClaimCommandId:
+		return applyStreamRecord(tx, record)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownRecord, record.String())
 	}
 
-	return err
+	return nil
 }
 
-func (s *Storage) pushToWal(query compute.Query) error {
-	if s.wal == nil {
-		return nil
+// update - выполняет fn в транзакции движка. Записи, которые вернул fn, ставятся в очередь WAL под той же
+// блокировкой, поэтому порядок в WAL совпадает с порядком применения. Ответ - после записи WAL на диск.
+// Добавленные в списки элементы в той же транзакции отдаются заблокированным клиентам, те получают их тоже
+// после записи WAL. После нее же отправляются уведомления об изменениях ключей.
+// Истекшие ключи, которые транзакция удалила при чтении, пишутся в WAL как DEL, даже если fn вернул ошибку
+func (s *Storage) update(ctx context.Context, fn func(Tx) ([]compute.Query, error)) error {
+	var (
+		promises = make([]utils.Promise[error], 0, 1)
+		wakeups  []wakeup
+		events   []keyEvent
+		expired  []string
+	)
+
+	ctx = WithExpireHook(ctx, func(key string) {
+		expired = append(expired, key)
+	})
+
+	err := s.engine.Update(ctx, func(tx Tx) error {
+		records, err := fn(tx)
+		if err != nil {
+			records = nil
+		} else {
+			// обслуженные до ошибки элементы уже сняты, их записи тоже должны попасть в WAL
+			var served []compute.Query
+			served, wakeups, err = s.serveBlocked(tx, records)
+			records = append(records, served...)
+		}
+
+		if s.notifier.active(notifyAll) {
+			for _, key := range expired {
+				events = append(events, keyEvent{class: notifyExpired, event: "expired", key: key})
+			}
+			for _, query := range records {
+				events = append(events, recordEvents(query)...)
+			}
+		}
+
+		// ключ удаляется по сроку до того, как транзакция пишет в него новое значение, поэтому удаления идут первыми
+		if len(expired) > 0 {
+			deletes := make([]compute.Query, 0, len(expired)+len(records))
+			for _, key := range expired {
+				deletes = append(deletes, compute.NewQuery(compute.DeleteCommandId, []string{key}))
+			}
+			records = append(deletes, records...)
+		}
+
+		if s.wal != nil {
+			for _, query := range records {
+				record := compute.NewRecord(query, tx.Now())
+				promises = append(promises, s.wal.Append(record.String()))
+			}
+
+			if len(records) > 0 {
+				s.seq += uint64(len(records))
+				err = errors.Join(err, s.checkpoint(tx))
+			}
+		}
+
+		return err
+	})
+
+	var walErr error
+	for _, p := range promises {
+		if err := p.Get(); err != nil && walErr == nil {
+			walErr = err
+		}
+	}
+
+	for _, w := range wakeups {
+		if w.result.err == nil {
+			w.result.err = walErr
+		}
+		w.client.result <- w.result
+	}
+
+	if walErr == nil {
+		s.notifier.publish(events)
 	}
 
-	return s.wal.Push(query.String())
+	return errors.Join(err, walErr)
+}
+
+// view - выполняет fn в транзакции движка на чтение. Найденные ею истекшие ключи под блокировкой чтения
+// удалить нельзя, они удаляются сразу после нее: с записью в WAL и уведомлением expired
+func (s *Storage) view(ctx context.Context, fn func(Tx) error) error {
+	var expired []string
+	err := s.engine.View(WithExpireHook(ctx, func(key string) {
+		expired = append(expired, key)
+	}), fn)
+
+	if len(expired) > 0 {
+		if err := s.deleteExpired(ctx, expired); err != nil {
+			s.logger.Warn("failed to delete expired keys", zap.Error(err))
+		}
+	}
+
+	return err
+}
+
+// write - безусловная запись: команда сама является записью WAL
+func (s *Storage) write(ctx context.Context, query compute.Query) error {
+	return s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		if err := applyRecord(tx, query); err != nil {
+			return nil, err
+		}
+
+		return []compute.Query{query}, nil
+	})
 }
 
 func (s *Storage) Start(ctx context.Context) error {
@@ -66,6 +322,7 @@ func (s *Storage) Start(ctx context.Context) error {
 	}
 
 	if s.wal == nil {
+		s.startExpire(ctx)
 		return nil
 	}
 
@@ -75,12 +332,34 @@ func (s *Storage) Start(ctx context.Context) error {
 	}
 	s.logger.Info("loading records", zap.Int("records", len(records)))
 
+	// движок с данными на диске уже содержит изменения первых записей, повторять их нельзя:
+	// APPEND, LPUSH, HINCRBY и подобные применились бы дважды
+	if cp, ok := s.engine.(Checkpointer); ok {
+		checkpoint, total := cp.Checkpoint(), uint64(len(records))
+		if checkpoint > total {
+			s.logger.Warn("engine is ahead of wal", zap.Uint64("checkpoint", checkpoint), zap.Uint64("records", total))
+			if err := cp.SetCheckpoint(total); err != nil {
+				return err
+			}
+			checkpoint = total
+		}
+
+		s.logger.Info("skipping records already in engine", zap.Uint64("checkpoint", checkpoint))
+		records, s.seq = records[checkpoint:], checkpoint
+	}
+
 	err = s.setData(ctx, records)
 	if err != nil {
 		return err
 	}
 
-	return s.wal.Start(ctx)
+	if err := s.wal.Start(ctx); err != nil {
+		return err
+	}
+
+	s.startExpire(ctx)
+
+	return nil
 }
 
 func (s *Storage) Get(ctx context.Context, query compute.Query) (string, error) {
@@ -88,31 +367,540 @@ func (s *Storage) Get(ctx context.Context, query compute.Query) (string, error)
 		return "", ctx.Err()
 	}
 
-	return s.engine.Get(ctx, query.Key())
+	var value string
+	err := s.view(ctx, func(tx Tx) error {
+		entry, err := getString(tx, query.Key())
+		value = entry.Value
+
+		return err
+	})
+
+	return value, err
+}
+
+// SetResult - результат SET с параметрами
+type SetResult struct {
+	// Written - false, если не выполнилось условие NX или XX
+	Written bool
+	// Old - прежнее значение, заполняется для SET ... GET
+	Old   string
+	Found bool
 }
 
-func (s *Storage) Set(ctx context.Context, query compute.Query) error {
+// Set - SET key value [NX|XX] [GET] [EX|PX|EXAT|PXAT|KEEPTTL]. Проверка условия и запись атомарны,
+// в WAL пишется итоговое значение с абсолютным сроком жизни
+func (s *Storage) Set(ctx context.Context, query compute.Query) (SetResult, error) {
 	if ctx.Err() != nil {
-		return ctx.Err()
+		return SetResult{}, ctx.Err()
 	}
 
-	err := s.pushToWal(query)
+	opts := query.SetOptions()
+
+	var result SetResult
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		old, err := tx.Get(query.Key())
+		if err != nil && !errors.Is(err, ErrKeyNotFound) {
+			return nil, err
+		}
+		found := err == nil
+
+		if opts.Get {
+			if found && old.Type() != TypeString {
+				return nil, ErrWrongType
+			}
+
+			result.Old, result.Found = old.Value, found
+		}
+
+		if (opts.NX && found) || (opts.XX && !found) {
+			return nil, nil
+		}
+
+		record := setRecord(query.Key(), query.Value(), opts.Expire.Resolve(tx.Now(), old.ExpireAt))
+		if err := applyRecord(tx, record); err != nil {
+			return nil, err
+		}
+		result.Written = true
+
+		return []compute.Query{record}, nil
+	})
+
+	return result, err
+}
+
+// GetSet - записывает значение и возвращает прежнее, ErrKeyNotFound если его не было
+func (s *Storage) GetSet(ctx context.Context, query compute.Query) (string, error) {
+	result, err := s.Set(ctx, compute.NewQuery(compute.SetCommandId, []string{query.Key(), query.Value(), compute.GetOption}))
 	if err != nil {
+		return "", err
+	}
+
+	if !result.Found {
+		return "", ErrKeyNotFound
+	}
+
+	return result.Old, nil
+}
+
+// GetDel - читает и удаляет ключ одной операцией
+func (s *Storage) GetDel(ctx context.Context, query compute.Query) (string, error) {
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	var value string
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		entry, err := getString(tx, query.Key())
+		if err != nil {
+			return nil, err
+		}
+		value = entry.Value
+
+		record := compute.NewQuery(compute.DeleteCommandId, []string{query.Key()})
+		if err := applyRecord(tx, record); err != nil {
+			return nil, err
+		}
+
+		return []compute.Query{record}, nil
+	})
+
+	return value, err
+}
+
+// GetEx - читает ключ и меняет его срок жизни одной операцией
+func (s *Storage) GetEx(ctx context.Context, query compute.Query) (string, error) {
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	expire := query.GetExOptions()
+
+	var value string
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		entry, err := getString(tx, query.Key())
+		if err != nil {
+			return nil, err
+		}
+		value = entry.Value
+
+		expireAt := expire.Resolve(tx.Now(), entry.ExpireAt)
+		if expireAt == entry.ExpireAt {
+			return nil, nil
+		}
+
+		record := compute.NewQuery(compute.PExpireAtCommandId, []string{query.Key(), strconv.FormatInt(expireAt, 10)})
+		if err := applyRecord(tx, record); err != nil {
+			return nil, err
+		}
+
+		return []compute.Query{record}, nil
+	})
+
+	return value, err
+}
+
+// TTL - оставшееся время жизни ключа в миллисекундах, -1 - бессрочный ключ
+func (s *Storage) TTL(ctx context.Context, query compute.Query) (int64, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var ttl int64
+	err := s.view(ctx, func(tx Tx) error {
+		entry, err := tx.Get(query.Key())
+		if err != nil {
+			return err
+		}
+
+		ttl = -1
+		if entry.ExpireAt != 0 {
+			ttl = entry.ExpireAt - tx.Now()
+		}
+
+		return nil
+	})
+
+	return ttl, err
+}
+
+// Exists - сколько из перечисленных ключей существует, повторы считаются столько раз, сколько указаны
+func (s *Storage) Exists(ctx context.Context, query compute.Query) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var count int
+	err := s.view(ctx, func(tx Tx) error {
+		for _, key := range query.Args() {
+			_, err := tx.Get(key)
+			if errors.Is(err, ErrKeyNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			count++
+		}
+
+		return nil
+	})
+
+	return count, err
+}
+
+// Rename - переносит значение вместе со сроком жизни на новый ключ, перезаписывая его.
+// ErrKeyNotFound, если исходного ключа нет
+func (s *Storage) Rename(ctx context.Context, query compute.Query) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		if err := applyRecord(tx, query); err != nil {
+			return nil, err
+		}
+
+		return []compute.Query{query}, nil
+	})
+}
+
+// Copy - COPY src dst [REPLACE]. Без REPLACE существующий dst не перезаписывается. Возвращает, было ли копирование
+func (s *Storage) Copy(ctx context.Context, query compute.Query) (bool, error) {
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+
+	var copied bool
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		if _, err := tx.Get(query.Key()); err != nil {
+			if errors.Is(err, ErrKeyNotFound) {
+				return nil, nil
+			}
+
+			return nil, err
+		}
+
+		_, err := tx.Get(query.Value())
+		if err != nil && !errors.Is(err, ErrKeyNotFound) {
+			return nil, err
+		}
+
+		if err == nil && !query.CopyReplace() {
+			return nil, nil
+		}
+
+		// в WAL копирование уже безусловное
+		record := compute.NewQuery(compute.CopyCommandId, []string{query.Key(), query.Value()})
+		if err := applyRecord(tx, record); err != nil {
+			return nil, err
+		}
+		copied = true
+
+		return []compute.Query{record}, nil
+	})
+
+	return copied, err
+}
+
+// Type - тип значения ключа, ErrKeyNotFound если ключа нет
+func (s *Storage) Type(ctx context.Context, query compute.Query) (string, error) {
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	var valueType ValueType
+	err := s.view(ctx, func(tx Tx) error {
+		entry, err := tx.Get(query.Key())
+		valueType = entry.Type()
+
 		return err
+	})
+
+	return valueType.String(), err
+}
+
+// FlushDB - удаляет все ключи. В WAL пишется одна запись, а не удаление каждого ключа
+func (s *Storage) FlushDB(ctx context.Context, query compute.Query) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return s.write(ctx, query)
+}
+
+// getString - строковая запись ключа, ErrWrongType если по ключу лежит значение другого типа
+func getString(tx Tx, key string) (Entry, error) {
+	entry, err := tx.Get(key)
+	if err != nil {
+		return Entry{}, err
 	}
 
-	return s.engine.Set(ctx, query.Key(), query.Value())
+	if entry.Type() != TypeString {
+		return Entry{}, ErrWrongType
+	}
+
+	return entry, nil
 }
 
+// setRecord - запись WAL для SET с уже вычисленным абсолютным сроком жизни
+func setRecord(key, value string, expireAt int64) compute.Query {
+	args := []string{key, value}
+	if expireAt != 0 {
+		args = append(args, compute.PXATOption, strconv.FormatInt(expireAt, 10))
+	}
+
+	return compute.NewQuery(compute.SetCommandId, args)
+}
+
+// Changes - лента изменений CDC: вызывает fn для записей WAL начиная с from, пока fn не вернет ошибку
+// или не отменится ctx
+func (s *Storage) Changes(ctx context.Context, from uint64, fn func(compute.Change) error) error {
+	if s.wal == nil {
+		return ErrNoWAL
+	}
+
+	return s.wal.Tail(ctx, from, func(seq uint64, record compute.Record) error {
+		return fn(compute.NewChange(seq, record))
+	})
+}
+
+// Delete - удаляет ключ. Отсутствующий ключ в WAL не пишется
 func (s *Storage) Delete(ctx context.Context, query compute.Query) error {
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
 
-	err := s.pushToWal(query)
+	return s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		if _, err := tx.Get(query.Key()); err != nil {
+			if errors.Is(err, ErrKeyNotFound) {
+				return nil, nil
+			}
+
+			return nil, err
+		}
+
+		if err := applyRecord(tx, query); err != nil {
+			return nil, err
+		}
+
+		return []compute.Query{query}, nil
+	})
+}
+
+// MGet - значения нескольких ключей на один момент времени. Отсутствующие ключи и ключи не строкового типа пропускаются
+func (s *Storage) MGet(ctx context.Context, query compute.Query) ([]KeyValue, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	pairs := make([]KeyValue, 0, len(query.Args()))
+	err := s.view(ctx, func(tx Tx) error {
+		for _, key := range query.Args() {
+			entry, err := tx.Get(key)
+			if errors.Is(err, ErrKeyNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			if entry.Type() != TypeString {
+				continue
+			}
+
+			pairs = append(pairs, KeyValue{Key: key, Value: entry.Value})
+		}
+
+		return nil
+	})
+
+	return pairs, err
+}
+
+// MSet - атомарная запись нескольких ключей одной записью WAL
+func (s *Storage) MSet(ctx context.Context, query compute.Query) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return s.write(ctx, query)
+}
+
+// MSetNX - как MSet, но только если ни одного из ключей нет. Возвращает, была ли запись
+func (s *Storage) MSetNX(ctx context.Context, query compute.Query) (bool, error) {
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+
+	var written bool
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		for _, pair := range query.Pairs() {
+			_, err := tx.Get(pair[0])
+			if err == nil {
+				return nil, nil
+			}
+			if !errors.Is(err, ErrKeyNotFound) {
+				return nil, err
+			}
+		}
+
+		record := compute.NewQuery(compute.MSetCommandId, query.Args())
+		if err := applyRecord(tx, record); err != nil {
+			return nil, err
+		}
+		written = true
+
+		return []compute.Query{record}, nil
+	})
+
+	return written, err
+}
+
+// MDel - удаляет ключи и возвращает, сколько из них существовало
+func (s *Storage) MDel(ctx context.Context, query compute.Query) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var deleted []string
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		for _, key := range query.Args() {
+			_, err := tx.Get(key)
+			if errors.Is(err, ErrKeyNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			if err := tx.Delete(key); err != nil {
+				return nil, err
+			}
+			deleted = append(deleted, key)
+		}
+
+		if len(deleted) == 0 {
+			return nil, nil
+		}
+
+		return []compute.Query{compute.NewQuery(compute.MDelCommandId, deleted)}, nil
+	})
+
+	return len(deleted), err
+}
+
+// Range - ключи из [start, end] по порядку, RANGE start end [LIMIT n] [REV]
+func (s *Storage) Range(ctx context.Context, query compute.Query) ([]KeyValue, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	args, opts := query.Args(), query.RangeOptions()
+
+	return s.iterate(ctx, IterOptions{Start: args[0], End: args[1] + "\x00", Reverse: opts.Reverse}, opts.Limit)
+}
+
+// Prefix - ключи с префиксом по порядку, PREFIX prefix [LIMIT n] [REV]
+func (s *Storage) Prefix(ctx context.Context, query compute.Query) ([]KeyValue, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	opts := query.RangeOptions()
+
+	return s.iterate(ctx, IterOptions{Start: query.Key(), End: PrefixEnd(query.Key()), Reverse: opts.Reverse}, opts.Limit)
+}
+
+func (s *Storage) iterate(ctx context.Context, opts IterOptions, limit int) ([]KeyValue, error) {
+	if opts.End != "" && opts.Start >= opts.End {
+		return nil, nil
+	}
+
+	it, err := s.engine.Iterate(ctx, opts)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	defer func() {
+		if err := it.Close(); err != nil {
+			s.logger.Warn("failed to close iterator", zap.Error(err))
+		}
+	}()
+
+	pairs := make([]KeyValue, 0)
+	for it.Next() {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		pairs = append(pairs, KeyValue{Key: it.Key(), Value: it.Value()})
+		if limit > 0 && len(pairs) == limit {
+			break
+		}
+	}
+
+	return pairs, it.Err()
+}
+
+// Scan - SCAN cursor [MATCH pattern] [COUNT n]. MATCH применяется к уже выбранной порции,
+// поэтому вызов может вернуть меньше ключей, чем COUNT, и даже ни одного при ненулевом курсоре
+func (s *Storage) Scan(ctx context.Context, query compute.Query) (string, []string, error) {
+	if ctx.Err() != nil {
+		return "", nil, ctx.Err()
+	}
+
+	opts := query.ScanOptions()
+	cursor, keys, err := s.engine.Scan(ctx, query.Key(), opts.Count)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return cursor, filterKeys(keys, opts.Match), nil
+}
+
+// Keys - все ключи по шаблону. Обходит всю базу, предназначен для небольших баз
+func (s *Storage) Keys(ctx context.Context, query compute.Query) ([]string, error) {
+	keys := make([]string, 0)
+
+	cursor := "0"
+	for {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		next, portion, err := s.engine.Scan(ctx, cursor, keysScanCount)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, filterKeys(portion, query.Key())...)
+		if next == "0" {
+			return keys, nil
+		}
+		cursor = next
+	}
+}
+
+func (s *Storage) DBSize(ctx context.Context) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	return s.engine.Len(ctx)
+}
+
+func filterKeys(keys []string, pattern string) []string {
+	if pattern == "" || pattern == "*" {
+		return keys
+	}
+
+	filtered := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if utils.MatchGlob(pattern, key) {
+			filtered = append(filtered, key)
+		}
 	}
 
-	return s.engine.Delete(ctx, query.Key())
+	return filtered
 }
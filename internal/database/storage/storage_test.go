@@ -0,0 +1,1216 @@
+package storage_test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TimonKK/inmemory-db/internal/config"
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+	"github.com/TimonKK/inmemory-db/internal/database/dataset"
+	"github.com/TimonKK/inmemory-db/internal/database/storage"
+	"github.com/TimonKK/inmemory-db/internal/database/storage/engine"
+	"github.com/TimonKK/inmemory-db/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// memoryWAL - WAL в памяти: записи сразу считаются записанными на диск
+type memoryWAL struct {
+	mu      sync.Mutex
+	records []string
+}
+
+func (w *memoryWAL) Start(context.Context) error {
+	return nil
+}
+
+func (w *memoryWAL) LoadRecords() ([]compute.Record, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	records := make([]compute.Record, 0, len(w.records))
+	for _, line := range w.records {
+		record, err := compute.NewRecordFromString(line)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// Tail - только уже записанные записи, новых не ждет
+func (w *memoryWAL) Tail(ctx context.Context, from uint64, fn func(seq uint64, record compute.Record) error) error {
+	records, err := w.LoadRecords()
+	if err != nil {
+		return err
+	}
+
+	for i, record := range records {
+		if seq := uint64(i + 1); seq >= from {
+			if err := fn(seq, record); err != nil {
+				return err
+			}
+		}
+	}
+
+	<-ctx.Done()
+
+	return ctx.Err()
+}
+
+// queries - записи без времени
+func (w *memoryWAL) queries(t *testing.T) []string {
+	t.Helper()
+
+	records, err := w.LoadRecords()
+	require.NoError(t, err)
+
+	queries := make([]string, 0, len(records))
+	for _, record := range records {
+		queries = append(queries, record.Query.String())
+	}
+
+	return queries
+}
+
+func (w *memoryWAL) Push(data string) error {
+	p := w.Append(data)
+	return p.Get()
+}
+
+func (w *memoryWAL) Append(data string) utils.Promise[error] {
+	w.mu.Lock()
+	w.records = append(w.records, data)
+	w.mu.Unlock()
+
+	p := utils.NewPromise[error]()
+	p.Set(nil)
+
+	return p
+}
+
+func newTestStorage(t *testing.T, wal *memoryWAL) *storage.Storage {
+	t.Helper()
+
+	s, err := storage.NewStorage(engine.NewMemoryEngine(), wal, nil, zap.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, s.Start(context.Background()))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// replayed - новое хранилище, восстановленное из WAL первого
+func replayed(t *testing.T, wal *memoryWAL) *storage.Storage {
+	t.Helper()
+
+	wal.mu.Lock()
+	defer wal.mu.Unlock()
+
+	return newTestStorage(t, &memoryWAL{records: slices.Clone(wal.records)})
+}
+
+func query(id compute.CommandId, args ...string) compute.Query {
+	return compute.NewQuery(id, args)
+}
+
+func TestStorage_MultiKey(t *testing.T) {
+	ctx := context.Background()
+	wal := &memoryWAL{}
+	s := newTestStorage(t, wal)
+
+	require.NoError(t, s.MSet(ctx, query(compute.MSetCommandId, "a", "1", "b", "2")))
+
+	written, err := s.MSetNX(ctx, query(compute.MSetNXCommandId, "b", "3", "c", "3"))
+	require.NoError(t, err)
+	assert.False(t, written)
+
+	written, err = s.MSetNX(ctx, query(compute.MSetNXCommandId, "c", "3", "d", "4"))
+	require.NoError(t, err)
+	assert.True(t, written)
+
+	deleted, err := s.MDel(ctx, query(compute.MDelCommandId, "a", "missing"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+
+	want := []storage.KeyValue{{Key: "b", Value: "2"}, {Key: "c", Value: "3"}, {Key: "d", Value: "4"}}
+
+	pairs, err := s.MGet(ctx, query(compute.MGetCommandId, "a", "b", "c", "d"))
+	require.NoError(t, err)
+	assert.Equal(t, want, pairs)
+
+	// в WAL только итоговые изменения: неудачный MSETNX не записан, MDEL - только с удаленным ключом
+	assert.Equal(t, []string{"MSET;a,1,b,2", "MSET;c,3,d,4", "MDEL;a"}, wal.queries(t))
+
+	pairs, err = replayed(t, wal).MGet(ctx, query(compute.MGetCommandId, "a", "b", "c", "d"))
+	require.NoError(t, err)
+	assert.Equal(t, want, pairs)
+}
+
+func TestStorage_ConditionalSet(t *testing.T) {
+	ctx := context.Background()
+	wal := &memoryWAL{}
+	s := newTestStorage(t, wal)
+
+	result, err := s.Set(ctx, query(compute.SetCommandId, "lock", "a", "NX", "PX", "60000"))
+	require.NoError(t, err)
+	assert.True(t, result.Written)
+
+	result, err = s.Set(ctx, query(compute.SetCommandId, "lock", "b", "NX", "GET"))
+	require.NoError(t, err)
+	assert.Equal(t, storage.SetResult{Written: false, Old: "a", Found: true}, result)
+
+	result, err = s.Set(ctx, query(compute.SetCommandId, "missing", "x", "XX"))
+	require.NoError(t, err)
+	assert.False(t, result.Written)
+
+	old, err := s.GetSet(ctx, query(compute.GetSetCommandId, "lock", "c"))
+	require.NoError(t, err)
+	assert.Equal(t, "a", old)
+
+	// GETSET снимает срок жизни, GETEX ставит новый
+	ttl, err := s.TTL(ctx, query(compute.TTLCommandId, "lock"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), ttl)
+
+	value, err := s.GetEx(ctx, query(compute.GetExCommandId, "lock", "PXAT", "1"))
+	require.NoError(t, err)
+	assert.Equal(t, "c", value)
+
+	_, err = s.Get(ctx, query(compute.GetCommandId, "lock"))
+	assert.ErrorIs(t, err, storage.ErrKeyNotFound)
+
+	require.NoError(t, s.MSet(ctx, query(compute.MSetCommandId, "k", "v")))
+	value, err = s.GetDel(ctx, query(compute.GetDelCommandId, "k"))
+	require.NoError(t, err)
+	assert.Equal(t, "v", value)
+
+	_, err = s.GetDel(ctx, query(compute.GetDelCommandId, "k"))
+	assert.ErrorIs(t, err, storage.ErrKeyNotFound)
+
+	// в WAL только сработавшие записи со сроками в абсолютном времени. Истекший ключ, найденный GET, удаляется
+	queries := wal.queries(t)
+	require.Len(t, queries, 6)
+	assert.Regexp(t, `^SET;lock,a,PXAT,\d+$`, queries[0])
+	assert.Equal(t, []string{"SET;lock,c", "PEXPIREAT;lock,1", "DEL;lock", "MSET;k,v", "DEL;k"}, queries[1:])
+
+	r := replayed(t, wal)
+	_, err = r.Get(ctx, query(compute.GetCommandId, "lock"))
+	assert.ErrorIs(t, err, storage.ErrKeyNotFound)
+	_, err = r.Get(ctx, query(compute.GetCommandId, "k"))
+	assert.ErrorIs(t, err, storage.ErrKeyNotFound)
+}
+
+func TestStorage_Keyspace(t *testing.T) {
+	ctx := context.Background()
+	wal := &memoryWAL{}
+	s := newTestStorage(t, wal)
+
+	require.NoError(t, s.MSet(ctx, query(compute.MSetCommandId, "tmp", "new", "live", "old")))
+
+	count, err := s.Exists(ctx, query(compute.ExistsCommandId, "tmp", "missing", "tmp"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	require.NoError(t, s.Rename(ctx, query(compute.RenameCommandId, "tmp", "live")))
+	assert.ErrorIs(t, s.Rename(ctx, query(compute.RenameCommandId, "tmp", "live")), storage.ErrKeyNotFound)
+
+	copied, err := s.Copy(ctx, query(compute.CopyCommandId, "live", "backup"))
+	require.NoError(t, err)
+	assert.True(t, copied)
+
+	copied, err = s.Copy(ctx, query(compute.CopyCommandId, "live", "backup"))
+	require.NoError(t, err)
+	assert.False(t, copied)
+
+	valueType, err := s.Type(ctx, query(compute.TypeCommandId, "backup"))
+	require.NoError(t, err)
+	assert.Equal(t, "string", valueType)
+
+	want := []storage.KeyValue{{Key: "live", Value: "new"}, {Key: "backup", Value: "new"}}
+	pairs, err := replayed(t, wal).MGet(ctx, query(compute.MGetCommandId, "tmp", "live", "backup"))
+	require.NoError(t, err)
+	assert.Equal(t, want, pairs)
+
+	require.NoError(t, s.FlushDB(ctx, query(compute.FlushDBCommandId)))
+	size, err := s.DBSize(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, size)
+
+	assert.Equal(t, []string{"MSET;tmp,new,live,old", "RENAME;tmp,live", "COPY;live,backup", "FLUSHDB;"}, wal.queries(t))
+
+	size, err = replayed(t, wal).DBSize(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, size)
+}
+
+// TestStorage_ReplayTime - повтор WAL выполняется во время исходной записи: ключ, живой в момент RENAME,
+// переносится и при повторе, даже если к моменту повтора его срок уже истек
+func TestStorage_ReplayTime(t *testing.T) {
+	ctx := context.Background()
+	wal := &memoryWAL{}
+	s := newTestStorage(t, wal)
+
+	require.NoError(t, s.MSet(ctx, query(compute.MSetCommandId, "dst", "old")))
+	_, err := s.Set(ctx, query(compute.SetCommandId, "src", "new", "PX", "50"))
+	require.NoError(t, err)
+	require.NoError(t, s.Rename(ctx, query(compute.RenameCommandId, "src", "dst")))
+
+	time.Sleep(60 * time.Millisecond)
+
+	// dst перезаписан истекающим значением, старое значение не должно вернуться
+	_, err = replayed(t, wal).Get(ctx, query(compute.GetCommandId, "dst"))
+	assert.ErrorIs(t, err, storage.ErrKeyNotFound)
+}
+
+// TestStorage_ActiveExpire - истекшие ключи удаляются в фоне, даже если к ним больше не обращаются,
+// а удаления пишутся в WAL
+func TestStorage_ActiveExpire(t *testing.T) {
+	ctx := context.Background()
+	wal := &memoryWAL{}
+	s := newTestStorage(t, wal)
+
+	for i := range 10 {
+		_, err := s.Set(ctx, query(compute.SetCommandId, fmt.Sprintf("session%d", i), "1", "PX", "10"))
+		require.NoError(t, err)
+	}
+	_, err := s.Set(ctx, query(compute.SetCommandId, "user", "bob"))
+	require.NoError(t, err)
+
+	size, err := s.DBSize(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 11, size)
+
+	require.Eventually(t, func() bool {
+		return slices.Contains(wal.queries(t), "DEL;session9")
+	}, time.Second, 10*time.Millisecond)
+
+	size, err = s.DBSize(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, size)
+
+	for i := range 10 {
+		assert.Contains(t, wal.queries(t), fmt.Sprintf("DEL;session%d", i))
+	}
+}
+
+// TestStorage_ExpiredWrite - ключ, истекший к моменту записи, удаляется в WAL раньше новой записи
+func TestStorage_ExpiredWrite(t *testing.T) {
+	ctx := context.Background()
+	wal := &memoryWAL{}
+	s := newTestStorage(t, wal)
+	s.Close()
+
+	_, err := s.Set(ctx, query(compute.SetCommandId, "log", "a", "PX", "10"))
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+
+	_, err = s.Append(ctx, query(compute.AppendCommandId, "log", "b"))
+	require.NoError(t, err)
+
+	queries := wal.queries(t)
+	require.Len(t, queries, 3)
+	assert.Equal(t, []string{"DEL;log", "APPEND;log,b"}, queries[1:])
+
+	value, err := replayed(t, wal).Get(ctx, query(compute.GetCommandId, "log"))
+	require.NoError(t, err)
+	assert.Equal(t, "b", value)
+}
+
+// TestStorage_RestartLSM - после перезапуска WAL повторяется только после checkpoint движка,
+// неидемпотентные записи не применяются второй раз
+func TestStorage_RestartLSM(t *testing.T) {
+	ctx := context.Background()
+	dir, crashed := t.TempDir(), t.TempDir()
+	wal := &memoryWAL{}
+
+	start := func(dir string) (*storage.Storage, *engine.LSMEngine) {
+		t.Helper()
+
+		e, err := engine.NewLSMEngine(config.LSMConfig{DataDirectory: dir, MemtableSize: 256, L0CompactionTrigger: 64}, zap.NewNop())
+		require.NoError(t, err)
+
+		s, err := storage.NewStorage(e, wal, nil, zap.NewNop())
+		require.NoError(t, err)
+		require.NoError(t, s.Start(ctx))
+
+		return s, e
+	}
+
+	s, e := start(dir)
+	_, err := s.Append(ctx, query(compute.AppendCommandId, "log", "ab"))
+	require.NoError(t, err)
+
+	// memtable сбрасывается в таблицы несколько раз
+	for i := range 30 {
+		_, err = s.Push(ctx, query(compute.RPushCommandId, "jobs", fmt.Sprint(i)))
+		require.NoError(t, err)
+		_, err = s.Set(ctx, query(compute.SetCommandId, fmt.Sprintf("key%02d", i), "value"))
+		require.NoError(t, err)
+	}
+
+	_, err = s.Append(ctx, query(compute.AppendCommandId, "log", "cd"))
+	require.NoError(t, err)
+
+	// копия до Close - как после падения: хвост изменений есть только в WAL
+	require.NoError(t, os.CopyFS(crashed, os.DirFS(dir)))
+	require.NoError(t, e.Close())
+
+	for _, dir := range []string{dir, crashed, dir} {
+		s, e := start(dir)
+
+		length, err := s.StrLen(ctx, query(compute.StrLenCommandId, "log"))
+		require.NoError(t, err)
+		assert.Equal(t, 4, length)
+
+		items, err := s.LRange(ctx, query(compute.LRangeCommandId, "jobs", "0", "-1"))
+		require.NoError(t, err)
+		assert.Len(t, items, 30)
+
+		require.NoError(t, e.Close())
+	}
+}
+
+// TestStorage_RestartBitcask - bitcask пишет изменения в файлы сразу, после перезапуска из WAL
+// повторяются только записи после его checkpoint, в том числе после слияния
+func TestStorage_RestartBitcask(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	wal := &memoryWAL{}
+
+	start := func(wal *memoryWAL) (*storage.Storage, *engine.BitcaskEngine) {
+		t.Helper()
+
+		e, err := engine.NewBitcaskEngine(config.BitcaskConfig{DataDirectory: dir, MaxFileSize: 256}, zap.NewNop())
+		require.NoError(t, err)
+
+		s, err := storage.NewStorage(e, wal, nil, zap.NewNop())
+		require.NoError(t, err)
+		require.NoError(t, s.Start(ctx))
+
+		return s, e
+	}
+
+	check := func(s *storage.Storage, length int, counter int64) {
+		t.Helper()
+
+		n, err := s.StrLen(ctx, query(compute.StrLenCommandId, "log"))
+		require.NoError(t, err)
+		assert.Equal(t, length, n)
+
+		value, err := s.HIncrBy(ctx, query(compute.HIncrByCommandId, "stats", "hits", "0"))
+		require.NoError(t, err)
+		assert.Equal(t, counter, value)
+	}
+
+	s, e := start(wal)
+	_, err := s.Append(ctx, query(compute.AppendCommandId, "log", "ab"))
+	require.NoError(t, err)
+	for i := range 20 {
+		_, err = s.HIncrBy(ctx, query(compute.HIncrByCommandId, "stats", "hits", "1"))
+		require.NoError(t, err)
+		_, err = s.Set(ctx, query(compute.SetCommandId, fmt.Sprintf("key%02d", i), "value"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, e.Merge())
+	require.NoError(t, e.Close())
+
+	s, e = start(wal)
+	check(s, 2, 20)
+	require.NoError(t, e.Close())
+
+	// последние записи не успели попасть в WAL: движок впереди, следующие записи WAL
+	// получают те же номера и не должны пропускаться
+	lost := &memoryWAL{records: wal.records[:len(wal.records)-2]}
+	s, e = start(lost)
+	check(s, 2, 20)
+	_, err = s.Append(ctx, query(compute.AppendCommandId, "log", "cd"))
+	require.NoError(t, err)
+	require.NoError(t, e.Close())
+
+	s, e = start(lost)
+	check(s, 4, 20)
+	require.NoError(t, e.Close())
+}
+
+func TestStorage_Strings(t *testing.T) {
+	ctx := context.Background()
+	wal := &memoryWAL{}
+	s := newTestStorage(t, wal)
+
+	length, err := s.Append(ctx, query(compute.AppendCommandId, "log", "Hello"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, length)
+
+	length, err = s.Append(ctx, query(compute.AppendCommandId, "log", "_World"))
+	require.NoError(t, err)
+	assert.Equal(t, 11, length)
+
+	length, err = s.SetRange(ctx, query(compute.SetRangeCommandId, "log", "6", "Redis"))
+	require.NoError(t, err)
+	assert.Equal(t, 11, length)
+
+	length, err = s.SetRange(ctx, query(compute.SetRangeCommandId, "pad", "2", "x"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, length)
+
+	// offset+len(value) не должен переполняться
+	for _, offset := range []string{strconv.Itoa(math.MaxInt64), strconv.Itoa(compute.MaxStringSize)} {
+		_, err = s.SetRange(ctx, query(compute.SetRangeCommandId, "huge", offset, "x"))
+		assert.ErrorIs(t, err, storage.ErrStringTooLong)
+	}
+
+	tests := []struct {
+		key        string
+		start, end string
+		want       string
+	}{
+		{key: "log", start: "0", end: "4", want: "Hello"},
+		{key: "log", start: "-5", end: "-1", want: "Redis"},
+		{key: "log", start: "0", end: "-1", want: "Hello_Redis"},
+		{key: "log", start: "-100", end: "100", want: "Hello_Redis"},
+		{key: "log", start: "5", end: "3", want: ""},
+		{key: "pad", start: "0", end: "-1", want: "\x00\x00x"},
+		{key: "missing", start: "0", end: "-1", want: ""},
+	}
+
+	for _, tt := range tests {
+		value, err := s.GetRange(ctx, query(compute.GetRangeCommandId, tt.key, tt.start, tt.end))
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, value, "%s %s %s", tt.key, tt.start, tt.end)
+	}
+
+	length, err = replayed(t, wal).StrLen(ctx, query(compute.StrLenCommandId, "log"))
+	require.NoError(t, err)
+	assert.Equal(t, 11, length)
+
+	// в WAL только изменения, а не значения целиком
+	assert.Equal(t, []string{"APPEND;log,Hello", "APPEND;log,_World", "SETRANGE;log,6,Redis", "SETRANGE;pad,2,x"}, wal.queries(t))
+}
+
+func TestStorage_Lists(t *testing.T) {
+	ctx := context.Background()
+	wal := &memoryWAL{}
+	s := newTestStorage(t, wal)
+
+	length, err := s.Push(ctx, query(compute.RPushCommandId, "jobs", "b", "c", "d"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, length)
+
+	length, err = s.Push(ctx, query(compute.LPushCommandId, "jobs", "a"))
+	require.NoError(t, err)
+	assert.Equal(t, 4, length)
+
+	values, err := s.Pop(ctx, query(compute.RPopCommandId, "jobs", "2"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"d", "c"}, values)
+
+	// снимается не больше, чем есть, пустой список удаляется
+	values, err = s.Pop(ctx, query(compute.LPopCommandId, "jobs", "10"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, values)
+
+	_, err = s.Pop(ctx, query(compute.LPopCommandId, "jobs"))
+	assert.ErrorIs(t, err, storage.ErrKeyNotFound)
+
+	_, err = s.Push(ctx, query(compute.RPushCommandId, "feed", "1", "2", "3", "4", "5"))
+	require.NoError(t, err)
+	require.NoError(t, s.LTrim(ctx, query(compute.LTrimCommandId, "feed", "1", "-2")))
+
+	_, err = s.Set(ctx, query(compute.SetCommandId, "name", "x"))
+	require.NoError(t, err)
+
+	_, err = s.Push(ctx, query(compute.LPushCommandId, "name", "a"))
+	assert.ErrorIs(t, err, storage.ErrWrongType)
+
+	_, err = s.Get(ctx, query(compute.GetCommandId, "feed"))
+	assert.ErrorIs(t, err, storage.ErrWrongType)
+
+	valueType, err := s.Type(ctx, query(compute.TypeCommandId, "feed"))
+	require.NoError(t, err)
+	assert.Equal(t, "list", valueType)
+
+	// копия списка не разделяет элементы с исходным
+	_, err = s.Copy(ctx, query(compute.CopyCommandId, "feed", "copy"))
+	require.NoError(t, err)
+	_, err = s.Pop(ctx, query(compute.LPopCommandId, "copy"))
+	require.NoError(t, err)
+
+	for _, st := range []*storage.Storage{s, replayed(t, wal)} {
+		values, err = st.LRange(ctx, query(compute.LRangeCommandId, "feed", "0", "-1"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"2", "3", "4"}, values)
+
+		value, err := st.LIndex(ctx, query(compute.LIndexCommandId, "copy", "-1"))
+		require.NoError(t, err)
+		assert.Equal(t, "4", value)
+
+		length, err = st.LLen(ctx, query(compute.LLenCommandId, "copy"))
+		require.NoError(t, err)
+		assert.Equal(t, 2, length)
+	}
+
+	assert.Equal(t, []string{
+		"RPUSH;jobs,b,c,d", "LPUSH;jobs,a", "RPOP;jobs,2", "LPOP;jobs,2",
+		"RPUSH;feed,1,2,3,4,5", "LTRIM;feed,1,-2", "SET;name,x", "COPY;feed,copy", "LPOP;copy,1",
+	}, wal.queries(t))
+}
+
+func TestStorage_BlockingPop(t *testing.T) {
+	ctx := context.Background()
+	wal := &memoryWAL{}
+	s := newTestStorage(t, wal)
+
+	// блокируются по очереди, чтобы порядок ожидания был известен
+	results := make([]chan storage.KeyValue, 2)
+	for i := range results {
+		results[i] = make(chan storage.KeyValue, 1)
+
+		go func() {
+			pair, err := s.BPop(ctx, query(compute.BLPopCommandId, "a", "jobs", "0"))
+			assert.NoError(t, err)
+			results[i] <- pair
+		}()
+
+		require.Eventually(t, func() bool {
+			return s.BlockedClients() == i+1
+		}, time.Second, time.Millisecond)
+	}
+
+	_, err := s.Push(ctx, query(compute.RPushCommandId, "jobs", "j1", "j2", "j3"))
+	require.NoError(t, err)
+
+	// первым получает элемент тот, кто дольше ждет
+	assert.Equal(t, storage.KeyValue{Key: "jobs", Value: "j1"}, <-results[0])
+	assert.Equal(t, storage.KeyValue{Key: "jobs", Value: "j2"}, <-results[1])
+	assert.Equal(t, 0, s.BlockedClients())
+
+	moved := make(chan string, 1)
+	go func() {
+		value, err := s.BLMove(ctx, query(compute.BLMoveCommandId, "src", "jobs", "RIGHT", "LEFT", "0"))
+		assert.NoError(t, err)
+		moved <- value
+	}()
+
+	require.Eventually(t, func() bool {
+		return s.BlockedClients() == 1
+	}, time.Second, time.Millisecond)
+
+	_, err = s.Push(ctx, query(compute.RPushCommandId, "src", "m"))
+	require.NoError(t, err)
+	assert.Equal(t, "m", <-moved)
+
+	_, err = s.BPop(ctx, query(compute.BRPopCommandId, "empty", "1"))
+	assert.ErrorIs(t, err, storage.ErrKeyNotFound)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	go cancel()
+	_, err = s.BPop(cancelled, query(compute.BRPopCommandId, "empty", "0"))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, s.BlockedClients())
+
+	for _, st := range []*storage.Storage{s, replayed(t, wal)} {
+		values, err := st.LRange(ctx, query(compute.LRangeCommandId, "jobs", "0", "-1"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"m", "j3"}, values)
+	}
+
+	assert.Equal(t, []string{
+		"RPUSH;jobs,j1,j2,j3", "LPOP;jobs,1", "LPOP;jobs,1", "RPUSH;src,m", "LMOVE;src,jobs,RIGHT,LEFT",
+	}, wal.queries(t))
+}
+
+func TestStorage_Hashes(t *testing.T) {
+	ctx := context.Background()
+	wal := &memoryWAL{}
+	s := newTestStorage(t, wal)
+
+	created, err := s.HSet(ctx, query(compute.HSetCommandId, "user", "name", "bob", "visits", "1", "city", "oslo"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, created)
+
+	created, err = s.HSet(ctx, query(compute.HSetCommandId, "user", "name", "alice"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, created)
+
+	visits, err := s.HIncrBy(ctx, query(compute.HIncrByCommandId, "user", "visits", "41"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), visits)
+
+	_, err = s.HIncrBy(ctx, query(compute.HIncrByCommandId, "user", "name", "1"))
+	assert.ErrorIs(t, err, storage.ErrNotInteger)
+
+	deleted, err := s.HDel(ctx, query(compute.HDelCommandId, "user", "city", "missing"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+
+	updated, err := s.HExpire(ctx, query(compute.HExpireCommandId, "user", "100", "visits", "missing"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, updated)
+
+	ttl, err := s.HTTL(ctx, query(compute.HTTLCommandId, "user", "visits"))
+	require.NoError(t, err)
+	assert.InDelta(t, 100_000, ttl, 1000)
+
+	// нулевой срок удаляет поле сразу
+	_, err = s.HSet(ctx, query(compute.HSetCommandId, "session", "token", "t1", "ip", "1"))
+	require.NoError(t, err)
+	_, err = s.HExpire(ctx, query(compute.HExpireCommandId, "session", "0", "token"))
+	require.NoError(t, err)
+
+	_, err = s.HGet(ctx, query(compute.HGetCommandId, "session", "token"))
+	assert.ErrorIs(t, err, storage.ErrKeyNotFound)
+
+	_, err = s.HGet(ctx, query(compute.HGetCommandId, "name", "x"))
+	assert.ErrorIs(t, err, storage.ErrKeyNotFound)
+
+	_, err = s.Set(ctx, query(compute.SetCommandId, "name", "x"))
+	require.NoError(t, err)
+	_, err = s.HSet(ctx, query(compute.HSetCommandId, "name", "f", "v"))
+	assert.ErrorIs(t, err, storage.ErrWrongType)
+
+	for _, st := range []*storage.Storage{s, replayed(t, wal)} {
+		pairs, err := st.HGetAll(ctx, query(compute.HGetAllCommandId, "user"))
+		require.NoError(t, err)
+		assert.Equal(t, []storage.KeyValue{{Key: "name", Value: "alice"}, {Key: "visits", Value: "42"}}, pairs)
+
+		length, err := st.HLen(ctx, query(compute.HLenCommandId, "session"))
+		require.NoError(t, err)
+		assert.Equal(t, 1, length)
+
+		valueType, err := st.Type(ctx, query(compute.TypeCommandId, "user"))
+		require.NoError(t, err)
+		assert.Equal(t, "hash", valueType)
+	}
+
+	cursor, pairs, err := s.HScan(ctx, query(compute.HScanCommandId, "user", "0", "COUNT", "1"))
+	require.NoError(t, err)
+	assert.Equal(t, "1", cursor)
+	assert.Equal(t, []storage.KeyValue{{Key: "name", Value: "alice"}}, pairs)
+
+	cursor, pairs, err = s.HScan(ctx, query(compute.HScanCommandId, "user", cursor, "COUNT", "1"))
+	require.NoError(t, err)
+	assert.Equal(t, "0", cursor)
+	assert.Equal(t, []storage.KeyValue{{Key: "visits", Value: "42"}}, pairs)
+
+	queries := wal.queries(t)
+	assert.Contains(t, queries, "HDEL;user,city")
+	assert.Contains(t, queries, "HINCRBY;user,visits,41")
+}
+
+func TestStorage_Sets(t *testing.T) {
+	ctx := context.Background()
+	wal := &memoryWAL{}
+	s := newTestStorage(t, wal)
+
+	added, err := s.SAdd(ctx, query(compute.SAddCommandId, "a", "1", "2", "3", "go"))
+	require.NoError(t, err)
+	assert.Equal(t, 4, added)
+
+	added, err = s.SAdd(ctx, query(compute.SAddCommandId, "b", "2", "3", "4", "2"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, added)
+
+	removed, err := s.SRem(ctx, query(compute.SRemCommandId, "b", "4", "missing"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	stored, err := s.SetStore(ctx, query(compute.SInterStoreCommandId, "common", "a", "b"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, stored)
+
+	// пустой результат удаляет dst, даже если там было значение другого типа
+	_, err = s.Set(ctx, query(compute.SetCommandId, "nothing", "x"))
+	require.NoError(t, err)
+	stored, err = s.SetStore(ctx, query(compute.SDiffStoreCommandId, "nothing", "b", "a"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, stored)
+
+	_, err = s.Get(ctx, query(compute.GetCommandId, "nothing"))
+	assert.ErrorIs(t, err, storage.ErrKeyNotFound)
+
+	_, err = s.Set(ctx, query(compute.SetCommandId, "name", "x"))
+	require.NoError(t, err)
+	_, err = s.SAdd(ctx, query(compute.SAddCommandId, "name", "x"))
+	assert.ErrorIs(t, err, storage.ErrWrongType)
+	_, err = s.SetOp(ctx, query(compute.SUnionCommandId, "a", "name"))
+	assert.ErrorIs(t, err, storage.ErrWrongType)
+
+	for _, st := range []*storage.Storage{s, replayed(t, wal)} {
+		members, err := st.SMembers(ctx, query(compute.SMembersCommandId, "common"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"2", "3"}, members)
+
+		members, err = st.SetOp(ctx, query(compute.SUnionCommandId, "a", "b", "missing"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"1", "2", "3", "go"}, members)
+
+		members, err = st.SetOp(ctx, query(compute.SDiffCommandId, "a", "b"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"1", "go"}, members)
+
+		found, err := st.SIsMember(ctx, query(compute.SIsMemberCommandId, "a", "go"))
+		require.NoError(t, err)
+		assert.True(t, found)
+
+		size, err := st.SCard(ctx, query(compute.SCardCommandId, "missing"))
+		require.NoError(t, err)
+		assert.Equal(t, 0, size)
+
+		valueType, err := st.Type(ctx, query(compute.TypeCommandId, "common"))
+		require.NoError(t, err)
+		assert.Equal(t, "set", valueType)
+	}
+
+	cursor, members, err := s.SScan(ctx, query(compute.SScanCommandId, "a", "0", "COUNT", "3"))
+	require.NoError(t, err)
+	assert.Equal(t, "3", cursor)
+	assert.Equal(t, []string{"1", "2", "3"}, members)
+
+	cursor, members, err = s.SScan(ctx, query(compute.SScanCommandId, "a", cursor, "MATCH", "g*"))
+	require.NoError(t, err)
+	assert.Equal(t, "0", cursor)
+	assert.Equal(t, []string{"go"}, members)
+
+	assert.Contains(t, wal.queries(t), "SINTERSTORE;common,a,b")
+}
+
+func TestStorage_SortedSets(t *testing.T) {
+	ctx := context.Background()
+	wal := &memoryWAL{}
+	s := newTestStorage(t, wal)
+
+	added, err := s.ZAdd(ctx, query(compute.ZAddCommandId, "board", "10", "bob", "20", "alice", "15", "carol"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, added)
+
+	// GT меняет score только в большую сторону, CH считает изменения
+	changed, err := s.ZAdd(ctx, query(compute.ZAddCommandId, "board", "GT", "CH", "5", "bob", "25", "carol", "1", "dave"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, changed)
+
+	score, err := s.ZIncrBy(ctx, query(compute.ZIncrByCommandId, "board", "2.5", "alice"))
+	require.NoError(t, err)
+	assert.Equal(t, 22.5, score)
+
+	_, err = s.ZIncrBy(ctx, query(compute.ZIncrByCommandId, "inf", "inf", "x"))
+	require.NoError(t, err)
+	_, err = s.ZIncrBy(ctx, query(compute.ZIncrByCommandId, "inf", "-inf", "x"))
+	assert.ErrorIs(t, err, storage.ErrScoreNaN)
+
+	stored, err := s.ZRangeStore(ctx, query(compute.ZRangeStoreCommandId, "top", "board", "+inf", "(10", "BYSCORE", "REV"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, stored)
+
+	popped, err := s.ZPop(ctx, query(compute.ZPopMinCommandId, "board", "2"))
+	require.NoError(t, err)
+	assert.Equal(t, []compute.ScoreMember{{Score: 1, Member: "dave"}, {Score: 10, Member: "bob"}}, popped)
+
+	popped, err = s.ZPop(ctx, query(compute.ZPopMaxCommandId, "missing"))
+	require.NoError(t, err)
+	assert.Empty(t, popped)
+
+	_, err = s.Set(ctx, query(compute.SetCommandId, "name", "x"))
+	require.NoError(t, err)
+	_, err = s.ZAdd(ctx, query(compute.ZAddCommandId, "name", "1", "x"))
+	assert.ErrorIs(t, err, storage.ErrWrongType)
+
+	for _, st := range []*storage.Storage{s, replayed(t, wal)} {
+		members, err := st.ZRange(ctx, query(compute.ZRangeCommandId, "board", "0", "-1"))
+		require.NoError(t, err)
+		assert.Equal(t, []compute.ScoreMember{{Score: 22.5, Member: "alice"}, {Score: 25, Member: "carol"}}, members)
+
+		members, err = st.ZRange(ctx, query(compute.ZRangeCommandId, "top", "0", "0", "REV"))
+		require.NoError(t, err)
+		assert.Equal(t, []compute.ScoreMember{{Score: 25, Member: "carol"}}, members)
+
+		rank, err := st.ZRank(ctx, query(compute.ZRevRankCommandId, "board", "alice"))
+		require.NoError(t, err)
+		assert.Equal(t, 1, rank)
+
+		_, err = st.ZScore(ctx, query(compute.ZScoreCommandId, "board", "dave"))
+		assert.ErrorIs(t, err, storage.ErrKeyNotFound)
+
+		size, err := st.ZCard(ctx, query(compute.ZCardCommandId, "inf"))
+		require.NoError(t, err)
+		assert.Equal(t, 1, size)
+
+		valueType, err := st.Type(ctx, query(compute.TypeCommandId, "top"))
+		require.NoError(t, err)
+		assert.Equal(t, "zset", valueType)
+	}
+
+	removed, err := s.ZRem(ctx, query(compute.ZRemCommandId, "board", "alice", "carol", "missing"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+
+	exists, err := s.Exists(ctx, query(compute.ExistsCommandId, "board"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, exists)
+
+	queries := wal.queries(t)
+	assert.Contains(t, queries, "ZPOPMIN;board,2")
+	for _, q := range queries {
+		assert.NotContains(t, q, "ZPOPMAX", "nothing popped, nothing to log")
+	}
+}
+
+func TestStorage_Streams(t *testing.T) {
+	ctx := context.Background()
+	wal := &memoryWAL{}
+	s := newTestStorage(t, wal)
+
+	for _, id := range []string{"1-1", "1-2", "2-0"} {
+		_, err := s.XAdd(ctx, query(compute.XAddCommandId, "events", id, "type", "e"+id))
+		require.NoError(t, err)
+	}
+
+	_, err := s.XAdd(ctx, query(compute.XAddCommandId, "events", "1-5", "type", "late"))
+	assert.ErrorIs(t, err, storage.ErrStreamID)
+
+	// id по времени не меньше последнего, даже если тот из будущего
+	id, err := s.XAdd(ctx, query(compute.XAddCommandId, "events", "MAXLEN", "3", "*", "type", "auto"))
+	require.NoError(t, err)
+	assert.Positive(t, id.Compare(compute.StreamID{Ms: 2}))
+
+	entries, err := s.XRange(ctx, query(compute.XRangeCommandId, "events", "-", "+", "COUNT", "1"))
+	require.NoError(t, err)
+	assert.Equal(t, []storage.StreamEntry{
+		{ID: compute.StreamID{Ms: 1, Seq: 2}, Fields: []storage.KeyValue{{Key: "type", Value: "e1-2"}}},
+	}, entries)
+
+	reads, err := s.XRead(ctx, query(compute.XReadCommandId, "STREAMS", "events", "missing", "1-2", "0"))
+	require.NoError(t, err)
+	require.Len(t, reads, 1)
+	assert.Equal(t, "events", reads[0].Key)
+	assert.Len(t, reads[0].Entries, 2)
+
+	_, err = s.XGroup(ctx, query(compute.XGroupCommandId, "CREATE", "events", "workers", "0"))
+	require.NoError(t, err)
+	_, err = s.XGroup(ctx, query(compute.XGroupCommandId, "CREATE", "events", "workers", "$"))
+	assert.ErrorIs(t, err, storage.ErrGroupExists)
+	_, err = s.XGroup(ctx, query(compute.XGroupCommandId, "CREATE", "jobs", "workers", "$"))
+	assert.ErrorIs(t, err, storage.ErrKeyNotFound)
+
+	reads, err = s.XReadGroup(ctx, query(compute.XReadGroupCommandId, "GROUP", "workers", "w1", "COUNT", "2", "STREAMS", "events", ">"))
+	require.NoError(t, err)
+	require.Len(t, reads, 1)
+	assert.Len(t, reads[0].Entries, 2)
+
+	reads, err = s.XReadGroup(ctx, query(compute.XReadGroupCommandId, "GROUP", "workers", "w2", "STREAMS", "events", ">"))
+	require.NoError(t, err)
+	require.Len(t, reads, 1)
+	assert.Equal(t, id, reads[0].Entries[0].ID)
+
+	acked, err := s.XAck(ctx, query(compute.XAckCommandId, "events", "workers", "1-2", "9-9"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, acked)
+
+	// w2 забирает запись w1, повторная выдача увеличивает счетчик
+	claimed, err := s.XClaim(ctx, query(compute.XClaimCommandId, "events", "workers", "w2", "0", "2-0"))
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+
+	reads, err = s.XReadGroup(ctx, query(compute.XReadGroupCommandId, "GROUP", "workers", "w2", "STREAMS", "events", "0"))
+	require.NoError(t, err)
+	require.Len(t, reads, 1)
+	assert.Len(t, reads[0].Entries, 2)
+
+	_, err = s.XReadGroup(ctx, query(compute.XReadGroupCommandId, "GROUP", "missing", "w1", "STREAMS", "events", ">"))
+	assert.ErrorIs(t, err, storage.ErrNoGroup)
+
+	pending, err := s.XPending(ctx, query(compute.XPendingCommandId, "events", "workers"))
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Equal(t, storage.PendingEntry{ID: compute.StreamID{Ms: 2}, Consumer: "w2", DeliveredAt: pending[0].DeliveredAt, Deliveries: 3}, pending[0])
+	assert.Equal(t, 2, pending[1].Deliveries)
+
+	// PEL, потребители и последний выданный id восстанавливаются из WAL
+	st := replayed(t, wal)
+
+	replayedPending, err := st.XPending(ctx, query(compute.XPendingCommandId, "events", "workers"))
+	require.NoError(t, err)
+	assert.Equal(t, pending, replayedPending)
+
+	reads, err = st.XReadGroup(ctx, query(compute.XReadGroupCommandId, "GROUP", "workers", "w1", "STREAMS", "events", ">"))
+	require.NoError(t, err)
+	assert.Empty(t, reads)
+
+	length, err := st.XLen(ctx, query(compute.XLenCommandId, "events"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, length)
+
+	valueType, err := st.Type(ctx, query(compute.TypeCommandId, "events"))
+	require.NoError(t, err)
+	assert.Equal(t, "stream", valueType)
+
+	assert.Contains(t, wal.queries(t), "XADD;events,MAXLEN,3,"+id.String()+",type,auto")
+}
+
+// testPublisher - Publisher, который запоминает уведомления как "channel message"
+type testPublisher struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (p *testPublisher) Publish(channel, message string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.messages = append(p.messages, channel+" "+message)
+	return 1
+}
+
+// published - уведомления, отправленные к этому моменту. Истекшие ключи удаляются и в фоне
+func (p *testPublisher) published() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return slices.Clone(p.messages)
+}
+
+func (p *testPublisher) HasSubscribers() bool {
+	return true
+}
+
+func TestStorage_Notifications(t *testing.T) {
+	ctx := context.Background()
+	publisher := &testPublisher{}
+
+	// g и x: строки ($) не отправляются
+	notifier, err := storage.NewNotifier(publisher, "KEgx")
+	require.NoError(t, err)
+
+	s, err := storage.NewStorage(engine.NewMemoryEngine(), &memoryWAL{}, notifier, zap.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, s.Start(ctx))
+
+	_, err = s.Set(ctx, query(compute.SetCommandId, "session", "1", "PX", "10"))
+	require.NoError(t, err)
+	_, err = s.Set(ctx, query(compute.SetCommandId, "user", "bob"))
+	require.NoError(t, err)
+	require.NoError(t, s.Delete(ctx, query(compute.DeleteCommandId, "user")))
+	require.NoError(t, s.Delete(ctx, query(compute.DeleteCommandId, "missing")))
+
+	time.Sleep(20 * time.Millisecond)
+	// истекший ключ удаляется при обращении на запись: expired, но не del
+	require.NoError(t, s.Delete(ctx, query(compute.DeleteCommandId, "session")))
+
+	assert.Equal(t, []string{
+		"__keyspace@0__:session expire",
+		"__keyevent@0__:expire session",
+		"__keyspace@0__:user del",
+		"__keyevent@0__:del user",
+		"__keyspace@0__:session expired",
+		"__keyevent@0__:expired session",
+	}, publisher.published())
+
+	_, err = storage.NewNotifier(publisher, "KZ")
+	assert.ErrorIs(t, err, storage.ErrInvalidNotifyFlags)
+	// вытеснения нет, флаг e не принимается
+	_, err = storage.NewNotifier(publisher, "Ee")
+	assert.ErrorIs(t, err, storage.ErrInvalidNotifyFlags)
+}
+
+// TestStorage_ExpiredNotifications - expired отправляется и когда истекший ключ нашло чтение,
+// и когда его удалило фоновое удаление
+func TestStorage_ExpiredNotifications(t *testing.T) {
+	ctx := context.Background()
+	publisher := &testPublisher{}
+
+	notifier, err := storage.NewNotifier(publisher, "Ex")
+	require.NoError(t, err)
+
+	wal := &memoryWAL{}
+	s, err := storage.NewStorage(engine.NewMemoryEngine(), wal, notifier, zap.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, s.Start(ctx))
+	t.Cleanup(s.Close)
+
+	_, err = s.Set(ctx, query(compute.SetCommandId, "read", "1", "PX", "10"))
+	require.NoError(t, err)
+	_, err = s.Set(ctx, query(compute.SetCommandId, "idle", "1", "PX", "10"))
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+
+	_, err = s.Get(ctx, query(compute.GetCommandId, "read"))
+	assert.ErrorIs(t, err, storage.ErrKeyNotFound)
+	assert.Contains(t, publisher.published(), "__keyevent@0__:expired read")
+	assert.Contains(t, wal.queries(t), "DEL;read")
+
+	require.Eventually(t, func() bool {
+		return slices.Contains(publisher.published(), "__keyevent@0__:expired idle")
+	}, time.Second, 10*time.Millisecond)
+	assert.Contains(t, wal.queries(t), "DEL;idle")
+}
+
+func TestStorage_Changes(t *testing.T) {
+	wal := &memoryWAL{}
+	s := newTestStorage(t, wal)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := s.Set(ctx, query(compute.SetCommandId, "a", "1"))
+	require.NoError(t, err)
+	require.NoError(t, s.MSet(ctx, query(compute.MSetCommandId, "b", "2", "c", "3")))
+	require.NoError(t, s.Delete(ctx, query(compute.DeleteCommandId, "a")))
+
+	var changes []string
+	err = s.Changes(ctx, 2, func(change compute.Change) error {
+		changes = append(changes, fmt.Sprintf("%d %s %s", change.Seq, change.Op(), change.Key()))
+		if len(changes) == 2 {
+			cancel()
+		}
+
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []string{"2 MSET b", "3 DEL a"}, changes)
+
+	withoutWAL, err := storage.NewStorage(engine.NewMemoryEngine(), nil, nil, zap.NewNop())
+	require.NoError(t, err)
+	assert.ErrorIs(t, withoutWAL.Changes(context.Background(), 0, nil), storage.ErrNoWAL)
+}
+
+// exported - все ключи хранилища в виде записей выгрузки, по ключам
+func exported(t *testing.T, s *storage.Storage) map[string]dataset.Record {
+	t.Helper()
+
+	records := make(map[string]dataset.Record)
+	err := s.Export(context.Background(), func(e storage.KeyEntry) error {
+		record, err := dataset.Encode(e, time.Now().UnixMilli())
+		records[e.Key] = record
+		return err
+	})
+	require.NoError(t, err)
+
+	return records
+}
+
+func TestStorage_ExportImport(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, &memoryWAL{})
+
+	_, err := s.Set(ctx, query(compute.SetCommandId, "name", "alice", "PX", "100000"))
+	require.NoError(t, err)
+	_, err = s.Push(ctx, query(compute.RPushCommandId, "queue", "a", "b"))
+	require.NoError(t, err)
+	_, err = s.HSet(ctx, query(compute.HSetCommandId, "user", "name", "bob", "visits", "3"))
+	require.NoError(t, err)
+	_, err = s.HExpire(ctx, query(compute.HExpireCommandId, "user", "100", "visits"))
+	require.NoError(t, err)
+	_, err = s.SAdd(ctx, query(compute.SAddCommandId, "tags", "x", "y"))
+	require.NoError(t, err)
+	_, err = s.ZAdd(ctx, query(compute.ZAddCommandId, "board", "1.5", "bob", "-inf", "alice"))
+	require.NoError(t, err)
+	_, err = s.XAdd(ctx, query(compute.XAddCommandId, "events", "1-1", "type", "login"))
+	require.NoError(t, err)
+	_, err = s.XGroup(ctx, query(compute.XGroupCommandId, "CREATE", "events", "workers", "$"))
+	require.NoError(t, err)
+
+	var entries []storage.KeyEntry
+	require.NoError(t, s.Export(ctx, func(e storage.KeyEntry) error {
+		entries = append(entries, e)
+		return nil
+	}))
+	require.Len(t, entries, 6)
+
+	wal := &memoryWAL{}
+	target := newTestStorage(t, wal)
+	imported, err := target.Import(ctx, entries, false)
+	require.NoError(t, err)
+	assert.Equal(t, 6, imported)
+
+	expected := exported(t, s)
+	assert.Equal(t, expected, exported(t, target))
+	assert.Equal(t, expected, exported(t, replayed(t, wal)))
+
+	// без REPLACE существующие ключи не меняются
+	_, err = target.Set(ctx, query(compute.SetCommandId, "name", "carol"))
+	require.NoError(t, err)
+	imported, err = target.Import(ctx, entries[:1], false)
+	require.NoError(t, err)
+	assert.Zero(t, imported)
+	assert.NotEqual(t, expected["name"], exported(t, target)["name"])
+
+	imported, err = target.Import(ctx, entries, true)
+	require.NoError(t, err)
+	assert.Equal(t, 6, imported)
+	assert.Equal(t, expected, exported(t, replayed(t, wal)))
+
+	// значение, которое нельзя записать в WAL, отклоняет всю пачку
+	records := len(wal.records)
+	invalid := []storage.KeyEntry{
+		{Key: "fresh", Entry: storage.NewEntry("ok")},
+		{Key: "broken", Entry: storage.NewEntry("a,b")},
+	}
+	_, err = target.Import(ctx, invalid, false)
+	assert.ErrorIs(t, err, storage.ErrInvalidImport)
+	assert.Len(t, wal.records, records)
+	assert.NotContains(t, exported(t, target), "fresh")
+}
+
+func TestStorage_DumpRestore(t *testing.T) {
+	ctx := context.Background()
+	wal := &memoryWAL{}
+	s := newTestStorage(t, wal)
+
+	_, err := s.ZAdd(ctx, query(compute.ZAddCommandId, "board", "1.5", "bob", "-inf", "alice"))
+	require.NoError(t, err)
+	_, err = s.XAdd(ctx, query(compute.XAddCommandId, "events", "1-1", "type", "login"))
+	require.NoError(t, err)
+	_, err = s.XGroup(ctx, query(compute.XGroupCommandId, "CREATE", "events", "workers", "0"))
+	require.NoError(t, err)
+	_, err = s.XReadGroup(ctx, query(compute.XReadGroupCommandId, "GROUP", "workers", "w1", "STREAMS", "events", ">"))
+	require.NoError(t, err)
+
+	board, err := s.Dump(ctx, query(compute.DumpCommandId, "board"))
+	require.NoError(t, err)
+	assert.True(t, compute.ValidArg(board))
+	events, err := s.Dump(ctx, query(compute.DumpCommandId, "events"))
+	require.NoError(t, err)
+
+	_, err = s.Dump(ctx, query(compute.DumpCommandId, "missing"))
+	assert.ErrorIs(t, err, storage.ErrKeyNotFound)
+
+	err = s.Restore(ctx, query(compute.RestoreCommandId, "board", "0", board))
+	assert.ErrorIs(t, err, storage.ErrBusyKey)
+	err = s.Restore(ctx, query(compute.RestoreCommandId, "copy", "0", board[:len(board)-2]+"AA"))
+	assert.ErrorIs(t, err, storage.ErrInvalidDump)
+
+	require.NoError(t, s.Restore(ctx, query(compute.RestoreCommandId, "copy", "100000", board)))
+	require.NoError(t, s.Restore(ctx, query(compute.RestoreCommandId, "events", "0", events, "REPLACE")))
+
+	// RESTORE попадает в WAL с итоговым сроком жизни, PEL потока переносится вместе с ним
+	r := replayed(t, wal)
+	ttl, err := r.TTL(ctx, query(compute.TTLCommandId, "copy"))
+	require.NoError(t, err)
+	assert.InDelta(t, 100000, ttl, 1000)
+
+	copied, err := r.Dump(ctx, query(compute.DumpCommandId, "copy"))
+	require.NoError(t, err)
+	entry, err := storage.DecodeDump(copied)
+	require.NoError(t, err)
+	assert.Equal(t, []compute.ScoreMember{{Member: "alice", Score: math.Inf(-1)}, {Member: "bob", Score: 1.5}},
+		entry.Data.(*storage.SortedSet).Members())
+
+	pending, err := r.XPending(ctx, query(compute.XPendingCommandId, "events", "workers"))
+	require.NoError(t, err)
+	assert.Len(t, pending, 1)
+
+	deleted, err := s.DeleteUnchanged(ctx, []storage.KeyDump{{Key: "board", Payload: board}, {Key: "copy", Payload: board}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	_, err = s.Dump(ctx, query(compute.DumpCommandId, "board"))
+	assert.ErrorIs(t, err, storage.ErrKeyNotFound)
+}
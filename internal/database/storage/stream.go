@@ -0,0 +1,363 @@
+package storage
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+)
+
+var (
+	ErrStreamID = errors.New("the ID specified in XADD is equal or smaller than the target stream top item")
+)
+
+// StreamEntry - запись потока. Fields == nil - запись уже удалена из потока (MAXLEN), но еще числится в PEL
+type StreamEntry struct {
+	ID     compute.StreamID
+	Fields []KeyValue
+}
+
+// PendingEntry - запись, выданная потребителю группы и еще не подтвержденная через XACK
+type PendingEntry struct {
+	ID       compute.StreamID
+	Consumer string
+	// DeliveredAt - время последней выдачи в unix ms
+	DeliveredAt int64
+	Deliveries  int
+}
+
+// Idle - сколько миллисекунд прошло с последней выдачи к моменту now
+func (p PendingEntry) Idle(now int64) int64 {
+	return max(now-p.DeliveredAt, 0)
+}
+
+// StreamConsumer - потребитель группы. SeenAt - время последнего чтения или XCLAIM в unix ms
+type StreamConsumer struct {
+	Name   string
+	SeenAt int64
+}
+
+// ConsumerGroup - группа потребителей потока: последний выданный группе id, выданные и не подтвержденные
+// записи (PEL) и потребители
+type ConsumerGroup struct {
+	Name      string
+	LastID    compute.StreamID
+	pending   map[compute.StreamID]*PendingEntry
+	consumers map[string]*StreamConsumer
+}
+
+func NewConsumerGroup(name string, lastID compute.StreamID, consumers []StreamConsumer, pending []PendingEntry) *ConsumerGroup {
+	g := &ConsumerGroup{
+		Name:      name,
+		LastID:    lastID,
+		pending:   make(map[compute.StreamID]*PendingEntry, len(pending)),
+		consumers: make(map[string]*StreamConsumer, len(consumers)),
+	}
+
+	for _, c := range consumers {
+		g.consumers[c.Name] = &c
+	}
+	for _, p := range pending {
+		g.pending[p.ID] = &p
+	}
+
+	return g
+}
+
+// Consumers - потребители по имени
+func (g *ConsumerGroup) Consumers() []StreamConsumer {
+	consumers := make([]StreamConsumer, 0, len(g.consumers))
+	for _, c := range g.consumers {
+		consumers = append(consumers, *c)
+	}
+
+	slices.SortFunc(consumers, func(a, b StreamConsumer) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return consumers
+}
+
+// Pending - записи PEL с id в [start, end] по возрастанию id, не больше count (0 - все).
+// Пустой consumer - записи всех потребителей
+func (g *ConsumerGroup) Pending(start, end compute.StreamID, count int, consumer string) []PendingEntry {
+	pending := make([]PendingEntry, 0)
+	for _, p := range g.pending {
+		if p.ID.Compare(start) >= 0 && p.ID.Compare(end) <= 0 && (consumer == "" || p.Consumer == consumer) {
+			pending = append(pending, *p)
+		}
+	}
+
+	slices.SortFunc(pending, func(a, b PendingEntry) int {
+		return a.ID.Compare(b.ID)
+	})
+
+	if count > 0 && len(pending) > count {
+		pending = pending[:count]
+	}
+
+	return pending
+}
+
+// Ack - убирает записи из PEL, возвращает, сколько из них там было
+func (g *ConsumerGroup) Ack(ids []compute.StreamID) int {
+	n := 0
+	for _, id := range ids {
+		if _, ok := g.pending[id]; ok {
+			delete(g.pending, id)
+			n++
+		}
+	}
+
+	return n
+}
+
+// HasConsumer - есть ли в группе потребитель name
+func (g *ConsumerGroup) HasConsumer(name string) bool {
+	_, ok := g.consumers[name]
+	return ok
+}
+
+// touch - создает потребителя при необходимости и отмечает время обращения
+func (g *ConsumerGroup) touch(name string, now int64) {
+	c, ok := g.consumers[name]
+	if !ok {
+		c = &StreamConsumer{Name: name}
+		g.consumers[name] = c
+	}
+	c.SeenAt = now
+}
+
+func (g *ConsumerGroup) clone() *ConsumerGroup {
+	consumers := make([]StreamConsumer, 0, len(g.consumers))
+	for _, c := range g.consumers {
+		consumers = append(consumers, *c)
+	}
+
+	pending := make([]PendingEntry, 0, len(g.pending))
+	for _, p := range g.pending {
+		pending = append(pending, *p)
+	}
+
+	return NewConsumerGroup(g.Name, g.LastID, consumers, pending)
+}
+
+// Stream - записи по возрастанию id. Новые добавляются в конец, MAXLEN удаляет самые старые.
+// lastID - id последней добавленной записи, он не уменьшается и после удаления записей
+type Stream struct {
+	entries []StreamEntry
+	lastID  compute.StreamID
+	groups  map[string]*ConsumerGroup
+}
+
+var _ Collection = (*Stream)(nil)
+
+func NewStream(lastID compute.StreamID, entries []StreamEntry, groups ...*ConsumerGroup) *Stream {
+	s := &Stream{entries: entries, lastID: lastID, groups: make(map[string]*ConsumerGroup, len(groups))}
+	for _, g := range groups {
+		s.groups[g.Name] = g
+	}
+
+	return s
+}
+
+func (s *Stream) Type() ValueType {
+	return TypeStream
+}
+
+func (s *Stream) Clone() Collection {
+	groups := make([]*ConsumerGroup, 0, len(s.groups))
+	for _, g := range s.groups {
+		groups = append(groups, g.clone())
+	}
+
+	return NewStream(s.lastID, slices.Clone(s.entries), groups...)
+}
+
+func (s *Stream) Len() int {
+	return len(s.entries)
+}
+
+func (s *Stream) LastID() compute.StreamID {
+	return s.lastID
+}
+
+// Entries - все записи по возрастанию id
+func (s *Stream) Entries() []StreamEntry {
+	return s.entries
+}
+
+// NextID - id для XADD * в момент now: время now, а если часы отстают от последней записи - ее время
+// со следующим номером. Так id остаются возрастающими
+func (s *Stream) NextID(now int64) compute.StreamID {
+	ms := max(uint64(max(now, 0)), s.lastID.Ms)
+	if ms == s.lastID.Ms {
+		return compute.StreamID{Ms: ms, Seq: s.lastID.Seq + 1}
+	}
+
+	return compute.StreamID{Ms: ms}
+}
+
+// Add - добавляет запись в конец. ErrStreamID, если id не больше последнего
+func (s *Stream) Add(id compute.StreamID, fields []KeyValue) error {
+	if id.IsZero() || id.Compare(s.lastID) <= 0 {
+		return ErrStreamID
+	}
+
+	s.entries = append(s.entries, StreamEntry{ID: id, Fields: fields})
+	s.lastID = id
+
+	return nil
+}
+
+// Trim - оставляет maxLen последних записей, возвращает число удаленных
+func (s *Stream) Trim(maxLen int) int {
+	n := max(len(s.entries)-maxLen, 0)
+	// начало массива освободится при следующем расширении в append
+	s.entries = s.entries[n:]
+
+	return n
+}
+
+// Range - записи с id в [start, end], не больше count (0 - все)
+func (s *Stream) Range(start, end compute.StreamID, count int) []StreamEntry {
+	i := s.search(start)
+
+	entries := make([]StreamEntry, 0)
+	for ; i < len(s.entries) && s.entries[i].ID.Compare(end) <= 0; i++ {
+		if count > 0 && len(entries) == count {
+			break
+		}
+
+		entries = append(entries, s.entries[i])
+	}
+
+	return entries
+}
+
+// After - записи с id больше id, не больше count (0 - все)
+func (s *Stream) After(id compute.StreamID, count int) []StreamEntry {
+	i := s.search(id)
+	if i < len(s.entries) && s.entries[i].ID == id {
+		i++
+	}
+
+	if count > 0 {
+		return slices.Clone(s.entries[i:min(i+count, len(s.entries))])
+	}
+
+	return slices.Clone(s.entries[i:])
+}
+
+// Get - запись по id, Fields == nil если ее уже нет
+func (s *Stream) Get(id compute.StreamID) StreamEntry {
+	i := s.search(id)
+	if i < len(s.entries) && s.entries[i].ID == id {
+		return s.entries[i]
+	}
+
+	return StreamEntry{ID: id}
+}
+
+// Groups - группы по имени
+func (s *Stream) Groups() []*ConsumerGroup {
+	return slices.SortedFunc(maps.Values(s.groups), func(a, b *ConsumerGroup) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+}
+
+func (s *Stream) Group(name string) (*ConsumerGroup, bool) {
+	g, ok := s.groups[name]
+	return g, ok
+}
+
+// CreateGroup - новая группа, которой будут выданы записи после lastID. false, если группа уже есть
+func (s *Stream) CreateGroup(name string, lastID compute.StreamID) bool {
+	if _, ok := s.groups[name]; ok {
+		return false
+	}
+
+	s.groups[name] = NewConsumerGroup(name, lastID, nil, nil)
+
+	return true
+}
+
+func (s *Stream) DestroyGroup(name string) bool {
+	_, ok := s.groups[name]
+	delete(s.groups, name)
+
+	return ok
+}
+
+// ReadNew - XREADGROUP ... >: записи после последней выданной группе. Без noAck они попадают в PEL потребителя
+func (s *Stream) ReadNew(g *ConsumerGroup, consumer string, count int, noAck bool, now int64) []StreamEntry {
+	g.touch(consumer, now)
+
+	entries := s.After(g.LastID, count)
+	for _, entry := range entries {
+		g.LastID = entry.ID
+		if !noAck {
+			g.pending[entry.ID] = &PendingEntry{ID: entry.ID, Consumer: consumer, DeliveredAt: now, Deliveries: 1}
+		}
+	}
+
+	return entries
+}
+
+// ReadHistory - XREADGROUP ... id: записи PEL потребителя с id больше after. Выдача засчитывается повторной
+func (s *Stream) ReadHistory(g *ConsumerGroup, consumer string, after compute.StreamID, count int, now int64) []StreamEntry {
+	g.touch(consumer, now)
+
+	entries := make([]StreamEntry, 0)
+	for _, p := range g.Pending(after, compute.MaxStreamID, 0, consumer) {
+		if p.ID == after {
+			continue
+		}
+
+		if count > 0 && len(entries) == count {
+			break
+		}
+
+		entry := g.pending[p.ID]
+		entry.DeliveredAt, entry.Deliveries = now, entry.Deliveries+1
+		entries = append(entries, s.Get(p.ID))
+	}
+
+	return entries
+}
+
+// Claim - передает потребителю записи PEL, которые не подтверждались хотя бы minIdle миллисекунд.
+// Записи, которых уже нет в потоке, убираются из PEL и не возвращаются
+func (s *Stream) Claim(g *ConsumerGroup, consumer string, minIdle int64, ids []compute.StreamID, now int64) []StreamEntry {
+	g.touch(consumer, now)
+
+	entries := make([]StreamEntry, 0, len(ids))
+	for _, id := range ids {
+		p, ok := g.pending[id]
+		if !ok || p.Idle(now) < minIdle {
+			continue
+		}
+
+		entry := s.Get(id)
+		if entry.Fields == nil {
+			delete(g.pending, id)
+			continue
+		}
+
+		p.Consumer, p.DeliveredAt, p.Deliveries = consumer, now, p.Deliveries+1
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// search - индекс первой записи с id не меньше id
+func (s *Stream) search(id compute.StreamID) int {
+	i, _ := slices.BinarySearchFunc(s.entries, id, func(entry StreamEntry, id compute.StreamID) int {
+		return entry.ID.Compare(id)
+	})
+
+	return i
+}
@@ -0,0 +1,482 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+)
+
+var (
+	ErrNoGroup     = errors.New("NOGROUP No such key or consumer group")
+	ErrGroupExists = errors.New("BUSYGROUP Consumer Group name already exists")
+)
+
+// StreamRead - записи одного ключа в ответе XREAD и XREADGROUP
+type StreamRead struct {
+	Key     string
+	Entries []StreamEntry
+}
+
+// XAdd - добавляет запись, создавая поток при необходимости, и обрезает его по MAXLEN. Возвращает id записи.
+// В WAL пишется уже выбранный id, поэтому повтор дает те же id
+func (s *Storage) XAdd(ctx context.Context, query compute.Query) (compute.StreamID, error) {
+	if ctx.Err() != nil {
+		return compute.StreamID{}, ctx.Err()
+	}
+
+	var id compute.StreamID
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		stream, _, err := getStream(tx, query.Key())
+		if errors.Is(err, ErrKeyNotFound) {
+			stream, err = NewStream(compute.StreamID{}, nil), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		opts := query.XAddOptions()
+		if opts.ID == compute.AutoStreamID {
+			id = stream.NextID(tx.Now())
+		} else {
+			id, _ = compute.ParseStreamID(opts.ID)
+		}
+
+		args := []string{query.Key()}
+		if opts.MaxLen >= 0 {
+			args = append(args, compute.MaxLenOption, strconv.Itoa(opts.MaxLen))
+		}
+		args = append(args, id.String())
+		for _, field := range opts.Fields {
+			args = append(args, field[0], field[1])
+		}
+
+		record := compute.NewQuery(compute.XAddCommandId, args)
+		if err := xadd(tx, record); err != nil {
+			return nil, err
+		}
+
+		return []compute.Query{record}, nil
+	})
+
+	return id, err
+}
+
+// XLen - число записей, 0 для отсутствующего ключа
+func (s *Storage) XLen(ctx context.Context, query compute.Query) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var n int
+	err := s.view(ctx, func(tx Tx) error {
+		stream, _, err := getStream(tx, query.Key())
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		n = stream.Len()
+
+		return nil
+	})
+
+	return n, err
+}
+
+// XRange - XRANGE key start end [COUNT n], записи по возрастанию id
+func (s *Storage) XRange(ctx context.Context, query compute.Query) ([]StreamEntry, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	entries := make([]StreamEntry, 0)
+	err := s.view(ctx, func(tx Tx) error {
+		stream, _, err := getStream(tx, query.Key())
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		start, end, count := query.XRange()
+		entries = stream.Range(start, end, count)
+
+		return nil
+	})
+
+	return entries, err
+}
+
+// XRead - XREAD [COUNT n] STREAMS key [key ...] id [id ...], записи после id по каждому ключу.
+// Ключи без новых записей в ответ не попадают
+func (s *Storage) XRead(ctx context.Context, query compute.Query) ([]StreamRead, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	opts := query.XReadOptions()
+
+	reads := make([]StreamRead, 0, len(opts.Keys))
+	err := s.view(ctx, func(tx Tx) error {
+		for i, key := range opts.Keys {
+			stream, _, err := getStream(tx, key)
+			if errors.Is(err, ErrKeyNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			after := stream.LastID()
+			if opts.IDs[i] != compute.LastStreamID {
+				after, _ = compute.ParseStreamID(opts.IDs[i])
+			}
+
+			if entries := stream.After(after, opts.Count); len(entries) > 0 {
+				reads = append(reads, StreamRead{Key: key, Entries: entries})
+			}
+		}
+
+		return nil
+	})
+
+	return reads, err
+}
+
+// XGroup - XGROUP CREATE возвращает 1 или ErrGroupExists, XGROUP DESTROY - число удаленных групп
+func (s *Storage) XGroup(ctx context.Context, query compute.Query) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var n int
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		var err error
+		if n, err = xgroup(tx, query); err != nil || n == 0 {
+			return nil, err
+		}
+
+		return []compute.Query{query}, nil
+	})
+
+	return n, err
+}
+
+// XReadGroup - XREADGROUP GROUP group consumer ... STREAMS key [key ...] id [id ...]. С id ">" выдает потребителю
+// новые для группы записи, с явным id - его же невыполненные записи после id. ErrNoGroup, если нет ключа или группы.
+// В WAL команда пишется как есть, если что-то выдано или появился новый потребитель: повтор в то же время
+// транзакции выдает те же записи
+func (s *Storage) XReadGroup(ctx context.Context, query compute.Query) ([]StreamRead, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	opts := query.XReadOptions()
+
+	var reads []StreamRead
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		changed := false
+		for _, key := range opts.Keys {
+			stream, _, err := getStream(tx, key)
+			if errors.Is(err, ErrKeyNotFound) {
+				return nil, fmt.Errorf("%w: %s", ErrNoGroup, key)
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			g, ok := stream.Group(opts.Group)
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", ErrNoGroup, key)
+			}
+
+			changed = changed || !g.HasConsumer(opts.Consumer)
+		}
+
+		var err error
+		if reads, err = xreadgroup(tx, query); err != nil {
+			return nil, err
+		}
+
+		if !changed && len(reads) == 0 {
+			return nil, nil
+		}
+
+		return []compute.Query{query}, nil
+	})
+
+	return reads, err
+}
+
+// XAck - подтверждает обработку записей, возвращает, сколько из них было в PEL группы
+func (s *Storage) XAck(ctx context.Context, query compute.Query) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var n int
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		var err error
+		if n, err = xack(tx, query); err != nil || n == 0 {
+			return nil, err
+		}
+
+		return []compute.Query{query}, nil
+	})
+
+	return n, err
+}
+
+// XPending - записи PEL группы: все для сводки XPENDING key group, иначе в диапазоне [start, end]
+func (s *Storage) XPending(ctx context.Context, query compute.Query) ([]PendingEntry, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	var pending []PendingEntry
+	err := s.view(ctx, func(tx Tx) error {
+		_, g, err := getGroup(tx, query.Key(), query.Value())
+		if err != nil {
+			return err
+		}
+
+		r, ok := query.XPendingRange()
+		if !ok {
+			r = compute.XPendingRange{End: compute.MaxStreamID}
+		}
+		pending = g.Pending(r.Start, r.End, r.Count, r.Consumer)
+
+		return nil
+	})
+
+	return pending, err
+}
+
+// XClaim - XCLAIM key group consumer min-idle-time id [id ...], передает потребителю давно не подтвержденные
+// записи. Возвращает переданные записи
+func (s *Storage) XClaim(ctx context.Context, query compute.Query) ([]StreamEntry, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	var entries []StreamEntry
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		var err error
+		if entries, err = xclaim(tx, query); err != nil {
+			return nil, err
+		}
+
+		return []compute.Query{query}, nil
+	})
+
+	return entries, err
+}
+
+// applyStreamRecord - XADD с явным id, XGROUP, XREADGROUP, XACK и XCLAIM
+func applyStreamRecord(tx Tx, record compute.Query) error {
+	var err error
+	switch record.CommandId() {
+	case compute.XAddCommandId:
+		err = xadd(tx, record)
+	case compute.XGroupCommandId:
+		_, err = xgroup(tx, record)
+	case compute.XReadGroupCommandId:
+		_, err = xreadgroup(tx, record)
+	case compute.XAckCommandId:
+		_, err = xack(tx, record)
+	case compute.XClaimCommandId:
+		_, err = xclaim(tx, record)
+	default:
+		err = fmt.Errorf("%w: %s", ErrUnknownRecord, record.String())
+	}
+
+	return err
+}
+
+func xadd(tx Tx, record compute.Query) error {
+	stream, entry, err := getStream(tx, record.Key())
+	if errors.Is(err, ErrKeyNotFound) {
+		stream = NewStream(compute.StreamID{}, nil)
+		entry, err = NewCollectionEntry(stream), nil
+	}
+	if err != nil {
+		return err
+	}
+
+	opts := record.XAddOptions()
+	id, err := compute.ParseStreamID(opts.ID)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrUnknownRecord, record.String())
+	}
+
+	fields := make([]KeyValue, 0, len(opts.Fields))
+	for _, field := range opts.Fields {
+		fields = append(fields, KeyValue{Key: field[0], Value: field[1]})
+	}
+
+	if err := stream.Add(id, fields); err != nil {
+		return err
+	}
+
+	if opts.MaxLen >= 0 {
+		stream.Trim(opts.MaxLen)
+	}
+
+	return tx.Set(record.Key(), entry)
+}
+
+func xgroup(tx Tx, record compute.Query) (int, error) {
+	args := record.Args()
+	key, name := args[1], args[2]
+
+	stream, entry, err := getStream(tx, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		if args[0] == compute.DestroyOption {
+			return 0, nil
+		}
+
+		if len(args) < 5 || args[4] != compute.MkStreamOption {
+			return 0, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+		}
+
+		stream = NewStream(compute.StreamID{}, nil)
+		entry, err = NewCollectionEntry(stream), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if args[0] == compute.DestroyOption {
+		if !stream.DestroyGroup(name) {
+			return 0, nil
+		}
+
+		return 1, tx.Set(key, entry)
+	}
+
+	lastID := stream.LastID()
+	if args[3] != compute.LastStreamID {
+		lastID, _ = compute.ParseStreamID(args[3])
+	}
+
+	if !stream.CreateGroup(name, lastID) {
+		return 0, ErrGroupExists
+	}
+
+	return 1, tx.Set(key, entry)
+}
+
+func xreadgroup(tx Tx, record compute.Query) ([]StreamRead, error) {
+	opts := record.XReadOptions()
+
+	reads := make([]StreamRead, 0, len(opts.Keys))
+	for i, key := range opts.Keys {
+		stream, entry, err := getStream(tx, key)
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrNoGroup, key)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		g, ok := stream.Group(opts.Group)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrNoGroup, key)
+		}
+
+		var entries []StreamEntry
+		if opts.IDs[i] == compute.NewEntriesID {
+			entries = stream.ReadNew(g, opts.Consumer, opts.Count, opts.NoAck, tx.Now())
+		} else {
+			after, _ := compute.ParseStreamID(opts.IDs[i])
+			entries = stream.ReadHistory(g, opts.Consumer, after, opts.Count, tx.Now())
+		}
+
+		if err := tx.Set(key, entry); err != nil {
+			return nil, err
+		}
+
+		if len(entries) > 0 {
+			reads = append(reads, StreamRead{Key: key, Entries: entries})
+		}
+	}
+
+	return reads, nil
+}
+
+func xack(tx Tx, record compute.Query) (int, error) {
+	_, g, err := getGroup(tx, record.Key(), record.Value())
+	if errors.Is(err, ErrNoGroup) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	n := g.Ack(record.StreamIDs(2))
+	if n == 0 {
+		return 0, nil
+	}
+
+	entry, err := tx.Get(record.Key())
+	if err != nil {
+		return 0, err
+	}
+
+	return n, tx.Set(record.Key(), entry)
+}
+
+func xclaim(tx Tx, record compute.Query) ([]StreamEntry, error) {
+	stream, g, err := getGroup(tx, record.Key(), record.Value())
+	if err != nil {
+		return nil, err
+	}
+
+	args := record.Args()
+	entries := stream.Claim(g, args[2], record.Int64Arg(3), record.StreamIDs(4), tx.Now())
+
+	entry, err := tx.Get(record.Key())
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, tx.Set(record.Key(), entry)
+}
+
+// getStream - поток ключа и его запись, ErrWrongType если по ключу значение другого типа
+func getStream(tx Tx, key string) (*Stream, Entry, error) {
+	entry, err := tx.Get(key)
+	if err != nil {
+		return nil, Entry{}, err
+	}
+
+	stream, ok := entry.Data.(*Stream)
+	if !ok {
+		return nil, Entry{}, ErrWrongType
+	}
+
+	return stream, entry, nil
+}
+
+// getGroup - поток и его группа, ErrNoGroup если нет ключа или группы
+func getGroup(tx Tx, key, name string) (*Stream, *ConsumerGroup, error) {
+	stream, _, err := getStream(tx, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, nil, fmt.Errorf("%w: %s", ErrNoGroup, key)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	g, ok := stream.Group(name)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s %s", ErrNoGroup, key, name)
+	}
+
+	return stream, g, nil
+}
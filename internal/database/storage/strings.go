@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+)
+
+var ErrStringTooLong = errors.New("string exceeds maximum allowed size")
+
+// Append - дописывает значение в конец строки, создавая ключ при необходимости. Срок жизни сохраняется.
+// В WAL пишется только добавленная часть
+func (s *Storage) Append(ctx context.Context, query compute.Query) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var length int
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		entry, err := getOrEmpty(tx, query.Key())
+		if err != nil {
+			return nil, err
+		}
+
+		length = len(entry.Value) + len(query.Value())
+		if length > compute.MaxStringSize {
+			return nil, ErrStringTooLong
+		}
+
+		if err := applyRecord(tx, query); err != nil {
+			return nil, err
+		}
+
+		return []compute.Query{query}, nil
+	})
+
+	return length, err
+}
+
+// StrLen - длина строки, 0 для отсутствующего ключа
+func (s *Storage) StrLen(ctx context.Context, query compute.Query) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var length int
+	err := s.view(ctx, func(tx Tx) error {
+		entry, err := getOrEmpty(tx, query.Key())
+		length = len(entry.Value)
+
+		return err
+	})
+
+	return length, err
+}
+
+// GetRange - подстрока [start, end] включительно, отрицательные индексы отсчитываются от конца
+func (s *Storage) GetRange(ctx context.Context, query compute.Query) (string, error) {
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	var value string
+	err := s.view(ctx, func(tx Tx) error {
+		entry, err := getOrEmpty(tx, query.Key())
+		value = substring(entry.Value, query.IntArg(1), query.IntArg(2))
+
+		return err
+	})
+
+	return value, err
+}
+
+// SetRange - перезаписывает часть строки с offset, дополняя её нулевыми байтами при необходимости.
+// Возвращает новую длину. В WAL пишется только перезаписанная часть
+func (s *Storage) SetRange(ctx context.Context, query compute.Query) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var length int
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		entry, err := getOrEmpty(tx, query.Key())
+		if err != nil {
+			return nil, err
+		}
+
+		offset, piece := query.IntArg(1), query.Args()[2]
+		// offset+len(piece) может переполниться, если offset не проверен разбором запроса
+		if offset < 0 || offset > compute.MaxStringSize-len(piece) {
+			return nil, ErrStringTooLong
+		}
+
+		length = max(len(entry.Value), offset+len(piece))
+		if err := applyRecord(tx, query); err != nil {
+			return nil, err
+		}
+
+		return []compute.Query{query}, nil
+	})
+
+	return length, err
+}
+
+// applyStringRecord - APPEND и SETRANGE
+func applyStringRecord(tx Tx, record compute.Query) error {
+	entry, err := getOrEmpty(tx, record.Key())
+	if err != nil {
+		return err
+	}
+
+	switch record.CommandId() {
+	case compute.AppendCommandId:
+		entry.Value += record.Value()
+	case compute.SetRangeCommandId:
+		entry.Value = overwrite(entry.Value, record.IntArg(1), record.Args()[2])
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownRecord, record.String())
+	}
+
+	return tx.Set(record.Key(), entry)
+}
+
+// getOrEmpty - строковая запись ключа или пустая строка без срока жизни, если ключа нет
+func getOrEmpty(tx Tx, key string) (Entry, error) {
+	entry, err := getString(tx, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return NewEntry(""), nil
+	}
+
+	return entry, err
+}
+
+func substring(value string, start, end int) string {
+	if start < 0 {
+		start = max(len(value)+start, 0)
+	}
+	if end < 0 {
+		end = len(value) + end
+	}
+	end = min(end, len(value)-1)
+
+	if start > end {
+		return ""
+	}
+
+	return value[start : end+1]
+}
+
+func overwrite(value string, offset int, piece string) string {
+	if offset > len(value) {
+		value += strings.Repeat("\x00", offset-len(value))
+	}
+
+	if offset+len(piece) >= len(value) {
+		return value[:offset] + piece
+	}
+
+	return value[:offset] + piece + value[offset+len(piece):]
+}
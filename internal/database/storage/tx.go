@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrKeyNotFound = errors.New("key not found")
+	ErrReadOnlyTx  = errors.New("write in read-only transaction")
+)
+
+// Tx - операции над движком внутри транзакции. Транзакция выполняется целиком под блокировкой движка,
+// поэтому составные команды (проверка и запись) атомарны относительно остальных запросов
+type Tx interface {
+	// Get - живая запись ключа, истекшая считается отсутствующей
+	Get(key string) (Entry, error)
+	Set(key string, entry Entry) error
+	Delete(key string) error
+	// Clear - удаляет все ключи
+	Clear() error
+	// Now - время начала транзакции в unix ms, относительно него проверяется истечение
+	Now() int64
+}
+
+// CheckpointTx - транзакция движка, который сам хранит изменения на диске. SetCheckpoint - номер
+// последней записи WAL, изменения которой сделаны к этому моменту
+type CheckpointTx interface {
+	SetCheckpoint(seq uint64) error
+}
+
+// Checkpointer - движок, который сам хранит изменения на диске. Checkpoint - число первых записей WAL,
+// изменения которых уже есть в его файлах: при старте повторяются только следующие за ними
+type Checkpointer interface {
+	Checkpoint() uint64
+	// SetCheckpoint - сразу сохраняет номер на диск. Нужен, если при старте WAL короче: примененные
+	// к движку записи не успели попасть в WAL
+	SetCheckpoint(seq uint64) error
+}
+
+type txTimeKey struct{}
+
+// WithTxTime - транзакции движка с этим контекстом выполняются в момент now (unix ms), а не в текущий.
+// Так повтор WAL проверяет сроки жизни так же, как при исходной записи
+func WithTxTime(ctx context.Context, now int64) context.Context {
+	return context.WithValue(ctx, txTimeKey{}, now)
+}
+
+// TxTime - время транзакции из контекста, по умолчанию текущее
+func TxTime(ctx context.Context) int64 {
+	if now, ok := ctx.Value(txTimeKey{}).(int64); ok && now != 0 {
+		return now
+	}
+
+	return NowMillis()
+}
+
+type expireHookKey struct{}
+
+// WithExpireHook - транзакции с этим контекстом вызывают fn для каждого истекшего ключа, который нашли
+// при чтении. Транзакция на запись такой ключ уже удалила, транзакция на чтение удалить его не может
+func WithExpireHook(ctx context.Context, fn func(key string)) context.Context {
+	return context.WithValue(ctx, expireHookKey{}, fn)
+}
+
+// ExpireHook - обработчик удаления истекших ключей из контекста, nil если его нет
+func ExpireHook(ctx context.Context) func(key string) {
+	fn, _ := ctx.Value(expireHookKey{}).(func(key string))
+	return fn
+}
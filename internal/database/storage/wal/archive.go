@@ -0,0 +1,104 @@
+package wal
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+
+	"go.uber.org/zap"
+)
+
+// startArchiver - копирует закрытые сегменты в каталог архива после каждой ротации.
+// Копирование идет в фоне и не задерживает запись; сегмент, который не удалось скопировать,
+// будет скопирован при следующей ротации или перезапуске
+func (w *WAL) startArchiver(ctx context.Context) {
+	w.archiveCh <- struct{}{}
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.archiveCh:
+			}
+
+			if err := archiveSegments(w.config.DataDirectory, w.config.ArchiveDirectory); err != nil {
+				w.logger.Error("archiver: failed to archive segments", zap.Error(err))
+			}
+		}
+	}()
+}
+
+// archiveSegment - будит архиватор, не блокируясь
+func (w *WAL) archiveSegment(string) {
+	select {
+	case w.archiveCh <- struct{}{}:
+	default:
+	}
+}
+
+// archiveSegments - копирует в archiveDir закрытые сегменты из dir, которых там еще нет.
+// Последний сегмент открыт на запись и не копируется
+func archiveSegments(dir, archiveDir string) error {
+	segments, err := ListSegments(dir)
+	if err != nil {
+		return err
+	}
+
+	if len(segments) < 2 {
+		return nil
+	}
+
+	if err := os.MkdirAll(archiveDir, 0755); err != nil {
+		return err
+	}
+
+	for _, segment := range segments[:len(segments)-1] {
+		target := path.Join(archiveDir, path.Base(segment.Path))
+		if _, err := os.Stat(target); err == nil {
+			continue
+		}
+
+		if err := copyFile(segment.Path, target); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyFile - копирует через временный файл, поэтому в архиве не бывает недописанных сегментов
+func copyFile(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = out.Close()
+			_ = os.Remove(tmp)
+		}
+	}()
+
+	if _, err = io.Copy(out, in); err != nil {
+		return err
+	}
+
+	if err = out.Sync(); err != nil {
+		return err
+	}
+
+	if err = out.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, dst)
+}
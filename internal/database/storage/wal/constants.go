@@ -8,5 +8,5 @@ import (
 var (
 	FormatWalFilename  = "wal.%d.log"
 	DefaultWalFilename = fmt.Sprintf(FormatWalFilename, 0)
-	SegmentNameR       = regexp.MustCompile(`wal.(\d).log`)
+	SegmentNameR       = regexp.MustCompile(`^wal\.(\d+)\.log$`)
 )
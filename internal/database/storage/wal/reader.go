@@ -0,0 +1,110 @@
+package wal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var ErrRecordNotFound = errors.New("wal record not found on disk")
+
+// segmentReader - последовательное чтение записей из всех сегментов по порядку
+type segmentReader struct {
+	dir string
+	// num - номер открытого сегмента, -1 - еще ни один не открыт
+	num    int
+	file   *os.File
+	reader *bufio.Reader
+}
+
+func newSegmentReader(dir string) *segmentReader {
+	return &segmentReader{dir: dir, num: -1}
+}
+
+// Next - следующая запись. Вызывать, только если запись уже записана на диск целиком:
+// конец сегмента тогда значит, что она лежит в следующем
+func (r *segmentReader) Next() (string, error) {
+	for {
+		if r.reader != nil {
+			line, err := r.reader.ReadString('\n')
+			if err == nil {
+				return strings.TrimSuffix(line, "\n"), nil
+			}
+
+			if !errors.Is(err, io.EOF) {
+				return "", err
+			}
+
+			if line != "" {
+				return "", fmt.Errorf("%w: torn record at the end of %s", ErrRecordNotFound, r.file.Name())
+			}
+		}
+
+		if err := r.openNext(); err != nil {
+			return "", err
+		}
+	}
+}
+
+// openNext - переходит к сегменту, следующему за открытым
+func (r *segmentReader) openNext() error {
+	segments, err := ListSegments(r.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, segment := range segments {
+		if segment.Num <= r.num {
+			continue
+		}
+
+		file, err := os.Open(segment.Path)
+		if err != nil {
+			return err
+		}
+
+		if err := r.Close(); err != nil {
+			return err
+		}
+
+		r.num, r.file, r.reader = segment.Num, file, bufio.NewReader(file)
+
+		return nil
+	}
+
+	return fmt.Errorf("%w: no segment after %d", ErrRecordNotFound, r.num)
+}
+
+func (r *segmentReader) Close() error {
+	if r.file == nil {
+		return nil
+	}
+
+	err := r.file.Close()
+	r.file, r.reader = nil, nil
+
+	return err
+}
+
+// countRecords - число записей во всех сегментах
+func countRecords(dir string) (uint64, error) {
+	segments, err := ListSegments(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var n uint64
+	for _, segment := range segments {
+		data, err := os.ReadFile(segment.Path)
+		if err != nil {
+			return 0, err
+		}
+
+		n += uint64(strings.Count(string(data), "\n"))
+	}
+
+	return n, nil
+}
@@ -0,0 +1,170 @@
+package wal
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/TimonKK/inmemory-db/internal/config"
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrWALNotEmpty    = errors.New("wal directory already contains segments")
+	ErrMissingSegment = errors.New("wal segment is missing")
+	ErrTornRecord     = errors.New("torn wal record")
+	ErrBaseNotReached = errors.New("wal ends before the base snapshot")
+)
+
+// RecoveryTarget - до какой записи восстанавливать WAL. Нулевые поля не ограничивают
+type RecoveryTarget struct {
+	// Seq - номер последней восстанавливаемой записи
+	Seq uint64
+	// Timestamp - unix ms, записи позже него не восстанавливаются.
+	// У записей старого формата времени нет, они восстанавливаются всегда
+	Timestamp int64
+}
+
+// includes - входит ли запись в восстановление
+func (t RecoveryTarget) includes(seq uint64, record compute.Record) bool {
+	if t.Seq != 0 && seq > t.Seq {
+		return false
+	}
+
+	return t.Timestamp == 0 || record.Timestamp == 0 || record.Timestamp <= t.Timestamp
+}
+
+// RecoveryOptions - из чего собирается WAL при восстановлении
+type RecoveryOptions struct {
+	// Sources - каталоги с сегментами: обычно архив, затем отложенный в сторону каталог WAL, в котором лежит
+	// последний, еще не архивированный сегмент. Сегмент с одним номером берется из более позднего каталога
+	Sources []string
+	// Base - записи, которые воссоздают базовую выгрузку. Пишутся в начало WAL со временем записи BaseSeq
+	Base []compute.Query
+	// BaseSeq - номер последней записи, уже вошедшей в базовую выгрузку: повторяются только записи после нее
+	BaseSeq uint64
+	Target  RecoveryTarget
+}
+
+// Recover - переписывает в config.DataDirectory базовую выгрузку и записи сегментов opts.Sources после
+// opts.BaseSeq до цели включительно. Возвращает номер последней восстановленной записи. Каталог WAL не должен
+// содержать сегментов: поврежденный WAL нужно убрать в сторону и передать в Sources, Recover его
+// не перезаписывает. Сервер, запущенный после Recover, повторит восстановленные записи как обычно
+func Recover(config *config.WALConfig, opts RecoveryOptions, logger *zap.Logger) (uint64, error) {
+	if err := os.MkdirAll(config.DataDirectory, 0755); err != nil {
+		return 0, err
+	}
+
+	existing, err := ListSegments(config.DataDirectory)
+	if err != nil {
+		return 0, err
+	}
+	if len(existing) > 0 {
+		return 0, fmt.Errorf("%w: %s", ErrWALNotEmpty, config.DataDirectory)
+	}
+
+	segments, err := sourceSegments(opts.Sources)
+	if err != nil {
+		return 0, err
+	}
+
+	// сегменты нумеруются подряд с 0, пропуск значит потерянные записи
+	for i, segment := range segments {
+		if segment.Num != i {
+			return 0, fmt.Errorf("%w: %s", ErrMissingSegment, fmt.Sprintf(FormatWalFilename, i))
+		}
+	}
+
+	out := NewSegment(config.DataDirectory, int(config.MaxSegmentSize))
+	if err := out.Open(); err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := out.Close(); err != nil {
+			logger.Error("Recover: failed to close segment", zap.Error(err))
+		}
+	}()
+
+	writeBase := func(timestamp int64) error {
+		for _, query := range opts.Base {
+			record := compute.NewRecord(query, timestamp)
+			if err := out.Write(encodeLine(record.String()) + "\n"); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if opts.BaseSeq == 0 {
+		if err := writeBase(0); err != nil {
+			return 0, err
+		}
+	}
+
+	var seq uint64
+	err = scanSegments(segments, func(entry Entry) error {
+		// недописанная запись в конце последнего сегмента - обрыв при аварии, она отбрасывается
+		if errors.Is(entry.Err, ErrTornRecord) && entry.Segment == segments[len(segments)-1].Num {
+			logger.Warn("Recover: dropping torn record", zap.Int("segment", entry.Segment), zap.Int64("offset", entry.Offset))
+			return errStopScan
+		}
+		if entry.Err != nil {
+			return fmt.Errorf("record %d: %w", entry.Seq, entry.Err)
+		}
+
+		if !opts.Target.includes(entry.Seq, entry.Record) {
+			return errStopScan
+		}
+
+		seq = entry.Seq
+		if entry.Seq < opts.BaseSeq {
+			return nil
+		}
+		if entry.Seq == opts.BaseSeq {
+			return writeBase(entry.Record.Timestamp)
+		}
+
+		return out.Write(encodeLine(entry.Data) + "\n")
+	})
+	if err != nil && !errors.Is(err, errStopScan) {
+		return seq, err
+	}
+
+	// выгрузка сделана позже цели или позже последней уцелевшей записи, к ней нельзя вернуться повтором
+	if seq < opts.BaseSeq {
+		return seq, fmt.Errorf("%w: base seq %d, last record %d", ErrBaseNotReached, opts.BaseSeq, seq)
+	}
+
+	logger.Info("Recover: wal restored", zap.Strings("sources", opts.Sources),
+		zap.Int("base", len(opts.Base)), zap.Uint64("base_seq", opts.BaseSeq), zap.Uint64("records", seq))
+
+	return seq, out.Close()
+}
+
+// sourceSegments - сегменты всех каталогов по номерам. Сегмент с одним номером берется из более позднего
+// каталога: в каталоге WAL последний сегмент длиннее своей копии в архиве
+func sourceSegments(dirs []string) ([]SegmentFile, error) {
+	byNum := make(map[int]SegmentFile)
+	for _, dir := range dirs {
+		segments, err := ListSegments(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, segment := range segments {
+			byNum[segment.Num] = segment
+		}
+	}
+
+	segments := slices.Collect(maps.Values(byNum))
+	slices.SortFunc(segments, func(a, b SegmentFile) int {
+		return cmp.Compare(a.Num, b.Num)
+	})
+
+	return segments, nil
+}
@@ -0,0 +1,92 @@
+package wal
+
+import (
+	"os"
+)
+
+// OrphanSuffix - окончание имени сегментов, отрезанных Truncate. Такие файлы не считаются сегментами WAL
+const OrphanSuffix = ".orphan"
+
+// TruncateResult - что сделал Truncate
+type TruncateResult struct {
+	// Records - сколько записей осталось в WAL
+	Records uint64
+	// Segment и Offset - где обрезан WAL. Cut=false - обрезать было нечего
+	Cut     bool
+	Segment int
+	Offset  int64
+	// Orphaned - сегменты после места обрезки, переименованные с OrphanSuffix
+	Orphaned []string
+}
+
+// Truncate - оставляет в WAL каталога dir первые keep записей. Сегмент, где лежит следующая запись,
+// обрезается перед ней, а последующие сегменты не удаляются, а переименовываются с OrphanSuffix.
+// Сервер в этот момент должен быть остановлен
+func Truncate(dir string, keep uint64) (TruncateResult, error) {
+	var result TruncateResult
+
+	err := Scan(dir, func(entry Entry) error {
+		if entry.Seq <= keep {
+			result.Records = entry.Seq
+			return nil
+		}
+
+		result.Cut, result.Segment, result.Offset = true, entry.Segment, entry.Offset
+		return errStopScan
+	})
+	if err != nil && err != errStopScan {
+		return result, err
+	}
+
+	if !result.Cut {
+		return result, nil
+	}
+
+	segments, err := ListSegments(dir)
+	if err != nil {
+		return result, err
+	}
+
+	for _, segment := range segments {
+		switch {
+		case segment.Num == result.Segment:
+			if err := os.Truncate(segment.Path, result.Offset); err != nil {
+				return result, err
+			}
+		case segment.Num > result.Segment:
+			if err := os.Rename(segment.Path, segment.Path+OrphanSuffix); err != nil {
+				return result, err
+			}
+
+			result.Orphaned = append(result.Orphaned, segment.Path+OrphanSuffix)
+		}
+	}
+
+	return result, nil
+}
+
+// Repair - обрезает WAL по последней целой записи перед первой поврежденной. Возвращает Cut=false,
+// если повреждений нет
+func Repair(dir string) (TruncateResult, error) {
+	var keep uint64
+	damaged := false
+
+	err := Scan(dir, func(entry Entry) error {
+		if entry.Err != nil {
+			damaged = true
+			return errStopScan
+		}
+
+		keep = entry.Seq
+		return nil
+	})
+	if err != nil && err != errStopScan {
+		return TruncateResult{}, err
+	}
+
+	if !damaged {
+		return TruncateResult{Records: keep}, nil
+	}
+
+	return Truncate(dir, keep)
+}
@@ -0,0 +1,123 @@
+package wal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+)
+
+var ErrChecksumMismatch = errors.New("wal record checksum mismatch")
+
+// checksumSeparator - отделяет от записи ее CRC32. В аргументах команд символ не встречается
+const checksumSeparator = "#"
+
+// errStopScan - прерывает Scan без ошибки
+var errStopScan = errors.New("stop scan")
+
+// encodeLine - строка сегмента: запись и ее CRC32, "SET;a,1;100#1c291ca3"
+func encodeLine(data string) string {
+	return data + checksumSeparator + fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(data)))
+}
+
+// decodeLine - запись из строки сегмента. У записей старого формата контрольной суммы нет, они принимаются как есть
+func decodeLine(line string) (data string, checksum bool, err error) {
+	i := strings.LastIndex(line, checksumSeparator)
+	if i < 0 {
+		return line, false, nil
+	}
+
+	data = line[:i]
+	sum, err := strconv.ParseUint(line[i+1:], 16, 32)
+	if err != nil || uint32(sum) != crc32.ChecksumIEEE([]byte(data)) {
+		return data, true, fmt.Errorf("%w: %q", ErrChecksumMismatch, line)
+	}
+
+	return data, true, nil
+}
+
+// Entry - запись сегмента, прочитанная Scan
+type Entry struct {
+	// Segment - номер сегмента, Offset - смещение записи в нем
+	Segment int
+	Offset  int64
+	// Size - длина строки записи вместе с переводом строки
+	Size int
+	// Seq - номер записи во всем WAL, с 1
+	Seq uint64
+	// Data - запись без контрольной суммы
+	Data     string
+	Checksum bool
+	Record   compute.Record
+	// Err - запись повреждена: ErrTornRecord, ErrChecksumMismatch или compute.ErrInvalidRecord.
+	// Record тогда не заполнена
+	Err error
+}
+
+// Scan - передает fn все записи сегментов dir по порядку, включая поврежденные.
+// Ошибка fn прерывает чтение и возвращается из Scan
+func Scan(dir string, fn func(entry Entry) error) error {
+	segments, err := ListSegments(dir)
+	if err != nil {
+		return err
+	}
+
+	return scanSegments(segments, fn)
+}
+
+// scanSegments - Scan по уже выбранным сегментам, номера записей считаются с первого из них
+func scanSegments(segments []SegmentFile, fn func(entry Entry) error) error {
+	var seq uint64
+	for _, segment := range segments {
+		if err := scanSegment(segment, &seq, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func scanSegment(segment SegmentFile, seq *uint64, fn func(entry Entry) error) error {
+	file, err := os.Open(segment.Path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := reader.ReadString('\n')
+		if errors.Is(err, io.EOF) && line == "" {
+			return nil
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		*seq++
+		entry := Entry{Segment: segment.Num, Offset: offset, Size: len(line), Seq: *seq}
+		offset += int64(len(line))
+
+		if err != nil {
+			// конец файла посреди записи: она не дописана
+			entry.Data = line
+			entry.Err = fmt.Errorf("%w: %s at offset %d", ErrTornRecord, segment.Path, entry.Offset)
+		} else {
+			entry.Data, entry.Checksum, entry.Err = decodeLine(strings.TrimSuffix(line, "\n"))
+			if entry.Err == nil {
+				entry.Record, entry.Err = compute.NewRecordFromString(entry.Data)
+			}
+		}
+
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+}
@@ -2,9 +2,14 @@ package wal
 
 import (
 	"bufio"
+	"bytes"
+	"cmp"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path"
+	"slices"
 	"strconv"
 )
 
@@ -12,7 +17,13 @@ type Segment struct {
 	dir            string
 	maxSegmentSize int
 	num            int
+	file           *os.File
 	buf            *bufio.Writer
+	// size - размер открытого файла вместе с еще не сброшенным буфером
+	size int
+
+	// onRotate - вызывается с путем к закрытому сегменту после ротации
+	onRotate func(path string)
 }
 
 // TODO добавить компресию файла
@@ -25,84 +36,120 @@ func NewSegment(dir string, maxSegmentSize int) *Segment {
 	return &s
 }
 
+// Size - размер текущего файла сегмента в байтах
 func (s *Segment) Size() int {
-	return s.buf.Size()
+	return s.size
 }
 
 func (s *Segment) Open() error {
-	// получить список файлов вида wal.N.log
-	latestWalFile := ""
-	dir, err := os.ReadDir(s.dir)
+	// открыть на дозапись самый последний файл вида wal.N.log
+	segments, err := ListSegments(s.dir)
 	if err != nil {
 		return err
 	}
 
-	// найти самый последний файл
-	for _, file := range dir {
-		if file.IsDir() {
-			continue
-		}
+	latestWalFile := DefaultWalFilename
+	s.num = 0
+	if len(segments) > 0 {
+		latest := segments[len(segments)-1]
+		s.num, latestWalFile = latest.Num, path.Base(latest.Path)
 
-		matches := SegmentNameR.FindStringSubmatch(file.Name())
-		if len(matches) < 2 {
-			continue
+		if err := trimPartialLine(latest.Path); err != nil {
+			return err
 		}
+	}
 
-		num, err := strconv.Atoi(matches[1])
-		if err != nil {
-			continue
+	return s.open(latestWalFile)
+}
+
+// trimPartialLine - обрезает файл после последнего перевода строки: недописанная при аварии запись
+// иначе склеилась бы со следующей и испортила бы WAL посередине
+func trimPartialLine(name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	chunk := make([]byte, 4096)
+	for end := info.Size(); end > 0; {
+		start := max(end-int64(len(chunk)), 0)
+		n, err := file.ReadAt(chunk[:end-start], start)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
 		}
 
-		if file.Name() > latestWalFile {
-			s.num = num
-			latestWalFile = file.Name()
+		if i := bytes.LastIndexByte(chunk[:n], '\n'); i >= 0 {
+			if keep := start + int64(i) + 1; keep < info.Size() {
+				return os.Truncate(name, keep)
+			}
+
+			return nil
 		}
+		end = start
 	}
 
-	if latestWalFile == "" {
-		s.num = 0
-		latestWalFile = DefaultWalFilename
+	if info.Size() == 0 {
+		return nil
 	}
 
-	// открыть его на дозапись
-	file, err := os.OpenFile(path.Join(s.dir, latestWalFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
+	return os.Truncate(name, 0)
+}
+
+func (s *Segment) open(name string) error {
+	file, err := os.OpenFile(path.Join(s.dir, name), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
 	if err != nil {
 		return err
 	}
 
-	s.buf = bufio.NewWriter(file)
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	s.file, s.buf, s.size = file, bufio.NewWriter(file), int(info.Size())
 
 	return nil
 }
 
 func (s *Segment) Rotate() error {
-	err := s.Flush()
+	closed := s.file.Name()
+
+	err := s.Close()
 	if err != nil {
 		return err
 	}
 
 	s.num++
-	latestWalFile := fmt.Sprintf(FormatWalFilename, s.num)
-
-	file, err := os.OpenFile(path.Join(s.dir, latestWalFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0666)
-	if err != nil {
+	if err := s.open(fmt.Sprintf(FormatWalFilename, s.num)); err != nil {
 		return err
 	}
 
-	s.buf = bufio.NewWriter(file)
+	if s.onRotate != nil {
+		s.onRotate(closed)
+	}
 
 	return nil
 }
 
+// Write - дописывает данные, при переполнении сегмента сначала переходит к следующему.
+// Запись не разрывается между сегментами
 func (s *Segment) Write(data string) error {
-	if s.buf.Size() >= s.maxSegmentSize {
+	if s.size > 0 && s.size+len(data) > s.maxSegmentSize {
 		err := s.Rotate()
 		if err != nil {
 			return err
 		}
 	}
 
-	_, err := s.buf.WriteString(data)
+	n, err := s.buf.WriteString(data)
+	s.size += n
 	if err != nil {
 		return err
 	}
@@ -113,3 +160,71 @@ func (s *Segment) Write(data string) error {
 func (s *Segment) Flush() error {
 	return s.buf.Flush()
 }
+
+// Sync - сбрасывает буфер и fsync файла сегмента
+func (s *Segment) Sync() error {
+	if s.file == nil {
+		return nil
+	}
+
+	if err := s.Flush(); err != nil {
+		return err
+	}
+
+	return s.file.Sync()
+}
+
+// Close - сбрасывает буфер и закрывает файл сегмента
+func (s *Segment) Close() error {
+	if s.file == nil {
+		return nil
+	}
+
+	if err := s.Flush(); err != nil {
+		return err
+	}
+
+	err := s.file.Close()
+	s.file = nil
+
+	return err
+}
+
+// SegmentFile - файл сегмента и его номер
+type SegmentFile struct {
+	Num  int
+	Path string
+}
+
+// ListSegments - файлы вида wal.N.log по возрастанию N
+func ListSegments(dir string) ([]SegmentFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]SegmentFile, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		matches := SegmentNameR.FindStringSubmatch(entry.Name())
+		if len(matches) < 2 {
+			continue
+		}
+
+		num, err := strconv.Atoi(matches[1])
+		if err != nil {
+			continue
+		}
+
+		segments = append(segments, SegmentFile{Num: num, Path: path.Join(dir, entry.Name())})
+	}
+
+	slices.SortFunc(segments, func(a, b SegmentFile) int {
+		return cmp.Compare(a.Num, b.Num)
+	})
+
+	return segments, nil
+}
@@ -1,15 +1,13 @@
 package wal
 
 import (
-	"bufio"
 	"context"
+	"fmt"
 	"github.com/TimonKK/inmemory-db/internal/config"
 	"github.com/TimonKK/inmemory-db/internal/database/compute"
 	"github.com/TimonKK/inmemory-db/internal/utils"
 	"go.uber.org/zap"
 	"os"
-	"path"
-	"slices"
 	"sync"
 	"time"
 )
@@ -26,8 +24,26 @@ type WAL struct {
 	mu      sync.RWMutex
 	segment *Segment
 
-	batch   []walRecord
-	batchCh chan []walRecord
+	batch []walRecord
+	// full - набранные пачки, ожидающие записи, от старых к новым
+	full    [][]walRecord
+	batchCh chan struct{}
+
+	// seq - число записей на диске, номер последней из них
+	seq uint64
+	// flushed - закрывается после каждой записи пачки на диск, будит Tail
+	flushed chan struct{}
+
+	// archiveCh - будит архиватор после ротации сегмента
+	archiveCh chan struct{}
+
+	// stop - останавливает фоновую запись, stopped закрывается, когда она остановилась
+	stop      chan struct{}
+	stopped   chan struct{}
+	started   bool
+	closeOnce sync.Once
+	// draining - сервер останавливается, каждая запись пишется на диск сразу
+	draining bool
 }
 
 func NewWAL(config *config.WALConfig, logger *zap.Logger) *WAL {
@@ -36,7 +52,16 @@ func NewWAL(config *config.WALConfig, logger *zap.Logger) *WAL {
 		logger:  logger,
 		segment: NewSegment(config.DataDirectory, int(config.MaxSegmentSize)),
 		batch:   make([]walRecord, 0, config.FlushingBatchSize),
-		batchCh: make(chan []walRecord, 1),
+		batchCh: make(chan struct{}, 1),
+		flushed: make(chan struct{}),
+
+		archiveCh: make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+
+	if config.ArchiveDirectory != "" {
+		w.segment.onRotate = w.archiveSegment
 	}
 
 	return &w
@@ -47,7 +72,16 @@ func (w *WAL) Start(ctx context.Context) error {
 		return ctx.Err()
 	}
 
-	err := w.segment.Open()
+	seq, err := countRecords(w.config.DataDirectory)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	w.seq, w.started = seq, true
+	w.mu.Unlock()
+
+	err = w.segment.Open()
 	if err != nil {
 		return err
 	}
@@ -55,78 +89,133 @@ func (w *WAL) Start(ctx context.Context) error {
 	// TODO добавить явную обработку ошибок и выход при ее наступлении
 	w.startBackgroundWorker(ctx)
 
+	if w.config.ArchiveDirectory != "" {
+		w.startArchiver(ctx)
+	}
+
 	return nil
 }
 
-func (w *WAL) LoadRecords() ([]compute.Query, error) {
-	// получить список файлов вида wal.N.log
-	walFiles := make([]string, 0)
-	dir, err := os.ReadDir(w.config.DataDirectory)
+// LoadRecords - все записи WAL. Поврежденная последняя запись последнего сегмента - обрыв при аварии:
+// сегмент обрезается по предыдущей целой записи. Повреждение посередине WAL - ошибка, его чинит waltool
+func (w *WAL) LoadRecords() ([]compute.Record, error) {
+	records := make([]compute.Record, 0)
+
+	var damaged *Entry
+	err := Scan(w.config.DataDirectory, func(entry Entry) error {
+		if damaged != nil {
+			return fmt.Errorf("segment %d, offset %d: %w", damaged.Segment, damaged.Offset, damaged.Err)
+		}
+
+		if entry.Err != nil {
+			damaged = &entry
+			return nil
+		}
+
+		records = append(records, entry.Record)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	// пройтись по всем файлам
-	for _, file := range dir {
-		if file.IsDir() {
-			continue
-		}
-
-		fileInfo, err := file.Info()
-		if err != nil {
+	if damaged != nil {
+		if err := w.dropTail(*damaged); err != nil {
 			return nil, err
 		}
+	}
 
-		if fileInfo.Size() == 0 {
-			continue
-		}
+	return records, nil
+}
 
-		isMatch := SegmentNameR.MatchString(file.Name())
-		if isMatch {
-			fileName := path.Join(w.config.DataDirectory, file.Name())
-			walFiles = append(walFiles, fileName)
-		}
+// dropTail - обрезает последний сегмент перед поврежденной записью, после которой записей нет
+func (w *WAL) dropTail(damaged Entry) error {
+	segments, err := ListSegments(w.config.DataDirectory)
+	if err != nil {
+		return err
 	}
 
-	slices.Sort(walFiles)
+	last := segments[len(segments)-1]
+	if damaged.Segment != last.Num {
+		return fmt.Errorf("segment %d, offset %d: %w", damaged.Segment, damaged.Offset, damaged.Err)
+	}
 
-	records := make([]compute.Query, 0)
+	w.logger.Warn("dropping damaged last wal record", zap.Int("segment", damaged.Segment),
+		zap.Int64("offset", damaged.Offset), zap.Error(damaged.Err))
 
-	for _, fileName := range walFiles {
-		file, err := os.Open(fileName)
-		if err != nil {
-			return nil, err
+	return os.Truncate(last.Path, damaged.Offset)
+}
+
+// LastSeq - номер последней записи, записанной на диск. Записи нумеруются с 1 в порядке записи
+func (w *WAL) LastSeq() uint64 {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.seq
+}
+
+// Tail - вызывает fn для записей с номером не меньше from: сначала для уже записанных на диск,
+// затем для новых по мере их записи. Возвращается с ошибкой fn или при отмене ctx
+func (w *WAL) Tail(ctx context.Context, from uint64, fn func(seq uint64, record compute.Record) error) error {
+	reader := newSegmentReader(w.config.DataDirectory)
+	defer func() {
+		if err := reader.Close(); err != nil {
+			w.logger.Warn("Tail: failed to close segment", zap.Error(err))
 		}
+	}()
 
-		// закроем только при выходе из функции, а не цикла!
-		defer func(file *os.File) {
-			err := file.Close()
+	var seq uint64
+	for {
+		w.mu.RLock()
+		committed, flushed := w.seq, w.flushed
+		w.mu.RUnlock()
+
+		// записи до committed уже целиком на диске
+		for ; seq < committed; seq++ {
+			line, err := reader.Next()
 			if err != nil {
-				w.logger.Error("failed to close file", zap.Error(err))
+				return err
+			}
+
+			if seq+1 < from {
+				continue
 			}
-		}(file)
 
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			query := compute.NewQueryFromString(scanner.Text())
-			records = append(records, query)
+			data, _, err := decodeLine(line)
+			if err != nil {
+				return fmt.Errorf("record %d: %w", seq+1, err)
+			}
+
+			record, err := compute.NewRecordFromString(data)
+			if err != nil {
+				return fmt.Errorf("record %d: %w", seq+1, err)
+			}
+
+			if err := fn(seq+1, record); err != nil {
+				return err
+			}
 		}
 
-		if err := scanner.Err(); err != nil {
-			return nil, err
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-flushed:
 		}
 	}
-
-	return records, nil
 }
 
 func (w *WAL) startBackgroundWorker(ctx context.Context) {
 	go func() {
+		defer close(w.stopped)
+
 		ticker := time.NewTicker(w.config.FlushingBatchTimeout)
 		defer ticker.Stop()
 
 		for {
 			select {
+			case <-w.stop:
+				// остаток пишет Close, когда фоновая запись уже не мешает
+				return
 			case <-ctx.Done():
 				err := w.flush()
 				if err != nil {
@@ -139,10 +228,10 @@ func (w *WAL) startBackgroundWorker(ctx context.Context) {
 				if err != nil {
 					w.logger.Error("StartBackgroundWorker: flush error", zap.Error(err))
 				}
-			case batch := <-w.batchCh:
+			case <-w.batchCh:
 				ticker.Reset(w.config.FlushingBatchTimeout)
 
-				err := w.flushBatch(batch)
+				err := w.flush()
 				if err != nil {
 					w.logger.Error("StartBackgroundWorker: flush batch error", zap.Error(err))
 				}
@@ -151,20 +240,81 @@ func (w *WAL) startBackgroundWorker(ctx context.Context) {
 	}()
 }
 
+// Drain - режим остановки сервера: накопленные и новые записи пишутся на диск сразу, не дожидаясь полной пачки
+// или таймаута. Запросы, которые сервер ждет при остановке, не ждут таймаут пачки
+func (w *WAL) Drain() {
+	w.mu.Lock()
+	w.draining = true
+	if len(w.batch) > 0 {
+		w.full = append(w.full, w.batch)
+		w.batch = nil
+	}
+	w.mu.Unlock()
+
+	select {
+	case w.batchCh <- struct{}{}:
+	default:
+	}
+}
+
+// Close - останавливает фоновую запись, пишет на диск все поставленные записи, делает fsync и закрывает сегмент.
+// Вызывается, когда новых записей уже не будет: записи после Close на диск не попадут
+func (w *WAL) Close() error {
+	var err error
+
+	w.closeOnce.Do(func() {
+		w.mu.RLock()
+		started := w.started
+		w.mu.RUnlock()
+
+		close(w.stop)
+		if !started {
+			return
+		}
+		<-w.stopped
+
+		if err = w.flush(); err != nil {
+			return
+		}
+
+		if err = w.segment.Sync(); err != nil {
+			return
+		}
+
+		err = w.segment.Close()
+	})
+
+	return err
+}
+
 // Push - отправка данных в WAL. Блокируется пока WAL не запишет данные на диск
 func (w *WAL) Push(data string) error {
+	p := w.Append(data)
+
+	// блокируемся
+	return p.Get()
+}
+
+// Append - ставит данные в очередь на запись и сразу возвращается. Порядок записей в WAL совпадает
+// с порядком вызовов Append, результат записи на диск придет в промис
+func (w *WAL) Append(data string) utils.Promise[error] {
 	p := utils.NewPromise[error]()
 
 	w.mu.Lock()
 	w.batch = append(w.batch, walRecord{data, p})
-	if len(w.batch) == w.config.FlushingBatchSize {
-		w.batchCh <- w.batch
+	if len(w.batch) == w.config.FlushingBatchSize || w.draining {
+		w.full = append(w.full, w.batch)
 		w.batch = nil
+
+		// не блокируемся: воркер заберет все набранные пачки разом
+		select {
+		case w.batchCh <- struct{}{}:
+		default:
+		}
 	}
 	w.mu.Unlock()
 
-	// блокируемся
-	return p.Get()
+	return p
 }
 
 // TODO придумать что делать, если вызов segment.Write или Flush вернули ошибку:
@@ -180,7 +330,7 @@ func (w *WAL) flushBatch(batch []walRecord) error {
 
 	promises := make([]utils.Promise[error], 0, len(batch))
 	for _, walRecord := range batch {
-		err := w.segment.Write(walRecord.data + "\n")
+		err := w.segment.Write(encodeLine(walRecord.data) + "\n")
 		if err != nil {
 			return err
 		}
@@ -193,6 +343,12 @@ func (w *WAL) flushBatch(batch []walRecord) error {
 		return err
 	}
 
+	w.mu.Lock()
+	w.seq += uint64(len(batch))
+	close(w.flushed)
+	w.flushed = make(chan struct{})
+	w.mu.Unlock()
+
 	for i := 0; i < len(promises); i++ {
 		promises[i].Set(nil)
 	}
@@ -202,11 +358,19 @@ func (w *WAL) flushBatch(batch []walRecord) error {
 	return nil
 }
 
+// flush - пишет набранные пачки и текущую неполную. Все забираются под одной блокировкой,
+// поэтому записи попадают на диск в порядке Append
 func (w *WAL) flush() error {
 	w.mu.Lock()
-	batch := w.batch
-	w.batch = nil
+	batches := append(w.full, w.batch)
+	w.full, w.batch = nil, nil
 	w.mu.Unlock()
 
-	return w.flushBatch(batch)
+	for _, batch := range batches {
+		if err := w.flushBatch(batch); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
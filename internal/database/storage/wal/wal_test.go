@@ -2,12 +2,15 @@ package wal
 
 import (
 	"context"
+	"fmt"
 	"github.com/TimonKK/inmemory-db/internal/config"
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 	"os"
+	"path"
 	"strconv"
 	"testing"
 	"time"
@@ -73,3 +76,344 @@ func TestWal_Push(t *testing.T) {
 		})
 	}
 }
+
+func TestWal_Tail(t *testing.T) {
+	cfg := &config.WALConfig{
+		FlushingBatchSize:    10,
+		FlushingBatchTimeout: time.Millisecond,
+		MaxSegmentSize:       1000000,
+		DataDirectory:        t.TempDir(),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// прошлый запуск: две записи в старом сегменте
+	require.NoError(t, os.WriteFile(path.Join(cfg.DataDirectory, "wal.9.log"), []byte("SET;a,1;1\nSET;b,2;2\n"), 0666))
+
+	wal := NewWAL(cfg, zap.NewNop())
+	require.NoError(t, wal.Start(ctx))
+	assert.Equal(t, uint64(2), wal.LastSeq())
+
+	// новые записи попадают в сегмент с большим номером
+	require.NoError(t, wal.segment.Rotate())
+	require.NoError(t, wal.Push("DEL;a;3"))
+
+	changes := make(chan string)
+	go func() {
+		_ = wal.Tail(ctx, 2, func(seq uint64, record compute.Record) error {
+			changes <- fmt.Sprintf("%d %s", seq, record.String())
+			return nil
+		})
+	}()
+
+	assert.Equal(t, "2 SET;b,2;2", <-changes)
+	assert.Equal(t, "3 DEL;a;3", <-changes)
+
+	require.NoError(t, wal.Push("DEL;b;4"))
+	assert.Equal(t, "4 DEL;b;4", <-changes)
+
+	segments, err := ListSegments(cfg.DataDirectory)
+	require.NoError(t, err)
+	require.Len(t, segments, 2)
+	assert.Equal(t, 10, segments[1].Num)
+}
+
+func TestWal_Archive(t *testing.T) {
+	cfg := &config.WALConfig{
+		FlushingBatchSize:    1,
+		FlushingBatchTimeout: time.Millisecond,
+		MaxSegmentSize:       20,
+		DataDirectory:        t.TempDir(),
+		ArchiveDirectory:     path.Join(t.TempDir(), "archive"),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wal := NewWAL(cfg, zap.NewNop())
+	require.NoError(t, wal.Start(ctx))
+
+	// каждая запись длиннее половины сегмента, поэтому лежит в своем сегменте
+	for i := range 3 {
+		require.NoError(t, wal.Push(fmt.Sprintf("SET;key%d,value;%d", i, i+1)))
+	}
+
+	segments, err := ListSegments(cfg.DataDirectory)
+	require.NoError(t, err)
+	require.Len(t, segments, 3)
+
+	// открытый на запись сегмент в архив не попадает
+	require.Eventually(t, func() bool {
+		archived, err := ListSegments(cfg.ArchiveDirectory)
+		return err == nil && len(archived) == 2
+	}, time.Second, time.Millisecond)
+
+	data, err := os.ReadFile(path.Join(cfg.ArchiveDirectory, "wal.1.log"))
+	require.NoError(t, err)
+	assert.Equal(t, encodeLine("SET;key1,value;2")+"\n", string(data))
+}
+
+func TestRecover(t *testing.T) {
+	archive := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(archive, "wal.0.log"), []byte("SET;a,1;100\nSET;b,2;200\n"), 0666))
+	require.NoError(t, os.WriteFile(path.Join(archive, "wal.1.log"), []byte("DEL;a;300\nSET;b,3;400\nSET;c"), 0666))
+
+	newConfig := func() *config.WALConfig {
+		return &config.WALConfig{MaxSegmentSize: 1000000, DataDirectory: path.Join(t.TempDir(), "wal")}
+	}
+
+	tests := []struct {
+		name    string
+		target  RecoveryTarget
+		records []string
+	}{
+		{
+			name:    "up to timestamp",
+			target:  RecoveryTarget{Timestamp: 300},
+			records: []string{"SET;a,1;100", "SET;b,2;200", "DEL;a;300"},
+		},
+		{
+			name:    "up to seq",
+			target:  RecoveryTarget{Seq: 2},
+			records: []string{"SET;a,1;100", "SET;b,2;200"},
+		},
+		{
+			name:    "whole archive without torn tail",
+			records: []string{"SET;a,1;100", "SET;b,2;200", "DEL;a;300", "SET;b,3;400"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newConfig()
+
+			n, err := Recover(cfg, RecoveryOptions{Sources: []string{archive}, Target: tt.target}, zap.NewNop())
+			require.NoError(t, err)
+			assert.Equal(t, uint64(len(tt.records)), n)
+
+			records, err := NewWAL(cfg, zap.NewNop()).LoadRecords()
+			require.NoError(t, err)
+
+			restored := make([]string, 0, len(records))
+			for _, record := range records {
+				restored = append(restored, record.String())
+			}
+			assert.Equal(t, tt.records, restored)
+		})
+	}
+
+	t.Run("wal is not empty", func(t *testing.T) {
+		cfg := newConfig()
+		_, err := Recover(cfg, RecoveryOptions{Sources: []string{archive}}, zap.NewNop())
+		require.NoError(t, err)
+
+		_, err = Recover(cfg, RecoveryOptions{Sources: []string{archive}}, zap.NewNop())
+		assert.ErrorIs(t, err, ErrWALNotEmpty)
+	})
+
+	t.Run("missing segment", func(t *testing.T) {
+		gap := t.TempDir()
+		require.NoError(t, os.WriteFile(path.Join(gap, "wal.0.log"), []byte("SET;a,1;100\n"), 0666))
+		require.NoError(t, os.WriteFile(path.Join(gap, "wal.2.log"), []byte("SET;b,1;200\n"), 0666))
+
+		_, err := Recover(newConfig(), RecoveryOptions{Sources: []string{gap}}, zap.NewNop())
+		assert.ErrorIs(t, err, ErrMissingSegment)
+	})
+
+	restored := func(t *testing.T, cfg *config.WALConfig) []string {
+		t.Helper()
+
+		records, err := NewWAL(cfg, zap.NewNop()).LoadRecords()
+		require.NoError(t, err)
+
+		lines := make([]string, 0, len(records))
+		for _, record := range records {
+			lines = append(lines, record.String())
+		}
+
+		return lines
+	}
+
+	// последний сегмент еще не архивирован, он берется из отложенного каталога WAL
+	t.Run("live segment", func(t *testing.T) {
+		moved := t.TempDir()
+		require.NoError(t, os.WriteFile(path.Join(moved, "wal.1.log"), []byte("DEL;a;300\nSET;b,3;400\n"), 0666))
+		require.NoError(t, os.WriteFile(path.Join(moved, "wal.2.log"), []byte("SET;d,4;500\n"), 0666))
+
+		cfg := newConfig()
+		n, err := Recover(cfg, RecoveryOptions{Sources: []string{archive, moved}}, zap.NewNop())
+		require.NoError(t, err)
+		assert.Equal(t, uint64(5), n)
+		assert.Equal(t, []string{"SET;a,1;100", "SET;b,2;200", "DEL;a;300", "SET;b,3;400", "SET;d,4;500"}, restored(t, cfg))
+	})
+
+	// выгрузка уже содержит первые две записи, повторяются только следующие
+	t.Run("base snapshot", func(t *testing.T) {
+		cfg := newConfig()
+		n, err := Recover(cfg, RecoveryOptions{
+			Sources: []string{archive},
+			Base:    []compute.Query{compute.NewQuery(compute.SetCommandId, []string{"a", "1"})},
+			BaseSeq: 2,
+			Target:  RecoveryTarget{Timestamp: 300},
+		}, zap.NewNop())
+		require.NoError(t, err)
+		assert.Equal(t, uint64(3), n)
+		assert.Equal(t, []string{"SET;a,1;200", "DEL;a;300"}, restored(t, cfg))
+
+		_, err = Recover(newConfig(), RecoveryOptions{Sources: []string{archive}, BaseSeq: 3, Target: RecoveryTarget{Seq: 2}}, zap.NewNop())
+		assert.ErrorIs(t, err, ErrBaseNotReached)
+	})
+}
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	good := encodeLine("SET;a,1;100") + "\n"
+	require.NoError(t, os.WriteFile(path.Join(dir, "wal.0.log"), []byte(good+"DEL;a;200\n"), 0666))
+	require.NoError(t, os.WriteFile(path.Join(dir, "wal.1.log"), []byte("SET;b,2;300#00000000\nSET;c"), 0666))
+
+	var entries []Entry
+	require.NoError(t, Scan(dir, func(entry Entry) error {
+		entries = append(entries, entry)
+		return nil
+	}))
+	require.Len(t, entries, 4)
+
+	assert.Equal(t, Entry{Segment: 0, Offset: 0, Size: len(good), Seq: 1, Data: "SET;a,1;100", Checksum: true,
+		Record: compute.NewRecord(compute.NewQueryFromString("SET;a,1"), 100)}, entries[0])
+
+	// запись старого формата без контрольной суммы
+	assert.NoError(t, entries[1].Err)
+	assert.False(t, entries[1].Checksum)
+	assert.Equal(t, int64(len(good)), entries[1].Offset)
+
+	assert.ErrorIs(t, entries[2].Err, ErrChecksumMismatch)
+	assert.Equal(t, 1, entries[2].Segment)
+	assert.ErrorIs(t, entries[3].Err, ErrTornRecord)
+	assert.Equal(t, uint64(4), entries[3].Seq)
+}
+
+func TestRepair(t *testing.T) {
+	dir := t.TempDir()
+	first := encodeLine("SET;a,1;100") + "\n"
+	require.NoError(t, os.WriteFile(path.Join(dir, "wal.0.log"), []byte(first+"SET;b,2;200#00000000\nDEL;a;300\n"), 0666))
+	require.NoError(t, os.WriteFile(path.Join(dir, "wal.1.log"), []byte("DEL;b;400\n"), 0666))
+
+	result, err := Repair(dir)
+	require.NoError(t, err)
+	assert.Equal(t, TruncateResult{
+		Records:  1,
+		Cut:      true,
+		Segment:  0,
+		Offset:   int64(len(first)),
+		Orphaned: []string{path.Join(dir, "wal.1.log") + OrphanSuffix},
+	}, result)
+
+	data, err := os.ReadFile(path.Join(dir, "wal.0.log"))
+	require.NoError(t, err)
+	assert.Equal(t, first, string(data))
+
+	records, err := NewWAL(&config.WALConfig{DataDirectory: dir}, zap.NewNop()).LoadRecords()
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	// после починки повреждений нет
+	result, err = Repair(dir)
+	require.NoError(t, err)
+	assert.Equal(t, TruncateResult{Records: 1}, result)
+}
+
+func TestWal_Close(t *testing.T) {
+	cfg := &config.WALConfig{
+		FlushingBatchSize:    100,
+		FlushingBatchTimeout: time.Hour,
+		MaxSegmentSize:       1 << 20,
+		DataDirectory:        t.TempDir(),
+	}
+
+	wal := NewWAL(cfg, zap.NewNop())
+	require.NoError(t, wal.Start(context.Background()))
+
+	// пачка не набрана и таймаут не истек: записи пишет Close
+	first, second := wal.Append("SET;a,1;1"), wal.Append("DEL;a;2")
+	require.NoError(t, wal.Close())
+	require.NoError(t, first.Get())
+	require.NoError(t, second.Get())
+	assert.Equal(t, uint64(2), wal.LastSeq())
+	assert.NoError(t, wal.Close())
+
+	// в режиме остановки запись не ждет пачку и таймаут
+	wal = NewWAL(cfg, zap.NewNop())
+	require.NoError(t, wal.Start(context.Background()))
+	wal.Drain()
+	require.NoError(t, wal.Push("SET;b,1;3"))
+	require.NoError(t, wal.Close())
+
+	records, err := NewWAL(cfg, zap.NewNop()).LoadRecords()
+	require.NoError(t, err)
+	assert.Len(t, records, 3)
+}
+
+// TestWal_LoadRecordsDamagedTail - поврежденная последняя запись отбрасывается при старте,
+// поврежденная запись посередине WAL останавливает его
+func TestWal_LoadRecordsDamagedTail(t *testing.T) {
+	first, second := encodeLine("SET;a,1;100")+"\n", encodeLine("SET;b,2;200")+"\n"
+
+	tests := []struct {
+		name string
+		tail string
+	}{
+		{name: "torn record", tail: "SET;c,3"},
+		{name: "checksum mismatch", tail: "SET;c,3;300#00000000\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.WALConfig{FlushingBatchSize: 1, FlushingBatchTimeout: time.Millisecond, MaxSegmentSize: 1 << 20, DataDirectory: t.TempDir()}
+			require.NoError(t, os.WriteFile(path.Join(cfg.DataDirectory, "wal.0.log"), []byte(first), 0666))
+			require.NoError(t, os.WriteFile(path.Join(cfg.DataDirectory, "wal.1.log"), []byte(second+tt.tail), 0666))
+
+			wal := NewWAL(cfg, zap.NewNop())
+			records, err := wal.LoadRecords()
+			require.NoError(t, err)
+			assert.Len(t, records, 2)
+
+			data, err := os.ReadFile(path.Join(cfg.DataDirectory, "wal.1.log"))
+			require.NoError(t, err)
+			assert.Equal(t, second, string(data))
+
+			require.NoError(t, wal.Start(context.Background()))
+			require.NoError(t, wal.Push("DEL;a;400"))
+			require.NoError(t, wal.Close())
+
+			records, err = NewWAL(cfg, zap.NewNop()).LoadRecords()
+			require.NoError(t, err)
+			assert.Len(t, records, 3)
+		})
+	}
+
+	t.Run("damage in the middle", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(path.Join(dir, "wal.0.log"), []byte(first+"SET;c,3;300#00000000\n"), 0666))
+		require.NoError(t, os.WriteFile(path.Join(dir, "wal.1.log"), []byte(second), 0666))
+
+		_, err := NewWAL(&config.WALConfig{DataDirectory: dir}, zap.NewNop()).LoadRecords()
+		assert.ErrorIs(t, err, ErrChecksumMismatch)
+	})
+}
+
+// TestSegment_OpenPartialLine - новая запись не дописывается к недописанной строке
+func TestSegment_OpenPartialLine(t *testing.T) {
+	dir := t.TempDir()
+	first := encodeLine("SET;a,1;100") + "\n"
+	require.NoError(t, os.WriteFile(path.Join(dir, "wal.0.log"), []byte(first+"SET;b"), 0666))
+
+	segment := NewSegment(dir, 1<<20)
+	require.NoError(t, segment.Open())
+	require.NoError(t, segment.Write(encodeLine("DEL;a;200")+"\n"))
+	require.NoError(t, segment.Close())
+
+	data, err := os.ReadFile(path.Join(dir, "wal.0.log"))
+	require.NoError(t, err)
+	assert.Equal(t, first+encodeLine("DEL;a;200")+"\n", string(data))
+}
@@ -0,0 +1,321 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/TimonKK/inmemory-db/internal/database/compute"
+)
+
+var (
+	ErrScoreNaN = errors.New("resulting score is not a number (NaN)")
+)
+
+// ZAdd - ZADD key [NX|XX] [GT|LT] [CH] score member [score member ...]. Возвращает число добавленных элементов,
+// с CH - добавленных и изменивших score
+func (s *Storage) ZAdd(ctx context.Context, query compute.Query) (int, error) {
+	return s.writeSortedSet(ctx, query)
+}
+
+// ZRem - удаляет элементы и возвращает, сколько из них было. Опустевшее множество удаляется
+func (s *Storage) ZRem(ctx context.Context, query compute.Query) (int, error) {
+	return s.writeSortedSet(ctx, query)
+}
+
+// ZRangeStore - ZRANGESTORE dst src ..., записывает выборку ZRANGE в dst, заменяя прежнее значение любого типа.
+// Пустая выборка удаляет dst. Возвращает размер записанного множества
+func (s *Storage) ZRangeStore(ctx context.Context, query compute.Query) (int, error) {
+	return s.writeSortedSet(ctx, query)
+}
+
+// writeSortedSet - команда записи в сортированное множество, которая сама является записью WAL
+func (s *Storage) writeSortedSet(ctx context.Context, query compute.Query) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var n int
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		var err error
+		if n, err = applySortedSetRecord(tx, query); err != nil {
+			return nil, err
+		}
+
+		return []compute.Query{query}, nil
+	})
+
+	return n, err
+}
+
+// ZIncrBy - прибавляет к score элемента, отсутствующий элемент считается нулем. Возвращает новый score
+func (s *Storage) ZIncrBy(ctx context.Context, query compute.Query) (float64, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var score float64
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		if _, err := applySortedSetRecord(tx, query); err != nil {
+			return nil, err
+		}
+
+		zset, err := getSortedSet(tx, query.Key())
+		if err != nil {
+			return nil, err
+		}
+		score, _ = zset.Score(query.Args()[2])
+
+		return []compute.Query{query}, nil
+	})
+
+	return score, err
+}
+
+// ZPop - ZPOPMIN и ZPOPMAX, снимает до count элементов. В WAL пишется число реально снятых элементов,
+// если снимать нечего - ничего
+func (s *Storage) ZPop(ctx context.Context, query compute.Query) ([]compute.ScoreMember, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	var members []compute.ScoreMember
+	err := s.update(ctx, func(tx Tx) ([]compute.Query, error) {
+		zset, err := getSortedSet(tx, query.Key())
+		if err != nil {
+			return nil, err
+		}
+
+		members = zset.RangeByRank(0, query.PopCount()-1, query.CommandId() == compute.ZPopMaxCommandId)
+		if len(members) == 0 {
+			return nil, nil
+		}
+
+		record := compute.NewQuery(query.CommandId(), []string{query.Key(), strconv.Itoa(len(members))})
+		if _, err := applySortedSetRecord(tx, record); err != nil {
+			return nil, err
+		}
+
+		return []compute.Query{record}, nil
+	})
+
+	return members, err
+}
+
+// ZScore - score элемента, ErrKeyNotFound если нет ключа или элемента
+func (s *Storage) ZScore(ctx context.Context, query compute.Query) (float64, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var score float64
+	err := s.view(ctx, func(tx Tx) error {
+		zset, err := getSortedSet(tx, query.Key())
+		if err != nil {
+			return err
+		}
+
+		var ok bool
+		if score, ok = zset.Score(query.Value()); !ok {
+			return ErrKeyNotFound
+		}
+
+		return nil
+	})
+
+	return score, err
+}
+
+func (s *Storage) ZCard(ctx context.Context, query compute.Query) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var n int
+	err := s.view(ctx, func(tx Tx) error {
+		zset, err := getSortedSet(tx, query.Key())
+		if err != nil {
+			return err
+		}
+		n = zset.Len()
+
+		return nil
+	})
+
+	return n, err
+}
+
+// ZRank - ZRANK и ZREVRANK, позиция элемента с нуля. ErrKeyNotFound, если нет ключа или элемента
+func (s *Storage) ZRank(ctx context.Context, query compute.Query) (int, error) {
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	var rank int
+	err := s.view(ctx, func(tx Tx) error {
+		zset, err := getSortedSet(tx, query.Key())
+		if err != nil {
+			return err
+		}
+
+		var ok bool
+		if query.CommandId() == compute.ZRevRankCommandId {
+			rank, ok = zset.RevRank(query.Value())
+		} else {
+			rank, ok = zset.Rank(query.Value())
+		}
+
+		if !ok {
+			return ErrKeyNotFound
+		}
+
+		return nil
+	})
+
+	return rank, err
+}
+
+// ZRange - ZRANGE key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count]. Отсутствующий ключ - пустой результат
+func (s *Storage) ZRange(ctx context.Context, query compute.Query) ([]compute.ScoreMember, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	var members []compute.ScoreMember
+	err := s.view(ctx, func(tx Tx) error {
+		zset, err := getSortedSet(tx, query.ZRangeSource())
+		if err != nil {
+			return err
+		}
+		members = zrange(zset, query)
+
+		return nil
+	})
+
+	return members, err
+}
+
+// applySortedSetRecord - ZADD, ZINCRBY, ZREM, ZPOPMIN, ZPOPMAX и ZRANGESTORE. Возвращает число добавленных
+// (с CH - и измененных) элементов для ZADD, удаленных для ZREM и ZPOP*, размер результата для ZRANGESTORE
+func applySortedSetRecord(tx Tx, record compute.Query) (int, error) {
+	id, key := record.CommandId(), record.Key()
+
+	switch id {
+	case compute.ZRangeStoreCommandId:
+		src, err := getSortedSet(tx, record.ZRangeSource())
+		if err != nil {
+			return 0, err
+		}
+
+		result := NewSortedSet(zrange(src, record)...)
+		if result.Len() == 0 {
+			return 0, tx.Delete(key)
+		}
+
+		return result.Len(), tx.Set(key, NewCollectionEntry(result))
+	case compute.ZAddCommandId, compute.ZIncrByCommandId, compute.ZRemCommandId,
+		compute.ZPopMinCommandId, compute.ZPopMaxCommandId:
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrUnknownRecord, record.String())
+	}
+
+	entry, err := tx.Get(key)
+	created := errors.Is(err, ErrKeyNotFound)
+	if created {
+		entry, err = NewCollectionEntry(NewSortedSet()), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	zset, ok := entry.Data.(*SortedSet)
+	if !ok {
+		return 0, ErrWrongType
+	}
+
+	result := 0
+	switch id {
+	case compute.ZAddCommandId:
+		opts := record.ZAddOptions()
+		for _, m := range record.ZAddMembers() {
+			current, exists := zset.Score(m.Member)
+			if (opts.NX && exists) || (opts.XX && !exists) {
+				continue
+			}
+
+			if exists && ((opts.GT && m.Score <= current) || (opts.LT && m.Score >= current)) {
+				continue
+			}
+
+			if zset.Add(m.Member, m.Score) || (opts.CH && current != m.Score) {
+				result++
+			}
+		}
+	case compute.ZIncrByCommandId:
+		member := record.Args()[2]
+
+		current, _ := zset.Score(member)
+		score := current + record.FloatArg(1)
+		if math.IsNaN(score) {
+			return 0, ErrScoreNaN
+		}
+
+		zset.Add(member, score)
+	case compute.ZRemCommandId:
+		for _, member := range record.Args()[1:] {
+			if zset.Remove(member) {
+				result++
+			}
+		}
+	case compute.ZPopMinCommandId, compute.ZPopMaxCommandId:
+		result = len(zset.Pop(record.PopCount(), id == compute.ZPopMaxCommandId))
+	}
+
+	if zset.Len() == 0 {
+		if created {
+			return result, nil
+		}
+
+		return result, tx.Delete(key)
+	}
+
+	return result, tx.Set(key, entry)
+}
+
+// zrange - выборка ZRANGE и ZRANGESTORE по рангу, score или элементам
+func zrange(zset *SortedSet, query compute.Query) []compute.ScoreMember {
+	opts := query.ZRangeOptions()
+
+	switch opts.By {
+	case compute.ZRangeByScore:
+		lo, hi := query.ScoreRange()
+		return zset.RangeByScore(lo, hi, opts.Reverse, opts.Offset, opts.Count)
+	case compute.ZRangeByLex:
+		lo, hi := query.LexRange()
+		return zset.RangeByLex(lo, hi, opts.Reverse, opts.Offset, opts.Count)
+	default:
+		start, stop := query.RankRange()
+		return zset.RangeByRank(start, stop, opts.Reverse)
+	}
+}
+
+// getSortedSet - сортированное множество ключа, пустое для отсутствующего ключа.
+// ErrWrongType, если по ключу значение другого типа. Пустое множество нельзя менять: оно не записано в движок
+func getSortedSet(tx Tx, key string) (*SortedSet, error) {
+	entry, err := tx.Get(key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return NewSortedSet(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	zset, ok := entry.Data.(*SortedSet)
+	if !ok {
+		return nil, ErrWrongType
+	}
+
+	return zset, nil
+}
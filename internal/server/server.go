@@ -5,18 +5,29 @@ import (
 	"errors"
 	"github.com/TimonKK/inmemory-db/internal/config"
 	"github.com/TimonKK/inmemory-db/internal/database"
+	"github.com/TimonKK/inmemory-db/internal/database/acl"
 	"github.com/TimonKK/inmemory-db/internal/database/compute"
 	"github.com/TimonKK/inmemory-db/internal/database/network"
+	"github.com/TimonKK/inmemory-db/internal/database/pubsub"
 	"github.com/TimonKK/inmemory-db/internal/database/storage"
 	"github.com/TimonKK/inmemory-db/internal/database/storage/engine"
 	"github.com/TimonKK/inmemory-db/internal/database/storage/wal"
 	"go.uber.org/zap"
+	"io"
+	"slices"
 )
 
 type Server struct {
 	tcpServer *network.TCPServer
 	db        *database.Database
+	storage   *storage.Storage
+	wal       *wal.WAL
+	engine    storage.Engine
+	config    *config.Config
 	logger    *zap.Logger
+
+	// cancel - отменяет контекст запросов и фоновых задач, вызывается в конце Shutdown
+	cancel context.CancelFunc
 }
 
 func NewServer(config *config.Config, logger *zap.Logger) (*Server, error) {
@@ -29,18 +40,34 @@ func NewServer(config *config.Config, logger *zap.Logger) (*Server, error) {
 	}
 
 	computeInstance := compute.NewCompute(logger)
-	engineInstance, err := engine.NewEngine(config.Engine.Type)
+	engineInstance, err := engine.NewEngine(&config.Engine, logger)
 	if err != nil {
 		logger.Fatal("Failed to init engine", zap.Error(err), zap.String("type", config.Engine.Type))
 	}
 
+	broker := pubsub.NewBroker()
+	notifier, err := storage.NewNotifier(broker, config.Notifications.KeyspaceEvents)
+	if err != nil {
+		logger.Fatal("Failed to init keyspace notifications", zap.Error(err))
+	}
+
 	w := wal.NewWAL(&config.Wal, logger)
-	storageInstance, err := storage.NewStorage(engineInstance, w, logger)
+	storageInstance, err := storage.NewStorage(engineInstance, w, notifier, logger)
 	if err != nil {
 		logger.Fatal("Failed to init storage", zap.Error(err))
 	}
 
-	db := database.NewDatabase(computeInstance, storageInstance, logger)
+	db := database.NewDatabase(computeInstance, storageInstance, broker, logger)
+	db.SetExportDirectory(config.Export.Directory)
+	db.SetLinkTLS(config.Network.TLS)
+
+	users, err := newACL(config.Auth)
+	if err != nil {
+		logger.Fatal("Failed to init ACL", zap.Error(err))
+	}
+	if users != nil {
+		db.SetACL(users, config.Auth.TLSUsers)
+	}
 
 	tcpServer, err := network.NewTCPServer(config.Network, logger)
 	if err != nil {
@@ -50,13 +77,36 @@ func NewServer(config *config.Config, logger *zap.Logger) (*Server, error) {
 	server := &Server{
 		tcpServer: tcpServer,
 		db:        db,
+		storage:   storageInstance,
+		wal:       w,
+		engine:    engineInstance,
+		config:    config,
 		logger:    logger,
 	}
 
 	return server, nil
 }
 
+// newACL - пользователи из конфига и ACL файла, nil - пользователей нет и аутентификация выключена
+func newACL(config config.AuthConfig) (*acl.ACL, error) {
+	lines := slices.Clone(config.Users)
+	if config.ACLFile != "" {
+		fileLines, err := acl.LoadFile(config.ACLFile)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, fileLines...)
+	}
+
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	return acl.New(lines)
+}
+
 func (s *Server) Handlers(ctx context.Context) {
+	s.tcpServer.SetDisconnectHandler(s.db.Disconnect)
 	s.tcpServer.HandleConnect(ctx, func(ctx context.Context, query string) (string, error) {
 		res, err := s.db.ExecQuery(ctx, query)
 
@@ -68,9 +118,14 @@ func (s *Server) Handlers(ctx context.Context) {
 	})
 }
 
+// Start - загружает данные, запускает WAL и начинает принимать соединения, не блокируясь.
+// Отмена ctx не останавливает сервер, для этого есть Shutdown
 func (s *Server) Start(ctx context.Context) error {
 	s.logger.Info("Starting server")
 
+	// запросы и фоновая запись WAL не должны прерываться сигналом остановки: их по порядку завершает Shutdown
+	ctx, s.cancel = context.WithCancel(context.WithoutCancel(ctx))
+
 	err := s.db.Start(ctx)
 	if err != nil {
 		return err
@@ -82,18 +137,59 @@ func (s *Server) Start(ctx context.Context) error {
 		return err
 	}
 
-	s.Handlers(ctx)
+	go s.Handlers(ctx)
 
 	return nil
 }
 
+// Shutdown - останавливает сервер по порядку: перестает принимать соединения, ждет выполняемые запросы
+// не дольше shutdown.grace_period, пишет на диск и синхронизирует WAL, выгружает снимок, если он задан,
+// и закрывает движок. Ошибка одного шага не отменяет следующие, Shutdown возвращает их все
 func (s *Server) Shutdown() error {
-	s.logger.Info("Shutting down server")
-	err := s.tcpServer.Shutdown()
-	if err != nil {
-		s.logger.Error("Failed to shutdown server", zap.Error(err))
-		return err
+	s.logger.Info("Shutting down server", zap.Duration("grace_period", s.config.Shutdown.GracePeriod))
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Shutdown.GracePeriod)
+	defer cancel()
+
+	// запросы, которые ждут записи WAL, не должны ждать таймаут пачки
+	s.wal.Drain()
+
+	var errs []error
+	if err := s.tcpServer.Shutdown(ctx); err != nil {
+		s.logger.Error("Failed to drain connections", zap.Error(err))
+		errs = append(errs, err)
 	}
 
-	return nil
+	// активное удаление истекших ключей пишет в WAL, поэтому останавливается до его закрытия
+	s.storage.Close()
+
+	if err := s.wal.Close(); err != nil {
+		s.logger.Error("Failed to flush WAL", zap.Error(err))
+		errs = append(errs, err)
+	}
+
+	if file := s.config.Shutdown.SnapshotFile; file != "" {
+		n, err := s.db.Export(context.Background(), file)
+		if err != nil {
+			s.logger.Error("Failed to write shutdown snapshot", zap.String("file", file), zap.Error(err))
+			errs = append(errs, err)
+		} else {
+			// номер последней записи WAL в снимке нужен, чтобы восстанавливаться от него (-recover-base-seq)
+			s.logger.Info("Shutdown snapshot written", zap.String("file", file), zap.Int("keys", n),
+				zap.Uint64("wal_seq", s.wal.LastSeq()))
+		}
+	}
+
+	if closer, ok := s.engine.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			s.logger.Error("Failed to close engine", zap.Error(err))
+			errs = append(errs, err)
+		}
+	}
+
+	if s.cancel != nil {
+		s.cancel()
+	}
+
+	return errors.Join(errs...)
 }
@@ -0,0 +1,32 @@
+package utils
+
+// MatchGlob проверяет строку на соответствие glob шаблону: "*" - любая последовательность символов
+// (включая "/"), "?" - любой один символ, остальные символы сравниваются как есть
+func MatchGlob(pattern, s string) bool {
+	p, i := 0, 0
+	// позиция последней "*" в шаблоне и позиция в строке, с которой она начала совпадать
+	star, match := -1, 0
+
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case p < len(pattern) && pattern[p] == '*':
+			star, match = p, i
+			p++
+		case star != -1:
+			// откатываемся: "*" забирает еще один символ
+			match++
+			p, i = star+1, match
+		default:
+			return false
+		}
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
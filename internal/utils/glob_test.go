@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		str     string
+		want    bool
+	}{
+		{pattern: "*", str: "", want: true},
+		{pattern: "*", str: "user/42/name", want: true},
+		{pattern: "user/*", str: "user/42/name", want: true},
+		{pattern: "user/*/name", str: "user/42/name", want: true},
+		{pattern: "user/*/name", str: "user/42/age", want: false},
+		{pattern: "*name", str: "user/42/name", want: true},
+		{pattern: "user_?", str: "user_1", want: true},
+		{pattern: "user_?", str: "user_12", want: false},
+		{pattern: "a*b*c", str: "aXbYbZc", want: true},
+		{pattern: "a*b*c", str: "aXbYbZ", want: false},
+		{pattern: "abc", str: "abc", want: true},
+		{pattern: "abc", str: "ab", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.str, func(t *testing.T) {
+			assert.Equal(t, tt.want, MatchGlob(tt.pattern, tt.str))
+		})
+	}
+}
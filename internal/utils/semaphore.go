@@ -19,3 +19,13 @@ func (s *Semaphore) Acquire() {
 func (s *Semaphore) Release() {
 	<-s.ch
 }
+
+// TryAcquire - занимает место, если оно есть, не блокируясь. false, если все места заняты
+func (s *Semaphore) TryAcquire() bool {
+	select {
+	case s.ch <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSemaphore_TryAcquire(t *testing.T) {
+	semaphore := NewSemaphore(2)
+
+	assert.True(t, semaphore.TryAcquire())
+	semaphore.Acquire()
+	assert.False(t, semaphore.TryAcquire())
+
+	semaphore.Release()
+	assert.True(t, semaphore.TryAcquire())
+}